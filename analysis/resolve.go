@@ -0,0 +1,169 @@
+package analysis
+
+import "github.com/user/golang-interpreter/parser"
+
+// BindingKind represents the construct that introduced a binding.
+type BindingKind int
+
+const (
+	// LetBinding is introduced by a let statement.
+	LetBinding BindingKind = iota
+	// ParamBinding is introduced by a function parameter.
+	ParamBinding
+)
+
+// Binding represents a name bound by a let statement or a function parameter.
+type Binding struct {
+	Name     string                  // The bound name.
+	Kind     BindingKind             // The construct that introduced the binding.
+	Decl     *parser.Identifier      // The identifier at the point of declaration.
+	Let      *parser.LetStatement    // The let statement, for let bindings.
+	Function *parser.FunctionLiteral // The function literal, for parameters.
+	Uses     []*parser.Identifier    // The identifiers referring to the binding.
+	TopLevel bool                    // Whether the binding is declared at the top level of the program.
+	Block    *parser.BlockStatement  // The block the binding is visible in, nil at the top level.
+}
+
+// Resolution represents the result of resolving the identifiers of a program.
+type Resolution struct {
+	Bindings   []*Binding                      // All bindings, in declaration order.
+	Uses       map[*parser.Identifier]*Binding // The binding each resolved identifier refers to.
+	Unresolved []*parser.Identifier            // The identifiers that refer to no binding.
+}
+
+// scope represents the bindings visible in a block.
+type scope struct {
+	names map[string]*Binding    // The bindings declared in the block.
+	outer *scope                 // The enclosing scope, or nil for the top level.
+	block *parser.BlockStatement // The block, or nil for the top level.
+}
+
+// lookup returns the binding of name in the scope or any enclosing scope.
+func (s *scope) lookup(name string) *Binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// deferredFunction represents a function body whose resolution is postponed
+// until the enclosing block has been resolved.
+type deferredFunction struct {
+	lit   *parser.FunctionLiteral
+	scope *scope
+}
+
+// resolver walks a program and records the binding of every identifier.
+type resolver struct {
+	result  *Resolution
+	pending []deferredFunction
+}
+
+// Resolve returns the binding of every identifier in the program.
+//
+// A function body is resolved after the rest of the block it appears in,
+// because it runs when the function is called and then sees bindings made
+// after the function literal, which is what makes recursion through a let
+// binding work.
+func Resolve(program *parser.Program) *Resolution {
+	r := &resolver{result: &Resolution{Uses: make(map[*parser.Identifier]*Binding)}}
+	r.resolveBlock(program.Statements, nil, nil)
+	return r.result
+}
+
+// resolveBlock resolves the statements of a block in a new scope. The block
+// is nil for the statements of the program.
+func (r *resolver) resolveBlock(stmts []parser.Statement, block *parser.BlockStatement, outer *scope) *scope {
+	s := &scope{names: make(map[string]*Binding), outer: outer, block: block}
+	pending := r.pending
+	r.pending = nil
+
+	for _, stmt := range stmts {
+		r.resolveStatement(stmt, s)
+	}
+
+	for len(r.pending) > 0 {
+		d := r.pending[0]
+		r.pending = r.pending[1:]
+		r.resolveFunction(d.lit, d.scope)
+	}
+	r.pending = pending
+	return s
+}
+
+// resolveStatement resolves a single statement.
+func (r *resolver) resolveStatement(stmt parser.Statement, s *scope) {
+	switch st := stmt.(type) {
+	case *parser.LetStatement:
+		r.resolveExpression(st.Value, s)
+		b := &Binding{Name: st.Name.Value, Kind: LetBinding, Decl: st.Name, Let: st, TopLevel: s.outer == nil, Block: s.block}
+		s.names[b.Name] = b
+		r.result.Bindings = append(r.result.Bindings, b)
+	case *parser.ReturnStatement:
+		r.resolveExpression(st.ReturnValue, s)
+	case *parser.ExpressionStatement:
+		r.resolveExpression(st.Expression, s)
+	case *parser.BlockStatement:
+		r.resolveBlock(st.Statements, st, s)
+	}
+}
+
+// resolveExpression resolves every identifier in an expression.
+func (r *resolver) resolveExpression(expr parser.Expression, s *scope) {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		if b := s.lookup(e.Value); b != nil {
+			b.Uses = append(b.Uses, e)
+			r.result.Uses[e] = b
+		} else {
+			r.result.Unresolved = append(r.result.Unresolved, e)
+		}
+	case *parser.PrefixExpression:
+		r.resolveExpression(e.Right, s)
+	case *parser.InfixExpression:
+		r.resolveExpression(e.Left, s)
+		r.resolveExpression(e.Right, s)
+	case *parser.IfExpression:
+		r.resolveExpression(e.Condition, s)
+		if e.Consequence != nil {
+			r.resolveBlock(e.Consequence.Statements, e.Consequence, s)
+		}
+		if e.Alternative != nil {
+			r.resolveBlock(e.Alternative.Statements, e.Alternative, s)
+		}
+	case *parser.FunctionLiteral:
+		r.pending = append(r.pending, deferredFunction{lit: e, scope: s})
+	case *parser.CallExpression:
+		r.resolveExpression(e.Function, s)
+		for _, a := range e.Arguments {
+			r.resolveExpression(a, s)
+		}
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			r.resolveExpression(el, s)
+		}
+	case *parser.IndexExpression:
+		r.resolveExpression(e.Left, s)
+		r.resolveExpression(e.Index, s)
+	case *parser.HashLiteral:
+		for k, v := range e.Pairs {
+			r.resolveExpression(k, s)
+			r.resolveExpression(v, s)
+		}
+	}
+}
+
+// resolveFunction resolves the parameters and body of a function literal.
+func (r *resolver) resolveFunction(lit *parser.FunctionLiteral, outer *scope) {
+	params := &scope{names: make(map[string]*Binding), outer: outer, block: lit.Body}
+	for _, p := range lit.Parameters {
+		b := &Binding{Name: p.Value, Kind: ParamBinding, Decl: p, Function: lit, Block: lit.Body}
+		params.names[p.Value] = b
+		r.result.Bindings = append(r.result.Bindings, b)
+	}
+	if lit.Body != nil {
+		r.resolveBlock(lit.Body.Statements, lit.Body, params)
+	}
+}
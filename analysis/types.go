@@ -0,0 +1,357 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/user/golang-interpreter/parser"
+)
+
+// TypeKind represents the kind of the values of a type.
+type TypeKind string
+
+const (
+	AnyType      TypeKind = "any"    // Values of any kind, when nothing more is known.
+	IntType      TypeKind = "int"    // Integers.
+	BoolType     TypeKind = "bool"   // Booleans.
+	StringType   TypeKind = "string" // Strings.
+	ArrayType    TypeKind = "array"  // Arrays.
+	HashType     TypeKind = "hash"   // Hashes.
+	NullType     TypeKind = "null"   // The null value of statements and of if without else.
+	FunctionType TypeKind = "fn"     // Functions, builtin or not.
+)
+
+// Type represents what is known about the values of an expression, since
+// Monkey is dynamically typed and only some types can be inferred.
+type Type struct {
+	Kind   TypeKind // The kind of the values.
+	Params []*Type  // The types of the parameters of a function.
+	Names  []string // The names of the parameters of a function, if known.
+	Result *Type    // The type of the result of a function.
+}
+
+// String returns the type in the form "int" or "fn(n int) bool".
+func (t *Type) String() string {
+	if t.Kind != FunctionType {
+		return string(t.Kind)
+	}
+	var params []string
+	for n, p := range t.Params {
+		if n < len(t.Names) {
+			params = append(params, t.Names[n]+" "+p.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	return "fn(" + strings.Join(params, ", ") + ") " + t.Result.String()
+}
+
+// The types of the kinds that have nothing more to them.
+var (
+	anyType    = &Type{Kind: AnyType}
+	intType    = &Type{Kind: IntType}
+	boolType   = &Type{Kind: BoolType}
+	stringType = &Type{Kind: StringType}
+	arrayType  = &Type{Kind: ArrayType}
+	hashType   = &Type{Kind: HashType}
+	nullType   = &Type{Kind: NullType}
+)
+
+// builtinTypes maps the builtin functions to their type.
+var builtinTypes = map[string]*Type{
+	"len":   {Kind: FunctionType, Params: []*Type{anyType}, Result: intType},
+	"puts":  {Kind: FunctionType, Params: []*Type{anyType}, Result: nullType},
+	"first": {Kind: FunctionType, Params: []*Type{arrayType}, Result: anyType},
+	"last":  {Kind: FunctionType, Params: []*Type{arrayType}, Result: anyType},
+	"rest":  {Kind: FunctionType, Params: []*Type{arrayType}, Result: arrayType},
+	"push":  {Kind: FunctionType, Params: []*Type{arrayType, anyType}, Result: arrayType},
+}
+
+// BuiltinType returns the type of the builtin function with the name, or nil
+// if there is none.
+func BuiltinType(name string) *Type {
+	return builtinTypes[name]
+}
+
+// Types represents the types inferred for the expressions of a program.
+//
+// A parameter is an integer if the program uses it as the operand of an
+// arithmetic or comparison operator, since those only take integers, and of
+// any type otherwise. The result of a function is what its return
+// statements and its last expression have in common.
+type Types struct {
+	res       *Resolution
+	params    map[*parser.FunctionLiteral][]*Binding // The parameters of each function.
+	used      map[*Binding]*Type                     // The types the uses of parameters imply.
+	functions map[*parser.FunctionLiteral]*Type      // The types of the functions inferred so far.
+	inferring map[*parser.FunctionLiteral]bool       // The functions whose type is being inferred.
+	partial   bool                                   // Whether a type depended on a function being inferred.
+}
+
+// Infer returns the types of the program whose identifiers are resolved.
+func Infer(program *parser.Program, res *Resolution) *Types {
+	t := &Types{
+		res:       res,
+		params:    make(map[*parser.FunctionLiteral][]*Binding),
+		used:      make(map[*Binding]*Type),
+		functions: make(map[*parser.FunctionLiteral]*Type),
+		inferring: make(map[*parser.FunctionLiteral]bool),
+	}
+	for _, b := range res.Bindings {
+		if b.Kind == ParamBinding {
+			t.params[b.Function] = append(t.params[b.Function], b)
+		}
+	}
+	walkStatements(program.Statements, false, nil, func(expr parser.Expression) {
+		switch e := expr.(type) {
+		case *parser.PrefixExpression:
+			if e.Operator == "-" {
+				t.useAsInt(e.Right)
+			}
+		case *parser.InfixExpression:
+			switch e.Operator {
+			case "-", "*", "/", "<", ">":
+				t.useAsInt(e.Left)
+				t.useAsInt(e.Right)
+			}
+		}
+	})
+	return t
+}
+
+// useAsInt records that the expression, if it is a parameter, holds an
+// integer.
+func (t *Types) useAsInt(expr parser.Expression) {
+	if id, ok := expr.(*parser.Identifier); ok {
+		if b := t.res.Uses[id]; b != nil && b.Kind == ParamBinding {
+			t.used[b] = intType
+		}
+	}
+}
+
+// OfBinding returns the type of the values of a binding.
+func (t *Types) OfBinding(b *Binding) *Type {
+	if typ := t.ofBinding(b); typ != nil {
+		return typ
+	}
+	return anyType
+}
+
+// ofBinding returns the type of the values of a binding like of.
+func (t *Types) ofBinding(b *Binding) *Type {
+	if b.Kind == ParamBinding {
+		if typ, ok := t.used[b]; ok {
+			return typ
+		}
+		return anyType
+	}
+	return t.of(b.Let.Value)
+}
+
+// Of returns the type of an expression.
+func (t *Types) Of(expr parser.Expression) *Type {
+	if typ := t.of(expr); typ != nil {
+		return typ
+	}
+	return anyType
+}
+
+// of returns the type of an expression, or nil if it depends on the result
+// of a function whose type is being inferred, as in recursive calls.
+func (t *Types) of(expr parser.Expression) *Type {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		if b := t.res.Uses[e]; b != nil {
+			return t.ofBinding(b)
+		}
+		if typ := BuiltinType(e.Value); typ != nil {
+			return typ
+		}
+	case *parser.IntegerLiteral:
+		return intType
+	case *parser.Boolean:
+		return boolType
+	case *parser.StringLiteral:
+		return stringType
+	case *parser.ArrayLiteral:
+		return arrayType
+	case *parser.HashLiteral:
+		return hashType
+	case *parser.PrefixExpression:
+		if e.Operator == "!" {
+			return boolType
+		}
+		return intType
+	case *parser.InfixExpression:
+		switch e.Operator {
+		case "==", "!=", "<", ">":
+			return boolType
+		case "+":
+			return plus(t.of(e.Left), t.of(e.Right))
+		}
+		return intType
+	case *parser.IfExpression:
+		alternative := nullType
+		if e.Alternative != nil {
+			alternative = t.blockType(e.Alternative)
+		}
+		return join(t.blockType(e.Consequence), alternative)
+	case *parser.FunctionLiteral:
+		return t.functionType(e)
+	case *parser.CallExpression:
+		callee := t.of(e.Function)
+		if callee == nil {
+			return nil
+		}
+		if callee.Kind == FunctionType {
+			return callee.Result
+		}
+	}
+	return anyType
+}
+
+// plus returns the type of the sum of operands of the types: strings are
+// concatenated and integers added.
+func plus(left, right *Type) *Type {
+	switch {
+	case left != nil && left.Kind == StringType, right != nil && right.Kind == StringType:
+		return stringType
+	case left == nil && right == nil:
+		return nil
+	case (left == nil || left.Kind == IntType) && (right == nil || right.Kind == IntType):
+		return intType
+	}
+	return anyType
+}
+
+// functionType returns the type of a function literal.
+func (t *Types) functionType(lit *parser.FunctionLiteral) *Type {
+	if typ, ok := t.functions[lit]; ok {
+		return typ
+	}
+	if t.inferring[lit] {
+		t.partial = true
+		return nil
+	}
+	t.inferring[lit] = true
+	partial := t.partial
+	t.partial = false
+
+	typ := &Type{Kind: FunctionType}
+	for _, b := range t.params[lit] {
+		typ.Params = append(typ.Params, t.OfBinding(b))
+		typ.Names = append(typ.Names, b.Name)
+	}
+	typ.Result = t.blockType(lit.Body)
+	if lit.Body != nil {
+		walkStatements(lit.Body.Statements, true, func(stmt parser.Statement) {
+			if r, ok := stmt.(*parser.ReturnStatement); ok && r.ReturnValue != nil {
+				typ.Result = join(typ.Result, t.of(r.ReturnValue))
+			}
+		}, nil)
+	}
+	if typ.Result == nil {
+		typ.Result = anyType
+	}
+
+	delete(t.inferring, lit)
+	if !t.partial {
+		t.functions[lit] = typ
+	}
+	t.partial = t.partial || partial
+	return typ
+}
+
+// blockType returns the type of the value of a block: that of its last
+// statement if it is an expression, and null otherwise.
+func (t *Types) blockType(block *parser.BlockStatement) *Type {
+	if block == nil || len(block.Statements) == 0 {
+		return nullType
+	}
+	if s, ok := block.Statements[len(block.Statements)-1].(*parser.ExpressionStatement); ok && s.Expression != nil {
+		return t.of(s.Expression)
+	}
+	return nullType
+}
+
+// join returns what two types have in common. A nil type, depending on a
+// function being inferred, adds nothing to the other.
+func join(a, b *Type) *Type {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.String() == b.String():
+		return a
+	}
+	return anyType
+}
+
+// walkStatements calls stmtVisit for every statement and visit for every
+// expression of the statements and of the blocks they contain, either of
+// which may be nil. It does not enter function literals if shallow is set.
+func walkStatements(stmts []parser.Statement, shallow bool, stmtVisit func(parser.Statement), visit func(parser.Expression)) {
+	for _, stmt := range stmts {
+		if stmtVisit != nil {
+			stmtVisit(stmt)
+		}
+		switch s := stmt.(type) {
+		case *parser.LetStatement:
+			walkExpression(s.Value, shallow, stmtVisit, visit)
+		case *parser.ReturnStatement:
+			walkExpression(s.ReturnValue, shallow, stmtVisit, visit)
+		case *parser.ExpressionStatement:
+			walkExpression(s.Expression, shallow, stmtVisit, visit)
+		case *parser.BlockStatement:
+			walkStatements(s.Statements, shallow, stmtVisit, visit)
+		}
+	}
+}
+
+// walkExpression walks an expression like walkStatements.
+func walkExpression(expr parser.Expression, shallow bool, stmtVisit func(parser.Statement), visit func(parser.Expression)) {
+	if expr == nil {
+		return
+	}
+	if visit != nil {
+		visit(expr)
+	}
+	sub := func(e parser.Expression) { walkExpression(e, shallow, stmtVisit, visit) }
+	block := func(b *parser.BlockStatement) {
+		if b != nil {
+			walkStatements(b.Statements, shallow, stmtVisit, visit)
+		}
+	}
+	switch e := expr.(type) {
+	case *parser.PrefixExpression:
+		sub(e.Right)
+	case *parser.InfixExpression:
+		sub(e.Left)
+		sub(e.Right)
+	case *parser.IfExpression:
+		sub(e.Condition)
+		block(e.Consequence)
+		block(e.Alternative)
+	case *parser.FunctionLiteral:
+		if !shallow {
+			block(e.Body)
+		}
+	case *parser.CallExpression:
+		sub(e.Function)
+		for _, a := range e.Arguments {
+			sub(a)
+		}
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			sub(el)
+		}
+	case *parser.IndexExpression:
+		sub(e.Left)
+		sub(e.Index)
+	case *parser.HashLiteral:
+		for k, v := range e.Pairs {
+			sub(k)
+			sub(v)
+		}
+	}
+}
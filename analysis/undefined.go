@@ -0,0 +1,31 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/diagnostic"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// CodeUndefined is the code of the error for identifiers that refer to no
+// binding and no builtin function.
+const CodeUndefined = "undefined"
+
+// Undefined returns an error for every identifier of the program that refers
+// to neither a binding nor a builtin function.
+func Undefined(program *parser.Program) []diagnostic.Diagnostic {
+	var diags []diagnostic.Diagnostic
+	for _, id := range Resolve(program).Unresolved {
+		if object.LookupBuiltin(id.Value) != nil {
+			continue
+		}
+		diags = append(diags, diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     CodeUndefined,
+			Span:     diagnostic.TokenSpan(id.Token),
+			Message:  fmt.Sprintf("identifier not found: %s", id.Value),
+		})
+	}
+	return diags
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/diagnostic"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+const (
+	// CodeUnusedLet is the code of the warning for let bindings that are never read.
+	CodeUnusedLet = "unused-let"
+	// CodeUnreachable is the code of the warning for statements following a return.
+	CodeUnreachable = "unreachable"
+)
+
+// Unused returns a warning for every let binding whose value is never read
+// and for the first statement after a return statement in each block, in the
+// order of their positions. Bindings whose name starts with an underscore are
+// never reported.
+func Unused(program *parser.Program) []diagnostic.Diagnostic {
+	var diags []diagnostic.Diagnostic
+
+	res := Resolve(program)
+	for _, b := range res.Bindings {
+		if b.Kind != LetBinding || len(b.Uses) > 0 || strings.HasPrefix(b.Name, "_") {
+			continue
+		}
+		diags = append(diags, diagnostic.Diagnostic{
+			Severity: diagnostic.Warning,
+			Code:     CodeUnusedLet,
+			Span:     diagnostic.TokenSpan(b.Decl.Token),
+			Message:  fmt.Sprintf("%s is bound but never used", b.Name),
+		})
+	}
+
+	u := &unreachable{}
+	u.block(program.Statements)
+	diags = append(diags, u.diags...)
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Span.Start.Offset < diags[j].Span.Start.Offset })
+	return diags
+}
+
+// unreachable finds statements following a return statement.
+type unreachable struct {
+	diags []diagnostic.Diagnostic
+}
+
+// block reports the first statement after a return in the given statements
+// and visits every nested block.
+func (u *unreachable) block(stmts []parser.Statement) {
+	returned := false
+	for n, stmt := range stmts {
+		if returned {
+			last := stmts[len(stmts)-1]
+			u.diags = append(u.diags, diagnostic.Diagnostic{
+				Severity: diagnostic.Warning,
+				Code:     CodeUnreachable,
+				Span:     diagnostic.Span{Start: parser.Pos(stmt), End: endOf(last)},
+				Message:  fmt.Sprintf("unreachable code: %d statement(s) after return", len(stmts)-n),
+			})
+			break
+		}
+		if _, ok := stmt.(*parser.ReturnStatement); ok {
+			returned = true
+		}
+	}
+
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *parser.LetStatement:
+			u.expression(s.Value)
+		case *parser.ReturnStatement:
+			u.expression(s.ReturnValue)
+		case *parser.ExpressionStatement:
+			u.expression(s.Expression)
+		}
+	}
+}
+
+// expression visits the blocks nested in an expression.
+func (u *unreachable) expression(expr parser.Expression) {
+	switch e := expr.(type) {
+	case *parser.PrefixExpression:
+		u.expression(e.Right)
+	case *parser.InfixExpression:
+		u.expression(e.Left)
+		u.expression(e.Right)
+	case *parser.IfExpression:
+		u.expression(e.Condition)
+		if e.Consequence != nil {
+			u.block(e.Consequence.Statements)
+		}
+		if e.Alternative != nil {
+			u.block(e.Alternative.Statements)
+		}
+	case *parser.FunctionLiteral:
+		if e.Body != nil {
+			u.block(e.Body.Statements)
+		}
+	case *parser.CallExpression:
+		u.expression(e.Function)
+		for _, a := range e.Arguments {
+			u.expression(a)
+		}
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			u.expression(el)
+		}
+	case *parser.IndexExpression:
+		u.expression(e.Left)
+		u.expression(e.Index)
+	case *parser.HashLiteral:
+		for k, v := range e.Pairs {
+			u.expression(k)
+			u.expression(v)
+		}
+	}
+}
+
+// endOf returns the position just after the first token of the statement,
+// which is the best approximation of its end the AST records.
+func endOf(stmt parser.Statement) lexer.Position {
+	end := parser.Pos(stmt)
+	n := len(stmt.TokenLiteral())
+	end.Offset += n
+	end.Column += n
+	return end
+}
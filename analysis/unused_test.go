@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+func TestUnused(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"let a = 1; let b = 2; puts(b);", []string{"1:5: warning: a is bound but never used [unused-let]"}},
+		{"let _a = 1;", nil},
+		{"puts([fn() { return 1; 2 }]);", []string{"1:24: warning: unreachable code: 1 statement(s) after return [unreachable]"}},
+		{"puts({1: fn() { return 1; 2 }});", []string{"1:27: warning: unreachable code: 1 statement(s) after return [unreachable]"}},
+		{"let a = [1]; puts(a[fn() { return 0; 1 }()]);", []string{"1:38: warning: unreachable code: 1 statement(s) after return [unreachable]"}},
+		{"let f = fn() { return 1; let x = 2; x }; let y = 3;", []string{
+			"1:5: warning: f is bound but never used [unused-let]",
+			"1:26: warning: unreachable code: 2 statement(s) after return [unreachable]",
+			"1:46: warning: y is bound but never used [unused-let]",
+		}},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.source))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatalf("%s: parse errors: %v", tt.source, errs)
+		}
+		diags := Unused(program)
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.source, got, tt.want)
+			continue
+		}
+		for n := range got {
+			if got[n] != tt.want[n] {
+				t.Errorf("%s: got %q, want %q", tt.source, got, tt.want)
+				break
+			}
+		}
+	}
+}
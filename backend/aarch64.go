@@ -0,0 +1,287 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// The AArch64 general-purpose registers, numbered as in the encoding. Number
+// 31 is the stack pointer in the instructions this backend uses.
+const (
+	X0 Reg = iota
+	X1
+	X2
+	X3
+	X4
+	X5
+	X6
+	X7
+	X8
+	X9
+	X10
+	X11
+	X12
+	X13
+	X14
+	X15
+	X16
+	X17
+	X18
+	X19
+	X20
+	X21
+	X22
+	X23
+	X24
+	X25
+	X26
+	X27
+	X28
+	X29
+	X30
+	SP
+)
+
+// a64Names maps the AArch64 registers to their 64-bit names.
+var a64Names = func() []string {
+	names := make([]string, 32)
+	for n := 0; n < 31; n++ {
+		names[n] = fmt.Sprintf("x%d", n)
+	}
+	names[SP] = "sp"
+	return names
+}()
+
+// The registers with a fixed role in the generated code: x16 addresses
+// globals in selected instructions and x17 addresses stack slots too far
+// from the frame pointer for a single load or store.
+const (
+	a64GlobalTemp = X16
+	a64SlotTemp   = X17
+)
+
+// a64Args are the registers the AAPCS64 passes the first arguments in.
+var a64Args = []Reg{X0, X1, X2, X3, X4, X5, X6, X7}
+
+// a64CallerSaved are the registers a call may overwrite, including the link
+// register.
+var a64CallerSaved = []Reg{X0, X1, X2, X3, X4, X5, X6, X7, X8, X9, X10, X11, X12, X13, X14, X15, X16, X17, X30}
+
+// a64CalleeSaved are the registers a function must preserve for its caller.
+var a64CalleeSaved = []Reg{X19, X20, X21, X22, X23, X24, X25, X26, X27, X28}
+
+// a64Registers is the register file of AArch64. x29 is the frame pointer,
+// x30 the link register, x18 is reserved for the platform, x9 and x10 are
+// reserved for spill code and x16 and x17 for addressing.
+var a64Registers = &RegisterFile{
+	Names: a64Names,
+	Allocatable: []Reg{
+		X0, X1, X2, X3, X4, X5, X6, X7, X8, X11, X12, X13, X14, X15,
+		X19, X20, X21, X22, X23, X24, X25, X26, X27, X28,
+	},
+	Scratch:      []Reg{X9, X10},
+	FramePointer: X29,
+	StackPointer: SP,
+}
+
+// a64Convention is the AAPCS64 calling convention.
+var a64Convention = &CallingConvention{
+	Args:        a64Args,
+	Result:      X0,
+	CallerSaved: a64CallerSaved,
+	CalleeSaved: a64CalleeSaved,
+}
+
+// AArch64 is the AArch64 Linux target, generating assembly for the GNU
+// assembler.
+type AArch64 struct{}
+
+// Name returns the name of the target.
+func (AArch64) Name() string { return "aarch64-linux" }
+
+// Registers returns the register file of AArch64.
+func (AArch64) Registers() *RegisterFile { return a64Registers }
+
+// CallingConvention returns the AAPCS64 calling convention.
+func (AArch64) CallingConvention() *CallingConvention { return a64Convention }
+
+// SelectFunction selects AArch64 instructions for a function.
+func (AArch64) SelectFunction(fn *intermediate.Function) *Func { return a64SelectFunction(fn) }
+
+// Load returns the instructions loading the register from the slot.
+func (AArch64) Load(r Reg, slot Operand) []*Instr {
+	addr, setup := a64SlotAddress(slot)
+	return append(setup, a64Instr("ldr", R(r), addr))
+}
+
+// Store returns the instructions storing the register to the slot.
+func (AArch64) Store(slot Operand, r Reg) []*Instr {
+	addr, setup := a64SlotAddress(slot)
+	return append(setup, a64Instr("str", R(r), addr))
+}
+
+// a64SlotAddress returns an operand addressing the slot, and the
+// instructions computing the address into x17 if the slot is beyond the
+// range of the unscaled offsets of ldur and stur.
+func a64SlotAddress(slot Operand) (Operand, []*Instr) {
+	if slot.Imm >= -256 && slot.Imm < 256 {
+		return slot, nil
+	}
+	var setup []*Instr
+	if -slot.Imm < 4096 {
+		setup = append(setup, a64Instr("sub", R(a64SlotTemp), R(slot.Reg), Imm(-slot.Imm)))
+	} else {
+		setup = append(setup,
+			a64Instr("ldr", R(a64SlotTemp), Imm(-slot.Imm)),
+			a64Instr("sub", R(a64SlotTemp), R(slot.Reg), R(a64SlotTemp)))
+	}
+	return Mem(a64SlotTemp, 0), setup
+}
+
+// Jump returns a b to the label.
+func (AArch64) Jump(label string) *Instr { return a64Instr("b", Label(label)) }
+
+// FinishFunction adds the frame to the function and removes the branches to
+// the next block.
+func (AArch64) FinishFunction(f *Func) {
+	a64InsertFrame(f)
+	removeFallthroughJumps(f, "b")
+}
+
+// AddRuntime adds _start, the runtime routines printing values and the one
+// reporting invalid divisions.
+func (AArch64) AddRuntime(prog *Program) {
+	prog.Funcs = append([]*Func{a64StartFunc(prog.Entry)}, prog.Funcs...)
+	prog.Funcs = append(prog.Funcs, a64PutsIntFunc(), a64PutsBoolFunc(), a64DivErrorFunc())
+	for sym, s := range runtimeRodata() {
+		prog.Rodata[sym] = s
+	}
+	prog.Rodata[a64DivErrorMessage] = a64DivErrorText
+}
+
+// a64Instr creates an AArch64 instruction, deriving how it accesses its
+// first operand from the mnemonic.
+func a64Instr(op string, args ...Operand) *Instr {
+	return NewInstr(op, a64Access(op), args...)
+}
+
+// a64Access returns how the AArch64 instruction accesses its first operand.
+func a64Access(op string) Access {
+	switch op {
+	case "cmp", "str", "strb", "cbz", "cbnz", "b", "bl", "ret", "svc":
+		return Read
+	}
+	if strings.HasPrefix(op, "b.") {
+		return Read
+	}
+	return Write
+}
+
+// PrintAssembly returns the program in GNU assembler syntax.
+func (AArch64) PrintAssembly(prog *Program) (string, error) {
+	var b strings.Builder
+
+	// Write the functions
+	fmt.Fprintf(&b, "\t.text\n\t.global %s\n", startSymbol)
+	for _, f := range prog.Funcs {
+		fmt.Fprintf(&b, "\n\t.balign 4\n%s:\n", f.Name)
+		for _, blk := range f.Blocks {
+			if blk.Label != f.Name {
+				fmt.Fprintf(&b, "%s:\n", blk.Label)
+			}
+			for _, in := range blk.Instrs {
+				for _, a := range in.Args {
+					if a.Kind != LabelOperand && a.Reg.IsVirtual() {
+						return "", fmt.Errorf("%s: virtual register %s left after register allocation", f.Name, a.Reg)
+					}
+				}
+				fmt.Fprintf(&b, "\t%s\n", a64Format(in))
+			}
+		}
+	}
+	// Literal pools of ldr with an immediate go after the code.
+	fmt.Fprintf(&b, "\t.ltorg\n")
+
+	// Write the globals, which are all 8-byte integers initialized to 0
+	if len(prog.Data) > 0 {
+		fmt.Fprintf(&b, "\n\t.data\n\t.balign 8\n")
+		for _, sym := range prog.Data {
+			fmt.Fprintf(&b, "%s:\n\t.quad 0\n", sym)
+		}
+	}
+
+	// Write the read-only strings
+	if len(prog.Rodata) > 0 {
+		fmt.Fprintf(&b, "\n\t.section .rodata\n")
+		syms := make([]string, 0, len(prog.Rodata))
+		for sym := range prog.Rodata {
+			syms = append(syms, sym)
+		}
+		sort.Strings(syms)
+		for _, sym := range syms {
+			fmt.Fprintf(&b, "%s:\n\t.ascii %q\n", sym, prog.Rodata[sym])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// a64Format returns the instruction in GNU assembler syntax. The condition of
+// cset is kept in the mnemonic, like that of b.cond, and printed as its last
+// operand.
+func a64Format(in *Instr) string {
+	s := in.Op
+	if cond := strings.TrimPrefix(in.Op, "cset."); cond != in.Op {
+		return fmt.Sprintf("cset %s, %s", a64FormatOperand(in.Args[0], "cset"), cond)
+	}
+	for n, a := range in.Args {
+		if n == 0 {
+			s += " "
+		} else {
+			s += ", "
+		}
+		s += a64FormatOperand(a, in.Op)
+	}
+	return s
+}
+
+// a64FormatOperand returns an operand in GNU assembler syntax. Byte operands
+// name the 32-bit view of a register, which strb stores the low byte of.
+// A symbol without a base register is a page address for adrp and the low
+// 12 bits of the address for add.
+func a64FormatOperand(a Operand, op string) string {
+	switch a.Kind {
+	case RegOperand:
+		if a.Reg.IsVirtual() {
+			return a.Reg.String()
+		}
+		if a.Byte {
+			return "w" + a64Names[a.Reg][1:]
+		}
+		return a64Names[a.Reg]
+	case ImmOperand:
+		if op == "ldr" {
+			return fmt.Sprintf("=%d", a.Imm)
+		}
+		return fmt.Sprintf("#%d", a.Imm)
+	case MemOperand:
+		switch {
+		case a.Reg == NoReg && op == "adrp":
+			return a.Sym
+		case a.Reg == NoReg:
+			return ":lo12:" + a.Sym
+		case a.Sym != "":
+			return fmt.Sprintf("[%s, :lo12:%s]", a64FormatOperand(R(a.Reg), ""), a.Sym)
+		case a.Imm != 0:
+			return fmt.Sprintf("[%s, #%d]", a64FormatOperand(R(a.Reg), ""), a.Imm)
+		default:
+			return fmt.Sprintf("[%s]", a64FormatOperand(R(a.Reg), ""))
+		}
+	case LabelOperand:
+		return a.Sym
+	}
+	return "?"
+}
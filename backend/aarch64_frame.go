@@ -0,0 +1,76 @@
+package backend
+
+// The instructions pushing and popping the frame record, the saved frame
+// pointer and link register. Only the prologue and epilogues use writeback
+// addressing, so they are kept verbatim in the mnemonic.
+const (
+	a64PushFrame = "stp x29, x30, [sp, #-16]!"
+	a64PopFrame  = "ldp x29, x30, [sp], #16"
+)
+
+// a64InsertFrame adds the prologue and epilogues of a function once its
+// registers are allocated: the prologue pushes the frame record, reserves
+// the stack frame rounded up to keep the stack 16-byte aligned, and saves
+// the callee-saved registers the function uses; an epilogue restores them
+// before every return and tail call.
+func a64InsertFrame(f *Func) {
+	if !f.HasFrame {
+		return
+	}
+	f.SavedRegs = nil
+	used := make(map[Reg]bool)
+	for _, b := range f.Blocks {
+		for _, in := range b.Instrs {
+			for _, r := range in.Defs() {
+				used[r] = true
+			}
+		}
+	}
+	var saves []Operand
+	for _, r := range a64CalleeSaved {
+		if used[r] {
+			f.SavedRegs = append(f.SavedRegs, r)
+			saves = append(saves, f.AllocSlot())
+		}
+	}
+	f.FrameSize = (f.spillOffset + 15) &^ 15
+
+	prologue := []*Instr{
+		a64Instr(a64PushFrame),
+		a64Instr("mov", R(X29), R(SP)),
+	}
+	switch {
+	case f.FrameSize >= 4096:
+		prologue = append(prologue,
+			a64Instr("ldr", R(a64SlotTemp), Imm(int64(f.FrameSize))),
+			a64Instr("sub", R(SP), R(SP), R(a64SlotTemp)))
+	case f.FrameSize > 0:
+		prologue = append(prologue, a64Instr("sub", R(SP), R(SP), Imm(int64(f.FrameSize))))
+	}
+	for n, r := range f.SavedRegs {
+		prologue = append(prologue, AArch64{}.Store(saves[n], r)...)
+	}
+
+	// The prologue gets a block of its own, so that loops back to the first
+	// block do not run it again.
+	entry := &Block{Label: f.Name + ".entry", Instrs: prologue}
+	if len(f.Blocks) > 0 {
+		entry.Instrs = append(entry.Instrs, a64Instr("b", Label(f.Blocks[0].Label)))
+	}
+	f.Blocks = append([]*Block{entry}, f.Blocks...)
+
+	for _, b := range f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			if in.Op == "ret" || in.TailCall {
+				for n, r := range f.SavedRegs {
+					out = append(out, AArch64{}.Load(r, saves[n])...)
+				}
+				out = append(out, a64Instr("mov", R(SP), R(X29)), a64Instr(a64PopFrame))
+			}
+			out = append(out, in)
+		}
+		b.Instrs = out
+	}
+	linkBlocks(f)
+}
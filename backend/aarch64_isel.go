@@ -0,0 +1,344 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// a64Conditions maps the comparison operations to AArch64 condition codes.
+var a64Conditions = map[intermediate.Op]string{
+	intermediate.OpEq: "eq",
+	intermediate.OpNe: "ne",
+	intermediate.OpLt: "lt",
+	intermediate.OpGt: "gt",
+}
+
+// a64Selector translates a function of the intermediate representation into
+// AArch64 machine instructions operating on virtual registers.
+type a64Selector struct {
+	fn     *intermediate.Function
+	mf     *Func
+	blocks map[*intermediate.Block]*Block
+	vregs  map[*intermediate.Instr]Reg
+	uses   []int                        // The number of uses of every value.
+	fused  map[*intermediate.Instr]bool // The comparisons only used by the branch following them.
+	cur    *Block                       // The block instructions are appended to.
+	edges  int                          // The number of edge blocks created so far.
+}
+
+// a64SelectFunction performs instruction selection for a function.
+func a64SelectFunction(fn *intermediate.Function) *Func {
+	s := &a64Selector{
+		fn:     fn,
+		mf:     &Func{Name: funcSymbol(fn.Name), Target: AArch64{}, Params: len(fn.Params), HasFrame: true},
+		blocks: make(map[*intermediate.Block]*Block),
+		vregs:  make(map[*intermediate.Instr]Reg),
+		uses:   fn.Uses(),
+		fused:  make(map[*intermediate.Instr]bool),
+	}
+	for _, b := range fn.Blocks {
+		mb := &Block{Label: fmt.Sprintf("%s.b%d", s.mf.Name, b.ID)}
+		s.blocks[b] = mb
+		s.mf.Blocks = append(s.mf.Blocks, mb)
+		for n, in := range b.Instrs {
+			if _, ok := a64Conditions[in.Op]; ok && s.uses[in.ID] == 1 && n+1 < len(b.Instrs) {
+				next := b.Instrs[n+1]
+				if next.Op == intermediate.OpBranch && next.Args[0] == in {
+					s.fused[in] = true
+				}
+			}
+		}
+	}
+
+	for _, b := range fn.Blocks {
+		s.cur = s.blocks[b]
+		for _, in := range b.Instrs {
+			s.selectInstr(in)
+		}
+	}
+	linkBlocks(s.mf)
+	return s.mf
+}
+
+// emit appends a machine instruction to the current block.
+func (s *a64Selector) emit(op string, args ...Operand) *Instr {
+	i := a64Instr(op, args...)
+	s.cur.Instrs = append(s.cur.Instrs, i)
+	return i
+}
+
+// vreg returns the virtual register holding the value of an instruction.
+func (s *a64Selector) vreg(v *intermediate.Instr) Reg {
+	r, ok := s.vregs[v]
+	if !ok {
+		r = s.mf.NewVirtual()
+		s.vregs[v] = r
+	}
+	return r
+}
+
+// move copies the value into the register, materializing constants.
+// Constants movz or movn can build are moved directly, the others are
+// loaded from the literal pool.
+func (s *a64Selector) move(d Operand, v *intermediate.Instr) {
+	switch {
+	case v.Op != intermediate.OpConst:
+		s.emit("mov", d, R(s.vreg(v)))
+	case v.Const >= -65536 && v.Const < 65536:
+		s.emit("mov", d, Imm(v.Const))
+	default:
+		s.emit("ldr", d, Imm(v.Const))
+	}
+}
+
+// reg returns a register operand holding the value, materializing constants
+// into a new virtual register.
+func (s *a64Selector) reg(v *intermediate.Instr) Operand {
+	if v.Op == intermediate.OpConst {
+		t := R(s.mf.NewVirtual())
+		s.move(t, v)
+		return t
+	}
+	return R(s.vreg(v))
+}
+
+// operand2 returns an operand for the value as the second source of add, sub
+// or cmp, which accept a 12-bit unsigned immediate.
+func (s *a64Selector) operand2(v *intermediate.Instr) Operand {
+	if v.Op == intermediate.OpConst && v.Const >= 0 && v.Const < 4096 {
+		return Imm(v.Const)
+	}
+	return s.reg(v)
+}
+
+// global returns the operand addressing a global, whose page address is
+// loaded into x16 first.
+func (s *a64Selector) global(name string) Operand {
+	sym := globalSymbol(name)
+	s.emit("adrp", R(a64GlobalTemp), Global(sym))
+	m := Mem(a64GlobalTemp, 0)
+	m.Sym = sym
+	return m
+}
+
+// selectInstr selects the machine instructions for an instruction.
+func (s *a64Selector) selectInstr(in *intermediate.Instr) {
+	switch in.Op {
+	case intermediate.OpConst, intermediate.OpPhi:
+		// Constants are materialized where they are used, and phis are
+		// resolved by copies in the predecessors.
+
+	case intermediate.OpParam:
+		d := R(s.vreg(in))
+		if int(in.Const) < len(a64Args) {
+			s.emit("mov", d, R(a64Args[in.Const]))
+		} else {
+			// Stack arguments are above the saved frame pointer and link
+			// register.
+			s.emit("ldr", d, Mem(X29, 16+8*(in.Const-int64(len(a64Args)))))
+		}
+
+	case intermediate.OpAdd, intermediate.OpSub:
+		op := map[intermediate.Op]string{intermediate.OpAdd: "add", intermediate.OpSub: "sub"}[in.Op]
+		a := s.reg(in.Args[0])
+		s.emit(op, R(s.vreg(in)), a, s.operand2(in.Args[1]))
+
+	case intermediate.OpMul:
+		s.emit("mul", R(s.vreg(in)), s.reg(in.Args[0]), s.reg(in.Args[1]))
+
+	case intermediate.OpDiv:
+		s.selectDiv(in)
+
+	case intermediate.OpNeg:
+		s.emit("neg", R(s.vreg(in)), s.reg(in.Args[0]))
+
+	case intermediate.OpNot:
+		s.emit("eor", R(s.vreg(in)), s.reg(in.Args[0]), Imm(1))
+
+	case intermediate.OpZext:
+		// Booleans are already 0 or 1 in a full register.
+		s.move(R(s.vreg(in)), in.Args[0])
+
+	case intermediate.OpEq, intermediate.OpNe, intermediate.OpLt, intermediate.OpGt:
+		a := s.reg(in.Args[0])
+		s.emit("cmp", a, s.operand2(in.Args[1]))
+		if !s.fused[in] {
+			s.emit("cset."+a64Conditions[in.Op], R(s.vreg(in)))
+		}
+
+	case intermediate.OpCall:
+		s.selectCall(in)
+
+	case intermediate.OpLoadGlobal:
+		s.emit("ldr", R(s.vreg(in)), s.global(in.Name))
+
+	case intermediate.OpStoreGlobal:
+		v := s.reg(in.Args[0])
+		s.emit("str", v, s.global(in.Name))
+
+	case intermediate.OpJump:
+		s.jumpTo(in.Targets[0])
+
+	case intermediate.OpBranch:
+		cond := in.Args[0]
+		if s.fused[cond] {
+			s.emit("b."+a64Conditions[cond.Op], Label(s.edgeTo(in.Targets[0]).Label))
+		} else {
+			s.emit("cbnz", s.reg(cond), Label(s.edgeTo(in.Targets[0]).Label))
+		}
+		s.emit("b", Label(s.edgeTo(in.Targets[1]).Label))
+
+	case intermediate.OpReturn:
+		ret := a64Instr("ret")
+		if len(in.Args) > 0 {
+			s.move(R(X0), in.Args[0])
+			ret.ImplicitUses = []Reg{X0}
+		}
+		s.cur.Instrs = append(s.cur.Instrs, ret)
+
+	case intermediate.OpTailCall:
+		s.selectTailCall(in)
+	}
+}
+
+// selectDiv selects a division. Unlike idiv on x86-64, sdiv does not trap:
+// it gives 0 for a zero divisor and the dividend for the most negative
+// integer divided by -1, so both are checked first, unless the divisor is a
+// constant ruling them out, and branch to the runtime routine reporting the
+// error. The second check is the or of b+1 and of the dividend with its sign
+// bit flipped, which is zero only for those operands.
+func (s *a64Selector) selectDiv(in *intermediate.Instr) {
+	a := s.reg(in.Args[0])
+	b := s.reg(in.Args[1])
+	divisor := in.Args[1]
+	constant := divisor.Op == intermediate.OpConst
+	if !constant || divisor.Const == 0 {
+		s.emit("cbz", b, Label(a64DivError))
+	}
+	if !constant || divisor.Const == -1 {
+		min := R(s.mf.NewVirtual())
+		s.emit("mov", min, Imm(math.MinInt64))
+		flipped := R(s.mf.NewVirtual())
+		s.emit("eor", flipped, a, min)
+		overflow := R(s.mf.NewVirtual())
+		s.emit("add", overflow, b, Imm(1))
+		s.emit("orr", overflow, overflow, flipped)
+		s.emit("cbz", overflow, Label(a64DivError))
+	}
+	s.emit("sdiv", R(s.vreg(in)), a, b)
+}
+
+// passArguments evaluates the arguments into virtual registers, stores the
+// ones beyond the argument registers with store, then copies the first ones
+// into the argument registers, which are not overwritten until all the
+// arguments are evaluated. It returns the argument registers used.
+func (s *a64Selector) passArguments(args []*intermediate.Instr, store func(n int, v Operand)) []Reg {
+	vals := make([]Operand, len(args))
+	for n, arg := range args {
+		vals[n] = s.reg(arg)
+	}
+	for n := len(a64Args); n < len(args); n++ {
+		store(n-len(a64Args), vals[n])
+	}
+	var regs []Reg
+	for n := 0; n < len(args) && n < len(a64Args); n++ {
+		s.emit("mov", R(a64Args[n]), vals[n])
+		regs = append(regs, a64Args[n])
+	}
+	return regs
+}
+
+// selectCall selects a call following the AAPCS64. Calls of puts go to the
+// runtime routine printing the type of the argument.
+func (s *a64Selector) selectCall(in *intermediate.Instr) {
+	sym := funcSymbol(in.Name)
+	if in.Name == "puts" {
+		sym = putsInt
+		if in.Args[0].Type == intermediate.TypeBool {
+			sym = putsBool
+		}
+	}
+
+	// The stack pointer must stay 16-byte aligned, so the area of the stack
+	// arguments is rounded up.
+	size := 0
+	if stackArgs := len(in.Args) - len(a64Args); stackArgs > 0 {
+		size = (8*stackArgs + 15) &^ 15
+		s.emit("sub", R(SP), R(SP), Imm(int64(size)))
+	}
+	regs := s.passArguments(in.Args, func(n int, v Operand) {
+		s.emit("str", v, Mem(SP, 8*int64(n)))
+	})
+	call := s.emit("bl", Label(sym))
+	call.ImplicitUses = regs
+	call.ImplicitDefs = a64CallerSaved
+	if size > 0 {
+		s.emit("add", R(SP), R(SP), Imm(int64(size)))
+	}
+	if in.Type != intermediate.TypeVoid && s.uses[in.ID] > 0 {
+		s.emit("mov", R(s.vreg(in)), R(X0))
+	}
+}
+
+// selectTailCall selects a sibling call: the arguments replace those of the
+// current function, in registers and in the incoming stack argument area,
+// and the function branches to the callee after tearing down its frame.
+func (s *a64Selector) selectTailCall(in *intermediate.Instr) {
+	regs := s.passArguments(in.Args, func(n int, v Operand) {
+		s.emit("str", v, Mem(X29, 16+8*int64(n)))
+	})
+	b := s.emit("b", Label(funcSymbol(in.Name)))
+	b.ImplicitUses = regs
+	b.TailCall = true
+}
+
+// jumpTo copies the phi operands for the edge from the current block to the
+// target and branches there.
+func (s *a64Selector) jumpTo(target *intermediate.Block) {
+	s.phiCopies(s.cur, target)
+	s.emit("b", Label(s.blocks[target].Label))
+}
+
+// edgeTo returns the block a branch from the current block to target goes
+// to: the target itself, or a new block on the edge holding the copies of
+// the target's phi operands.
+func (s *a64Selector) edgeTo(target *intermediate.Block) *Block {
+	if len(target.Phis()) == 0 {
+		return s.blocks[target]
+	}
+	from := s.cur
+	edge := &Block{Label: fmt.Sprintf("%s.e%d", s.mf.Name, s.edges)}
+	s.edges++
+	s.mf.Blocks = append(s.mf.Blocks, edge)
+	s.cur = edge
+	s.phiCopies(from, target)
+	s.emit("b", Label(s.blocks[target].Label))
+	s.cur = from
+	return edge
+}
+
+// phiCopies copies the operands of the phis of target for the edge coming
+// from the machine block from, through temporaries.
+func (s *a64Selector) phiCopies(from *Block, target *intermediate.Block) {
+	phis := target.Phis()
+	if len(phis) == 0 {
+		return
+	}
+	var pred *intermediate.Block
+	for b, mb := range s.blocks {
+		if mb == from {
+			pred = b
+		}
+	}
+	n := target.PredIndex(pred)
+	temps := make([]Reg, len(phis))
+	for k, phi := range phis {
+		temps[k] = s.mf.NewVirtual()
+		s.move(R(temps[k]), phi.Args[n])
+	}
+	for k, phi := range phis {
+		s.emit("mov", R(s.vreg(phi)), R(temps[k]))
+	}
+}
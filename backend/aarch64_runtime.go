@@ -0,0 +1,129 @@
+package backend
+
+// The Linux system call numbers of AArch64.
+const (
+	a64SysWrite = 64
+	a64SysExit  = 93
+)
+
+// The runtime routine reporting an invalid division, its message, and the
+// exit status of a program ended by it.
+const (
+	a64DivError        = "rt_div_error"
+	a64DivErrorMessage = "rt_div_error_message"
+	a64DivErrorText    = "monkey: integer division error\n"
+	stderrFileno       = 2
+	runtimeErrorStatus = 1
+)
+
+// a64Svc returns a supervisor call, which reads the system call number from
+// x8 and its arguments from x0, x1 and x2, and returns its result in x0.
+func a64Svc() *Instr {
+	i := a64Instr("svc", Imm(0))
+	i.ImplicitUses = []Reg{X8, X0, X1, X2}
+	i.ImplicitDefs = []Reg{X0}
+	return i
+}
+
+// a64StartFunc returns the entry point of the program, which calls the main
+// function and exits with status 0.
+func a64StartFunc(entry string) *Func {
+	return &Func{Name: startSymbol, Target: AArch64{}, Blocks: []*Block{newBlock(startSymbol,
+		a64Instr("bl", Label(entry)),
+		a64Instr("mov", R(X0), Imm(0)),
+		a64Instr("mov", R(X8), Imm(a64SysExit)),
+		a64Svc(),
+	)}}
+}
+
+// a64PutsIntFunc returns the runtime routine printing the integer in x0 in
+// decimal followed by a newline. The digits are written backwards into a
+// buffer on the stack; the magnitude of a negative number is divided as an
+// unsigned value, which also handles the most negative integer.
+func a64PutsIntFunc() *Func {
+	l := func(name string) string { return putsInt + "." + name }
+	return &Func{Name: putsInt, Target: AArch64{}, Blocks: []*Block{
+		newBlock(putsInt,
+			a64Instr(a64PushFrame),
+			a64Instr("mov", R(X29), R(SP)),
+			a64Instr("sub", R(SP), R(SP), Imm(32)),
+			a64Instr("sub", R(X1), R(X29), Imm(1)),
+			a64Instr("mov", R(X2), Imm('\n')),
+			a64Instr("strb", R8b(X2), Mem(X1, 0)),
+			a64Instr("mov", R(X3), R(X0)),
+			a64Instr("cmp", R(X0), Imm(0)),
+			a64Instr("b.ge", Label(l("digits"))),
+			a64Instr("neg", R(X0), R(X0)),
+		),
+		newBlock(l("digits"),
+			a64Instr("mov", R(X4), Imm(10)),
+		),
+		newBlock(l("loop"),
+			a64Instr("udiv", R(X5), R(X0), R(X4)),
+			a64Instr("msub", R(X6), R(X5), R(X4), R(X0)),
+			a64Instr("add", R(X6), R(X6), Imm('0')),
+			a64Instr("sub", R(X1), R(X1), Imm(1)),
+			a64Instr("strb", R8b(X6), Mem(X1, 0)),
+			a64Instr("mov", R(X0), R(X5)),
+			a64Instr("cbnz", R(X0), Label(l("loop"))),
+			a64Instr("cmp", R(X3), Imm(0)),
+			a64Instr("b.ge", Label(l("write"))),
+			a64Instr("mov", R(X6), Imm('-')),
+			a64Instr("sub", R(X1), R(X1), Imm(1)),
+			a64Instr("strb", R8b(X6), Mem(X1, 0)),
+		),
+		newBlock(l("write"),
+			a64Instr("sub", R(X2), R(X29), R(X1)),
+			a64Instr("mov", R(X0), Imm(stdoutFileno)),
+			a64Instr("mov", R(X8), Imm(a64SysWrite)),
+			a64Svc(),
+			a64Instr("mov", R(SP), R(X29)),
+			a64Instr(a64PopFrame),
+			a64Instr("ret"),
+		),
+	}}
+}
+
+// a64PutsBoolFunc returns the runtime routine printing the boolean in x0 as
+// true or false followed by a newline.
+func a64PutsBoolFunc() *Func {
+	l := func(name string) string { return putsBool + "." + name }
+	return &Func{Name: putsBool, Target: AArch64{}, Blocks: []*Block{
+		newBlock(putsBool,
+			a64Instr("cbz", R(X0), Label(l("false"))),
+			a64Instr("adrp", R(X1), Global(trueSymbol)),
+			a64Instr("add", R(X1), R(X1), Global(trueSymbol)),
+			a64Instr("mov", R(X2), Imm(5)),
+			a64Instr("b", Label(l("write"))),
+		),
+		newBlock(l("false"),
+			a64Instr("adrp", R(X1), Global(falseSymbol)),
+			a64Instr("add", R(X1), R(X1), Global(falseSymbol)),
+			a64Instr("mov", R(X2), Imm(6)),
+		),
+		newBlock(l("write"),
+			a64Instr("mov", R(X0), Imm(stdoutFileno)),
+			a64Instr("mov", R(X8), Imm(a64SysWrite)),
+			a64Svc(),
+			a64Instr("ret"),
+		),
+	}}
+}
+
+// a64DivErrorFunc returns the runtime routine the divisions branch to when
+// the divisor is zero or the division overflows. It reports the error on
+// stderr and exits with the status of a runtime error, like the C runtime;
+// what the program printed is already written, since puts does not buffer.
+func a64DivErrorFunc() *Func {
+	return &Func{Name: a64DivError, Target: AArch64{}, Blocks: []*Block{newBlock(a64DivError,
+		a64Instr("adrp", R(X1), Global(a64DivErrorMessage)),
+		a64Instr("add", R(X1), R(X1), Global(a64DivErrorMessage)),
+		a64Instr("mov", R(X2), Imm(int64(len(a64DivErrorText)))),
+		a64Instr("mov", R(X0), Imm(stderrFileno)),
+		a64Instr("mov", R(X8), Imm(a64SysWrite)),
+		a64Svc(),
+		a64Instr("mov", R(X0), Imm(runtimeErrorStatus)),
+		a64Instr("mov", R(X8), Imm(a64SysExit)),
+		a64Svc(),
+	)}}
+}
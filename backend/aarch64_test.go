@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestAArch64Assembly compares the AArch64 assembly of the programs with the
+// golden files, and assembles it when an AArch64 assembler is installed.
+func TestAArch64Assembly(t *testing.T) {
+	assemble := aarch64Assembler()
+	for name, source := range programs(t, "aarch64") {
+		t.Run(name, func(t *testing.T) {
+			assembly, err := GenerateAssembly(lower(t, source, 1), Options{Target: AArch64{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "aarch64", name+".s")
+			golden(t, path, assembly)
+			if assemble != nil {
+				obj := filepath.Join(t.TempDir(), name+".o")
+				if out, err := assemble(path, obj).CombinedOutput(); err != nil {
+					t.Errorf("%s does not assemble: %s\n%s", path, err, out)
+				}
+			}
+		})
+	}
+}
+
+// aarch64Assembler returns a function making the command that assembles an
+// AArch64 file into an object file, or nil if there is no assembler.
+func aarch64Assembler() func(src, obj string) *exec.Cmd {
+	if as, err := exec.LookPath("aarch64-linux-gnu-as"); err == nil {
+		return func(src, obj string) *exec.Cmd { return exec.Command(as, "-o", obj, src) }
+	}
+	if mc, err := exec.LookPath("llvm-mc"); err == nil {
+		return func(src, obj string) *exec.Cmd {
+			return exec.Command(mc, "-triple=aarch64-linux-gnu", "-filetype=obj", "-o", obj, src)
+		}
+	}
+	return nil
+}
@@ -2,41 +2,82 @@ package backend
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
-// generateAssembly takes a slice of intermediate code nodes and returns
-// a string containing the corresponding assembly code.
-func generateAssembly(nodes []intermediateCodeNode) (string, error) {
+// generateAssembly takes a program with allocated registers and returns a
+// string containing the corresponding NASM assembly code. The program is a
+// complete static executable once assembled and linked: _start calls the
+// main function and exits.
+func generateAssembly(prog *Program) (string, error) {
 	var b strings.Builder
 
 	// Write the assembly file header
-	fmt.Fprintf(&b, "section .text\n\n")
-
-	// Loop over each intermediate code node
-	for _, node := range nodes {
-		switch node.opcode {
-		case opcodeAdd:
-			// Add the two operands and store the result
-			fmt.Fprintf(&b, "add eax, %d\n", node.operand1)
-		case opcodeSubtract:
-			// Subtract the second operand from the first and store the result
-			fmt.Fprintf(&b, "sub eax, %d\n", node.operand2)
-		case opcodeMultiply:
-			// Multiply the two operands and store the result
-			fmt.Fprintf(&b, "imul eax, %d\n", node.operand1)
-		case opcodeDivide:
-			// Divide the first operand by the second and store the result
-			fmt.Fprintf(&b, "cdq\n")
-			fmt.Fprintf(&b, "idiv %d\n", node.operand2)
-		default:
-			// If the opcode is not recognized, return an error
-			return "", fmt.Errorf("unknown opcode %d", node.opcode)
+	fmt.Fprintf(&b, "bits 64\ndefault rel\n\n")
+	fmt.Fprintf(&b, "section .text\nglobal %s\n", startSymbol)
+
+	// Write the functions
+	for _, f := range prog.Funcs {
+		fmt.Fprintf(&b, "\n%s:\n", f.Name)
+		for _, blk := range f.Blocks {
+			if blk.Label != f.Name {
+				fmt.Fprintf(&b, "%s:\n", blk.Label)
+			}
+			for _, in := range blk.Instrs {
+				for _, a := range in.Args {
+					if a.Kind != LabelOperand && a.Reg.IsVirtual() {
+						return "", fmt.Errorf("%s: virtual register %s left after register allocation", f.Name, a.Reg)
+					}
+				}
+				fmt.Fprintf(&b, "\t%s\n", in)
+			}
+		}
+	}
+
+	// Write the globals, which are all 8-byte integers initialized to 0
+	if len(prog.Data) > 0 {
+		fmt.Fprintf(&b, "\nsection .data\n")
+		for _, sym := range prog.Data {
+			fmt.Fprintf(&b, "%s:\tdq 0\n", sym)
 		}
 	}
 
-	// Write the assembly file footer
-	fmt.Fprintf(&b, "\n")
+	// Write the read-only strings
+	if len(prog.Rodata) > 0 {
+		fmt.Fprintf(&b, "\nsection .rodata\n")
+		syms := make([]string, 0, len(prog.Rodata))
+		for sym := range prog.Rodata {
+			syms = append(syms, sym)
+		}
+		sort.Strings(syms)
+		for _, sym := range syms {
+			fmt.Fprintf(&b, "%s:\tdb %s\n", sym, formatBytes(prog.Rodata[sym]))
+		}
+	}
 
 	return b.String(), nil
 }
+
+// formatBytes returns the operands of a db directive defining the string,
+// quoting printable runs and writing other bytes as numbers.
+func formatBytes(s string) string {
+	var parts []string
+	run := ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '"' {
+			run += string(c)
+			continue
+		}
+		if run != "" {
+			parts = append(parts, `"`+run+`"`)
+			run = ""
+		}
+		parts = append(parts, fmt.Sprintf("%d", c))
+	}
+	if run != "" {
+		parts = append(parts, `"`+run+`"`)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// update makes the tests rewrite their golden files instead of comparing
+// against them: go test ./backend -update.
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// lower parses and lowers a Monkey program, and runs the passes of the
+// optimization level except those named in skip.
+func lower(t *testing.T, source string, level int, skip ...string) *intermediate.Module {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		t.Fatalf("lower: %s", err)
+	}
+	var passes []intermediate.Pass
+	for _, pass := range intermediate.Passes(intermediate.Options{Level: level, InlineThreshold: intermediate.DefaultInlineThreshold}) {
+		if !contains(skip, pass.Name) {
+			passes = append(passes, pass)
+		}
+	}
+	intermediate.Optimize(module, passes)
+	return module
+}
+
+// contains returns true if list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// programs returns the Monkey programs of a directory of testdata, by name.
+func programs(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", dir, "*.mk"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no programs in testdata/%s", dir)
+	}
+	result := make(map[string]string)
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[strings.TrimSuffix(filepath.Base(file), ".mk")] = string(source)
+	}
+	return result
+}
+
+// golden compares got with the golden file at path, or writes it there with
+// -update.
+func golden(t *testing.T, path string, got string) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (run go test -update to accept it):\n%s", path, got)
+	}
+}
+
+// countInstructions returns the number of instructions of the Monkey
+// functions in x86-64 assembly, leaving out the entry point and the runtime.
+func countInstructions(assembly string) int {
+	n := 0
+	monkey := false
+	for _, line := range strings.Split(assembly, "\n") {
+		switch {
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, "\t"):
+			monkey = strings.HasPrefix(line, "monkey_")
+		case monkey && strings.HasPrefix(line, "\t"):
+			n++
+		}
+	}
+	return n
+}
+
+// native skips the test on other machines than x86-64 Linux, where the
+// executables cannot run.
+func native(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("executables only run on x86-64 Linux")
+	}
+}
+
+// run writes the module as an executable, runs it and returns its standard
+// output.
+func run(t *testing.T, module *intermediate.Module, opts Options) string {
+	t.Helper()
+	native(t)
+	exe := filepath.Join(t.TempDir(), "a.out")
+	opts.Emit = EmitExe
+	if err := GenerateCode(module, exe, opts); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(exe).Output()
+	if err != nil {
+		t.Fatalf("%s: %s\n%s", exe, err, out)
+	}
+	return string(out)
+}
@@ -1,32 +1,137 @@
 package backend
 
-import "io/ioutil"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
 
-// GenerateCode generates code from the AST and writes it to the specified output file.
-func GenerateCode(ast *parser.AST, outputFile string) error {
-	// Create an intermediate code generator
-	icg := intermediateCodeGenerator{}
+	"github.com/user/golang-interpreter/intermediate"
+)
 
-	// Generate intermediate code from the AST
-	nodes, err := icg.generateIntermediateCode(ast)
-	if err != nil {
-		return err
+// The output formats of the code generator.
+const (
+	EmitAsm = "asm" // NASM assembly source.
+	EmitObj = "obj" // A relocatable ELF64 object file.
+	EmitExe = "exe" // A statically linked ELF64 executable.
+)
+
+// Options configures the code generator.
+type Options struct {
+	Target    Target            // The target machine; DefaultTarget if nil.
+	Allocator RegisterAllocator // The register allocator; linear scan if nil.
+	Emit      string            // The output format; assembly if empty.
+}
+
+// objectTarget is implemented by the targets that can encode machine code in
+// process for the obj and exe output formats.
+type objectTarget interface {
+	assemble(prog *Program) (*objectCode, error)
+}
+
+// Formats returns the output formats the target can emit.
+func Formats(target Target) []string {
+	if _, ok := target.(objectTarget); ok {
+		return []string{EmitAsm, EmitObj, EmitExe}
 	}
+	return []string{EmitAsm}
+}
 
-	// Create an assembly code generator
-	asm := asm{}
+// GenerateCode generates x86-64 code for the module and writes it to the
+// specified output file in the requested format.
+func GenerateCode(module *intermediate.Module, outputFile string, opts Options) error {
+	target := opts.Target
+	if target == nil {
+		target = DefaultTarget
+	}
 
-	// Generate assembly code from the intermediate code nodes
-	assembly, err := asm.generateAssembly(nodes)
-	if err != nil {
-		return err
+	// Translate the module to machine code
+	prog := compile(module, target, opts.Allocator)
+
+	var output []byte
+	perm := os.FileMode(0644)
+	switch opts.Emit {
+	case "", EmitAsm:
+		// Generate assembly code from the machine code
+		assembly, err := target.PrintAssembly(prog)
+		if err != nil {
+			return err
+		}
+		output = []byte(assembly)
+
+	case EmitObj, EmitExe:
+		// Encode the machine code and write it in an ELF file
+		encoder, ok := target.(objectTarget)
+		if !ok {
+			return fmt.Errorf("target %s cannot emit %s files, only asm", target.Name(), opts.Emit)
+		}
+		obj, err := encoder.assemble(prog)
+		if err != nil {
+			return err
+		}
+		if opts.Emit == EmitObj {
+			output, err = writeObject(obj)
+		} else {
+			output, err = writeExecutable(obj)
+			perm = 0755
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown output format %q", opts.Emit)
 	}
 
-	// Write the assembly code to the output file
-	err = ioutil.WriteFile(outputFile, []byte(assembly), 0644)
+	// Write the code to the output file
+	err := ioutil.WriteFile(outputFile, output, perm)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// GenerateAssembly generates code for the module and returns it in the
+// assembly syntax of the target, as GenerateCode writes it for asm.
+func GenerateAssembly(module *intermediate.Module, opts Options) (string, error) {
+	target := opts.Target
+	if target == nil {
+		target = DefaultTarget
+	}
+	return target.PrintAssembly(compile(module, target, opts.Allocator))
+}
+
+// funcSymbol returns the assembly symbol of a Monkey function. Symbols are
+// prefixed so that Monkey names cannot clash with the runtime or _start.
+func funcSymbol(name string) string {
+	return "monkey_" + name
+}
+
+// globalSymbol returns the assembly symbol of a global.
+func globalSymbol(name string) string {
+	return "global_" + name
+}
+
+// compile selects instructions for every function of the module, allocates
+// their registers and adds the runtime routines the program needs.
+func compile(module *intermediate.Module, target Target, allocator RegisterAllocator) *Program {
+	if allocator == nil {
+		allocator = LinearScan{}
+	}
+
+	prog := &Program{
+		Entry:  funcSymbol(intermediate.MainFunction),
+		Rodata: make(map[string]string),
+	}
+	for _, fn := range module.Functions {
+		f := target.SelectFunction(fn)
+		allocator.Allocate(f)
+		target.FinishFunction(f)
+		prog.Funcs = append(prog.Funcs, f)
+	}
+	target.AddRuntime(prog)
+	for _, g := range module.Globals {
+		prog.Data = append(prog.Data, globalSymbol(g))
+	}
+	return prog
+}
@@ -0,0 +1,562 @@
+package backend
+
+// GraphColoring assigns registers with the iterated register coalescing
+// algorithm of George and Appel. It builds the interference graph of the
+// function, then repeatedly simplifies nodes of low degree, coalesces moves
+// whose operands can share a register without making the graph harder to
+// color (Briggs' test, or George's test against physical registers), freezes
+// moves that cannot be coalesced, and picks spill candidates by cost. Spilled
+// registers are rewritten to load and store short-lived temporaries around
+// each use and definition, and allocation starts over.
+//
+// The physical registers the instructions name, such as the argument
+// registers and the caller-saved registers overwritten by calls, are
+// precolored nodes, so the values live across calls get callee-saved
+// registers and moves from and to argument registers are coalesced away.
+type GraphColoring struct{}
+
+// Allocate assigns the registers of the function.
+func (GraphColoring) Allocate(f *Func) {
+	noSpill := make(regSet)
+	for {
+		c := newColoring(f, noSpill)
+		c.build()
+		c.makeWorklist()
+		for len(c.simplifyWorklist) > 0 || len(c.worklistMoves) > 0 || len(c.freezeWorklist) > 0 || len(c.spillWorklist) > 0 {
+			switch {
+			case len(c.simplifyWorklist) > 0:
+				c.simplify()
+			case len(c.worklistMoves) > 0:
+				c.coalesce()
+			case len(c.freezeWorklist) > 0:
+				c.freeze()
+			default:
+				c.selectSpill()
+			}
+		}
+		c.assignColors()
+		if len(c.spilledNodes) == 0 {
+			c.rewriteColors()
+			return
+		}
+		c.rewriteSpills(noSpill)
+	}
+}
+
+// coloring holds the state of one round of iterated register coalescing. The
+// nodes of the interference graph are the virtual registers and the
+// allocatable physical registers.
+type coloring struct {
+	f          *Func
+	k          int              // The number of colors.
+	precolored regSet           // The allocatable physical registers.
+	initial    []Reg            // The virtual registers.
+	noSpill    regSet           // The temporaries of spill code, which must not be spilled again.
+	cost       map[Reg]float64  // The spill cost of every virtual register.
+	adjSet     map[[2]Reg]bool  // The interference edges, in both directions.
+	adjList    map[Reg][]Reg    // The neighbours of the virtual registers.
+	degree     map[Reg]int      // The number of neighbours of every node.
+	moveList   map[Reg][]*Instr // The moves every node is an operand of.
+	alias      map[Reg]Reg      // The node a coalesced node was merged into.
+	color      map[Reg]Reg      // The register assigned to every node.
+
+	simplifyWorklist regSet // The low-degree nodes that are not move related.
+	freezeWorklist   regSet // The low-degree move-related nodes.
+	spillWorklist    regSet // The high-degree nodes.
+	spilledNodes     regSet // The nodes marked for spilling.
+	coalescedNodes   regSet // The nodes merged into another node.
+	coloredNodes     regSet // The nodes successfully colored.
+	selectStack      []Reg  // The nodes removed from the graph, in removal order.
+	onStack          regSet // The nodes on the select stack.
+
+	worklistMoves    map[*Instr]bool // The moves that may be coalesced.
+	activeMoves      map[*Instr]bool // The moves not yet ready for coalescing.
+	coalescedMoves   map[*Instr]bool // The moves that have been coalesced.
+	constrainedMoves map[*Instr]bool // The moves whose operands interfere.
+	frozenMoves      map[*Instr]bool // The moves no longer considered for coalescing.
+}
+
+// infiniteDegree is the degree of the precolored nodes, which are never
+// simplified or spilled.
+const infiniteDegree = 1 << 30
+
+// newColoring creates the state for a round of allocation.
+func newColoring(f *Func, noSpill regSet) *coloring {
+	c := &coloring{
+		f:                f,
+		k:                len(f.Target.Registers().Allocatable),
+		precolored:       make(regSet),
+		noSpill:          noSpill,
+		cost:             make(map[Reg]float64),
+		adjSet:           make(map[[2]Reg]bool),
+		adjList:          make(map[Reg][]Reg),
+		degree:           make(map[Reg]int),
+		moveList:         make(map[Reg][]*Instr),
+		alias:            make(map[Reg]Reg),
+		color:            make(map[Reg]Reg),
+		simplifyWorklist: make(regSet),
+		freezeWorklist:   make(regSet),
+		spillWorklist:    make(regSet),
+		spilledNodes:     make(regSet),
+		coalescedNodes:   make(regSet),
+		coloredNodes:     make(regSet),
+		onStack:          make(regSet),
+		worklistMoves:    make(map[*Instr]bool),
+		activeMoves:      make(map[*Instr]bool),
+		coalescedMoves:   make(map[*Instr]bool),
+		constrainedMoves: make(map[*Instr]bool),
+		frozenMoves:      make(map[*Instr]bool),
+	}
+	for _, r := range f.Target.Registers().Allocatable {
+		c.precolored[r] = true
+		c.color[r] = r
+		c.degree[r] = infiniteDegree
+	}
+	return c
+}
+
+// isNode returns true if the register is a node of the interference graph.
+func (c *coloring) isNode(r Reg) bool {
+	return r.IsVirtual() || c.precolored[r]
+}
+
+// nodes filters the registers down to the nodes of the interference graph.
+func (c *coloring) nodes(regs []Reg) []Reg {
+	var ns []Reg
+	for _, r := range regs {
+		if c.isNode(r) {
+			ns = append(ns, r)
+		}
+	}
+	return ns
+}
+
+// build constructs the interference graph from the liveness of the
+// registers, and computes the spill costs, weighting every occurrence in a
+// loop by ten to the power of the loop depth.
+func (c *coloring) build() {
+	live := computeLiveness(c.f)
+	depth := loopDepths(c.f)
+	virtual := make(regSet)
+	for _, b := range c.f.Blocks {
+		now := make(regSet)
+		for r := range live.out[b] {
+			if c.isNode(r) {
+				now[r] = true
+			}
+		}
+		weight := 1.0
+		for n := 0; n < depth[b]; n++ {
+			weight *= 10
+		}
+		for n := len(b.Instrs) - 1; n >= 0; n-- {
+			in := b.Instrs[n]
+			uses, defs := c.nodes(in.Uses()), c.nodes(in.Defs())
+			for _, r := range append(append([]Reg(nil), uses...), defs...) {
+				if r.IsVirtual() {
+					virtual[r] = true
+					c.cost[r] += weight
+				}
+			}
+			if in.IsMove() && c.isNode(in.Args[0].Reg) && c.isNode(in.Args[1].Reg) {
+				for _, r := range uses {
+					delete(now, r)
+				}
+				for _, r := range append(uses, defs...) {
+					c.moveList[r] = append(c.moveList[r], in)
+				}
+				c.worklistMoves[in] = true
+			}
+			for _, d := range defs {
+				now[d] = true
+			}
+			for _, d := range defs {
+				for _, l := range sortedRegs(now) {
+					c.addEdge(l, d)
+				}
+			}
+			for _, d := range defs {
+				delete(now, d)
+			}
+			for _, u := range uses {
+				now[u] = true
+			}
+		}
+	}
+	c.initial = sortedRegs(virtual)
+}
+
+// loopDepths estimates the loop nesting depth of every block from the
+// layout: a jump to a block at or before the jumping block closes a loop
+// containing the blocks in between.
+func loopDepths(f *Func) map[*Block]int {
+	index := make(map[*Block]int)
+	for n, b := range f.Blocks {
+		index[b] = n
+	}
+	depth := make(map[*Block]int)
+	for n, b := range f.Blocks {
+		for _, s := range b.Succs {
+			if index[s] <= n {
+				for _, inner := range f.Blocks[index[s] : n+1] {
+					depth[inner]++
+				}
+			}
+		}
+	}
+	return depth
+}
+
+// addEdge adds an interference edge between two nodes.
+func (c *coloring) addEdge(u, v Reg) {
+	if u == v || c.adjSet[[2]Reg{u, v}] {
+		return
+	}
+	c.adjSet[[2]Reg{u, v}] = true
+	c.adjSet[[2]Reg{v, u}] = true
+	if !c.precolored[u] {
+		c.adjList[u] = append(c.adjList[u], v)
+		c.degree[u]++
+	}
+	if !c.precolored[v] {
+		c.adjList[v] = append(c.adjList[v], u)
+		c.degree[v]++
+	}
+}
+
+// makeWorklist sorts the virtual registers into the initial worklists.
+func (c *coloring) makeWorklist() {
+	for _, n := range c.initial {
+		switch {
+		case c.degree[n] >= c.k:
+			c.spillWorklist[n] = true
+		case c.moveRelated(n):
+			c.freezeWorklist[n] = true
+		default:
+			c.simplifyWorklist[n] = true
+		}
+	}
+}
+
+// adjacent returns the neighbours of a node still in the graph.
+func (c *coloring) adjacent(n Reg) []Reg {
+	var adj []Reg
+	for _, m := range c.adjList[n] {
+		if !c.onStack[m] && !c.coalescedNodes[m] {
+			adj = append(adj, m)
+		}
+	}
+	return adj
+}
+
+// nodeMoves returns the moves of a node that may still be coalesced.
+func (c *coloring) nodeMoves(n Reg) []*Instr {
+	var moves []*Instr
+	for _, m := range c.moveList[n] {
+		if c.activeMoves[m] || c.worklistMoves[m] {
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// moveRelated returns true if the node is an operand of a move that may
+// still be coalesced.
+func (c *coloring) moveRelated(n Reg) bool {
+	return len(c.nodeMoves(n)) > 0
+}
+
+// first returns the lowest register of a non-empty set, so that the choices
+// of the allocator are deterministic.
+func first(set regSet) Reg {
+	return sortedRegs(set)[0]
+}
+
+// firstMove returns the first move of the set in the order of the function.
+func (c *coloring) firstMove(set map[*Instr]bool) *Instr {
+	for _, b := range c.f.Blocks {
+		for _, in := range b.Instrs {
+			if set[in] {
+				return in
+			}
+		}
+	}
+	return nil
+}
+
+// simplify removes a node of low degree from the graph.
+func (c *coloring) simplify() {
+	n := first(c.simplifyWorklist)
+	delete(c.simplifyWorklist, n)
+	c.selectStack = append(c.selectStack, n)
+	c.onStack[n] = true
+	for _, m := range c.adjacent(n) {
+		c.decrementDegree(m)
+	}
+}
+
+// decrementDegree lowers the degree of a node whose neighbour left the
+// graph, moving it out of the spill worklist once its degree drops below
+// the number of colors.
+func (c *coloring) decrementDegree(m Reg) {
+	if c.precolored[m] {
+		return
+	}
+	d := c.degree[m]
+	c.degree[m] = d - 1
+	if d == c.k {
+		c.enableMoves(append([]Reg{m}, c.adjacent(m)...))
+		delete(c.spillWorklist, m)
+		if c.moveRelated(m) {
+			c.freezeWorklist[m] = true
+		} else {
+			c.simplifyWorklist[m] = true
+		}
+	}
+}
+
+// enableMoves makes the moves of the nodes candidates for coalescing again.
+func (c *coloring) enableMoves(nodes []Reg) {
+	for _, n := range nodes {
+		for _, m := range c.nodeMoves(n) {
+			if c.activeMoves[m] {
+				delete(c.activeMoves, m)
+				c.worklistMoves[m] = true
+			}
+		}
+	}
+}
+
+// coalesce considers a move for coalescing.
+func (c *coloring) coalesce() {
+	m := c.firstMove(c.worklistMoves)
+	delete(c.worklistMoves, m)
+	x, y := c.getAlias(m.Args[0].Reg), c.getAlias(m.Args[1].Reg)
+	u, v := x, y
+	if c.precolored[y] {
+		u, v = y, x
+	}
+
+	switch {
+	case u == v:
+		c.coalescedMoves[m] = true
+		c.addWorkList(u)
+	case c.precolored[v] || c.adjSet[[2]Reg{u, v}]:
+		c.constrainedMoves[m] = true
+		c.addWorkList(u)
+		c.addWorkList(v)
+	case c.precolored[u] && c.allOK(c.adjacent(v), u) ||
+		!c.precolored[u] && c.conservative(append(c.adjacent(u), c.adjacent(v)...)):
+		c.coalescedMoves[m] = true
+		c.combine(u, v)
+		c.addWorkList(u)
+	default:
+		c.activeMoves[m] = true
+	}
+}
+
+// addWorkList moves a node that is no longer move related and has a low
+// degree to the simplify worklist.
+func (c *coloring) addWorkList(u Reg) {
+	if !c.precolored[u] && !c.moveRelated(u) && c.degree[u] < c.k {
+		delete(c.freezeWorklist, u)
+		c.simplifyWorklist[u] = true
+	}
+}
+
+// allOK is George's test: coalescing v into the physical register r is safe
+// if every neighbour of v has a low degree, is precolored, or already
+// interferes with r.
+func (c *coloring) allOK(nodes []Reg, r Reg) bool {
+	for _, t := range nodes {
+		if !(c.degree[t] < c.k || c.precolored[t] || c.adjSet[[2]Reg{t, r}]) {
+			return false
+		}
+	}
+	return true
+}
+
+// conservative is Briggs' test: coalescing is safe if the combined node has
+// fewer than k neighbours of high degree.
+func (c *coloring) conservative(nodes []Reg) bool {
+	seen := make(regSet)
+	high := 0
+	for _, n := range nodes {
+		if !seen[n] {
+			seen[n] = true
+			if c.degree[n] >= c.k {
+				high++
+			}
+		}
+	}
+	return high < c.k
+}
+
+// getAlias returns the node a node was coalesced into.
+func (c *coloring) getAlias(n Reg) Reg {
+	for c.coalescedNodes[n] {
+		n = c.alias[n]
+	}
+	return n
+}
+
+// combine merges the node v into the node u.
+func (c *coloring) combine(u, v Reg) {
+	if c.freezeWorklist[v] {
+		delete(c.freezeWorklist, v)
+	} else {
+		delete(c.spillWorklist, v)
+	}
+	c.coalescedNodes[v] = true
+	c.alias[v] = u
+	c.moveList[u] = append(c.moveList[u], c.moveList[v]...)
+	c.enableMoves([]Reg{v})
+	for _, t := range c.adjacent(v) {
+		c.addEdge(t, u)
+		c.decrementDegree(t)
+	}
+	if c.degree[u] >= c.k && c.freezeWorklist[u] {
+		delete(c.freezeWorklist, u)
+		c.spillWorklist[u] = true
+	}
+}
+
+// freeze gives up coalescing the moves of a low-degree node so that it can
+// be simplified.
+func (c *coloring) freeze() {
+	u := first(c.freezeWorklist)
+	delete(c.freezeWorklist, u)
+	c.simplifyWorklist[u] = true
+	c.freezeMoves(u)
+}
+
+// freezeMoves freezes the moves of a node.
+func (c *coloring) freezeMoves(u Reg) {
+	for _, m := range c.nodeMoves(u) {
+		x, y := m.Args[0].Reg, m.Args[1].Reg
+		var v Reg
+		if c.getAlias(y) == c.getAlias(u) {
+			v = c.getAlias(x)
+		} else {
+			v = c.getAlias(y)
+		}
+		delete(c.activeMoves, m)
+		c.frozenMoves[m] = true
+		if c.freezeWorklist[v] && !c.moveRelated(v) && c.degree[v] < c.k {
+			delete(c.freezeWorklist, v)
+			c.simplifyWorklist[v] = true
+		}
+	}
+}
+
+// selectSpill picks the high-degree node with the lowest spill cost per
+// interference as a spill candidate and removes it from the graph. The
+// temporaries of earlier spill code are only picked if nothing else is left.
+func (c *coloring) selectSpill() {
+	var best Reg = NoReg
+	var bestCost float64
+	for _, n := range sortedRegs(c.spillWorklist) {
+		cost := c.cost[n] / float64(c.degree[n])
+		if c.noSpill[n] {
+			cost += 1e18
+		}
+		if best == NoReg || cost < bestCost {
+			best, bestCost = n, cost
+		}
+	}
+	delete(c.spillWorklist, best)
+	c.simplifyWorklist[best] = true
+	c.freezeMoves(best)
+}
+
+// assignColors pops the nodes from the select stack and gives each a
+// register none of its colored neighbours has, preferring caller-saved
+// registers. Nodes without a free register are marked for spilling.
+func (c *coloring) assignColors() {
+	for len(c.selectStack) > 0 {
+		n := c.selectStack[len(c.selectStack)-1]
+		c.selectStack = c.selectStack[:len(c.selectStack)-1]
+		delete(c.onStack, n)
+
+		used := make(regSet)
+		for _, w := range c.adjList[n] {
+			a := c.getAlias(w)
+			if c.coloredNodes[a] || c.precolored[a] {
+				used[c.color[a]] = true
+			}
+		}
+		c.spilledNodes[n] = true
+		for _, r := range c.f.Target.Registers().Allocatable {
+			if !used[r] {
+				delete(c.spilledNodes, n)
+				c.coloredNodes[n] = true
+				c.color[n] = r
+				break
+			}
+		}
+	}
+	for _, n := range sortedRegs(c.coalescedNodes) {
+		c.color[n] = c.color[c.getAlias(n)]
+	}
+}
+
+// rewriteSpills gives every spilled register a stack slot, and replaces each
+// of its occurrences with a new temporary that is loaded from the slot before
+// the instruction or stored to it afterwards.
+func (c *coloring) rewriteSpills(noSpill regSet) {
+	slots := make(map[Reg]Operand)
+	for _, v := range sortedRegs(c.spilledNodes) {
+		slots[v] = c.f.AllocSlot()
+	}
+	for _, b := range c.f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			var after []*Instr
+			temps := make(map[Reg]Reg)
+			loaded := make(map[Reg]bool)
+			for n, a := range in.Args {
+				slot, ok := slots[a.Reg]
+				if a.Kind != RegOperand || !ok {
+					continue
+				}
+				t, ok := temps[a.Reg]
+				if !ok {
+					t = c.f.NewVirtual()
+					noSpill[t] = true
+					temps[a.Reg] = t
+				}
+				if (n > 0 || in.readsDest()) && !loaded[a.Reg] {
+					out = append(out, c.f.Target.Load(t, slot)...)
+					loaded[a.Reg] = true
+				}
+				if n == 0 && in.writesDest() {
+					after = append(after, c.f.Target.Store(slot, t)...)
+				}
+				in.Args[n].Reg = t
+			}
+			out = append(out, in)
+			out = append(out, after...)
+		}
+		b.Instrs = out
+	}
+}
+
+// rewriteColors replaces the virtual registers with their colors and removes
+// the moves that coalescing made redundant.
+func (c *coloring) rewriteColors() {
+	for _, b := range c.f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			for n, a := range in.Args {
+				if (a.Kind == RegOperand || a.Kind == MemOperand) && a.Reg.IsVirtual() {
+					in.Args[n].Reg = c.color[a.Reg]
+				}
+			}
+			if in.IsMove() && in.Args[0].Reg == in.Args[1].Reg {
+				continue
+			}
+			out = append(out, in)
+		}
+		b.Instrs = out
+	}
+}
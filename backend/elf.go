@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+)
+
+// The layout of the executables: the code and read-only data are loaded at
+// textAddress, the writable data at the next page after them.
+const (
+	baseAddress = 0x400000
+	pageSize    = 0x1000
+	textOffset  = pageSize
+	textAddress = baseAddress + textOffset
+)
+
+// stringTable builds an ELF string table.
+type stringTable struct {
+	buf     bytes.Buffer
+	offsets map[string]uint32
+}
+
+// newStringTable creates a string table holding the empty string.
+func newStringTable() *stringTable {
+	t := &stringTable{offsets: make(map[string]uint32)}
+	t.add("")
+	return t
+}
+
+// add adds a string to the table and returns its offset.
+func (t *stringTable) add(s string) uint32 {
+	if off, ok := t.offsets[s]; ok {
+		return off
+	}
+	off := uint32(t.buf.Len())
+	t.buf.WriteString(s)
+	t.buf.WriteByte(0)
+	t.offsets[s] = off
+	return off
+}
+
+// align pads the buffer with zeros to a multiple of n bytes.
+func align(buf *bytes.Buffer, n int) {
+	for buf.Len()%n != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// writeObject returns a relocatable ELF64 object file holding the code. The
+// jumps and calls within the code are already resolved; the references to
+// data become R_X86_64_PC32 relocations against the data symbols.
+func writeObject(obj *objectCode) ([]byte, error) {
+	shstrtab := newStringTable()
+	strtab := newStringTable()
+
+	// The section indices.
+	const (
+		shText = iota + 1
+		shData
+		shRodata
+		shSymtab
+		shStrtab
+		shRelaText
+		shShstrtab
+		shCount
+	)
+	sectionIndex := map[string]elf.SectionIndex{sectionText: shText, sectionData: shData, sectionRodata: shRodata}
+
+	// Local symbols must come before global ones.
+	syms := []elf.Sym64{{}}
+	symIndex := make(map[string]uint32)
+	for _, global := range []bool{false, true} {
+		for _, s := range obj.symbols {
+			if s.global != global {
+				continue
+			}
+			bind, typ := elf.STB_LOCAL, elf.STT_OBJECT
+			if s.global {
+				bind = elf.STB_GLOBAL
+			}
+			if s.code {
+				typ = elf.STT_FUNC
+			}
+			symIndex[s.name] = uint32(len(syms))
+			syms = append(syms, elf.Sym64{
+				Name:  strtab.add(s.name),
+				Info:  elf.ST_INFO(bind, typ),
+				Shndx: uint16(sectionIndex[s.section]),
+				Value: uint64(s.offset),
+				Size:  uint64(s.size),
+			})
+		}
+	}
+	firstGlobal := len(syms)
+	for n, s := range syms {
+		if elf.ST_BIND(s.Info) == elf.STB_GLOBAL {
+			firstGlobal = n
+			break
+		}
+	}
+
+	var relas []elf.Rela64
+	for _, r := range obj.relocs {
+		idx, ok := symIndex[r.symbol]
+		if !ok {
+			return nil, fmt.Errorf("undefined symbol %s", r.symbol)
+		}
+		relas = append(relas, elf.Rela64{
+			Off:    uint64(r.offset),
+			Info:   elf.R_INFO(idx, uint32(elf.R_X86_64_PC32)),
+			Addend: r.addend,
+		})
+	}
+
+	// Lay out the file: the header, the section contents, then the
+	// section header table.
+	var buf bytes.Buffer
+	buf.Write(make([]byte, binary.Size(elf.Header64{})))
+	headers := make([]elf.Section64, shCount)
+	section := func(idx int, name string, typ elf.SectionType, flags elf.SectionFlag, alignment int, data []byte) {
+		align(&buf, alignment)
+		headers[idx] = elf.Section64{
+			Name:      shstrtab.add(name),
+			Type:      uint32(typ),
+			Flags:     uint64(flags),
+			Off:       uint64(buf.Len()),
+			Size:      uint64(len(data)),
+			Addralign: uint64(alignment),
+		}
+		buf.Write(data)
+	}
+	encode := func(v interface{}) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, v)
+		return b.Bytes()
+	}
+
+	section(shText, sectionText, elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR, 16, obj.text)
+	section(shData, sectionData, elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE, 8, obj.data)
+	section(shRodata, sectionRodata, elf.SHT_PROGBITS, elf.SHF_ALLOC, 1, obj.rodata)
+	section(shSymtab, ".symtab", elf.SHT_SYMTAB, 0, 8, encode(syms))
+	headers[shSymtab].Link = shStrtab
+	headers[shSymtab].Info = uint32(firstGlobal)
+	headers[shSymtab].Entsize = uint64(binary.Size(elf.Sym64{}))
+	section(shStrtab, ".strtab", elf.SHT_STRTAB, 0, 1, strtab.buf.Bytes())
+	section(shRelaText, ".rela.text", elf.SHT_RELA, elf.SHF_INFO_LINK, 8, encode(relas))
+	headers[shRelaText].Link = shSymtab
+	headers[shRelaText].Info = shText
+	headers[shRelaText].Entsize = uint64(binary.Size(elf.Rela64{}))
+	shstrtab.add(".shstrtab")
+	section(shShstrtab, ".shstrtab", elf.SHT_STRTAB, 0, 1, shstrtab.buf.Bytes())
+
+	align(&buf, 8)
+	shoff := buf.Len()
+	buf.Write(encode(headers))
+
+	hdr := header(elf.ET_REL)
+	hdr.Shoff = uint64(shoff)
+	hdr.Shentsize = uint16(binary.Size(elf.Section64{}))
+	hdr.Shnum = shCount
+	hdr.Shstrndx = shShstrtab
+	out := buf.Bytes()
+	copy(out, encode(hdr))
+	return out, nil
+}
+
+// writeExecutable returns a statically linked ELF64 executable holding the
+// code. The code and the read-only data share a read-only executable
+// segment, and the writable data gets a segment of its own.
+func writeExecutable(obj *objectCode) ([]byte, error) {
+	rodataOffset := textOffset + (len(obj.text)+15)&^15
+	dataOffset := (rodataOffset + len(obj.rodata) + pageSize - 1) &^ (pageSize - 1)
+	sectionAddress := map[string]int{
+		sectionText:   textAddress,
+		sectionRodata: baseAddress + rodataOffset,
+		sectionData:   baseAddress + dataOffset,
+	}
+	address := func(name string) (int, error) {
+		s := obj.symbol(name)
+		if s == nil {
+			return 0, fmt.Errorf("undefined symbol %s", name)
+		}
+		return sectionAddress[s.section] + s.offset, nil
+	}
+
+	text := append([]byte(nil), obj.text...)
+	for _, r := range obj.relocs {
+		target, err := address(r.symbol)
+		if err != nil {
+			return nil, err
+		}
+		place := textAddress + r.offset
+		binary.LittleEndian.PutUint32(text[r.offset:], uint32(int32(int64(target)+r.addend-int64(place))))
+	}
+	entry, err := address(startSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	hdr := header(elf.ET_EXEC)
+	hdr.Entry = uint64(entry)
+	hdr.Phoff = uint64(binary.Size(elf.Header64{}))
+	hdr.Phentsize = uint16(binary.Size(elf.Prog64{}))
+	hdr.Phnum = 2
+	binary.Write(&buf, binary.LittleEndian, hdr)
+
+	code := elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_X),
+		Off:    textOffset,
+		Vaddr:  textAddress,
+		Paddr:  textAddress,
+		Filesz: uint64(rodataOffset + len(obj.rodata) - textOffset),
+		Memsz:  uint64(rodataOffset + len(obj.rodata) - textOffset),
+		Align:  pageSize,
+	}
+	data := elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_W),
+		Off:    uint64(dataOffset),
+		Vaddr:  uint64(baseAddress + dataOffset),
+		Paddr:  uint64(baseAddress + dataOffset),
+		Filesz: uint64(len(obj.data)),
+		Memsz:  uint64(len(obj.data)),
+		Align:  pageSize,
+	}
+	binary.Write(&buf, binary.LittleEndian, []elf.Prog64{code, data})
+
+	buf.Write(make([]byte, textOffset-buf.Len()))
+	buf.Write(text)
+	buf.Write(make([]byte, rodataOffset-buf.Len()))
+	buf.Write(obj.rodata)
+	buf.Write(make([]byte, dataOffset-buf.Len()))
+	buf.Write(obj.data)
+	return buf.Bytes(), nil
+}
+
+// header returns an ELF64 header for x86-64 Linux of the file type.
+func header(typ elf.Type) elf.Header64 {
+	var h elf.Header64
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	h.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+	h.Type = uint16(typ)
+	h.Machine = uint16(elf.EM_X86_64)
+	h.Version = uint32(elf.EV_CURRENT)
+	h.Ehsize = uint16(binary.Size(elf.Header64{}))
+	return h
+}
@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// elfPrograms are programs exercising the code the encoder emits: calls,
+// branches, division, globals in the data section and the strings of the
+// runtime in the read-only data section.
+var elfPrograms = []struct {
+	name   string
+	source string
+	want   string
+}{
+	{"arithmetic", `puts(1 + 2 * 3 - 4 / 2); puts(0 - 42); puts(9223372036854775807 + 1);`, "5\n-42\n-9223372036854775808\n"},
+	{"booleans", `puts(1 < 2); puts(!(1 < 2)); puts(3 == 3);`, "true\nfalse\ntrue\n"},
+	{"functions", `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let div = fn(a, b) { a / b };
+puts(fib(20));
+puts(div(100, 7));
+puts(div(0 - 100, 7));
+`, "6765\n14\n-14\n"},
+	{"globals", `
+let base = 40;
+let flag = true;
+let get = fn(x) { if (flag) { base + x } else { 0 } };
+puts(get(2));
+`, "42\n"},
+}
+
+func TestExecutable(t *testing.T) {
+	for _, tt := range elfPrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, level := range []int{0, 2} {
+				if got := run(t, lower(t, tt.source, level), Options{}); got != tt.want {
+					t.Errorf("-O%d: got %q, want %q", level, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestObject links the object files with the system linker and runs the
+// executables it makes.
+func TestObject(t *testing.T) {
+	native(t)
+	ld, err := exec.LookPath("ld")
+	if err != nil {
+		t.Skip("no linker")
+	}
+	for _, tt := range elfPrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			obj, exe := filepath.Join(dir, "a.o"), filepath.Join(dir, "a.out")
+			if err := GenerateCode(lower(t, tt.source, 1), obj, Options{Emit: EmitObj}); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(ld, "-o", exe, obj).CombinedOutput(); err != nil {
+				t.Fatalf("ld: %s\n%s", err, out)
+			}
+			out, err := exec.Command(exe).Output()
+			if err != nil {
+				t.Fatalf("%s: %s", exe, err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+// TestDivisionByZero checks that the executable traps on a division by zero
+// after writing what it printed before.
+func TestDivisionByZero(t *testing.T) {
+	native(t)
+	module := lower(t, `let div = fn(a, b) { a / b }; puts(1); puts(div(1, 0));`, 0)
+	exe := filepath.Join(t.TempDir(), "a.out")
+	if err := GenerateCode(module, exe, Options{Emit: EmitExe}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(exe).Output()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("got error %v, want a failed exit", err)
+	}
+	if string(out) != "1\n" {
+		t.Errorf("got %q, want %q", out, "1\n")
+	}
+}
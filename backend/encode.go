@@ -0,0 +1,379 @@
+package backend
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Sections of the generated code.
+const (
+	sectionText   = ".text"
+	sectionData   = ".data"
+	sectionRodata = ".rodata"
+)
+
+// symbol represents a symbol defined by the generated code.
+type symbol struct {
+	name    string
+	section string // The section the symbol is defined in.
+	offset  int    // The offset of the symbol in its section.
+	size    int    // The size of the function or data.
+	global  bool   // Whether the symbol is visible to the linker outside the object.
+	code    bool   // Whether the symbol is a function rather than data.
+}
+
+// reloc represents a reference from the code to a data symbol that the
+// linker resolves: the 32-bit field at offset must hold the address of the
+// symbol plus the addend, relative to the field.
+type reloc struct {
+	offset int
+	symbol string
+	addend int64
+}
+
+// fixup represents a 32-bit relative jump or call to a label in the code,
+// resolved once all labels are placed.
+type fixup struct {
+	offset int
+	label  string
+}
+
+// objectCode represents a program encoded into machine code.
+type objectCode struct {
+	text    []byte
+	data    []byte
+	rodata  []byte
+	symbols []symbol
+	relocs  []reloc // The relocations of the text section.
+}
+
+// symbol returns the symbol with the name, or nil if there is none.
+func (o *objectCode) symbol(name string) *symbol {
+	for n := range o.symbols {
+		if o.symbols[n].name == name {
+			return &o.symbols[n]
+		}
+	}
+	return nil
+}
+
+// conditionCodes maps the suffixes of conditional jumps and set
+// instructions to their condition codes.
+var conditionCodes = map[string]byte{
+	"o": 0x0, "no": 0x1, "b": 0x2, "ae": 0x3, "e": 0x4, "ne": 0x5, "be": 0x6, "a": 0x7,
+	"s": 0x8, "ns": 0x9, "p": 0xa, "np": 0xb, "l": 0xc, "ge": 0xd, "le": 0xe, "g": 0xf,
+}
+
+// arithmetic maps the two-operand arithmetic instructions to the opcode of
+// their r/m, reg form and the opcode extension of their immediate form.
+var arithmetic = map[string]struct {
+	op    byte
+	digit int
+}{
+	"add": {0x01, 0}, "or": {0x09, 1}, "and": {0x21, 4}, "sub": {0x29, 5}, "xor": {0x31, 6}, "cmp": {0x39, 7},
+}
+
+// encoder encodes machine instructions into x86-64 machine code.
+type encoder struct {
+	code   []byte
+	labels map[string]int // The offsets of the labels placed so far.
+	fixups []fixup
+	relocs []reloc
+}
+
+// assemble encodes the program with allocated registers into machine code
+// and lays out its data.
+func assemble(prog *Program) (*objectCode, error) {
+	e := &encoder{labels: make(map[string]int)}
+	obj := &objectCode{}
+	for _, f := range prog.Funcs {
+		start := len(e.code)
+		e.labels[f.Name] = start
+		for _, b := range f.Blocks {
+			e.labels[b.Label] = len(e.code)
+			for _, in := range b.Instrs {
+				if err := e.encode(in); err != nil {
+					return nil, fmt.Errorf("%s: %s: %s", f.Name, in, err)
+				}
+			}
+		}
+		obj.symbols = append(obj.symbols, symbol{
+			name: f.Name, section: sectionText, offset: start, size: len(e.code) - start,
+			global: f.Name == startSymbol, code: true,
+		})
+		// Align functions to 16 bytes with nops.
+		for len(e.code)%16 != 0 {
+			e.code = append(e.code, 0x90)
+		}
+	}
+	for _, fx := range e.fixups {
+		target, ok := e.labels[fx.label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %s", fx.label)
+		}
+		binary.LittleEndian.PutUint32(e.code[fx.offset:], uint32(int32(target-(fx.offset+4))))
+	}
+	obj.text = e.code
+	obj.relocs = e.relocs
+
+	for _, sym := range prog.Data {
+		obj.symbols = append(obj.symbols, symbol{name: sym, section: sectionData, offset: len(obj.data), size: 8})
+		obj.data = append(obj.data, make([]byte, 8)...)
+	}
+	syms := make([]string, 0, len(prog.Rodata))
+	for sym := range prog.Rodata {
+		syms = append(syms, sym)
+	}
+	sort.Strings(syms)
+	for _, sym := range syms {
+		s := prog.Rodata[sym]
+		obj.symbols = append(obj.symbols, symbol{name: sym, section: sectionRodata, offset: len(obj.rodata), size: len(s)})
+		obj.rodata = append(obj.rodata, s...)
+	}
+	for _, r := range obj.relocs {
+		if s := obj.symbol(r.symbol); s == nil || s.code {
+			return nil, fmt.Errorf("undefined data symbol %s", r.symbol)
+		}
+	}
+	return obj, nil
+}
+
+// emit appends bytes to the code.
+func (e *encoder) emit(b ...byte) {
+	e.code = append(e.code, b...)
+}
+
+// emit32 appends a 32-bit little-endian value to the code.
+func (e *encoder) emit32(v int64) {
+	e.code = binary.LittleEndian.AppendUint32(e.code, uint32(int32(v)))
+}
+
+// modRM emits an instruction with a ModRM byte: the optional REX prefix, the
+// opcode, and the encoding of rm, which is a register or memory operand,
+// with reg in the reg field. reg is either a register or an opcode
+// extension. byteOps makes the prefix select the low byte registers spl,
+// bpl, sil and dil rather than ah, ch, dh and bh. immSize is the size of an
+// immediate following the operand, which RIP-relative displacements are
+// relative to.
+func (e *encoder) modRM(w bool, opcode []byte, reg int, rm Operand, byteOps bool, immSize int) {
+	var rex byte
+	if w {
+		rex |= 0x48
+	}
+	if reg >= 8 {
+		rex |= 0x44
+	}
+	if rm.Reg != NoReg && rm.Reg >= 8 {
+		rex |= 0x41
+	}
+	if byteOps && (reg >= 4 && reg < 8 || rm.Kind == RegOperand && rm.Reg >= 4 && rm.Reg < 8) {
+		rex |= 0x40
+	}
+	if rex != 0 {
+		e.emit(rex)
+	}
+	e.emit(opcode...)
+
+	r := byte(reg&7) << 3
+	switch {
+	case rm.Kind == RegOperand:
+		e.emit(0xc0 | r | byte(rm.Reg&7))
+	case rm.Reg == NoReg:
+		// RIP-relative addressing of a data symbol.
+		e.emit(0x05 | r)
+		e.relocs = append(e.relocs, reloc{offset: len(e.code), symbol: rm.Sym, addend: -4 - int64(immSize)})
+		e.emit32(0)
+	default:
+		base := byte(rm.Reg & 7)
+		var mod byte
+		switch {
+		case rm.Imm == 0 && base != 5:
+			mod = 0x00
+		case rm.Imm >= -128 && rm.Imm < 128:
+			mod = 0x40
+		default:
+			mod = 0x80
+		}
+		e.emit(mod | r | base)
+		if base == 4 {
+			// rsp and r12 as a base need a SIB byte.
+			e.emit(0x24)
+		}
+		switch mod {
+		case 0x40:
+			e.emit(byte(int8(rm.Imm)))
+		case 0x80:
+			e.emit32(rm.Imm)
+		}
+	}
+}
+
+// jump emits a jump or call with a 32-bit displacement to a label.
+func (e *encoder) jump(opcode []byte, label string) {
+	e.emit(opcode...)
+	e.fixups = append(e.fixups, fixup{offset: len(e.code), label: label})
+	e.emit32(0)
+}
+
+// encode encodes an instruction.
+func (e *encoder) encode(in *Instr) error {
+	var a, b Operand
+	if len(in.Args) > 0 {
+		a = in.Args[0]
+	}
+	if len(in.Args) > 1 {
+		b = in.Args[1]
+	}
+	for _, arg := range in.Args {
+		if arg.Kind != LabelOperand && arg.Reg.IsVirtual() {
+			return fmt.Errorf("virtual register %s", arg.Reg)
+		}
+	}
+
+	switch op := in.Op; {
+	case op == "mov":
+		return e.encodeMov(a, b)
+
+	case op == "movzx" && a.Kind == RegOperand && b.Byte:
+		e.modRM(true, []byte{0x0f, 0xb6}, int(a.Reg), b, true, 0)
+
+	case op == "lea" && a.Kind == RegOperand && b.Kind == MemOperand:
+		e.modRM(true, []byte{0x8d}, int(a.Reg), b, false, 0)
+
+	case arithmetic[op].op != 0:
+		ar := arithmetic[op]
+		switch {
+		case b.Kind == ImmOperand && fitsInt8(b.Imm):
+			e.modRM(true, []byte{0x83}, ar.digit, a, false, 1)
+			e.emit(byte(int8(b.Imm)))
+		case b.Kind == ImmOperand && fitsImm32(b.Imm):
+			e.modRM(true, []byte{0x81}, ar.digit, a, false, 4)
+			e.emit32(b.Imm)
+		case b.Kind == RegOperand:
+			e.modRM(true, []byte{ar.op}, int(b.Reg), a, false, 0)
+		case a.Kind == RegOperand && b.Kind == MemOperand:
+			e.modRM(true, []byte{ar.op + 2}, int(a.Reg), b, false, 0)
+		default:
+			return fmt.Errorf("unsupported operands")
+		}
+
+	case op == "imul" && a.Kind == RegOperand:
+		switch {
+		case b.Kind == ImmOperand && fitsInt8(b.Imm):
+			e.modRM(true, []byte{0x6b}, int(a.Reg), a, false, 1)
+			e.emit(byte(int8(b.Imm)))
+		case b.Kind == ImmOperand && fitsImm32(b.Imm):
+			e.modRM(true, []byte{0x69}, int(a.Reg), a, false, 4)
+			e.emit32(b.Imm)
+		case b.Kind == RegOperand || b.Kind == MemOperand:
+			e.modRM(true, []byte{0x0f, 0xaf}, int(a.Reg), b, false, 0)
+		default:
+			return fmt.Errorf("unsupported operands")
+		}
+
+	case op == "neg" || op == "div" || op == "idiv":
+		digit := map[string]int{"neg": 3, "div": 6, "idiv": 7}[op]
+		e.modRM(true, []byte{0xf7}, digit, a, false, 0)
+
+	case op == "test" && b.Kind == RegOperand:
+		e.modRM(true, []byte{0x85}, int(b.Reg), a, false, 0)
+
+	case len(op) > 3 && op[:3] == "set":
+		cc, ok := conditionCodes[op[3:]]
+		if !ok {
+			return fmt.Errorf("unknown condition")
+		}
+		e.modRM(false, []byte{0x0f, 0x90 + cc}, 0, a, true, 0)
+
+	case op == "push":
+		switch a.Kind {
+		case RegOperand:
+			if a.Reg >= 8 {
+				e.emit(0x41)
+			}
+			e.emit(0x50 + byte(a.Reg&7))
+		case ImmOperand:
+			if fitsInt8(a.Imm) {
+				e.emit(0x6a, byte(int8(a.Imm)))
+			} else {
+				e.emit(0x68)
+				e.emit32(a.Imm)
+			}
+		case MemOperand:
+			e.modRM(false, []byte{0xff}, 6, a, false, 0)
+		}
+
+	case op == "pop" && a.Kind == RegOperand:
+		if a.Reg >= 8 {
+			e.emit(0x41)
+		}
+		e.emit(0x58 + byte(a.Reg&7))
+
+	case op == "cqo":
+		e.emit(0x48, 0x99)
+
+	case op == "ret":
+		e.emit(0xc3)
+
+	case op == "syscall":
+		e.emit(0x0f, 0x05)
+
+	case op == "call" && a.Kind == LabelOperand:
+		e.jump([]byte{0xe8}, a.Sym)
+
+	case op == "jmp" && a.Kind == LabelOperand:
+		e.jump([]byte{0xe9}, a.Sym)
+
+	case op[0] == 'j' && a.Kind == LabelOperand:
+		cc, ok := conditionCodes[op[1:]]
+		if !ok {
+			return fmt.Errorf("unknown condition")
+		}
+		e.jump([]byte{0x0f, 0x80 + cc}, a.Sym)
+
+	default:
+		return fmt.Errorf("cannot encode instruction")
+	}
+	return nil
+}
+
+// encodeMov encodes the forms of mov.
+func (e *encoder) encodeMov(a, b Operand) error {
+	switch {
+	case a.Kind == RegOperand && b.Kind == RegOperand:
+		e.modRM(true, []byte{0x89}, int(b.Reg), a, false, 0)
+	case a.Kind == RegOperand && b.Kind == ImmOperand && fitsImm32(b.Imm):
+		e.modRM(true, []byte{0xc7}, 0, a, false, 4)
+		e.emit32(b.Imm)
+	case a.Kind == RegOperand && b.Kind == ImmOperand:
+		// The only instruction taking a 64-bit immediate.
+		rex := byte(0x48)
+		if a.Reg >= 8 {
+			rex |= 0x01
+		}
+		e.emit(rex, 0xb8+byte(a.Reg&7))
+		e.code = binary.LittleEndian.AppendUint64(e.code, uint64(b.Imm))
+	case a.Kind == RegOperand && b.Kind == MemOperand:
+		e.modRM(true, []byte{0x8b}, int(a.Reg), b, false, 0)
+	case a.Kind == MemOperand && b.Kind == RegOperand && a.Byte:
+		e.modRM(false, []byte{0x88}, int(b.Reg), a, true, 0)
+	case a.Kind == MemOperand && b.Kind == RegOperand:
+		e.modRM(true, []byte{0x89}, int(b.Reg), a, false, 0)
+	case a.Kind == MemOperand && b.Kind == ImmOperand && a.Byte:
+		e.modRM(false, []byte{0xc6}, 0, a, false, 1)
+		e.emit(byte(b.Imm))
+	case a.Kind == MemOperand && b.Kind == ImmOperand && fitsImm32(b.Imm):
+		e.modRM(true, []byte{0xc7}, 0, a, false, 4)
+		e.emit32(b.Imm)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+// fitsInt8 returns true if v can be encoded as a sign-extended 8-bit
+// immediate or displacement.
+func fitsInt8(v int64) bool {
+	return v >= -128 && v < 128
+}
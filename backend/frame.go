@@ -0,0 +1,63 @@
+package backend
+
+// insertFrame adds the prologue and epilogues of a function once its
+// registers are allocated: the prologue saves rbp, reserves the stack frame
+// rounded up to keep the stack 16-byte aligned, and saves the callee-saved
+// registers the function uses; an epilogue restores them before every return
+// and tail call.
+func insertFrame(f *Func) {
+	if !f.HasFrame {
+		return
+	}
+	f.SavedRegs = nil
+	used := make(map[Reg]bool)
+	for _, b := range f.Blocks {
+		for _, in := range b.Instrs {
+			for _, r := range in.Defs() {
+				used[r] = true
+			}
+		}
+	}
+	var saves []Operand
+	for _, r := range calleeSaved {
+		if used[r] {
+			f.SavedRegs = append(f.SavedRegs, r)
+			saves = append(saves, f.AllocSlot())
+		}
+	}
+	f.FrameSize = (f.spillOffset + 15) &^ 15
+
+	prologue := []*Instr{
+		x86Instr("push", R(RBP)),
+		x86Instr("mov", R(RBP), R(RSP)),
+	}
+	if f.FrameSize > 0 {
+		prologue = append(prologue, x86Instr("sub", R(RSP), Imm(int64(f.FrameSize))))
+	}
+	for n, r := range f.SavedRegs {
+		prologue = append(prologue, x86Instr("mov", saves[n], R(r)))
+	}
+
+	// The prologue gets a block of its own, so that loops back to the first
+	// block do not run it again.
+	entry := &Block{Label: f.Name + ".entry", Instrs: prologue}
+	if len(f.Blocks) > 0 {
+		entry.Instrs = append(entry.Instrs, x86Instr("jmp", Label(f.Blocks[0].Label)))
+	}
+	f.Blocks = append([]*Block{entry}, f.Blocks...)
+
+	for _, b := range f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			if in.Op == "ret" || in.TailCall {
+				for n, r := range f.SavedRegs {
+					out = append(out, x86Instr("mov", R(r), saves[n]))
+				}
+				out = append(out, x86Instr("mov", R(RSP), R(RBP)), x86Instr("pop", R(RBP)))
+			}
+			out = append(out, in)
+		}
+		b.Instrs = out
+	}
+	linkBlocks(f)
+}
@@ -0,0 +1,353 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// conditions maps the comparison operations to condition code suffixes.
+var conditions = map[intermediate.Op]string{
+	intermediate.OpEq: "e",
+	intermediate.OpNe: "ne",
+	intermediate.OpLt: "l",
+	intermediate.OpGt: "g",
+}
+
+// selector translates a function of the intermediate representation into
+// x86-64 machine instructions operating on virtual registers.
+type selector struct {
+	fn     *intermediate.Function
+	mf     *Func
+	blocks map[*intermediate.Block]*Block
+	vregs  map[*intermediate.Instr]Reg
+	uses   []int                        // The number of uses of every value.
+	fused  map[*intermediate.Instr]bool // The comparisons only used by the branch following them.
+	folded map[*intermediate.Instr]bool // The global loads folded into a memory operand of their user.
+	cur    *Block                       // The block instructions are appended to.
+	edges  int                          // The number of edge blocks created so far.
+}
+
+// selectFunction performs instruction selection for a function.
+func selectFunction(fn *intermediate.Function) *Func {
+	s := &selector{
+		fn:     fn,
+		mf:     &Func{Name: funcSymbol(fn.Name), Target: X86_64{}, Params: len(fn.Params), HasFrame: true},
+		blocks: make(map[*intermediate.Block]*Block),
+		vregs:  make(map[*intermediate.Instr]Reg),
+		uses:   fn.Uses(),
+		fused:  make(map[*intermediate.Instr]bool),
+		folded: make(map[*intermediate.Instr]bool),
+	}
+	for _, b := range fn.Blocks {
+		mb := &Block{Label: fmt.Sprintf("%s.b%d", s.mf.Name, b.ID)}
+		s.blocks[b] = mb
+		s.mf.Blocks = append(s.mf.Blocks, mb)
+	}
+	s.findFusions()
+
+	for _, b := range fn.Blocks {
+		s.cur = s.blocks[b]
+		for _, in := range b.Instrs {
+			s.selectInstr(in)
+		}
+	}
+	linkBlocks(s.mf)
+	return s.mf
+}
+
+// findFusions decides which comparisons are fused into the branch using them
+// and which global loads are folded into the instruction using them.
+func (s *selector) findFusions() {
+	for _, b := range s.fn.Blocks {
+		for n, in := range b.Instrs {
+			if _, ok := conditions[in.Op]; ok && s.uses[in.ID] == 1 && n+1 < len(b.Instrs) {
+				next := b.Instrs[n+1]
+				if next.Op == intermediate.OpBranch && next.Args[0] == in {
+					s.fused[in] = true
+				}
+			}
+			if in.Op != intermediate.OpLoadGlobal || s.uses[in.ID] != 1 {
+				continue
+			}
+			for _, user := range b.Instrs[n+1:] {
+				if user.Op == intermediate.OpStoreGlobal && user.Name == in.Name {
+					break
+				}
+				if len(user.Args) == 2 && user.Args[1] == in && user.Args[0] != in && acceptsMemory(user.Op) {
+					s.folded[in] = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// acceptsMemory returns true if the operation is selected into an
+// instruction that accepts a memory operand as its second operand.
+func acceptsMemory(op intermediate.Op) bool {
+	switch op {
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul,
+		intermediate.OpEq, intermediate.OpNe, intermediate.OpLt, intermediate.OpGt:
+		return true
+	}
+	return false
+}
+
+// emit appends a machine instruction to the current block.
+func (s *selector) emit(op string, args ...Operand) *Instr {
+	i := x86Instr(op, args...)
+	s.cur.Instrs = append(s.cur.Instrs, i)
+	return i
+}
+
+// vreg returns the virtual register holding the value of an instruction.
+func (s *selector) vreg(v *intermediate.Instr) Reg {
+	r, ok := s.vregs[v]
+	if !ok {
+		r = s.mf.NewVirtual()
+		s.vregs[v] = r
+	}
+	return r
+}
+
+// reg returns a register operand holding the value, materializing constants
+// into a new virtual register.
+func (s *selector) reg(v *intermediate.Instr) Operand {
+	if v.Op == intermediate.OpConst {
+		t := s.mf.NewVirtual()
+		s.emit("mov", R(t), Imm(v.Const))
+		return R(t)
+	}
+	return R(s.vreg(v))
+}
+
+// src returns an operand for the value in a position that accepts a register,
+// a memory operand or a 32-bit immediate.
+func (s *selector) src(v *intermediate.Instr) Operand {
+	if v.Op == intermediate.OpConst && fitsImm32(v.Const) {
+		return Imm(v.Const)
+	}
+	if s.folded[v] {
+		return Global(globalSymbol(v.Name))
+	}
+	return s.reg(v)
+}
+
+// movSrc returns an operand for the value as the source of a mov into a
+// register, which accepts 64-bit immediates.
+func (s *selector) movSrc(v *intermediate.Instr) Operand {
+	if v.Op == intermediate.OpConst {
+		return Imm(v.Const)
+	}
+	return s.src(v)
+}
+
+// selectInstr selects the machine instructions for an instruction.
+func (s *selector) selectInstr(in *intermediate.Instr) {
+	switch in.Op {
+	case intermediate.OpConst, intermediate.OpPhi:
+		// Constants are materialized where they are used, and phis are
+		// resolved by copies in the predecessors.
+
+	case intermediate.OpParam:
+		d := R(s.vreg(in))
+		if int(in.Const) < len(argRegs) {
+			s.emit("mov", d, R(argRegs[in.Const]))
+		} else {
+			// Stack arguments are above the return address and saved rbp.
+			s.emit("mov", d, Mem(RBP, 16+8*(in.Const-int64(len(argRegs)))))
+		}
+
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul:
+		op := map[intermediate.Op]string{intermediate.OpAdd: "add", intermediate.OpSub: "sub", intermediate.OpMul: "imul"}[in.Op]
+		d := R(s.vreg(in))
+		s.emit("mov", d, s.movSrc(in.Args[0]))
+		s.emit(op, d, s.src(in.Args[1]))
+
+	case intermediate.OpDiv:
+		// idiv divides rdx:rax by its operand, so the dividend is sign
+		// extended into rdx with cqo first. The divisor cannot be an
+		// immediate.
+		s.emit("mov", R(RAX), s.movSrc(in.Args[0]))
+		cqo := s.emit("cqo")
+		cqo.ImplicitUses = []Reg{RAX}
+		cqo.ImplicitDefs = []Reg{RDX}
+		divisor := s.reg(in.Args[1])
+		idiv := s.emit("idiv", divisor)
+		idiv.ImplicitUses = []Reg{RAX, RDX}
+		idiv.ImplicitDefs = []Reg{RAX, RDX}
+		s.emit("mov", R(s.vreg(in)), R(RAX))
+
+	case intermediate.OpNeg:
+		d := R(s.vreg(in))
+		s.emit("mov", d, s.movSrc(in.Args[0]))
+		s.emit("neg", d)
+
+	case intermediate.OpNot:
+		d := R(s.vreg(in))
+		s.emit("mov", d, s.movSrc(in.Args[0]))
+		s.emit("xor", d, Imm(1))
+
+	case intermediate.OpZext:
+		// Booleans are already 0 or 1 in a full register.
+		s.emit("mov", R(s.vreg(in)), s.movSrc(in.Args[0]))
+
+	case intermediate.OpEq, intermediate.OpNe, intermediate.OpLt, intermediate.OpGt:
+		s.emit("cmp", s.reg(in.Args[0]), s.src(in.Args[1]))
+		if s.fused[in] {
+			return
+		}
+		d := s.vreg(in)
+		s.emit("set"+conditions[in.Op], R8b(d))
+		s.emit("movzx", R(d), R8b(d))
+
+	case intermediate.OpCall:
+		s.selectCall(in)
+
+	case intermediate.OpLoadGlobal:
+		if !s.folded[in] {
+			s.emit("mov", R(s.vreg(in)), Global(globalSymbol(in.Name)))
+		}
+
+	case intermediate.OpStoreGlobal:
+		s.emit("mov", Global(globalSymbol(in.Name)), s.src(in.Args[0]))
+
+	case intermediate.OpJump:
+		s.jumpTo(in.Targets[0])
+
+	case intermediate.OpBranch:
+		cond := in.Args[0]
+		cc := "ne"
+		if s.fused[cond] {
+			cc = conditions[cond.Op]
+		} else {
+			r := s.reg(cond)
+			s.emit("test", r, r)
+		}
+		s.emit("j"+cc, Label(s.edgeTo(in.Targets[0]).Label))
+		s.emit("jmp", Label(s.edgeTo(in.Targets[1]).Label))
+
+	case intermediate.OpReturn:
+		ret := x86Instr("ret")
+		if len(in.Args) > 0 {
+			s.emit("mov", R(RAX), s.movSrc(in.Args[0]))
+			ret.ImplicitUses = []Reg{RAX}
+		}
+		s.cur.Instrs = append(s.cur.Instrs, ret)
+
+	case intermediate.OpTailCall:
+		s.selectTailCall(in)
+	}
+}
+
+// passArguments pushes the arguments on the stack, then pops the first ones
+// into the argument registers, which avoids overwriting an argument register
+// that still holds another argument. It returns the argument registers used
+// and the number of arguments left on the stack.
+func (s *selector) passArguments(args []*intermediate.Instr) ([]Reg, int) {
+	for n := len(args) - 1; n >= 0; n-- {
+		s.emit("push", s.src(args[n]))
+	}
+	var regs []Reg
+	for n := 0; n < len(args) && n < len(argRegs); n++ {
+		s.emit("pop", R(argRegs[n]))
+		regs = append(regs, argRegs[n])
+	}
+	return regs, len(args) - len(regs)
+}
+
+// selectCall selects a call following the System V AMD64 calling convention.
+// Calls of puts go to the runtime routine printing the type of the argument.
+func (s *selector) selectCall(in *intermediate.Instr) {
+	sym := funcSymbol(in.Name)
+	if in.Name == "puts" {
+		sym = putsInt
+		if in.Args[0].Type == intermediate.TypeBool {
+			sym = putsBool
+		}
+	}
+
+	// The stack must be 16-byte aligned at the call, so an odd number of
+	// stack arguments needs padding.
+	stackArgs := len(in.Args) - len(argRegs)
+	pad := 0
+	if stackArgs > 0 && stackArgs%2 == 1 {
+		pad = 8
+		s.emit("sub", R(RSP), Imm(8))
+	}
+	regs, stackArgs := s.passArguments(in.Args)
+	call := s.emit("call", Label(sym))
+	call.ImplicitUses = regs
+	call.ImplicitDefs = callerSaved
+	if size := 8*stackArgs + pad; size > 0 {
+		s.emit("add", R(RSP), Imm(int64(size)))
+	}
+	if in.Type != intermediate.TypeVoid && s.uses[in.ID] > 0 {
+		s.emit("mov", R(s.vreg(in)), R(RAX))
+	}
+}
+
+// selectTailCall selects a sibling call: the arguments replace those of the
+// current function, in registers and in the incoming stack argument area,
+// and the function jumps to the callee after tearing down its frame.
+func (s *selector) selectTailCall(in *intermediate.Instr) {
+	regs, stackArgs := s.passArguments(in.Args)
+	for n := 0; n < stackArgs; n++ {
+		s.emit("pop", R(RAX))
+		s.emit("mov", Mem(RBP, 16+8*int64(n)), R(RAX))
+	}
+	jmp := s.emit("jmp", Label(funcSymbol(in.Name)))
+	jmp.ImplicitUses = regs
+	jmp.TailCall = true
+}
+
+// jumpTo copies the phi operands for the edge from the current block to the
+// target and jumps there.
+func (s *selector) jumpTo(target *intermediate.Block) {
+	s.phiCopies(s.cur, target)
+	s.emit("jmp", Label(s.blocks[target].Label))
+}
+
+// edgeTo returns the block a branch from the current block to target jumps
+// to: the target itself, or a new block on the edge holding the copies of
+// the target's phi operands, since the branching block also jumps elsewhere.
+func (s *selector) edgeTo(target *intermediate.Block) *Block {
+	if len(target.Phis()) == 0 {
+		return s.blocks[target]
+	}
+	from := s.cur
+	edge := &Block{Label: fmt.Sprintf("%s.e%d", s.mf.Name, s.edges)}
+	s.edges++
+	s.mf.Blocks = append(s.mf.Blocks, edge)
+	s.cur = edge
+	s.phiCopies(from, target)
+	s.emit("jmp", Label(s.blocks[target].Label))
+	s.cur = from
+	return edge
+}
+
+// phiCopies copies the operands of the phis of target for the edge coming
+// from the machine block from. The copies go through temporaries, since
+// phis of a loop header may read each other's values.
+func (s *selector) phiCopies(from *Block, target *intermediate.Block) {
+	phis := target.Phis()
+	if len(phis) == 0 {
+		return
+	}
+	var pred *intermediate.Block
+	for b, mb := range s.blocks {
+		if mb == from {
+			pred = b
+		}
+	}
+	n := target.PredIndex(pred)
+	temps := make([]Reg, len(phis))
+	for k, phi := range phis {
+		temps[k] = s.mf.NewVirtual()
+		s.emit("mov", R(temps[k]), s.movSrc(phi.Args[n]))
+	}
+	for k, phi := range phis {
+		s.emit("mov", R(s.vreg(phi)), R(temps[k]))
+	}
+}
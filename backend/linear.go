@@ -0,0 +1,388 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+)
+
+// interval represents the live interval of a virtual register: the range of
+// instruction positions from its first to its last occurrence, including the
+// blocks it is live through. An interval that does not get a register for
+// its whole range is split: it keeps its register before the split position
+// and lives in its stack slot from there on.
+type interval struct {
+	vreg  Reg
+	start int     // The first position the virtual register is live at.
+	end   int     // The last position the virtual register is live at.
+	reg   Reg     // The register assigned before the split, or NoReg.
+	split int     // The position from which the value lives in the slot.
+	slot  Operand // The spill slot, if the interval is split.
+}
+
+// inReg returns true if the value is in the register of the interval at the
+// position.
+func (iv *interval) inReg(pos int) bool {
+	return iv.reg != NoReg && pos < iv.split
+}
+
+// positions numbers the instructions of a function in layout order. Every
+// instruction gets an even position.
+type positions struct {
+	of    map[*Instr]int
+	first map[*Block]int // The position of the first instruction of every block.
+	last  map[*Block]int // The position of the last instruction of every block.
+	count int            // The number of positions.
+}
+
+// numberInstrs numbers the instructions of the function.
+func numberInstrs(f *Func) *positions {
+	p := &positions{of: make(map[*Instr]int), first: make(map[*Block]int), last: make(map[*Block]int)}
+	for _, b := range f.Blocks {
+		p.first[b] = p.count
+		for _, in := range b.Instrs {
+			p.of[in] = p.count
+			p.count += 2
+		}
+		p.last[b] = p.count - 2
+	}
+	return p
+}
+
+// occupancy records, for every physical register, how many positions up to
+// each position the register is used, defined or live at, so that whether
+// a range of positions is free of the register can be answered at once.
+type occupancy map[Reg][]int
+
+// computeOccupancy scans every block backwards to find the positions where
+// the instructions need physical registers, e.g. the argument registers
+// around calls, rax and rdx around idiv, and every caller-saved register at
+// a call.
+func computeOccupancy(f *Func, live *liveness, pos *positions) occupancy {
+	busy := make(map[Reg][]bool)
+	for _, r := range f.Target.Registers().Allocatable {
+		busy[r] = make([]bool, pos.count+1)
+	}
+	mark := func(r Reg, p int) {
+		if b, ok := busy[r]; ok {
+			b[p] = true
+		}
+	}
+	for _, b := range f.Blocks {
+		liveNow := make(regSet)
+		for r := range live.out[b] {
+			if !r.IsVirtual() {
+				liveNow[r] = true
+			}
+		}
+		for n := len(b.Instrs) - 1; n >= 0; n-- {
+			in := b.Instrs[n]
+			p := pos.of[in]
+			for r := range liveNow {
+				mark(r, p)
+			}
+			for _, r := range in.Defs() {
+				if !r.IsVirtual() {
+					mark(r, p)
+					delete(liveNow, r)
+				}
+			}
+			for _, r := range in.Uses() {
+				if !r.IsVirtual() {
+					mark(r, p)
+					liveNow[r] = true
+				}
+			}
+		}
+	}
+
+	occ := make(occupancy)
+	for r, b := range busy {
+		sums := make([]int, len(b)+1)
+		for p, used := range b {
+			sums[p+1] = sums[p]
+			if used {
+				sums[p+1]++
+			}
+		}
+		occ[r] = sums
+	}
+	return occ
+}
+
+// free returns true if the register is not needed by any instruction in the
+// range of positions from start to end.
+func (o occupancy) free(r Reg, start, end int) bool {
+	sums := o[r]
+	return sums[end+1]-sums[start] == 0
+}
+
+// buildIntervals computes the live interval of every virtual register.
+func buildIntervals(f *Func, live *liveness, pos *positions) map[Reg]*interval {
+	intervals := make(map[Reg]*interval)
+	extend := func(v Reg, p int) {
+		if !v.IsVirtual() {
+			return
+		}
+		iv, ok := intervals[v]
+		if !ok {
+			intervals[v] = &interval{vreg: v, start: p, end: p, reg: NoReg}
+			return
+		}
+		if p < iv.start {
+			iv.start = p
+		}
+		if p > iv.end {
+			iv.end = p
+		}
+	}
+	for _, b := range f.Blocks {
+		for r := range live.in[b] {
+			extend(r, pos.first[b])
+		}
+		for r := range live.out[b] {
+			extend(r, pos.last[b])
+		}
+		for _, in := range b.Instrs {
+			for _, r := range in.Uses() {
+				extend(r, pos.of[in])
+			}
+			for _, r := range in.Defs() {
+				extend(r, pos.of[in])
+			}
+		}
+	}
+	for _, iv := range intervals {
+		iv.split = iv.end + 1
+	}
+	return intervals
+}
+
+// LinearScan assigns registers with the linear scan algorithm of Poletto and
+// Sarkar. The intervals are visited in order of their start; when no
+// register is free for an interval, the interval that ends last among it and
+// the active ones is split at the current position and continues in a stack
+// slot. Physical registers the instructions need, such as the caller-saved
+// registers at calls, are only given to intervals that do not overlap those
+// uses, so values live across calls end up in callee-saved registers.
+type LinearScan struct{}
+
+// Allocate assigns the registers of the function.
+func (LinearScan) Allocate(f *Func) {
+	live := computeLiveness(f)
+	pos := numberInstrs(f)
+	occ := computeOccupancy(f, live, pos)
+	intervals := buildIntervals(f, live, pos)
+
+	sorted := make([]*interval, 0, len(intervals))
+	for _, iv := range intervals {
+		sorted = append(sorted, iv)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start < sorted[j].start
+		}
+		return sorted[i].vreg < sorted[j].vreg
+	})
+
+	slots := &slotPool{f: f}
+	var active []*interval
+	for _, cur := range sorted {
+		// Expire the intervals that ended before the current one starts.
+		kept := active[:0]
+		for _, a := range active {
+			if a.end >= cur.start {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		taken := make(map[Reg]bool)
+		for _, a := range active {
+			taken[a.reg] = true
+		}
+		for _, r := range f.Target.Registers().Allocatable {
+			if !taken[r] && occ.free(r, cur.start, cur.end) {
+				cur.reg = r
+				break
+			}
+		}
+		if cur.reg != NoReg {
+			active = append(active, cur)
+			continue
+		}
+
+		// Split the active interval ending last whose register the
+		// current interval could use, if it ends after the current one.
+		var victim *interval
+		for _, a := range active {
+			if occ.free(a.reg, cur.start, cur.end) && (victim == nil || a.end > victim.end) {
+				victim = a
+			}
+		}
+		if victim == nil || victim.end <= cur.end {
+			cur.split = cur.start
+			cur.slot = slots.get(cur)
+			continue
+		}
+		victim.split = cur.start
+		victim.slot = slots.get(victim)
+		cur.reg = victim.reg
+		if victim.start == cur.start {
+			victim.reg = NoReg
+		}
+		for n, a := range active {
+			if a == victim {
+				active[n] = cur
+			}
+		}
+	}
+
+	rewriteIntervals(f, intervals, pos, live)
+}
+
+// slotPool hands out spill slots, reusing the slots of intervals whose part
+// on the stack has ended.
+type slotPool struct {
+	f     *Func
+	slots []Operand
+	until []int // The last position each slot is in use.
+}
+
+// get returns a slot for the part of the interval from its split position.
+// Slots are requested in increasing order of split positions.
+func (s *slotPool) get(iv *interval) Operand {
+	for n, end := range s.until {
+		if end < iv.split {
+			s.until[n] = iv.end
+			return s.slots[n]
+		}
+	}
+	slot := s.f.AllocSlot()
+	s.slots = append(s.slots, slot)
+	s.until = append(s.until, iv.end)
+	return slot
+}
+
+// rewriteIntervals replaces the virtual registers with their locations: the
+// assigned register, or a scratch register loaded from and stored to the
+// slot around the instruction. Split intervals store their register to the
+// slot at the split position, and moves are inserted on the control flow
+// edges where a value is in a different location at the end of the
+// predecessor than at the start of the successor.
+func rewriteIntervals(f *Func, intervals map[Reg]*interval, pos *positions, live *liveness) {
+	blockStart := make(map[int]bool)
+	for _, b := range f.Blocks {
+		blockStart[pos.first[b]] = true
+	}
+	splitsAt := make(map[int][]*interval)
+	for _, v := range sortedRegs(intervalRegs(intervals)) {
+		iv := intervals[v]
+		if iv.reg != NoReg && iv.split <= iv.end && !blockStart[iv.split] {
+			splitsAt[iv.split] = append(splitsAt[iv.split], iv)
+		}
+	}
+
+	for _, b := range f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			p := pos.of[in]
+			for _, iv := range splitsAt[p] {
+				out = append(out, f.Target.Store(iv.slot, iv.reg)...)
+			}
+			var after []*Instr
+			scratch := 0
+			assigned := make(map[Reg]Reg)
+			loaded := make(map[Reg]bool)
+			for n, a := range in.Args {
+				if a.Kind != RegOperand || !a.Reg.IsVirtual() {
+					continue
+				}
+				iv := intervals[a.Reg]
+				if iv.inReg(p) {
+					in.Args[n].Reg = iv.reg
+					continue
+				}
+				r, ok := assigned[a.Reg]
+				if !ok {
+					r = f.Target.Registers().Scratch[scratch]
+					scratch++
+					assigned[a.Reg] = r
+				}
+				if (n > 0 || in.readsDest()) && !loaded[a.Reg] {
+					out = append(out, f.Target.Load(r, iv.slot)...)
+					loaded[a.Reg] = true
+				}
+				if n == 0 && in.writesDest() {
+					after = append(after, f.Target.Store(iv.slot, r)...)
+				}
+				in.Args[n].Reg = r
+			}
+			out = append(out, in)
+			out = append(out, after...)
+		}
+		b.Instrs = out
+	}
+
+	resolveEdges(f, intervals, pos, live)
+}
+
+// resolveEdges inserts the moves between registers and slots needed on the
+// control flow edges. Stores to slots come first, since a register stored on
+// an edge may be loaded with another value on the same edge.
+func resolveEdges(f *Func, intervals map[Reg]*interval, pos *positions, live *liveness) {
+	edges := 0
+	for _, b := range append([]*Block(nil), f.Blocks...) {
+		seen := make(map[*Block]bool)
+		for _, s := range append([]*Block(nil), b.Succs...) {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+			var stores, loads []*Instr
+			for _, v := range sortedRegs(live.in[s]) {
+				iv, ok := intervals[v]
+				if !ok {
+					continue
+				}
+				atEnd, atStart := iv.inReg(pos.last[b]), iv.inReg(pos.first[s])
+				switch {
+				case atEnd && !atStart:
+					stores = append(stores, f.Target.Store(iv.slot, iv.reg)...)
+				case !atEnd && atStart:
+					loads = append(loads, f.Target.Load(iv.reg, iv.slot)...)
+				}
+			}
+			moves := append(stores, loads...)
+			if len(moves) == 0 {
+				continue
+			}
+			switch {
+			case len(b.Succs) == 1:
+				jmp := b.Instrs[len(b.Instrs)-1]
+				b.Instrs = append(append(b.Instrs[:len(b.Instrs)-1], moves...), jmp)
+			case len(s.Preds) == 1:
+				s.Instrs = append(moves, s.Instrs...)
+			default:
+				edge := &Block{Label: fmt.Sprintf("%s.r%d", f.Name, edges)}
+				edges++
+				edge.Instrs = append(moves, f.Target.Jump(s.Label))
+				f.Blocks = append(f.Blocks, edge)
+				for _, in := range b.Instrs {
+					if label, ok := in.JumpTarget(); ok && label == s.Label {
+						in.retarget(edge.Label)
+					}
+				}
+			}
+		}
+	}
+	linkBlocks(f)
+}
+
+// intervalRegs returns the set of virtual registers that have an interval.
+func intervalRegs(intervals map[Reg]*interval) regSet {
+	set := make(regSet)
+	for v := range intervals {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package backend
+
+import "sort"
+
+// regSet represents a set of registers.
+type regSet map[Reg]bool
+
+// sortedRegs returns the registers of the set in increasing order, so that
+// the code generated from a set does not depend on map iteration order.
+func sortedRegs(set regSet) []Reg {
+	regs := make([]Reg, 0, len(set))
+	for r := range set {
+		regs = append(regs, r)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i] < regs[j] })
+	return regs
+}
+
+// liveness holds the registers live on entry to and on exit from every block
+// of a function, both virtual and physical.
+type liveness struct {
+	in  map[*Block]regSet
+	out map[*Block]regSet
+}
+
+// computeLiveness solves the backward dataflow equations for the live
+// registers of the function, iterating until nothing changes.
+func computeLiveness(f *Func) *liveness {
+	l := &liveness{in: make(map[*Block]regSet), out: make(map[*Block]regSet)}
+	use := make(map[*Block]regSet)
+	def := make(map[*Block]regSet)
+	for _, b := range f.Blocks {
+		u, d := make(regSet), make(regSet)
+		for _, in := range b.Instrs {
+			for _, r := range in.Uses() {
+				if !d[r] {
+					u[r] = true
+				}
+			}
+			for _, r := range in.Defs() {
+				d[r] = true
+			}
+		}
+		use[b], def[b] = u, d
+		l.in[b], l.out[b] = make(regSet), make(regSet)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for n := len(f.Blocks) - 1; n >= 0; n-- {
+			b := f.Blocks[n]
+			out := make(regSet)
+			for _, s := range b.Succs {
+				for r := range l.in[s] {
+					out[r] = true
+				}
+			}
+			in := make(regSet)
+			for r := range use[b] {
+				in[r] = true
+			}
+			for r := range out {
+				if !def[b][r] {
+					in[r] = true
+				}
+			}
+			if len(in) != len(l.in[b]) || len(out) != len(l.out[b]) {
+				changed = true
+			}
+			l.in[b], l.out[b] = in, out
+		}
+	}
+	return l
+}
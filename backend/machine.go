@@ -0,0 +1,285 @@
+package backend
+
+import "fmt"
+
+// Reg represents a machine register. Values below VirtualBase are physical
+// x86-64 registers in encoding order; values from VirtualBase upwards are
+// virtual registers that the register allocator maps to physical registers
+// or stack slots.
+type Reg int
+
+// The physical x86-64 general-purpose registers, in encoding order.
+const (
+	RAX Reg = iota
+	RCX
+	RDX
+	RBX
+	RSP
+	RBP
+	RSI
+	RDI
+	R8
+	R9
+	R10
+	R11
+	R12
+	R13
+	R14
+	R15
+)
+
+// NoReg represents the absence of a register.
+const NoReg Reg = -1
+
+// VirtualBase is the number of the first virtual register.
+const VirtualBase Reg = 32
+
+// IsVirtual returns true if the register is a virtual register.
+func (r Reg) IsVirtual() bool {
+	return r >= VirtualBase
+}
+
+// OperandKind represents the kind of a machine operand.
+type OperandKind int
+
+const (
+	// RegOperand is a register.
+	RegOperand OperandKind = iota
+	// ImmOperand is an immediate value.
+	ImmOperand
+	// MemOperand is a memory location addressed by a base register and a
+	// displacement, or by a symbol relative to the instruction pointer.
+	MemOperand
+	// LabelOperand is a code label, the target of a jump or call.
+	LabelOperand
+)
+
+// Operand represents an operand of a machine instruction.
+type Operand struct {
+	Kind OperandKind // The kind of the operand.
+	Reg  Reg         // The register, or the base register of a memory operand.
+	Imm  int64       // The immediate value, or the displacement of a memory operand.
+	Sym  string      // The label, or the symbol of a RIP-relative memory operand.
+	Byte bool        // Whether the operand is the low byte of the register or memory location.
+}
+
+// R returns a register operand.
+func R(r Reg) Operand { return Operand{Kind: RegOperand, Reg: r} }
+
+// R8b returns an operand for the low byte of a register.
+func R8b(r Reg) Operand { return Operand{Kind: RegOperand, Reg: r, Byte: true} }
+
+// Imm returns an immediate operand.
+func Imm(v int64) Operand { return Operand{Kind: ImmOperand, Imm: v} }
+
+// Mem returns a memory operand addressed relative to a base register.
+func Mem(base Reg, disp int64) Operand { return Operand{Kind: MemOperand, Reg: base, Imm: disp} }
+
+// Global returns a memory operand addressing a symbol relative to the
+// instruction pointer.
+func Global(sym string) Operand { return Operand{Kind: MemOperand, Reg: NoReg, Sym: sym} }
+
+// Label returns a label operand.
+func Label(sym string) Operand { return Operand{Kind: LabelOperand, Sym: sym} }
+
+// fitsImm32 returns true if v can be encoded as a sign-extended 32-bit
+// immediate, which is what most x86-64 instructions accept.
+func fitsImm32(v int64) bool {
+	return v >= -1<<31 && v < 1<<31
+}
+
+// Access describes how an instruction accesses its first operand.
+type Access int
+
+const (
+	// Read means the first operand is only read, like the operands of cmp
+	// or the register stored by an AArch64 str.
+	Read Access = iota
+	// Write means the first operand is only written, like the destination
+	// of mov.
+	Write
+	// ReadWrite means the first operand is read and written, like the
+	// destination of the two-operand x86 add.
+	ReadWrite
+)
+
+// Instr represents a machine instruction with the destination first, as in
+// Intel and AArch64 assembly syntax.
+type Instr struct {
+	Op           string    // The mnemonic, e.g. "mov" or "jne".
+	Args         []Operand // The explicit operands.
+	Dest         Access    // How the instruction accesses its first operand.
+	ImplicitUses []Reg     // The registers read without being named, e.g. by idiv or call.
+	ImplicitDefs []Reg     // The registers written without being named.
+	TailCall     bool      // Whether the instruction is a jump to another function, which needs the epilogue first.
+}
+
+// NewInstr creates a machine instruction.
+func NewInstr(op string, dest Access, args ...Operand) *Instr {
+	return &Instr{Op: op, Dest: dest, Args: args}
+}
+
+// String returns the instruction in NASM syntax.
+func (i *Instr) String() string {
+	s := i.Op
+	for n, a := range i.Args {
+		if n == 0 {
+			s += " "
+		} else {
+			s += ", "
+		}
+		s += formatOperand(a, i.Op)
+	}
+	return s
+}
+
+// Block represents a machine basic block.
+type Block struct {
+	Label  string   // The assembly label of the block.
+	Instrs []*Instr // The instructions of the block.
+	Succs  []*Block // The successor blocks.
+	Preds  []*Block // The predecessor blocks.
+}
+
+// Func represents a function in machine code.
+type Func struct {
+	Name        string   // The assembly symbol of the function.
+	Target      Target   // The target the function is generated for.
+	Blocks      []*Block // The blocks, in layout order.
+	NumVirtual  int      // The number of virtual registers used.
+	FrameSize   int      // The size in bytes of the stack frame below the saved frame pointer.
+	Params      int      // The number of parameters.
+	SavedRegs   []Reg    // The callee-saved registers the function must preserve.
+	HasFrame    bool     // Whether the function sets up the frame pointer; runtime routines may not.
+	spillOffset int      // The size of the frame allocated for spill slots so far.
+}
+
+// NewVirtual returns a new virtual register.
+func (f *Func) NewVirtual() Reg {
+	r := VirtualBase + Reg(f.NumVirtual)
+	f.NumVirtual++
+	return r
+}
+
+// AllocSlot reserves a stack slot of 8 bytes below the frame pointer and
+// returns a memory operand for it.
+func (f *Func) AllocSlot() Operand {
+	f.spillOffset += 8
+	return Mem(f.Target.Registers().FramePointer, -int64(f.spillOffset))
+}
+
+// linkBlocks computes the successors and predecessors of the machine blocks
+// from their jumps.
+func linkBlocks(f *Func) {
+	byLabel := make(map[string]*Block)
+	for _, b := range f.Blocks {
+		byLabel[b.Label] = b
+		b.Succs, b.Preds = nil, nil
+	}
+	for _, b := range f.Blocks {
+		for _, in := range b.Instrs {
+			if label, ok := in.JumpTarget(); ok {
+				if t, ok := byLabel[label]; ok {
+					b.Succs = append(b.Succs, t)
+					t.Preds = append(t.Preds, b)
+				}
+			}
+		}
+	}
+}
+
+// removeFallthroughJumps removes the unconditional jumps, with the mnemonic
+// jump, to the block that follows in the layout.
+func removeFallthroughJumps(f *Func, jump string) {
+	for n, b := range f.Blocks {
+		if n+1 == len(f.Blocks) || len(b.Instrs) == 0 {
+			continue
+		}
+		last := b.Instrs[len(b.Instrs)-1]
+		if label, ok := last.JumpTarget(); ok && last.Op == jump && label == f.Blocks[n+1].Label {
+			b.Instrs = b.Instrs[:len(b.Instrs)-1]
+		}
+	}
+}
+
+// Program represents a whole program in machine code.
+type Program struct {
+	Funcs  []*Func           // The functions, including the runtime routines.
+	Data   []string          // The symbols of the 8-byte zero-initialized globals in .data.
+	Rodata map[string]string // The read-only strings in .rodata, by symbol.
+	Entry  string            // The symbol of the function called by _start.
+}
+
+// Uses returns the registers read by the instruction.
+func (i *Instr) Uses() []Reg {
+	var regs []Reg
+	for n, a := range i.Args {
+		switch a.Kind {
+		case RegOperand:
+			if n > 0 || i.readsDest() {
+				regs = append(regs, a.Reg)
+			}
+		case MemOperand:
+			if a.Reg != NoReg {
+				regs = append(regs, a.Reg)
+			}
+		}
+	}
+	return append(regs, i.ImplicitUses...)
+}
+
+// Defs returns the registers written by the instruction.
+func (i *Instr) Defs() []Reg {
+	var regs []Reg
+	if len(i.Args) > 0 && i.Args[0].Kind == RegOperand && i.writesDest() {
+		regs = append(regs, i.Args[0].Reg)
+	}
+	return append(regs, i.ImplicitDefs...)
+}
+
+// readsDest returns true if the instruction reads its first operand.
+func (i *Instr) readsDest() bool {
+	return i.Dest != Write
+}
+
+// writesDest returns true if the instruction writes its first operand.
+func (i *Instr) writesDest() bool {
+	return i.Dest != Read
+}
+
+// JumpTarget returns the label a jump or branch instruction may transfer
+// control to within the function, and false for other instructions. Calls
+// and tail calls leave the function, so they have no target.
+func (i *Instr) JumpTarget() (string, bool) {
+	if i.TailCall || i.Op == "call" || i.Op == "bl" {
+		return "", false
+	}
+	for _, a := range i.Args {
+		if a.Kind == LabelOperand {
+			return a.Sym, true
+		}
+	}
+	return "", false
+}
+
+// retarget makes a jump instruction transfer control to another label.
+func (i *Instr) retarget(label string) {
+	for n, a := range i.Args {
+		if a.Kind == LabelOperand {
+			i.Args[n].Sym = label
+		}
+	}
+}
+
+// IsMove returns true if the instruction copies one register into another.
+func (i *Instr) IsMove() bool {
+	return i.Op == "mov" && len(i.Args) == 2 && i.Args[0].Kind == RegOperand && i.Args[1].Kind == RegOperand && !i.Args[0].Byte && !i.Args[1].Byte
+}
+
+// String returns the register name, or a placeholder for virtual registers.
+func (r Reg) String() string {
+	if r.IsVirtual() {
+		return fmt.Sprintf("v%d", int(r-VirtualBase))
+	}
+	return regNames[r]
+}
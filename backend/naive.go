@@ -0,0 +1,73 @@
+package backend
+
+// NaiveAllocator assigns every virtual register its own stack slot. Each
+// instruction loads the virtual registers it reads into the scratch registers
+// and stores the ones it writes back, so no value lives in a register across
+// instructions. The code is slow but trivially correct,
+// which makes it the reference the other allocators are compared against.
+type NaiveAllocator struct{}
+
+// Allocate assigns the registers of the function.
+func (NaiveAllocator) Allocate(f *Func) {
+	slots := make(map[Reg]Operand)
+	slot := func(r Reg) Operand {
+		s, ok := slots[r]
+		if !ok {
+			s = f.AllocSlot()
+			slots[r] = s
+		}
+		return s
+	}
+
+	target := f.Target
+	scratchRegs := target.Registers().Scratch
+	for _, b := range f.Blocks {
+		var out []*Instr
+		for _, in := range b.Instrs {
+			var after []*Instr
+			scratch := 0
+			assigned := make(map[Reg]Reg)
+			loaded := make(map[Reg]bool)
+			// The sources are assigned first. An instruction reads its
+			// sources before it writes its destination, so a destination
+			// that is only written shares a scratch register with them,
+			// which the three-operand instructions of some targets need.
+			order := make([]int, 0, len(in.Args))
+			for n := 1; n < len(in.Args); n++ {
+				order = append(order, n)
+			}
+			if len(in.Args) > 0 {
+				order = append(order, 0)
+			}
+			for _, n := range order {
+				a := in.Args[n]
+				if a.Kind != RegOperand || !a.Reg.IsVirtual() {
+					continue
+				}
+				v := a.Reg
+				r, ok := assigned[v]
+				switch {
+				case ok:
+				case n == 0 && !in.readsDest():
+					r = scratchRegs[0]
+					assigned[v] = r
+				default:
+					r = scratchRegs[scratch]
+					scratch++
+					assigned[v] = r
+				}
+				if (n > 0 || in.readsDest()) && !loaded[v] {
+					out = append(out, target.Load(r, slot(v))...)
+					loaded[v] = true
+				}
+				if n == 0 && in.writesDest() {
+					after = append(after, target.Store(slot(v), r)...)
+				}
+				in.Args[n].Reg = r
+			}
+			out = append(out, in)
+			out = append(out, after...)
+		}
+		b.Instrs = out
+	}
+}
@@ -0,0 +1,18 @@
+package backend
+
+// RegisterAllocator maps the virtual registers of a function onto physical
+// registers and stack slots. An allocator may only use the allocatable
+// registers and, for spill code, the scratch registers, and reserves the
+// stack slots it needs with Func.AllocSlot. The prologue and epilogue are
+// added afterwards, saving whichever callee-saved registers it used.
+type RegisterAllocator interface {
+	Allocate(f *Func)
+}
+
+// Allocators maps the names of the register allocators, as accepted by the
+// --regalloc flag, to the allocators.
+var Allocators = map[string]RegisterAllocator{
+	"naive":  NaiveAllocator{},
+	"linear": LinearScan{},
+	"color":  GraphColoring{},
+}
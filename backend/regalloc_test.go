@@ -0,0 +1,31 @@
+package backend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestRegisterPressure compiles programs keeping more values alive than
+// there are registers, compares the assembly linear scan produces with the
+// golden files, and checks that every allocator's executable prints the
+// golden output.
+func TestRegisterPressure(t *testing.T) {
+	for name, source := range programs(t, "regalloc") {
+		t.Run(name, func(t *testing.T) {
+			// Without inlining, the values stay alive across the calls.
+			module := lower(t, source, 0)
+			assembly, err := GenerateAssembly(module, Options{Allocator: LinearScan{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, filepath.Join("testdata", "regalloc", name+".linear.s"), assembly)
+
+			for allocator, a := range Allocators {
+				t.Run(allocator, func(t *testing.T) {
+					got := run(t, lower(t, source, 0), Options{Allocator: a})
+					golden(t, filepath.Join("testdata", "regalloc", name+".out"), got)
+				})
+			}
+		})
+	}
+}
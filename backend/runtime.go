@@ -0,0 +1,126 @@
+package backend
+
+// The symbols of the runtime routines and data.
+const (
+	startSymbol  = "_start"
+	putsInt      = "rt_puts_int"
+	putsBool     = "rt_puts_bool"
+	trueSymbol   = "rt_true"
+	falseSymbol  = "rt_false"
+	sysWrite     = 1
+	sysExit      = 60
+	stdoutFileno = 1
+)
+
+// newBlock creates a machine block holding the instructions.
+func newBlock(label string, instrs ...*Instr) *Block {
+	return &Block{Label: label, Instrs: instrs}
+}
+
+// byteAt returns an operand for the byte at the address in the register.
+func byteAt(base Reg) Operand {
+	m := Mem(base, 0)
+	m.Byte = true
+	return m
+}
+
+// syscallInstr returns a syscall instruction, which reads its arguments from
+// rax, rdi, rsi and rdx and overwrites rax, rcx and r11.
+func syscallInstr() *Instr {
+	i := x86Instr("syscall")
+	i.ImplicitUses = []Reg{RAX, RDI, RSI, RDX}
+	i.ImplicitDefs = []Reg{RAX, RCX, R11}
+	return i
+}
+
+// startFunc returns the entry point of the program, which calls the main
+// function and exits with status 0.
+func startFunc(entry string) *Func {
+	return &Func{Name: startSymbol, Target: X86_64{}, Blocks: []*Block{newBlock(startSymbol,
+		x86Instr("call", Label(entry)),
+		x86Instr("mov", R(RDI), Imm(0)),
+		x86Instr("mov", R(RAX), Imm(sysExit)),
+		syscallInstr(),
+	)}}
+}
+
+// putsIntFunc returns the runtime routine printing the integer in rdi in
+// decimal followed by a newline. The digits are written backwards into a
+// buffer on the stack; the magnitude of a negative number is divided as an
+// unsigned value, which also handles the most negative integer.
+func putsIntFunc() *Func {
+	l := func(name string) string { return putsInt + "." + name }
+	return &Func{Name: putsInt, Target: X86_64{}, Blocks: []*Block{
+		newBlock(putsInt,
+			x86Instr("push", R(RBP)),
+			x86Instr("mov", R(RBP), R(RSP)),
+			x86Instr("sub", R(RSP), Imm(32)),
+			x86Instr("mov", R(RAX), R(RDI)),
+			x86Instr("lea", R(RSI), Mem(RBP, -1)),
+			x86Instr("mov", byteAt(RSI), Imm('\n')),
+			x86Instr("mov", R(R8), R(RAX)),
+			x86Instr("test", R(RAX), R(RAX)),
+			x86Instr("jge", Label(l("digits"))),
+			x86Instr("neg", R(RAX)),
+		),
+		newBlock(l("digits"),
+			x86Instr("mov", R(RCX), Imm(10)),
+		),
+		newBlock(l("loop"),
+			x86Instr("mov", R(RDX), Imm(0)),
+			x86Instr("div", R(RCX)),
+			x86Instr("add", R(RDX), Imm('0')),
+			x86Instr("sub", R(RSI), Imm(1)),
+			x86Instr("mov", byteAt(RSI), R8b(RDX)),
+			x86Instr("test", R(RAX), R(RAX)),
+			x86Instr("jne", Label(l("loop"))),
+			x86Instr("test", R(R8), R(R8)),
+			x86Instr("jge", Label(l("write"))),
+			x86Instr("sub", R(RSI), Imm(1)),
+			x86Instr("mov", byteAt(RSI), Imm('-')),
+		),
+		newBlock(l("write"),
+			x86Instr("mov", R(RDX), R(RBP)),
+			x86Instr("sub", R(RDX), R(RSI)),
+			x86Instr("mov", R(RDI), Imm(stdoutFileno)),
+			x86Instr("mov", R(RAX), Imm(sysWrite)),
+			syscallInstr(),
+			x86Instr("mov", R(RSP), R(RBP)),
+			x86Instr("pop", R(RBP)),
+			x86Instr("ret"),
+		),
+	}}
+}
+
+// putsBoolFunc returns the runtime routine printing the boolean in rdi as
+// true or false followed by a newline.
+func putsBoolFunc() *Func {
+	l := func(name string) string { return putsBool + "." + name }
+	return &Func{Name: putsBool, Target: X86_64{}, Blocks: []*Block{
+		newBlock(putsBool,
+			x86Instr("test", R(RDI), R(RDI)),
+			x86Instr("je", Label(l("false"))),
+			x86Instr("lea", R(RSI), Global(trueSymbol)),
+			x86Instr("mov", R(RDX), Imm(5)),
+			x86Instr("jmp", Label(l("write"))),
+		),
+		newBlock(l("false"),
+			x86Instr("lea", R(RSI), Global(falseSymbol)),
+			x86Instr("mov", R(RDX), Imm(6)),
+		),
+		newBlock(l("write"),
+			x86Instr("mov", R(RDI), Imm(stdoutFileno)),
+			x86Instr("mov", R(RAX), Imm(sysWrite)),
+			syscallInstr(),
+			x86Instr("ret"),
+		),
+	}}
+}
+
+// runtimeRodata returns the read-only data of the runtime routines.
+func runtimeRodata() map[string]string {
+	return map[string]string{
+		trueSymbol:  "true\n",
+		falseSymbol: "false\n",
+	}
+}
@@ -0,0 +1,94 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// sizeComparison compiles every program of a directory of testdata with and
+// without the passes named in skip, checks that the passes make the Monkey
+// functions smaller, and compares both instruction counts with the golden
+// file of the program.
+func sizeComparison(t *testing.T, dir string, level int, skip ...string) {
+	passes := strings.Join(skip, " and ")
+	for name, source := range programs(t, dir) {
+		t.Run(name, func(t *testing.T) {
+			without, err := GenerateAssembly(lower(t, source, level, skip...), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			with, err := GenerateAssembly(lower(t, source, level), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before, after := countInstructions(without), countInstructions(with)
+			if after >= before {
+				t.Errorf("%d instructions with %s, %d without: want fewer", after, passes, before)
+			}
+			golden(t, filepath.Join("testdata", dir, name+".size"), fmt.Sprintf("without %s: %d instructions\nwith %s: %d instructions\n", passes, before, passes, after))
+		})
+	}
+}
+
+func TestValueNumberingShrinksAssembly(t *testing.T) {
+	sizeComparison(t, "gvn", 1, "gvn")
+}
+
+// loopInstructions returns the number of instructions of the blocks of loops
+// in the x86-64 assembly of a module, and the multiplications among them.
+func loopInstructions(module *intermediate.Module, assembly string) (instructions, muls int) {
+	loopBlocks := make(map[string]bool)
+	for _, fn := range module.Functions {
+		for _, l := range intermediate.FindLoops(fn, intermediate.Dominators(fn)) {
+			for b := range l.Blocks {
+				loopBlocks[fmt.Sprintf("%s.%s:", funcSymbol(fn.Name), b.Label())] = true
+			}
+		}
+	}
+	loop := false
+	for _, line := range strings.Split(assembly, "\n") {
+		switch {
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, "\t"):
+			loop = loopBlocks[line]
+		case loop && strings.HasPrefix(line, "\t"):
+			instructions++
+			if strings.HasPrefix(line, "\timul") {
+				muls++
+			}
+		}
+	}
+	return instructions, muls
+}
+
+// loopSize compiles a program at -O2 without the passes named in skip, and
+// counts the instructions of its loops and the multiplications among them.
+func loopSize(t *testing.T, source string, skip ...string) (instructions, muls int) {
+	t.Helper()
+	module := lower(t, source, 2, skip...)
+	assembly, err := GenerateAssembly(module, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loopInstructions(module, assembly)
+}
+
+func TestLoopOptimizationsShrinkLoops(t *testing.T) {
+	for name, source := range programs(t, "loops") {
+		t.Run(name, func(t *testing.T) {
+			before, beforeMuls := loopSize(t, source, "licm", "indvars")
+			after, afterMuls := loopSize(t, source)
+			// Strength reduction trades a multiplication for additions, which
+			// may take more instructions.
+			if after >= before && afterMuls >= beforeMuls {
+				t.Errorf("%d instructions and %d multiplications in loops with licm and indvars, %d and %d without: want fewer of either", after, afterMuls, before, beforeMuls)
+			}
+			golden(t, filepath.Join("testdata", "loops", name+".size"), fmt.Sprintf(
+				"without licm and indvars: %d instructions in loops, %d multiplications\nwith licm and indvars: %d instructions in loops, %d multiplications\n",
+				before, beforeMuls, after, afterMuls))
+		})
+	}
+}
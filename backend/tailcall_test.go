@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestTailCallsDoNotGrowTheStack runs recursions ten million calls deep,
+// which overflow the 8 MiB stack of a process unless tail calls reuse the
+// frame of the caller.
+func TestTailCallsDoNotGrowTheStack(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"self", `
+let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+puts(countdown(10000000));
+`, "0\n"},
+		{"return", `
+let count = fn(n, acc) { if (n == 0) { return acc; } return count(n - 1, acc + 1); };
+puts(count(10000000, 0));
+`, "10000000\n"},
+		{"mutual", `
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+puts(even(10000000));
+`, "true\n"},
+		{"seven parameters, five unchanged", `
+let q = fn(n, b, c, d, e, g, acc) { if (n == 0) { acc + b + c + d + e + g } else { q(n - 1, b, c, d, e, g, acc + 1) } };
+puts(q(10000000, 1, 2, 3, 4, 5, 0));
+`, "10000015\n"},
+		{"nine parameters, on the stack", `
+let q = fn(n, b, c, d, e, g, h, i, acc) { if (n == 0) { acc * 1000 + h * 100 + i * 10 + b } else { q(n - 1, b, c, d, e, g, i, h, acc + c) } };
+puts(q(10000000, 1, 2, 3, 4, 5, 6, 7, 0));
+`, "20000000671\n"},
+		{"eight parameters, mutual", `
+let ping = fn(n, b, c, d, e, g, h, acc) { if (n == 0) { acc + h } else { pong(n - 1, b, c, d, e, g, h, acc + b) } };
+let pong = fn(n, b, c, d, e, g, h, acc) { if (n == 0) { acc + g } else { ping(n - 1, b, c, d, e, g, h, acc + d) } };
+puts(ping(10000000, 1, 2, 3, 4, 5, 6, 0));
+`, "20000006\n"},
+	}
+	for _, tt := range tests {
+		for _, level := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s/O%d", tt.name, level), func(t *testing.T) {
+				if got := run(t, lower(t, tt.source, level), Options{}); got != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package backend
+
+import "github.com/user/golang-interpreter/intermediate"
+
+// Target represents a machine the backend generates code for. The register
+// allocators and the driver are shared by all targets; a target provides the
+// instruction selection, the registers, the calling convention, the frame
+// layout, the runtime routines and the assembly syntax.
+type Target interface {
+	// Name returns the name of the target, as accepted by the --target flag.
+	Name() string
+	// Registers returns the register file of the machine.
+	Registers() *RegisterFile
+	// CallingConvention returns how functions pass arguments and results.
+	CallingConvention() *CallingConvention
+
+	// SelectFunction translates a function of the intermediate
+	// representation into machine instructions on virtual registers.
+	SelectFunction(fn *intermediate.Function) *Func
+	// Load returns the instructions loading a register from a stack slot.
+	Load(r Reg, slot Operand) []*Instr
+	// Store returns the instructions storing a register to a stack slot.
+	Store(slot Operand, r Reg) []*Instr
+	// Jump returns an unconditional jump to a label.
+	Jump(label string) *Instr
+	// FinishFunction adds the prologue and epilogues to a function once its
+	// registers are allocated.
+	FinishFunction(f *Func)
+	// AddRuntime adds the entry point of the program, which calls the
+	// entry function and exits, and the runtime routines and their data.
+	AddRuntime(prog *Program)
+
+	// PrintAssembly returns the program in the assembly syntax of the target.
+	PrintAssembly(prog *Program) (string, error)
+}
+
+// RegisterFile describes the general-purpose registers of a machine.
+type RegisterFile struct {
+	Names        []string // The names of the physical registers, by number.
+	Allocatable  []Reg    // The registers the allocators assign, in order of preference.
+	Scratch      []Reg    // The registers reserved for the spill code of the allocators.
+	FramePointer Reg      // The register addressing the stack slots.
+	StackPointer Reg      // The stack pointer.
+}
+
+// CallingConvention describes how functions pass arguments and results.
+type CallingConvention struct {
+	Args        []Reg // The registers passing the first arguments; the others go on the stack.
+	Result      Reg   // The register holding the result.
+	CallerSaved []Reg // The registers a call may overwrite.
+	CalleeSaved []Reg // The registers a function must preserve for its caller.
+}
+
+// isCalleeSaved returns true if the function must preserve the register.
+func (c *CallingConvention) isCalleeSaved(r Reg) bool {
+	for _, s := range c.CalleeSaved {
+		if s == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Targets maps the names accepted by the --target flag to the targets.
+var Targets = map[string]Target{
+	"x86_64-linux":  X86_64{},
+	"aarch64-linux": AArch64{},
+}
+
+// DefaultTarget is the target code is generated for unless another is
+// requested.
+var DefaultTarget Target = X86_64{}
@@ -0,0 +1,3 @@
+puts(1 + 2 * 3 - 4 / 2);
+puts(0 - 42);
+puts(100000 * 100000);
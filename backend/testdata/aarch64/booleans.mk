@@ -0,0 +1,4 @@
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+puts(even(10));
+puts(1 < 2);
@@ -0,0 +1,7 @@
+let divide = fn(a, b) { a / b };
+let half = fn(a) { a / 2 };
+let negate = fn(a) { a / (0 - 1) };
+puts(divide(7, 2));
+puts(half(0 - 7));
+puts(negate(5));
+puts(divide(1, 0));
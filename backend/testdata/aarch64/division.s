@@ -0,0 +1,177 @@
+	.text
+	.global _start
+
+	.balign 4
+_start:
+	bl monkey_main
+	mov x0, #0
+	mov x8, #93
+	svc #0
+
+	.balign 4
+monkey_divide:
+monkey_divide.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_divide.b0:
+	mov x2, x0
+	mov x0, x1
+	cbz x0, rt_div_error
+	mov x1, #-9223372036854775808
+	eor x3, x2, x1
+	add x1, x0, #1
+	orr x1, x1, x3
+	cbz x1, rt_div_error
+	sdiv x1, x2, x0
+	mov x0, x1
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+monkey_half:
+monkey_half.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_half.b0:
+	mov x1, x0
+	mov x0, #2
+	sdiv x2, x1, x0
+	mov x0, x2
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+monkey_negate:
+monkey_negate.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_negate.b0:
+	mov x1, x0
+	mov x0, #0
+	sub x2, x0, #1
+	cbz x2, rt_div_error
+	mov x0, #-9223372036854775808
+	eor x3, x1, x0
+	add x0, x2, #1
+	orr x0, x0, x3
+	cbz x0, rt_div_error
+	sdiv x3, x1, x2
+	mov x0, x3
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+monkey_main:
+monkey_main.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_main.b0:
+	mov x0, #7
+	mov x1, #2
+	sdiv x2, x0, x1
+	mov x0, x2
+	bl rt_puts_int
+	mov x0, #0
+	sub x1, x0, #7
+	mov x0, #2
+	sdiv x2, x1, x0
+	mov x0, x2
+	bl rt_puts_int
+	mov x0, #0
+	sub x1, x0, #1
+	mov x0, #5
+	cbz x1, rt_div_error
+	mov x2, #-9223372036854775808
+	eor x3, x0, x2
+	add x2, x1, #1
+	orr x2, x2, x3
+	cbz x2, rt_div_error
+	sdiv x2, x0, x1
+	mov x0, x2
+	bl rt_puts_int
+	mov x0, #1
+	mov x1, #0
+	cbz x1, rt_div_error
+	sdiv x2, x0, x1
+	mov x0, x2
+	bl rt_puts_int
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+rt_puts_int:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+	sub sp, sp, #32
+	sub x1, x29, #1
+	mov x2, #10
+	strb w2, [x1]
+	mov x3, x0
+	cmp x0, #0
+	b.ge rt_puts_int.digits
+	neg x0, x0
+rt_puts_int.digits:
+	mov x4, #10
+rt_puts_int.loop:
+	udiv x5, x0, x4
+	msub x6, x5, x4, x0
+	add x6, x6, #48
+	sub x1, x1, #1
+	strb w6, [x1]
+	mov x0, x5
+	cbnz x0, rt_puts_int.loop
+	cmp x3, #0
+	b.ge rt_puts_int.write
+	mov x6, #45
+	sub x1, x1, #1
+	strb w6, [x1]
+rt_puts_int.write:
+	sub x2, x29, x1
+	mov x0, #1
+	mov x8, #64
+	svc #0
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+rt_puts_bool:
+	cbz x0, rt_puts_bool.false
+	adrp x1, rt_true
+	add x1, x1, :lo12:rt_true
+	mov x2, #5
+	b rt_puts_bool.write
+rt_puts_bool.false:
+	adrp x1, rt_false
+	add x1, x1, :lo12:rt_false
+	mov x2, #6
+rt_puts_bool.write:
+	mov x0, #1
+	mov x8, #64
+	svc #0
+	ret
+
+	.balign 4
+rt_div_error:
+	adrp x1, rt_div_error_message
+	add x1, x1, :lo12:rt_div_error_message
+	mov x2, #31
+	mov x0, #2
+	mov x8, #64
+	svc #0
+	mov x0, #1
+	mov x8, #93
+	svc #0
+	.ltorg
+
+	.section .rodata
+rt_div_error_message:
+	.ascii "monkey: integer division error\n"
+rt_false:
+	.ascii "false\n"
+rt_true:
+	.ascii "true\n"
@@ -0,0 +1,4 @@
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let div = fn(a, b) { a / b };
+puts(fib(20));
+puts(div(100, 7));
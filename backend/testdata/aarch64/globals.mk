@@ -0,0 +1,3 @@
+let base = 40;
+let many = fn(a, b, c, d, e, f, g, h, i, j) { a + b + c + d + e + f + g + h + i + j + base };
+puts(many(1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
@@ -0,0 +1,149 @@
+	.text
+	.global _start
+
+	.balign 4
+_start:
+	bl monkey_main
+	mov x0, #0
+	mov x8, #93
+	svc #0
+
+	.balign 4
+monkey_many:
+monkey_many.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_many.b0:
+	mov x8, x0
+	mov x0, x1
+	mov x1, x2
+	mov x2, x3
+	mov x3, x4
+	mov x4, x5
+	mov x5, x6
+	mov x6, x7
+	ldr x7, [x29, #16]
+	ldr x11, [x29, #24]
+	add x12, x8, x0
+	add x0, x12, x1
+	add x1, x0, x2
+	add x0, x1, x3
+	add x1, x0, x4
+	add x0, x1, x5
+	add x1, x0, x6
+	add x0, x1, x7
+	add x1, x0, x11
+	adrp x16, global_base
+	ldr x0, [x16, :lo12:global_base]
+	add x2, x1, x0
+	mov x0, x2
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+monkey_main:
+monkey_main.entry:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+monkey_main.b0:
+	mov x0, #40
+	adrp x16, global_base
+	str x0, [x16, :lo12:global_base]
+	mov x0, #1
+	add x1, x0, #2
+	add x0, x1, #3
+	add x1, x0, #4
+	add x0, x1, #5
+	add x1, x0, #6
+	add x0, x1, #7
+	add x1, x0, #8
+	add x0, x1, #9
+	add x1, x0, #10
+	adrp x16, global_base
+	ldr x0, [x16, :lo12:global_base]
+	add x2, x1, x0
+	mov x0, x2
+	bl rt_puts_int
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+rt_puts_int:
+	stp x29, x30, [sp, #-16]!
+	mov x29, sp
+	sub sp, sp, #32
+	sub x1, x29, #1
+	mov x2, #10
+	strb w2, [x1]
+	mov x3, x0
+	cmp x0, #0
+	b.ge rt_puts_int.digits
+	neg x0, x0
+rt_puts_int.digits:
+	mov x4, #10
+rt_puts_int.loop:
+	udiv x5, x0, x4
+	msub x6, x5, x4, x0
+	add x6, x6, #48
+	sub x1, x1, #1
+	strb w6, [x1]
+	mov x0, x5
+	cbnz x0, rt_puts_int.loop
+	cmp x3, #0
+	b.ge rt_puts_int.write
+	mov x6, #45
+	sub x1, x1, #1
+	strb w6, [x1]
+rt_puts_int.write:
+	sub x2, x29, x1
+	mov x0, #1
+	mov x8, #64
+	svc #0
+	mov sp, x29
+	ldp x29, x30, [sp], #16
+	ret
+
+	.balign 4
+rt_puts_bool:
+	cbz x0, rt_puts_bool.false
+	adrp x1, rt_true
+	add x1, x1, :lo12:rt_true
+	mov x2, #5
+	b rt_puts_bool.write
+rt_puts_bool.false:
+	adrp x1, rt_false
+	add x1, x1, :lo12:rt_false
+	mov x2, #6
+rt_puts_bool.write:
+	mov x0, #1
+	mov x8, #64
+	svc #0
+	ret
+
+	.balign 4
+rt_div_error:
+	adrp x1, rt_div_error_message
+	add x1, x1, :lo12:rt_div_error_message
+	mov x2, #31
+	mov x0, #2
+	mov x8, #64
+	svc #0
+	mov x0, #1
+	mov x8, #93
+	svc #0
+	.ltorg
+
+	.data
+	.balign 8
+global_base:
+	.quad 0
+
+	.section .rodata
+rt_div_error_message:
+	.ascii "monkey: integer division error\n"
+rt_false:
+	.ascii "false\n"
+rt_true:
+	.ascii "true\n"
@@ -0,0 +1,9 @@
+let pick = fn(a, b, c) {
+  if (a < b) {
+    a * b - c + a * b
+  } else {
+    (a * b - c) * (a * b)
+  }
+};
+puts(pick(2, 3, 4));
+puts(pick(5, 3, 4));
@@ -0,0 +1,5 @@
+let norm = fn(x, y, z) {
+  x * x + y * y + z * z + (x * x + y * y) * (y * y + z * z) + (x * x) * (z * z)
+};
+puts(norm(1, 2, 3));
+puts(norm(4, 5, 6));
@@ -0,0 +1,7 @@
+let f = fn(a, b) {
+  let x = (a + b) * (a + b);
+  let y = (a + b) * (a - b);
+  x + y + (a - b) * (a + b)
+};
+puts(f(3, 4));
+puts(f(10, 2));
@@ -0,0 +1,6 @@
+let base = 100;
+let scale = 3;
+let total = fn(n, acc) {
+  if (n == 0) { acc } else { total(n - 1, acc + base * scale - n) }
+};
+puts(total(1000, 0));
@@ -0,0 +1,4 @@
+let sumsq = fn(n, k, acc) {
+  if (n == 0) { acc } else { sumsq(n - 1, k, acc + k * k + n) }
+};
+puts(sumsq(10, 3, 0));
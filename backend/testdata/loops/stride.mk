@@ -0,0 +1,4 @@
+let sum = fn(i, n, stride, acc) {
+  if (i == n) { acc } else { sum(i + 1, n, stride, acc + i * stride) }
+};
+puts(sum(0, 100, 7, 0));
@@ -0,0 +1,211 @@
+bits 64
+default rel
+
+section .text
+global _start
+
+_start:
+	call monkey_main
+	mov rdi, 0
+	mov rax, 60
+	syscall
+
+monkey_pick:
+monkey_pick.entry:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 64
+	mov qword [rbp-24], rbx
+	mov qword [rbp-32], r12
+	mov qword [rbp-40], r13
+	mov qword [rbp-48], r14
+	mov qword [rbp-56], r15
+monkey_pick.b0:
+	mov rax, rdi
+	mov rcx, rsi
+	mov rsi, rdx
+	mov rdx, rax
+	imul rdx, 2
+	mov rdi, rcx
+	imul rdi, 3
+	mov r8, rsi
+	imul r8, 5
+	mov r9, rdx
+	add r9, rdi
+	mov rbx, rdi
+	add rbx, r8
+	mov r12, r8
+	add r12, rdx
+	mov r13, r9
+	imul r13, rbx
+	mov r14, rbx
+	imul r14, r12
+	mov r15, r12
+	imul r15, r9
+	cmp rax, rcx
+	jl monkey_pick.b1
+	jmp monkey_pick.b2
+monkey_pick.b1:
+	mov rax, r13
+	add rax, r14
+	mov qword [rbp-8], r15
+	mov r15, rax
+	mov r10, qword [rbp-8]
+	add r15, r10
+	mov rax, r15
+	add rax, rdx
+	mov r15, rax
+	mov rax, r15
+	mov qword [rbp-16], rax
+	jmp monkey_pick.b3
+monkey_pick.b2:
+	mov qword [rbp-8], r15
+	mov r15, r13
+	sub r15, r14
+	mov qword [rbp-16], rax
+	mov rax, r15
+	mov r10, qword [rbp-8]
+	sub rax, r10
+	mov r15, rax
+	sub r15, rdi
+	mov rax, r15
+	mov r10, rax
+	mov qword [rbp-16], r10
+monkey_pick.b3:
+	cmp rcx, rsi
+	jl monkey_pick.b4
+	jmp monkey_pick.b5
+monkey_pick.b4:
+	mov r10, qword [rbp-16]
+	mov rax, r10
+	imul rax, r9
+	mov rcx, rax
+	add rcx, rbx
+	mov rax, rcx
+	mov rcx, rax
+	jmp monkey_pick.b6
+monkey_pick.b5:
+	mov r10, qword [rbp-16]
+	mov rax, r10
+	imul rax, r12
+	mov rsi, rax
+	sub rsi, r8
+	mov rax, rsi
+	mov rcx, rax
+monkey_pick.b6:
+	mov rax, rdx
+	add rax, rdi
+	mov rdx, rax
+	add rdx, r8
+	mov rax, rdx
+	add rax, r9
+	mov rdx, rax
+	add rdx, rbx
+	mov rax, rdx
+	add rax, r12
+	mov rdx, rax
+	add rdx, r13
+	mov rax, rdx
+	add rax, r14
+	mov rdx, rax
+	mov r10, qword [rbp-8]
+	add rdx, r10
+	mov rax, rdx
+	mov r10, qword [rbp-16]
+	add rax, r10
+	mov rdx, rax
+	add rdx, rcx
+	mov rax, rdx
+	mov rbx, qword [rbp-24]
+	mov r12, qword [rbp-32]
+	mov r13, qword [rbp-40]
+	mov r14, qword [rbp-48]
+	mov r15, qword [rbp-56]
+	mov rsp, rbp
+	pop rbp
+	ret
+
+monkey_main:
+monkey_main.entry:
+	push rbp
+	mov rbp, rsp
+monkey_main.b0:
+	push 3
+	push 2
+	push 1
+	pop rdi
+	pop rsi
+	pop rdx
+	call monkey_pick
+	mov rcx, rax
+	push rcx
+	pop rdi
+	call rt_puts_int
+	push 1
+	push 2
+	push 3
+	pop rdi
+	pop rsi
+	pop rdx
+	call monkey_pick
+	mov rcx, rax
+	push rcx
+	pop rdi
+	call rt_puts_int
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_int:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 32
+	mov rax, rdi
+	lea rsi, [rbp-1]
+	mov byte [rsi], 10
+	mov r8, rax
+	test rax, rax
+	jge rt_puts_int.digits
+	neg rax
+rt_puts_int.digits:
+	mov rcx, 10
+rt_puts_int.loop:
+	mov rdx, 0
+	div rcx
+	add rdx, 48
+	sub rsi, 1
+	mov byte [rsi], dl
+	test rax, rax
+	jne rt_puts_int.loop
+	test r8, r8
+	jge rt_puts_int.write
+	sub rsi, 1
+	mov byte [rsi], 45
+rt_puts_int.write:
+	mov rdx, rbp
+	sub rdx, rsi
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_bool:
+	test rdi, rdi
+	je rt_puts_bool.false
+	lea rsi, [rel rt_true]
+	mov rdx, 5
+	jmp rt_puts_bool.write
+rt_puts_bool.false:
+	lea rsi, [rel rt_false]
+	mov rdx, 6
+rt_puts_bool.write:
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	ret
+
+section .rodata
+rt_false:	db "false", 10
+rt_true:	db "true", 10
@@ -0,0 +1,16 @@
+let pick = fn(x, y, z) {
+  let a = x * 2;
+  let b = y * 3;
+  let c = z * 5;
+  let d = a + b;
+  let e = b + c;
+  let f = c + a;
+  let g = d * e;
+  let h = e * f;
+  let i = f * d;
+  let j = if (x < y) { g + h + i + a } else { g - h - i - b };
+  let k = if (y < z) { j * d + e } else { j * f - c };
+  a + b + c + d + e + f + g + h + i + j + k
+};
+puts(pick(1, 2, 3));
+puts(pick(3, 2, 1));
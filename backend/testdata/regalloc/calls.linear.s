@@ -0,0 +1,238 @@
+bits 64
+default rel
+
+section .text
+global _start
+
+_start:
+	call monkey_main
+	mov rdi, 0
+	mov rax, 60
+	syscall
+
+monkey_sq:
+monkey_sq.entry:
+	push rbp
+	mov rbp, rsp
+monkey_sq.b0:
+	mov rax, rdi
+	mov rcx, rax
+	imul rcx, rax
+	mov rax, rcx
+	mov rsp, rbp
+	pop rbp
+	ret
+
+monkey_sum:
+monkey_sum.entry:
+	push rbp
+	mov rbp, rsp
+monkey_sum.b0:
+	mov rax, rdi
+	mov rcx, rsi
+	mov rsi, rdx
+	mov rdx, rax
+	add rdx, rcx
+	mov rcx, rdx
+	add rcx, rsi
+	mov rax, rcx
+	mov rsp, rbp
+	pop rbp
+	ret
+
+monkey_spread:
+monkey_spread.entry:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 96
+	mov qword [rbp-56], rbx
+	mov qword [rbp-64], r12
+	mov qword [rbp-72], r13
+	mov qword [rbp-80], r14
+	mov qword [rbp-88], r15
+monkey_spread.b0:
+	mov rbx, rdi
+	mov r12, rsi
+	mov r13, rdx
+	mov r14, rcx
+	mov r15, r8
+	mov r10, r9
+	mov qword [rbp-8], r10
+	mov r10, qword [rbp+16]
+	mov qword [rbp-16], r10
+	mov r10, qword [rbp+24]
+	mov qword [rbp-24], r10
+	push rbx
+	pop rdi
+	call monkey_sq
+	mov rcx, rax
+	mov r10, rcx
+	mov qword [rbp-32], r10
+	mov r10, qword [rbp-32]
+	add r10, r12
+	mov qword [rbp-32], r10
+	push r13
+	pop rdi
+	call monkey_sq
+	mov rcx, rax
+	mov r10, rcx
+	mov qword [rbp-40], r10
+	mov r10, qword [rbp-40]
+	add r10, r14
+	mov qword [rbp-40], r10
+	mov r10, qword [rbp-16]
+	push r10
+	mov r10, qword [rbp-8]
+	push r10
+	push r15
+	pop rdi
+	pop rsi
+	pop rdx
+	call monkey_sum
+	mov rcx, rax
+	mov r10, rcx
+	mov qword [rbp-48], r10
+	mov r10, qword [rbp-48]
+	mov r11, qword [rbp-24]
+	add r10, r11
+	mov qword [rbp-48], r10
+	mov r10, qword [rbp-48]
+	push r10
+	mov r10, qword [rbp-40]
+	push r10
+	mov r10, qword [rbp-32]
+	push r10
+	pop rdi
+	pop rsi
+	pop rdx
+	call monkey_sum
+	mov rcx, rax
+	mov rax, rbx
+	add rax, r12
+	mov rdx, rax
+	add rdx, r13
+	mov rax, rdx
+	add rax, r14
+	mov rdx, rax
+	add rdx, r15
+	mov rax, rdx
+	mov r10, qword [rbp-8]
+	add rax, r10
+	mov rdx, rax
+	mov r10, qword [rbp-16]
+	add rdx, r10
+	mov rax, rdx
+	mov r10, qword [rbp-24]
+	add rax, r10
+	mov rdx, rax
+	mov r10, qword [rbp-32]
+	add rdx, r10
+	mov rax, rdx
+	mov r10, qword [rbp-40]
+	add rax, r10
+	mov rdx, rax
+	mov r10, qword [rbp-48]
+	add rdx, r10
+	mov rbx, rdx
+	add rbx, rcx
+	mov rax, rcx
+	mov r10, qword [rbp-32]
+	sub rax, r10
+	push rax
+	pop rdi
+	call monkey_sq
+	mov rcx, rax
+	mov rdx, rbx
+	add rdx, rcx
+	mov rax, rdx
+	mov rbx, qword [rbp-56]
+	mov r12, qword [rbp-64]
+	mov r13, qword [rbp-72]
+	mov r14, qword [rbp-80]
+	mov r15, qword [rbp-88]
+	mov rsp, rbp
+	pop rbp
+	ret
+
+monkey_main:
+monkey_main.entry:
+	push rbp
+	mov rbp, rsp
+monkey_main.b0:
+	push 8
+	push 7
+	push 6
+	push 5
+	push 4
+	push 3
+	push 2
+	push 1
+	pop rdi
+	pop rsi
+	pop rdx
+	pop rcx
+	pop r8
+	pop r9
+	call monkey_spread
+	add rsp, 16
+	mov rcx, rax
+	push rcx
+	pop rdi
+	call rt_puts_int
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_int:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 32
+	mov rax, rdi
+	lea rsi, [rbp-1]
+	mov byte [rsi], 10
+	mov r8, rax
+	test rax, rax
+	jge rt_puts_int.digits
+	neg rax
+rt_puts_int.digits:
+	mov rcx, 10
+rt_puts_int.loop:
+	mov rdx, 0
+	div rcx
+	add rdx, 48
+	sub rsi, 1
+	mov byte [rsi], dl
+	test rax, rax
+	jne rt_puts_int.loop
+	test r8, r8
+	jge rt_puts_int.write
+	sub rsi, 1
+	mov byte [rsi], 45
+rt_puts_int.write:
+	mov rdx, rbp
+	sub rdx, rsi
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_bool:
+	test rdi, rdi
+	je rt_puts_bool.false
+	lea rsi, [rel rt_true]
+	mov rdx, 5
+	jmp rt_puts_bool.write
+rt_puts_bool.false:
+	lea rsi, [rel rt_false]
+	mov rdx, 6
+rt_puts_bool.write:
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	ret
+
+section .rodata
+rt_false:	db "false", 10
+rt_true:	db "true", 10
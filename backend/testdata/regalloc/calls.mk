@@ -0,0 +1,10 @@
+let sq = fn(x) { x * x };
+let sum = fn(x, y, z) { x + y + z };
+let spread = fn(a, b, c, d, e, f, g, h) {
+  let p = sq(a) + b;
+  let q = sq(c) + d;
+  let r = sum(e, f, g) + h;
+  let s = sum(p, q, r);
+  a + b + c + d + e + f + g + h + p + q + r + s + sq(s - p)
+};
+puts(spread(1, 2, 3, 4, 5, 6, 7, 8));
@@ -0,0 +1,255 @@
+bits 64
+default rel
+
+section .text
+global _start
+
+_start:
+	call monkey_main
+	mov rdi, 0
+	mov rax, 60
+	syscall
+
+monkey_mix:
+monkey_mix.entry:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 128
+	mov qword [rbp-88], rbx
+	mov qword [rbp-96], r12
+	mov qword [rbp-104], r13
+	mov qword [rbp-112], r14
+	mov qword [rbp-120], r15
+monkey_mix.b0:
+	mov rax, rdi
+	mov rdi, rsi
+	mov rsi, rdx
+	mov rdx, rcx
+	mov rcx, rax
+	add rcx, rdi
+	mov r8, rdi
+	add r8, rsi
+	mov r9, rsi
+	add r9, rdx
+	mov rbx, rdx
+	add rbx, rax
+	mov r12, rcx
+	imul r12, r8
+	mov r13, r8
+	imul r13, r9
+	mov r14, r9
+	imul r14, rbx
+	mov r15, rbx
+	imul r15, rcx
+	mov r10, r12
+	mov qword [rbp-8], r10
+	mov r10, qword [rbp-8]
+	add r10, r13
+	mov qword [rbp-8], r10
+	mov r10, r13
+	mov qword [rbp-16], r10
+	mov r10, qword [rbp-16]
+	add r10, r14
+	mov qword [rbp-16], r10
+	mov r10, r14
+	mov qword [rbp-24], r10
+	mov r10, qword [rbp-24]
+	add r10, r15
+	mov qword [rbp-24], r10
+	mov r10, r15
+	mov qword [rbp-32], r10
+	mov r10, qword [rbp-32]
+	add r10, r12
+	mov qword [rbp-32], r10
+	mov qword [rbp-40], r15
+	mov r10, qword [rbp-8]
+	mov r15, r10
+	imul r15, rax
+	mov qword [rbp-48], r14
+	mov r10, qword [rbp-16]
+	mov r14, r10
+	imul r14, rdi
+	mov r10, r15
+	mov qword [rbp-56], r10
+	mov r10, qword [rbp-56]
+	sub r10, r14
+	mov qword [rbp-56], r10
+	mov r10, qword [rbp-16]
+	mov r14, r10
+	imul r14, rsi
+	mov r10, qword [rbp-24]
+	mov r15, r10
+	imul r15, rdx
+	mov r10, r14
+	mov qword [rbp-64], r10
+	mov r10, qword [rbp-64]
+	sub r10, r15
+	mov qword [rbp-64], r10
+	mov r10, qword [rbp-24]
+	mov r14, r10
+	imul r14, rax
+	mov r10, qword [rbp-32]
+	mov r15, r10
+	imul r15, rdi
+	mov r10, r14
+	mov qword [rbp-72], r10
+	mov r10, qword [rbp-72]
+	sub r10, r15
+	mov qword [rbp-72], r10
+	mov r10, qword [rbp-32]
+	mov r14, r10
+	imul r14, rsi
+	mov r10, qword [rbp-8]
+	mov r15, r10
+	imul r15, rdx
+	mov r10, r14
+	mov qword [rbp-80], r10
+	mov r10, qword [rbp-80]
+	sub r10, r15
+	mov qword [rbp-80], r10
+	mov r14, rax
+	add r14, rdi
+	mov rax, r14
+	add rax, rsi
+	mov rsi, rax
+	add rsi, rdx
+	mov rax, rsi
+	add rax, rcx
+	mov rcx, rax
+	add rcx, r8
+	mov rax, rcx
+	add rax, r9
+	mov rcx, rax
+	add rcx, rbx
+	mov rax, rcx
+	add rax, r12
+	mov rcx, rax
+	add rcx, r13
+	mov rax, rcx
+	mov r10, qword [rbp-48]
+	add rax, r10
+	mov rcx, rax
+	mov r10, qword [rbp-40]
+	add rcx, r10
+	mov rax, rcx
+	mov r10, qword [rbp-8]
+	add rax, r10
+	mov rcx, rax
+	mov r10, qword [rbp-16]
+	add rcx, r10
+	mov rax, rcx
+	mov r10, qword [rbp-24]
+	add rax, r10
+	mov rcx, rax
+	mov r10, qword [rbp-32]
+	add rcx, r10
+	mov rax, rcx
+	mov r10, qword [rbp-56]
+	add rax, r10
+	mov rcx, rax
+	mov r10, qword [rbp-64]
+	add rcx, r10
+	mov rax, rcx
+	mov r10, qword [rbp-72]
+	add rax, r10
+	mov rcx, rax
+	mov r10, qword [rbp-80]
+	add rcx, r10
+	mov rax, rcx
+	mov rbx, qword [rbp-88]
+	mov r12, qword [rbp-96]
+	mov r13, qword [rbp-104]
+	mov r14, qword [rbp-112]
+	mov r15, qword [rbp-120]
+	mov rsp, rbp
+	pop rbp
+	ret
+
+monkey_main:
+monkey_main.entry:
+	push rbp
+	mov rbp, rsp
+monkey_main.b0:
+	push 4
+	push 3
+	push 2
+	push 1
+	pop rdi
+	pop rsi
+	pop rdx
+	pop rcx
+	call monkey_mix
+	mov rcx, rax
+	push rcx
+	pop rdi
+	call rt_puts_int
+	push 8
+	push 7
+	push 6
+	push 5
+	pop rdi
+	pop rsi
+	pop rdx
+	pop rcx
+	call monkey_mix
+	mov rcx, rax
+	push rcx
+	pop rdi
+	call rt_puts_int
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_int:
+	push rbp
+	mov rbp, rsp
+	sub rsp, 32
+	mov rax, rdi
+	lea rsi, [rbp-1]
+	mov byte [rsi], 10
+	mov r8, rax
+	test rax, rax
+	jge rt_puts_int.digits
+	neg rax
+rt_puts_int.digits:
+	mov rcx, 10
+rt_puts_int.loop:
+	mov rdx, 0
+	div rcx
+	add rdx, 48
+	sub rsi, 1
+	mov byte [rsi], dl
+	test rax, rax
+	jne rt_puts_int.loop
+	test r8, r8
+	jge rt_puts_int.write
+	sub rsi, 1
+	mov byte [rsi], 45
+rt_puts_int.write:
+	mov rdx, rbp
+	sub rdx, rsi
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	mov rsp, rbp
+	pop rbp
+	ret
+
+rt_puts_bool:
+	test rdi, rdi
+	je rt_puts_bool.false
+	lea rsi, [rel rt_true]
+	mov rdx, 5
+	jmp rt_puts_bool.write
+rt_puts_bool.false:
+	lea rsi, [rel rt_false]
+	mov rdx, 6
+rt_puts_bool.write:
+	mov rdi, 1
+	mov rax, 1
+	syscall
+	ret
+
+section .rodata
+rt_false:	db "false", 10
+rt_true:	db "true", 10
@@ -0,0 +1,21 @@
+let mix = fn(a, b, c, d) {
+  let e = a + b;
+  let f = b + c;
+  let g = c + d;
+  let h = d + a;
+  let i = e * f;
+  let j = f * g;
+  let k = g * h;
+  let l = h * e;
+  let m = i + j;
+  let n = j + k;
+  let o = k + l;
+  let p = l + i;
+  let q = m * a - n * b;
+  let r = n * c - o * d;
+  let s = o * a - p * b;
+  let t = p * c - m * d;
+  a + b + c + d + e + f + g + h + i + j + k + l + m + n + o + p + q + r + s + t
+};
+puts(mix(1, 2, 3, 4));
+puts(mix(5, 6, 7, 8));
@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// regNames maps the physical registers to their 64-bit names.
+var regNames = [...]string{
+	"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+}
+
+// byteRegNames maps the physical registers to the names of their low byte.
+var byteRegNames = [...]string{
+	"al", "cl", "dl", "bl", "spl", "bpl", "sil", "dil",
+	"r8b", "r9b", "r10b", "r11b", "r12b", "r13b", "r14b", "r15b",
+}
+
+// argRegs are the registers the System V AMD64 calling convention passes the
+// first integer arguments in.
+var argRegs = []Reg{RDI, RSI, RDX, RCX, R8, R9}
+
+// callerSaved are the registers a call may overwrite.
+var callerSaved = []Reg{RAX, RCX, RDX, RSI, RDI, R8, R9, R10, R11}
+
+// calleeSaved are the registers a function must preserve for its caller.
+var calleeSaved = []Reg{RBX, R12, R13, R14, R15}
+
+// x86Registers is the register file of x86-64. rsp and rbp hold the frame,
+// and r10 and r11 are reserved for spill code, so instruction selection
+// never uses them. Caller-saved registers are preferred since using them
+// costs no save in the prologue.
+var x86Registers = &RegisterFile{
+	Names:        regNames[:],
+	Allocatable:  []Reg{RAX, RCX, RDX, RSI, RDI, R8, R9, RBX, R12, R13, R14, R15},
+	Scratch:      []Reg{R10, R11},
+	FramePointer: RBP,
+	StackPointer: RSP,
+}
+
+// x86Convention is the System V AMD64 calling convention.
+var x86Convention = &CallingConvention{
+	Args:        argRegs,
+	Result:      RAX,
+	CallerSaved: callerSaved,
+	CalleeSaved: calleeSaved,
+}
+
+// X86_64 is the x86-64 Linux target, generating NASM assembly or, through the
+// in-process encoder, ELF64 objects and executables.
+type X86_64 struct{}
+
+// Name returns the name of the target.
+func (X86_64) Name() string { return "x86_64-linux" }
+
+// Registers returns the register file of x86-64.
+func (X86_64) Registers() *RegisterFile { return x86Registers }
+
+// CallingConvention returns the System V AMD64 calling convention.
+func (X86_64) CallingConvention() *CallingConvention { return x86Convention }
+
+// SelectFunction selects x86-64 instructions for a function.
+func (X86_64) SelectFunction(fn *intermediate.Function) *Func { return selectFunction(fn) }
+
+// Load returns a mov from the slot into the register.
+func (X86_64) Load(r Reg, slot Operand) []*Instr { return []*Instr{x86Instr("mov", R(r), slot)} }
+
+// Store returns a mov from the register into the slot.
+func (X86_64) Store(slot Operand, r Reg) []*Instr { return []*Instr{x86Instr("mov", slot, R(r))} }
+
+// Jump returns a jmp to the label.
+func (X86_64) Jump(label string) *Instr { return x86Instr("jmp", Label(label)) }
+
+// FinishFunction adds the frame to the function and removes the jumps to the
+// next block.
+func (X86_64) FinishFunction(f *Func) {
+	insertFrame(f)
+	removeFallthroughJumps(f, "jmp")
+}
+
+// AddRuntime adds _start and the runtime routines printing values.
+func (X86_64) AddRuntime(prog *Program) {
+	prog.Funcs = append([]*Func{startFunc(prog.Entry)}, prog.Funcs...)
+	prog.Funcs = append(prog.Funcs, putsIntFunc(), putsBoolFunc())
+	for sym, s := range runtimeRodata() {
+		prog.Rodata[sym] = s
+	}
+}
+
+// PrintAssembly returns the program in NASM syntax.
+func (X86_64) PrintAssembly(prog *Program) (string, error) { return generateAssembly(prog) }
+
+// assemble encodes the program into machine code for an ELF file.
+func (X86_64) assemble(prog *Program) (*objectCode, error) { return assemble(prog) }
+
+// x86Instr creates an x86-64 instruction, deriving how it accesses its first
+// operand from the mnemonic.
+func x86Instr(op string, args ...Operand) *Instr {
+	return NewInstr(op, x86Access(op), args...)
+}
+
+// x86Access returns how the x86-64 instruction accesses its first operand.
+func x86Access(op string) Access {
+	switch op {
+	case "mov", "movzx", "lea", "pop", "setl", "setg", "sete", "setne":
+		return Write
+	case "cmp", "test", "push", "idiv", "div", "call", "ret", "syscall":
+		return Read
+	}
+	if op[0] == 'j' {
+		return Read
+	}
+	return ReadWrite
+}
+
+// formatOperand returns an operand in NASM syntax. Memory operands of
+// instructions whose size cannot be inferred from another operand are
+// annotated with the operand size.
+func formatOperand(a Operand, op string) string {
+	switch a.Kind {
+	case RegOperand:
+		if a.Reg.IsVirtual() {
+			return a.Reg.String()
+		}
+		if a.Byte {
+			return byteRegNames[a.Reg]
+		}
+		return regNames[a.Reg]
+	case ImmOperand:
+		return fmt.Sprintf("%d", a.Imm)
+	case MemOperand:
+		var addr string
+		switch {
+		case a.Reg == NoReg:
+			addr = fmt.Sprintf("[rel %s]", a.Sym)
+		case a.Imm > 0:
+			addr = fmt.Sprintf("[%s+%d]", formatOperand(R(a.Reg), ""), a.Imm)
+		case a.Imm < 0:
+			addr = fmt.Sprintf("[%s-%d]", formatOperand(R(a.Reg), ""), -a.Imm)
+		default:
+			addr = fmt.Sprintf("[%s]", formatOperand(R(a.Reg), ""))
+		}
+		if op == "lea" {
+			return addr
+		}
+		if a.Byte {
+			return "byte " + addr
+		}
+		return "qword " + addr
+	case LabelOperand:
+		return a.Sym
+	}
+	return "?"
+}
@@ -0,0 +1,231 @@
+// Package bytecode defines the instruction set of the virtual machine and
+// compiles parsed programs into it.
+//
+// The machine is a stack machine: instructions pop their operands off the
+// stack and push their results. Every instruction is an opcode byte followed
+// by its operands, which are big-endian unsigned integers of the widths given
+// by the definition of the opcode.
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Instructions represents a sequence of encoded instructions.
+type Instructions []byte
+
+// Opcode represents the operation of an instruction.
+type Opcode byte
+
+// The opcodes. The comments give the operands, then the effect on the stack.
+const (
+	// OpConstant pushes the constant with the operand index.
+	OpConstant Opcode = iota
+	// OpPop pops the top of the stack, the value of an expression statement.
+	OpPop
+
+	// OpAdd pops two values and pushes their sum, or concatenation for
+	// strings. The other binary operations follow the same pattern.
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+
+	// OpMinus pops a value and pushes its negation.
+	OpMinus
+	// OpBang pops a value and pushes whether it is false.
+	OpBang
+
+	// OpTrue, OpFalse and OpNull push the value.
+	OpTrue
+	OpFalse
+	OpNull
+
+	// OpJump jumps to the operand offset.
+	OpJump
+	// OpJumpNotTruthy pops a value and jumps to the operand offset if it is
+	// false.
+	OpJumpNotTruthy
+
+	// OpGetGlobal pushes the global with the operand index, and OpSetGlobal
+	// pops a value into it.
+	OpGetGlobal
+	OpSetGlobal
+	// OpGetLocal pushes the local of the current function with the operand
+	// index, and OpSetLocal pops a value into it.
+	OpGetLocal
+	OpSetLocal
+	// OpGetBuiltin pushes the builtin function with the operand index in
+	// object.Builtins.
+	OpGetBuiltin
+	// OpGetFree pushes the free variable of the current closure with the
+	// operand index.
+	OpGetFree
+	// OpCaptureLocal pushes the variable holding the local with the operand
+	// index, rather than its value, for OpClosure to capture: the closure
+	// sees the values the local is given after it is created. OpCaptureFree
+	// does the same for a free variable of the current closure.
+	OpCaptureLocal
+	OpCaptureFree
+	// OpCurrentClosure pushes the closure being executed, so that a function
+	// bound by let can call itself.
+	OpCurrentClosure
+
+	// OpArray pops the operand number of values and pushes an array of them.
+	OpArray
+	// OpHash pops the operand number of values, alternating keys and values,
+	// and pushes a hash of them.
+	OpHash
+	// OpIndex pops an index and a value and pushes the element at the index.
+	OpIndex
+
+	// OpCall calls the function below the operand number of arguments on the
+	// stack, and replaces them all with its result.
+	OpCall
+	// OpTailCall calls the function like OpCall and returns its result from
+	// the current function, reusing the frame of the current function.
+	OpTailCall
+	// OpReturnValue pops a value and returns it from the current function.
+	OpReturnValue
+	// OpReturn returns null from the current function.
+	OpReturn
+	// OpClosure pushes a closure of the function with the first operand index
+	// among the constants, capturing the second operand number of free
+	// variables popped off the stack, pushed by OpCaptureLocal, OpCaptureFree
+	// or OpCurrentClosure.
+	OpClosure
+)
+
+// Definition represents the encoding of an opcode.
+type Definition struct {
+	Name          string // The name of the opcode in listings.
+	OperandWidths []int  // The width in bytes of every operand.
+}
+
+// definitions maps every opcode to its definition.
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpJump:           {"OpJump", []int{2}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpCall:           {"OpCall", []int{1}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+}
+
+// Lookup returns the definition of an opcode.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction. It returns nil for an undefined opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return nil
+	}
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+	offset := 1
+	for n, o := range operands {
+		switch def.OperandWidths[n] {
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		case 1:
+			ins[offset] = byte(o)
+		}
+		offset += def.OperandWidths[n]
+	}
+	return ins
+}
+
+// ReadOperands decodes the operands of an instruction of the definition from
+// the instructions following its opcode, and returns them with the number of
+// bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for n, w := range def.OperandWidths {
+		switch w {
+		case 2:
+			operands[n] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[n] = int(ReadUint8(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
+
+// String returns a listing of the instructions, one per line preceded by its
+// offset.
+func (ins Instructions) String() string {
+	var b strings.Builder
+	for offset := 0; offset < len(ins); {
+		def, err := Lookup(ins[offset])
+		if err != nil {
+			fmt.Fprintf(&b, "ERROR: %s\n", err)
+			offset++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[offset+1:])
+		fmt.Fprintf(&b, "%04d %s", offset, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&b, " %d", o)
+		}
+		b.WriteString("\n")
+		offset += 1 + read
+	}
+	return b.String()
+}
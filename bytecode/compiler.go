@@ -0,0 +1,517 @@
+package bytecode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// CompiledFunction represents the code of a function literal. The virtual
+// machine wraps it in a closure with the free variables it captures.
+type CompiledFunction struct {
+	Instructions  Instructions // The code of the body.
+	NumLocals     int          // The number of locals, including the parameters.
+	NumParameters int          // The number of parameters, the first locals.
+	Parameters    []string     // The names of the parameters.
+	Name          string       // The name the function is bound to by let, or "".
+}
+
+func (f *CompiledFunction) Type() object.Type { return object.FunctionType }
+func (f *CompiledFunction) Inspect() string {
+	return "fn(" + strings.Join(f.Parameters, ", ") + ")"
+}
+
+// Bytecode represents a compiled program.
+type Bytecode struct {
+	Instructions Instructions    // The code of the top-level statements.
+	Constants    []object.Object // The constant pool.
+}
+
+// EmittedInstruction represents an instruction emitted into a scope.
+type EmittedInstruction struct {
+	Opcode   Opcode // The opcode.
+	Position int    // The offset of the instruction.
+}
+
+// CompilationScope represents the code of a function being compiled.
+type CompilationScope struct {
+	instructions        Instructions       // The code emitted so far.
+	lastInstruction     EmittedInstruction // The last instruction emitted.
+	previousInstruction EmittedInstruction // The instruction emitted before the last one.
+}
+
+// Compiler compiles parsed programs into bytecode.
+type Compiler struct {
+	constants  []object.Object    // The constant pool.
+	symbols    *SymbolTable       // The names visible in the block being compiled.
+	scopes     []CompilationScope // The code of the functions being compiled, innermost last.
+	scopeIndex int                // The index of the innermost scope.
+}
+
+// The limits of the encoding of the operands.
+const (
+	maxConstants = 1 << 16
+	maxGlobals   = 1 << 16
+	maxLocals    = 1 << 8
+	maxArgs      = 1<<8 - 1
+)
+
+// New returns a compiler for a new program.
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), nil)
+}
+
+// NewWithState returns a compiler that continues a program whose earlier parts
+// bound the globals of the symbol table and filled the constant pool, as the
+// REPL does.
+func NewWithState(symbols *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants: constants,
+		symbols:   symbols,
+		scopes:    []CompilationScope{{}},
+	}
+}
+
+// SymbolTable returns the symbol table of the top level, to continue the
+// program with NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbols
+}
+
+// Bytecode returns the compiled program.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{Instructions: c.currentInstructions(), Constants: c.constants}
+}
+
+// Compile compiles a program, or any node of one, into the top level.
+func (c *Compiler) Compile(node parser.Node) error {
+	return c.compile(node, false)
+}
+
+// errorf returns an error prefixed with the source position.
+func (c *Compiler) errorf(pos lexer.Position, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if pos.Line == 0 {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%d:%d: %s", pos.Line, pos.Column, msg)
+}
+
+// infixOps maps the infix operators of the source language to opcodes.
+var infixOps = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLessThan,
+	">":  OpGreaterThan,
+}
+
+// compile compiles a node. A node in tail position produces the result of
+// the function being compiled, so a call there becomes a tail call and does
+// not grow the stack of frames.
+func (c *Compiler) compile(node parser.Node, tail bool) error {
+	switch node := node.(type) {
+	case *parser.Program:
+		return c.compileStatements(node.Statements, false)
+
+	case *parser.BlockStatement:
+		outer := c.symbols
+		c.symbols = NewBlockSymbolTable(outer)
+		defer func() { c.symbols = outer }()
+		return c.compileStatements(node.Statements, tail)
+
+	case *parser.ExpressionStatement:
+		if node.Expression == nil {
+			return nil
+		}
+		if err := c.compile(node.Expression, tail); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+
+	case *parser.LetStatement:
+		return c.compileLet(node)
+
+	case *parser.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(OpReturn)
+			return nil
+		}
+		if err := c.compile(node.ReturnValue, c.scopeIndex > 0); err != nil {
+			return err
+		}
+		c.emit(OpReturnValue)
+
+	case *parser.Identifier:
+		sym, ok := c.symbols.Resolve(node.Value)
+		if !ok {
+			return c.errorf(node.Token.Pos, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(sym)
+
+	case *parser.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value}, node.Token.Pos)
+
+	case *parser.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value}, node.Token.Pos)
+
+	case *parser.Boolean:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+
+	case *parser.PrefixExpression:
+		if err := c.compile(node.Right, false); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(OpBang)
+		case "-":
+			c.emit(OpMinus)
+		default:
+			return c.errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+
+	case *parser.InfixExpression:
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return c.errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+		if err := c.compile(node.Left, false); err != nil {
+			return err
+		}
+		if err := c.compile(node.Right, false); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *parser.IfExpression:
+		return c.compileIf(node, tail)
+
+	case *parser.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *parser.CallExpression:
+		if len(node.Arguments) > maxArgs {
+			return c.errorf(node.Token.Pos, "too many arguments: %d", len(node.Arguments))
+		}
+		if err := c.compile(node.Function, false); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.compile(a, false); err != nil {
+				return err
+			}
+		}
+		if tail {
+			c.emit(OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(OpCall, len(node.Arguments))
+		}
+
+	case *parser.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compile(el, false); err != nil {
+				return err
+			}
+		}
+		c.emit(OpArray, len(node.Elements))
+
+	case *parser.HashLiteral:
+		// The pairs are evaluated in source order, whatever the order of the
+		// map holding them.
+		var keys []parser.Expression
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return parser.Pos(keys[i]).Offset < parser.Pos(keys[j]).Offset })
+		for _, k := range keys {
+			if err := c.compile(k, false); err != nil {
+				return err
+			}
+			if err := c.compile(node.Pairs[k], false); err != nil {
+				return err
+			}
+		}
+		c.emit(OpHash, 2*len(keys))
+
+	case *parser.IndexExpression:
+		if err := c.compile(node.Left, false); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index, false); err != nil {
+			return err
+		}
+		c.emit(OpIndex)
+
+	default:
+		return c.errorf(parser.Pos(node), "unsupported node %T", node)
+	}
+	return nil
+}
+
+// compileStatements compiles a sequence of statements, the last one in tail
+// position if the sequence is. The names of the functions bound by let are
+// defined first, so that functions can call those defined after them.
+func (c *Compiler) compileStatements(stmts []parser.Statement, tail bool) error {
+	for _, stmt := range stmts {
+		let, ok := stmt.(*parser.LetStatement)
+		if !ok {
+			continue
+		}
+		if _, ok := let.Value.(*parser.FunctionLiteral); ok {
+			if _, defined := c.symbols.store[let.Name.Value]; !defined {
+				if err := c.define(let.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for n, stmt := range stmts {
+		if err := c.compile(stmt, tail && n == len(stmts)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// define binds the name of an identifier in the current block.
+func (c *Compiler) define(name *parser.Identifier) error {
+	sym := c.symbols.Define(name.Value)
+	if sym.Scope == LocalScope && sym.Index >= maxLocals || sym.Index >= maxGlobals {
+		return c.errorf(name.Token.Pos, "too many bindings")
+	}
+	return nil
+}
+
+// compileLet compiles a let statement. The name of a function is already
+// defined, and the name of any other value is defined after compiling it, so
+// that it is not visible to the expression.
+func (c *Compiler) compileLet(let *parser.LetStatement) error {
+	if lit, ok := let.Value.(*parser.FunctionLiteral); ok {
+		if err := c.compileFunction(lit, let.Name.Value); err != nil {
+			return err
+		}
+	} else {
+		if err := c.compile(let.Value, false); err != nil {
+			return err
+		}
+		if err := c.define(let.Name); err != nil {
+			return err
+		}
+	}
+	sym, _ := c.symbols.Resolve(let.Name.Value)
+	if sym.Scope == GlobalScope {
+		c.emit(OpSetGlobal, sym.Index)
+	} else {
+		c.emit(OpSetLocal, sym.Index)
+	}
+	return nil
+}
+
+// compileIf compiles an if expression. Each branch leaves its value on the
+// stack, null when it has none.
+func (c *Compiler) compileIf(node *parser.IfExpression, tail bool) error {
+	if err := c.compile(node.Condition, false); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(OpJumpNotTruthy, 0)
+	if err := c.compileBranch(node.Consequence, tail); err != nil {
+		return err
+	}
+	jump := c.emit(OpJump, 0)
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	if err := c.compileBranch(node.Alternative, tail); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBranch compiles a branch of an if expression, which may be missing,
+// so that it leaves its value on the stack.
+func (c *Compiler) compileBranch(block *parser.BlockStatement, tail bool) error {
+	if block == nil {
+		c.emit(OpNull)
+		return nil
+	}
+	if err := c.compile(block, tail); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(OpNull)
+	}
+	return nil
+}
+
+// compileFunction compiles a function literal into a constant and emits the
+// creation of its closure. The name is that bound to the function by let.
+func (c *Compiler) compileFunction(lit *parser.FunctionLiteral, name string) error {
+	c.enterScope()
+	if name != "" {
+		c.symbols.DefineFunctionName(name)
+	}
+	var params []string
+	for _, p := range lit.Parameters {
+		if err := c.define(p); err != nil {
+			return err
+		}
+		params = append(params, p.Value)
+	}
+	if lit.Body != nil {
+		if err := c.compileStatements(lit.Body.Statements, true); err != nil {
+			return err
+		}
+	}
+	if c.lastInstructionIs(OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(OpReturnValue) {
+		c.emit(OpReturn)
+	}
+
+	free := c.symbols.FreeSymbols
+	numLocals := c.symbols.NumDefinitions()
+	instructions := c.leaveScope()
+	for _, sym := range free {
+		c.captureSymbol(sym)
+	}
+	fn := &CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(lit.Parameters),
+		Parameters:    params,
+		Name:          name,
+	}
+	index, err := c.addConstant(fn, lit.Token.Pos)
+	if err != nil {
+		return err
+	}
+	c.emit(OpClosure, index, len(free))
+	return nil
+}
+
+// loadSymbol emits the instruction pushing the value of a symbol.
+func (c *Compiler) loadSymbol(sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(OpGetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(OpGetLocal, sym.Index)
+	case BuiltinScope:
+		c.emit(OpGetBuiltin, sym.Index)
+	case FreeScope:
+		c.emit(OpGetFree, sym.Index)
+	case FunctionScope:
+		c.emit(OpCurrentClosure)
+	}
+}
+
+// captureSymbol emits the instruction pushing a symbol of the current function
+// for a closure to capture. Locals and free variables are captured as the
+// variables holding them, so that the closure sees the bindings made after
+// it is created, like the evaluator does; the function being defined is
+// captured as its value.
+func (c *Compiler) captureSymbol(sym Symbol) {
+	switch sym.Scope {
+	case LocalScope:
+		c.emit(OpCaptureLocal, sym.Index)
+	case FreeScope:
+		c.emit(OpCaptureFree, sym.Index)
+	default:
+		c.loadSymbol(sym)
+	}
+}
+
+// addConstant adds a value to the constant pool and returns its index.
+func (c *Compiler) addConstant(obj object.Object, pos lexer.Position) (int, error) {
+	if len(c.constants) >= maxConstants {
+		return 0, c.errorf(pos, "too many constants")
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// emitConstant emits the instruction pushing a new constant.
+func (c *Compiler) emitConstant(obj object.Object, pos lexer.Position) error {
+	index, err := c.addConstant(obj, pos)
+	if err != nil {
+		return err
+	}
+	c.emit(OpConstant, index)
+	return nil
+}
+
+// emit appends an instruction to the current scope and returns its offset.
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, Make(op, operands...)...)
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+	return pos
+}
+
+// currentInstructions returns the code of the current scope.
+func (c *Compiler) currentInstructions() Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// lastInstructionIs returns true if the last instruction of the current scope
+// has the opcode.
+func (c *Compiler) lastInstructionIs(op Opcode) bool {
+	scope := c.scopes[c.scopeIndex]
+	return len(scope.instructions) > 0 && scope.lastInstruction.Opcode == op
+}
+
+// removeLastPop removes the last instruction, an OpPop, so that the value of
+// the expression statement it ends stays on the stack.
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// replaceLastPopWithReturn replaces the last instruction, an OpPop, with an
+// OpReturnValue, so that a function returns the value of its last expression
+// statement.
+func (c *Compiler) replaceLastPopWithReturn() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions[scope.lastInstruction.Position] = byte(OpReturnValue)
+	scope.lastInstruction.Opcode = OpReturnValue
+}
+
+// changeOperand replaces the operand of the instruction at the offset, to
+// patch a jump once its target is known.
+func (c *Compiler) changeOperand(pos int, operand int) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], Make(Opcode(ins[pos]), operand))
+}
+
+// enterScope starts compiling a function.
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbols = NewEnclosedSymbolTable(c.symbols)
+}
+
+// leaveScope finishes compiling a function and returns its code.
+func (c *Compiler) leaveScope() Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbols = c.symbols.Outer
+	return instructions
+}
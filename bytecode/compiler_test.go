@@ -0,0 +1,196 @@
+package bytecode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// compile compiles a program, failing the test on errors.
+func compile(t *testing.T, source string) *Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("%s: parse errors: %v", source, errs)
+	}
+	c := New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("%s: %s", source, err)
+	}
+	return c.Bytecode()
+}
+
+// listing returns the listing of the top-level code followed by those of the
+// compiled functions among the constants, in the order of the pool.
+func listing(bc *Bytecode) string {
+	parts := []string{bc.Instructions.String()}
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*CompiledFunction); ok {
+			parts = append(parts, fn.Instructions.String())
+		}
+	}
+	return strings.Join(parts, "--\n")
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"redefined global", "let a = 1; let a = 2; a;", `0000 OpConstant 0
+0003 OpSetGlobal 0
+0006 OpConstant 1
+0009 OpSetGlobal 0
+0012 OpGetGlobal 0
+0015 OpPop
+`},
+		{"redefined local", "fn() { let a = 1; let a = a; }", `0000 OpClosure 1 0
+0004 OpPop
+--
+0000 OpConstant 0
+0003 OpSetLocal 0
+0005 OpGetLocal 0
+0007 OpSetLocal 0
+0009 OpReturn
+`},
+		{"captured local", "fn(a) { fn() { a } }", `0000 OpClosure 1 0
+0004 OpPop
+--
+0000 OpGetFree 0
+0002 OpReturnValue
+--
+0000 OpCaptureLocal 0
+0002 OpClosure 0 1
+0006 OpReturnValue
+`},
+		{"captured free variable", "fn(a) { fn() { fn() { a } } }", `0000 OpClosure 2 0
+0004 OpPop
+--
+0000 OpGetFree 0
+0002 OpReturnValue
+--
+0000 OpCaptureFree 0
+0002 OpClosure 0 1
+0006 OpReturnValue
+--
+0000 OpCaptureLocal 0
+0002 OpClosure 1 1
+0006 OpReturnValue
+`},
+		{"recursive closure", "let f = fn() { f() };", `0000 OpClosure 0 0
+0004 OpSetGlobal 0
+--
+0000 OpCurrentClosure
+0001 OpTailCall 0
+0003 OpReturnValue
+`},
+		{"function defined later", "let f = fn() { g() }; let g = fn() { 1 };", `0000 OpClosure 0 0
+0004 OpSetGlobal 0
+0007 OpClosure 2 0
+0011 OpSetGlobal 1
+--
+0000 OpGetGlobal 1
+0003 OpTailCall 0
+0005 OpReturnValue
+--
+0000 OpConstant 1
+0003 OpReturnValue
+`},
+		{"hash", `{"b": 1, "a": 2}`, `0000 OpConstant 0
+0003 OpConstant 1
+0006 OpConstant 2
+0009 OpConstant 3
+0012 OpHash 4
+0015 OpPop
+`},
+		{"builtin", "len([1])", `0000 OpGetBuiltin 0
+0002 OpConstant 0
+0005 OpArray 1
+0008 OpCall 1
+0010 OpPop
+`},
+		{"missing branch", "if (true) { 1 }", `0000 OpTrue
+0001 OpJumpNotTruthy 10
+0004 OpConstant 0
+0007 OpJump 11
+0010 OpNull
+0011 OpPop
+`},
+	}
+	for _, tt := range tests {
+		if got := listing(compile(t, tt.source)); got != tt.want {
+			t.Errorf("%s: got\n%swant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestHashKeysInSourceOrder checks that the pairs of a hash literal are
+// compiled in the order of the source, whatever the order of the map.
+func TestHashKeysInSourceOrder(t *testing.T) {
+	bc := compile(t, `{"e": 1, "d": 2, "c": 3, "b": 4, "a": 5}`)
+	var keys []string
+	for n := 0; n < len(bc.Constants); n += 2 {
+		keys = append(keys, bc.Constants[n].(*object.String).Value)
+	}
+	if got := strings.Join(keys, ""); got != "edcba" {
+		t.Errorf("got keys in the order %s, want edcba", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"puts(x);", "1:6: identifier not found: x"},
+		{"let f = fn() { let a = 1; }; a;", "1:30: identifier not found: a"},
+		{"if (true) { let b = 1; } b;", "1:26: identifier not found: b"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.source))
+		err := New().Compile(p.ParseProgram())
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefined global: got %+v, want %+v", again, a)
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.DefineFunctionName("f")
+	b := fn.Define("b")
+	block := NewBlockSymbolTable(fn)
+	shadow := block.Define("b")
+	if shadow == b || shadow.Index != 1 || fn.NumDefinitions() != 2 {
+		t.Errorf("shadowing local: got %+v and %d locals, want index 1 of 2", shadow, fn.NumDefinitions())
+	}
+	if own := fn.Define("f"); own.Scope != LocalScope {
+		t.Errorf("local named like the function: got %+v, want a local", own)
+	}
+
+	inner := NewEnclosedSymbolTable(block)
+	free, ok := inner.Resolve("b")
+	if !ok || free.Scope != FreeScope || free.Index != 0 || inner.FreeSymbols[0] != shadow {
+		t.Errorf("free variable: got %+v capturing %+v, want free 0 capturing %+v", free, inner.FreeSymbols, shadow)
+	}
+	if sym, _ := inner.Resolve("a"); sym != a {
+		t.Errorf("global from a function: got %+v, want %+v", sym, a)
+	}
+	if sym, ok := inner.Resolve("len"); !ok || sym.Scope != BuiltinScope {
+		t.Errorf("builtin: got %+v", sym)
+	}
+	if _, ok := inner.Resolve("missing"); ok {
+		t.Error("resolved an undefined name")
+	}
+}
@@ -0,0 +1,132 @@
+package bytecode
+
+import "github.com/user/golang-interpreter/object"
+
+// SymbolScope represents where the value of a name is stored.
+type SymbolScope string
+
+// The scopes of symbols.
+const (
+	// GlobalScope names a global, bound at the top level.
+	GlobalScope SymbolScope = "GLOBAL"
+	// LocalScope names a local of the current function: a parameter or a
+	// let binding in its body.
+	LocalScope SymbolScope = "LOCAL"
+	// BuiltinScope names a builtin function.
+	BuiltinScope SymbolScope = "BUILTIN"
+	// FreeScope names a local of an enclosing function captured by the
+	// closure of the current function.
+	FreeScope SymbolScope = "FREE"
+	// FunctionScope names the function being defined by a let statement,
+	// inside its own body.
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol represents a name and the storage of its value.
+type Symbol struct {
+	Name  string      // The name.
+	Scope SymbolScope // Where the value is stored.
+	Index int         // The index of the value within its scope.
+}
+
+// SymbolTable represents the names visible in a block of the program. Every
+// function, and the top level, has a table of its own, and every block within
+// them a table that allocates its names in the table of the function, so that
+// names bound in a block go out of scope at its end like in the compiled code.
+type SymbolTable struct {
+	Outer       *SymbolTable      // The enclosing table, or nil for the builtins.
+	FreeSymbols []Symbol          // The symbols of the enclosing functions captured, in order, for function tables.
+	store       map[string]Symbol // The symbols defined in the table.
+	block       bool              // Whether the table is that of a block within a function.
+	definitions int               // The number of locals or globals allocated, for function tables.
+}
+
+// NewSymbolTable returns the table of the top level, whose outer table defines
+// the builtin functions.
+func NewSymbolTable() *SymbolTable {
+	builtins := &SymbolTable{store: make(map[string]Symbol)}
+	for n, b := range object.Builtins {
+		builtins.store[b.Name] = Symbol{Name: b.Name, Scope: BuiltinScope, Index: n}
+	}
+	return NewEnclosedSymbolTable(builtins)
+}
+
+// NewEnclosedSymbolTable returns the table of a function enclosed by the outer
+// table.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]Symbol)}
+}
+
+// NewBlockSymbolTable returns the table of a block enclosed by the outer
+// table, within the same function.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]Symbol), block: true}
+}
+
+// function returns the table of the function the table belongs to.
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// global returns true if the table belongs to the top level.
+func (s *SymbolTable) global() bool {
+	return s.function().Outer.Outer == nil
+}
+
+// NumDefinitions returns the number of locals of the function the table
+// belongs to, or the number of globals at the top level.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.function().definitions
+}
+
+// Define binds a name in the table to a new global or local. A name the table
+// already binds to a global or local keeps its storage, so that binding it
+// again is seen by the functions that read it, as in the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	if sym, ok := s.store[name]; ok && (sym.Scope == GlobalScope || sym.Scope == LocalScope) {
+		return sym
+	}
+	fn := s.function()
+	sym := Symbol{Name: name, Scope: LocalScope, Index: fn.definitions}
+	if s.global() {
+		sym.Scope = GlobalScope
+	}
+	fn.definitions++
+	s.store[name] = sym
+	return sym
+}
+
+// DefineFunctionName binds the name of the function the table belongs to.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	sym := Symbol{Name: name, Scope: FunctionScope}
+	s.store[name] = sym
+	return sym
+}
+
+// Resolve returns the symbol a name refers to in the table. A local of an
+// enclosing function becomes a free variable of every function in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	if sym, ok := s.store[name]; ok {
+		return sym, true
+	}
+	if s.Outer == nil {
+		return Symbol{}, false
+	}
+	sym, ok := s.Outer.Resolve(name)
+	if !ok || s.block || sym.Scope == GlobalScope || sym.Scope == BuiltinScope {
+		return sym, ok
+	}
+	return s.defineFree(sym), true
+}
+
+// defineFree binds a name in a function table to a new free variable
+// capturing the symbol of the enclosing function.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	sym := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = sym
+	return sym
+}
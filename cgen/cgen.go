@@ -0,0 +1,309 @@
+// Package cgen translates the intermediate representation into portable C99,
+// as a fallback for machines the native backends do not support.
+//
+// Every Monkey function becomes a C function whose basic blocks are labels
+// jumped to with goto, and every value becomes a local variable. The
+// generated file includes monkey.h, the runtime header written next to it,
+// so the program builds with any C99 compiler:
+//
+//	cc -O2 -o prog prog.c
+//
+// Tail calls of other functions become return statements calling them,
+// which C compilers turn into jumps when optimizing. The runtime has no heap
+// objects yet, since intermediate.Lower rejects the strings, arrays, hashes
+// and closures that would need them.
+package cgen
+
+import (
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// TargetName is the name of the C target accepted by the --target flag.
+const TargetName = "c"
+
+// HeaderName is the name of the runtime header the generated code includes.
+const HeaderName = "monkey.h"
+
+// header is the runtime header.
+//
+//go:embed monkey.h
+var header string
+
+// GenerateCode translates the module to C and writes it to the output file,
+// and the runtime header to the same directory. C is the only output format
+// of the target, and is also emitted for asm.
+//
+// A file named like the header that is not the runtime header is never
+// overwritten: GenerateCode fails instead, before writing anything.
+func GenerateCode(module *intermediate.Module, outputFile string, emit string) error {
+	switch emit {
+	case "", "asm", TargetName:
+	default:
+		return fmt.Errorf("target %s cannot emit %s files, only c", TargetName, emit)
+	}
+	headerFile := filepath.Join(filepath.Dir(outputFile), HeaderName)
+	existing, err := ioutil.ReadFile(headerFile)
+	switch {
+	case err == nil && string(existing) != header:
+		return fmt.Errorf("%s exists and is not the runtime header; remove it or write the C file to another directory", headerFile)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if err := ioutil.WriteFile(outputFile, []byte(Translate(module)), 0644); err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	return ioutil.WriteFile(headerFile, []byte(header), 0644)
+}
+
+// Translate returns the C translation unit of the module.
+func Translate(module *intermediate.Module) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/* Generated from Monkey; build with a C99 compiler. */\n")
+	fmt.Fprintf(&b, "#include %q\n", HeaderName)
+
+	if len(module.Globals) > 0 {
+		b.WriteString("\n")
+		for _, g := range module.Globals {
+			fmt.Fprintf(&b, "static int64_t %s;\n", globalName(g))
+		}
+	}
+
+	// Declare every function first, since they may call each other.
+	b.WriteString("\n")
+	for _, fn := range module.Functions {
+		fmt.Fprintf(&b, "%s;\n", prototype(fn))
+	}
+	for _, fn := range module.Functions {
+		b.WriteString("\n")
+		translateFunction(&b, fn)
+	}
+
+	fmt.Fprintf(&b, "\nint main(void) {\n\t%s();\n\treturn 0;\n}\n", funcName(intermediate.MainFunction))
+	return b.String()
+}
+
+// funcName returns the C name of a Monkey function. Names are prefixed so
+// that they clash neither with C keywords nor with the C library.
+func funcName(name string) string {
+	return "mk_fn_" + name
+}
+
+// globalName returns the C name of a global.
+func globalName(name string) string {
+	return "mk_global_" + name
+}
+
+// valueName returns the C variable holding the value of an instruction.
+func valueName(v *intermediate.Instr) string {
+	return fmt.Sprintf("v%d", v.ID)
+}
+
+// cType returns the C type holding values of the type.
+func cType(t intermediate.Type) string {
+	switch t {
+	case intermediate.TypeInt:
+		return "int64_t"
+	case intermediate.TypeBool:
+		return "bool"
+	}
+	return "void"
+}
+
+// prototype returns the declarator of the function.
+func prototype(fn *intermediate.Function) string {
+	var params []string
+	for _, p := range fn.Params {
+		params = append(params, cType(p.Type)+" "+valueName(p))
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	return fmt.Sprintf("%s %s(%s)", cType(fn.ReturnType), funcName(fn.Name), strings.Join(params, ", "))
+}
+
+// translator translates one function.
+type translator struct {
+	b    *strings.Builder
+	uses []int // The number of uses of every value.
+}
+
+// translateFunction writes the definition of the function. The blocks are
+// written in reverse postorder, which leaves out the unreachable ones.
+func translateFunction(b *strings.Builder, fn *intermediate.Function) {
+	t := &translator{b: b, uses: fn.Uses()}
+	blocks := intermediate.ReversePostorder(fn)
+
+	fmt.Fprintf(b, "%s {\n", prototype(fn))
+	for _, blk := range blocks {
+		for _, in := range blk.Instrs {
+			if t.needsVariable(in) {
+				fmt.Fprintf(b, "\t%s %s;\n", cType(in.Type), valueName(in))
+			}
+		}
+	}
+	for _, blk := range blocks {
+		if len(blk.Preds) > 0 {
+			fmt.Fprintf(b, "%s:\n", blk.Label())
+		}
+		for _, in := range blk.Instrs {
+			t.instr(in)
+		}
+	}
+	b.WriteString("}\n")
+}
+
+// needsVariable returns true if the value of the instruction is held in a
+// variable of its own. Constants are written where they are used and
+// parameters are the parameters of the C function.
+func (t *translator) needsVariable(in *intermediate.Instr) bool {
+	switch in.Op {
+	case intermediate.OpConst, intermediate.OpParam:
+		return false
+	}
+	return in.Type != intermediate.TypeVoid && (t.uses[in.ID] > 0 || in.Op == intermediate.OpPhi)
+}
+
+// operand returns the C expression of a value.
+func operand(v *intermediate.Instr) string {
+	if v.Op != intermediate.OpConst {
+		return valueName(v)
+	}
+	if v.Type == intermediate.TypeBool {
+		if v.Const != 0 {
+			return "true"
+		}
+		return "false"
+	}
+	if v.Const == -1<<63 {
+		// The most negative integer cannot be written as a literal.
+		return "INT64_MIN"
+	}
+	return fmt.Sprintf("INT64_C(%d)", v.Const)
+}
+
+// helpers maps the arithmetic operations to the runtime functions performing
+// them, and the comparisons to C operators.
+var (
+	helpers = map[intermediate.Op]string{
+		intermediate.OpAdd: "mk_add",
+		intermediate.OpSub: "mk_sub",
+		intermediate.OpMul: "mk_mul",
+		intermediate.OpDiv: "mk_div",
+	}
+	comparisons = map[intermediate.Op]string{
+		intermediate.OpEq: "==",
+		intermediate.OpNe: "!=",
+		intermediate.OpLt: "<",
+		intermediate.OpGt: ">",
+	}
+)
+
+// expr returns the C expression computing the value of an instruction, or
+// performing it if it has no value.
+func expr(in *intermediate.Instr) string {
+	switch in.Op {
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul, intermediate.OpDiv:
+		return fmt.Sprintf("%s(%s, %s)", helpers[in.Op], operand(in.Args[0]), operand(in.Args[1]))
+	case intermediate.OpEq, intermediate.OpNe, intermediate.OpLt, intermediate.OpGt:
+		return fmt.Sprintf("%s %s %s", operand(in.Args[0]), comparisons[in.Op], operand(in.Args[1]))
+	case intermediate.OpNeg:
+		return fmt.Sprintf("mk_neg(%s)", operand(in.Args[0]))
+	case intermediate.OpNot:
+		return "!" + operand(in.Args[0])
+	case intermediate.OpZext:
+		return fmt.Sprintf("(int64_t)%s", operand(in.Args[0]))
+	case intermediate.OpLoadGlobal:
+		return globalName(in.Name)
+	case intermediate.OpCall, intermediate.OpTailCall:
+		return call(in)
+	}
+	return ""
+}
+
+// call returns the C call of the callee of the instruction. Calls of puts go
+// to the runtime function printing the type of the argument.
+func call(in *intermediate.Instr) string {
+	if in.Name == "puts" {
+		if in.Args[0].Type == intermediate.TypeBool {
+			return fmt.Sprintf("mk_puts_bool(%s)", operand(in.Args[0]))
+		}
+		return fmt.Sprintf("mk_puts_int(%s)", operand(in.Args[0]))
+	}
+	var args []string
+	for _, a := range in.Args {
+		args = append(args, operand(a))
+	}
+	return fmt.Sprintf("%s(%s)", funcName(in.Name), strings.Join(args, ", "))
+}
+
+// instr writes the statement of an instruction.
+func (t *translator) instr(in *intermediate.Instr) {
+	switch in.Op {
+	case intermediate.OpConst, intermediate.OpParam, intermediate.OpPhi:
+		// Constants are written where they are used, parameters are those
+		// of the C function, and phis are assigned by their predecessors.
+
+	case intermediate.OpStoreGlobal:
+		fmt.Fprintf(t.b, "\t%s = %s;\n", globalName(in.Name), operand(in.Args[0]))
+
+	case intermediate.OpJump:
+		t.b.WriteString("\t")
+		t.edge(in.Block, in.Targets[0])
+		t.b.WriteString("\n")
+
+	case intermediate.OpBranch:
+		fmt.Fprintf(t.b, "\tif (%s) ", operand(in.Args[0]))
+		t.edge(in.Block, in.Targets[0])
+		t.b.WriteString(" else ")
+		t.edge(in.Block, in.Targets[1])
+		t.b.WriteString("\n")
+
+	case intermediate.OpReturn:
+		if len(in.Args) == 0 {
+			t.b.WriteString("\treturn;\n")
+		} else {
+			fmt.Fprintf(t.b, "\treturn %s;\n", operand(in.Args[0]))
+		}
+
+	case intermediate.OpTailCall:
+		fmt.Fprintf(t.b, "\treturn %s;\n", expr(in))
+
+	default:
+		switch {
+		case t.needsVariable(in):
+			fmt.Fprintf(t.b, "\t%s = %s;\n", valueName(in), expr(in))
+		case in.HasSideEffects():
+			fmt.Fprintf(t.b, "\t%s;\n", expr(in))
+		}
+	}
+}
+
+// edge writes the transfer of control from one block to another: the phis
+// of the target are assigned their operands through temporaries, since phis
+// of a loop header may read each other's values, then control jumps there.
+func (t *translator) edge(from, to *intermediate.Block) {
+	phis := to.Phis()
+	if len(phis) == 0 {
+		fmt.Fprintf(t.b, "goto %s;", to.Label())
+		return
+	}
+	n := to.PredIndex(from)
+	t.b.WriteString("{ ")
+	for k, phi := range phis {
+		fmt.Fprintf(t.b, "%s t%d = %s; ", cType(phi.Type), k, operand(phi.Args[n]))
+	}
+	for k, phi := range phis {
+		fmt.Fprintf(t.b, "%s = t%d; ", valueName(phi), k)
+	}
+	fmt.Fprintf(t.b, "goto %s; }", to.Label())
+}
@@ -0,0 +1,137 @@
+package cgen
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// update makes the tests rewrite their golden files instead of comparing
+// against them: go test ./cgen -update.
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// lower parses and lowers a Monkey program, and optimizes it at the level.
+func lower(t *testing.T, source string, level int) *intermediate.Module {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate.Optimize(module, intermediate.Passes(intermediate.Options{Level: level, InlineThreshold: intermediate.DefaultInlineThreshold}))
+	return module
+}
+
+// compile translates the module to C in dir and compiles it with gcc, and
+// returns the executable.
+func compile(t *testing.T, module *intermediate.Module, dir string) string {
+	t.Helper()
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc is not installed")
+	}
+	source := filepath.Join(dir, "main.c")
+	if err := GenerateCode(module, source, TargetName); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "a.out")
+	if out, err := exec.Command(gcc, "-std=c99", "-O2", "-Wall", "-Werror", "-o", exe, source).CombinedOutput(); err != nil {
+		t.Fatalf("gcc: %s\n%s", err, out)
+	}
+	return exe
+}
+
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mk"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := strings.TrimSuffix(file, ".mk") + ".out"
+		for _, level := range []int{0, 2} {
+			exe := compile(t, lower(t, string(source), level), t.TempDir())
+			out, err := exec.Command(exe).Output()
+			if err != nil {
+				t.Fatalf("%s at -O%d: %s", file, level, err)
+			}
+			if *update {
+				if err := ioutil.WriteFile(golden, out, 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s (run go test -update to create it)", err)
+			}
+			if string(out) != string(want) {
+				t.Errorf("%s at -O%d printed\n%swant\n%s", file, level, out, want)
+			}
+		}
+	}
+}
+
+func TestDivisionError(t *testing.T) {
+	for _, source := range []string{
+		`let zero = fn() { 0 }; puts(1); puts(1 / zero());`,
+		`let min = fn() { 0 - 9223372036854775807 - 1 }; puts(1); puts(min() / (0 - 1));`,
+	} {
+		exe := compile(t, lower(t, source, 0), t.TempDir())
+		cmd := exec.Command(exe)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+			t.Errorf("%s: got %v, want exit status 1", source, err)
+		}
+		if string(out) != "1\n" {
+			t.Errorf("%s: printed %q before the error, want %q", source, out, "1\n")
+		}
+		if !strings.Contains(stderr.String(), "integer division error") {
+			t.Errorf("%s: stderr %q does not report the division", source, stderr.String())
+		}
+	}
+}
+
+func TestGenerateCodeKeepsForeignHeader(t *testing.T) {
+	dir := t.TempDir()
+	headerFile := filepath.Join(dir, HeaderName)
+	if err := ioutil.WriteFile(headerFile, []byte("/* mine */\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "main.c")
+	if err := GenerateCode(lower(t, `puts(1);`, 0), source, TargetName); err == nil {
+		t.Fatal("GenerateCode overwrote a header it did not write")
+	}
+	if got, _ := ioutil.ReadFile(headerFile); string(got) != "/* mine */\n" {
+		t.Errorf("header changed to %q", got)
+	}
+	if _, err := ioutil.ReadFile(source); err == nil {
+		t.Error("GenerateCode wrote the C file despite failing")
+	}
+
+	// The runtime header itself is left as it is.
+	if err := ioutil.WriteFile(headerFile, []byte(header), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCode(lower(t, `puts(1);`, 0), source, TargetName); err != nil {
+		t.Error(err)
+	}
+}
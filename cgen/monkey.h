@@ -0,0 +1,43 @@
+/*
+ * monkey.h - runtime of the C programs generated from Monkey.
+ *
+ * Integers are int64_t and booleans are bool. The arithmetic wraps around
+ * like the native targets, rather than overflowing into undefined behavior,
+ * and an invalid division ends the program like the trap of the native
+ * targets: it reports the error and exits with status MK_RUNTIME_ERROR,
+ * after writing out what the program printed.
+ *
+ * There are no heap objects yet: the intermediate representation has no
+ * strings, arrays, hashes or closures, and the compiler rejects programs
+ * using them, so every value fits in a variable.
+ */
+#ifndef MONKEY_H
+#define MONKEY_H
+
+#include <inttypes.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+/* The exit status of a program ended by a runtime error. */
+#define MK_RUNTIME_ERROR 1
+
+static inline int64_t mk_add(int64_t a, int64_t b) { return (int64_t)((uint64_t)a + (uint64_t)b); }
+static inline int64_t mk_sub(int64_t a, int64_t b) { return (int64_t)((uint64_t)a - (uint64_t)b); }
+static inline int64_t mk_mul(int64_t a, int64_t b) { return (int64_t)((uint64_t)a * (uint64_t)b); }
+static inline int64_t mk_neg(int64_t a) { return (int64_t)(0 - (uint64_t)a); }
+
+static inline int64_t mk_div(int64_t a, int64_t b) {
+	if (b == 0 || (a == INT64_MIN && b == -1)) {
+		fflush(stdout);
+		fputs("monkey: integer division error\n", stderr);
+		exit(MK_RUNTIME_ERROR);
+	}
+	return a / b;
+}
+
+static inline void mk_puts_int(int64_t v) { printf("%" PRId64 "\n", v); }
+static inline void mk_puts_bool(bool v) { puts(v ? "true" : "false"); }
+
+#endif
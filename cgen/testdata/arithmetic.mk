@@ -0,0 +1,4 @@
+puts(1 + 2 * 3 - 4 / 2);
+puts(0 - 42);
+puts(9223372036854775807 + 1);
+puts(-(0 - 7) / 2);
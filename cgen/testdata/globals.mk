@@ -0,0 +1,5 @@
+let base = 40;
+let flag = base > 10;
+let add = fn(x) { base + x };
+puts(add(2));
+puts(flag);
@@ -0,0 +1,4 @@
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+puts(fib(25));
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+puts(sum(1000000, 0));
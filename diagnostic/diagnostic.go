@@ -0,0 +1,125 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// Severity represents how serious a diagnostic is.
+type Severity int
+
+const (
+	// Error represents a problem that prevents compilation.
+	Error Severity = iota
+	// Warning represents a likely mistake that does not prevent compilation.
+	Warning
+	// Note represents additional information, such as an optimization remark.
+	Note
+)
+
+// String returns the lower-case name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// Span represents a range of the input, from Start up to but not including End.
+type Span struct {
+	Start lexer.Position // The position of the first character.
+	End   lexer.Position // The position just after the last character.
+}
+
+// TokenSpan returns the span covering the given token.
+func TokenSpan(tok lexer.Token) Span {
+	end := tok.Pos
+	end.Offset += len(tok.Literal)
+	end.Column += len(tok.Literal)
+	return Span{Start: tok.Pos, End: end}
+}
+
+// Diagnostic represents a message about the input reported to the user.
+type Diagnostic struct {
+	Severity Severity // The severity of the diagnostic.
+	Code     string   // The kind of the diagnostic, used to suppress it, e.g. "unused-let".
+	Span     Span     // The part of the input the diagnostic is about.
+	Message  string   // The human-readable message.
+}
+
+// String returns the diagnostic in the form "line:column: severity: message [code]".
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%d:%d: %s: %s", d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Message)
+	if d.Code != "" {
+		s += " [" + d.Code + "]"
+	}
+	return s
+}
+
+// Filter returns the diagnostics whose code is not in suppressed. Errors are
+// never suppressed.
+func Filter(diags []Diagnostic, suppressed map[string]bool) []Diagnostic {
+	var kept []Diagnostic
+	for _, d := range diags {
+		if d.Severity != Error && suppressed[d.Code] {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// The formats in which Write writes diagnostics.
+const (
+	FormatText = "text" // "file:line:column: severity: message [code]", as for compilers.
+	FormatJSON = "json" // One JSON object per line, for tools.
+)
+
+// Write writes a diagnostic about the file to w in the format.
+func Write(w io.Writer, format, file string, d Diagnostic) error {
+	if format != FormatJSON {
+		_, err := fmt.Fprintf(w, "%s:%s\n", file, d)
+		return err
+	}
+	line, err := json.Marshal(struct {
+		File      string `json:"file"`
+		Line      int    `json:"line"`
+		Column    int    `json:"column"`
+		EndLine   int    `json:"endLine"`
+		EndColumn int    `json:"endColumn"`
+		Severity  string `json:"severity"`
+		Code      string `json:"code,omitempty"`
+		Message   string `json:"message"`
+	}{file, d.Span.Start.Line, d.Span.Start.Column, d.Span.End.Line, d.Span.End.Column, d.Severity.String(), d.Code, d.Message})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", line)
+	return err
+}
+
+// positioned matches the errors of the parser and of the compiler, which
+// start with the position of the problem.
+var positioned = regexp.MustCompile(`(?s)^(\d+):(\d+): (.*)$`)
+
+// FromError returns the error diagnostic of an error message in the form
+// "line:column: message", or of a message without a position.
+func FromError(msg string) Diagnostic {
+	d := Diagnostic{Severity: Error, Message: msg}
+	if m := positioned.FindStringSubmatch(msg); m != nil {
+		d.Span.Start.Line, _ = strconv.Atoi(m[1])
+		d.Span.Start.Column, _ = strconv.Atoi(m[2])
+		d.Span.End = d.Span.Start
+		d.Message = m[3]
+	}
+	return d
+}
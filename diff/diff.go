@@ -0,0 +1,179 @@
+// Package diff computes the line differences between two texts as the hunks
+// of a unified diff, for the outputs difftest compares and the files fmt
+// would change.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around a change by
+// default, as by diff -u.
+const DefaultContext = 3
+
+// maxCells bounds the size of the table used to compute a diff, which takes
+// eight bytes a cell. The lines between the first and the last difference of
+// longer texts are all shown as changed.
+const maxCells = 1 << 22
+
+// line represents a line of a diff: kept in both texts, deleted from the
+// first or inserted into the second.
+type line struct {
+	kind      byte   // ' ', '-' or '+'.
+	text      string // The text of the line, without its newline.
+	noNewline bool   // Whether the line ends its text without a newline.
+}
+
+// Unified returns the changes turning the text a into the text b as the hunks
+// of a unified diff with context lines around each change, which patch
+// applies, or the empty string if the texts are equal.
+func Unified(a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change and the extent of its hunk, which continues
+		// while at most twice the context separates changes, as the
+		// context of both would overlap or touch.
+		first := start
+		for first < len(lines) && lines[first].kind == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for n := first; n < len(lines) && n-last <= 2*context+1; n++ {
+			if lines[n].kind != ' ' {
+				last = n
+			}
+		}
+		from := first - context
+		if from < start {
+			from = start
+		}
+		to := last + context + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		aStart, bStart := 1, 1
+		for _, l := range lines[:from] {
+			if l.kind != '+' {
+				aStart++
+			}
+			if l.kind != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.kind != '+' {
+				aCount++
+			}
+			if l.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", l.kind, l.text)
+			if l.noNewline {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange returns the range of lines of a hunk header. An empty range
+// starts at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines returns the lines of a text, the last one marked if the text
+// does not end with a newline.
+func splitLines(s string) []line {
+	if s == "" {
+		return nil
+	}
+	var lines []line
+	for _, text := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		lines = append(lines, line{text: text})
+	}
+	lines[len(lines)-1].noNewline = !strings.HasSuffix(s, "\n")
+	return lines
+}
+
+// diffLines returns the lines of the diff turning the lines a into the lines
+// b, keeping a longest common subsequence of them. Lines are equal if their
+// texts and newlines are.
+func diffLines(a, b []line) []line {
+	// The lines common to the start and the end of both are kept without
+	// entering the table, which formatting mostly leaves small and which
+	// lets long outputs differing in a few lines be diffed.
+	var prefix, suffix []line
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, line{' ', a[0].text, a[0].noNewline})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		l := a[len(a)-1]
+		suffix = append([]line{{' ', l.text, l.noNewline}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	lines := prefix
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, l := range a {
+			lines = append(lines, line{'-', l.text, l.noNewline})
+		}
+		for _, l := range b {
+			lines = append(lines, line{'+', l.text, l.noNewline})
+		}
+		return append(lines, suffix...)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i].text, a[i].noNewline})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i].text, a[i].noNewline})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j].text, b[j].noNewline})
+			j++
+		}
+	}
+	return append(lines, suffix...)
+}
@@ -0,0 +1,58 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 3, ""},
+		{"inserted", "", "a\n", 3, "@@ -0,0 +1,1 @@\n+a\n"},
+		{"deleted", "a\n", "", 3, "@@ -1,1 +0,0 @@\n-a\n"},
+		{"changed", "a\nb\nc\n", "a\nx\nc\n", 1, "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"no newline", "a", "a\n", 3, "@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{"two hunks", "1\n2\n3\n4\n5\n6\n7\n", "x\n2\n3\n4\n5\n6\ny\n", 1, "@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n"},
+		{"joined hunks", "1\n2\n3\n4\n", "x\n2\n3\ny\n", 1, "@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n"},
+	}
+	for _, tt := range tests {
+		if got := Unified(tt.a, tt.b, tt.context); got != tt.want {
+			t.Errorf("%s: got\n%swant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestUnifiedLongTexts checks that texts whose table would be larger than
+// maxCells are diffed from their first to their last difference without it.
+func TestUnifiedLongTexts(t *testing.T) {
+	const n = 3000
+	var a, b, want strings.Builder
+	a.WriteString("same\n")
+	b.WriteString("same\n")
+	fmt.Fprintf(&want, "@@ -1,%d +1,%d @@\n same\n", n+2, n+2)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+	}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&want, "-a%d\n", i)
+	}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&want, "+b%d\n", i)
+	}
+	a.WriteString("end\n")
+	b.WriteString("end\n")
+	want.WriteString(" end\n")
+	if (n+1)*(n+1) <= maxCells {
+		t.Fatalf("%d lines fit in the table", n)
+	}
+	if got := Unified(a.String(), b.String(), 1); got != want.String() {
+		t.Errorf("got a diff of %d bytes, want %d", len(got), want.Len())
+	}
+}
@@ -0,0 +1,213 @@
+// Package difftest checks that the ways of executing Monkey programs agree:
+// it runs programs through the evaluator, the virtual machine and the
+// compiled backends, and reports the programs on which their output or
+// failure differs, reduced to the statements needed to show the difference.
+package difftest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/golang-interpreter/diff"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// RuntimeError is the exit status of a program ended by a runtime error,
+// whatever the path executing it. The paths report the error in their own
+// way, a message, a trap or a status of the C library, so every one is
+// normalized into this status and the class of the error.
+const RuntimeError = 1
+
+// The classes of runtime errors.
+const (
+	ClassDivision      = "division"       // A division by zero or overflowing.
+	ClassStackOverflow = "stack overflow" // Calls nested too deep.
+	ClassTimeout       = "timeout"        // A program running too long.
+	ClassCrash         = "crash"          // A compiled program killed by another signal.
+	ClassError         = "error"          // Any other error, such as a type mismatch.
+)
+
+// diffContext is the number of unchanged lines shown around a difference
+// between two outputs.
+const diffContext = 2
+
+// Result represents the outcome of executing a program.
+type Result struct {
+	Stdout   string // What the program printed.
+	ExitCode int    // The exit status, 0 if the program ran to completion.
+	Error    string // The runtime error or the signal that ended the program, if any.
+	Class    string // The class of the runtime error, if any.
+}
+
+// failed returns the result of a program that printed stdout and then
+// failed with the runtime error message.
+func failed(stdout, message string) Result {
+	return Result{Stdout: stdout, ExitCode: RuntimeError, Error: message, Class: classify(message)}
+}
+
+// classify returns the class of a runtime error message, as reported by the
+// evaluator, the virtual machine, the IR interpreter or the C and LLVM
+// runtimes.
+func classify(message string) string {
+	switch m := strings.ToLower(message); {
+	case strings.Contains(m, "division by zero"), strings.Contains(m, "overflow in division"), strings.Contains(m, "division error"):
+		return ClassDivision
+	case strings.Contains(m, "stack overflow"):
+		return ClassStackOverflow
+	case strings.Contains(m, "timed out"), strings.Contains(m, "step limit"):
+		return ClassTimeout
+	}
+	return ClassError
+}
+
+// agrees returns true if two results count as the same behaviour: the same
+// output, exit status and class of runtime error. The messages are not
+// compared, since they differ between paths for the same error.
+func (r Result) agrees(other Result) bool {
+	return r.Stdout == other.Stdout && r.ExitCode == other.ExitCode && r.Class == other.Class
+}
+
+// String returns a one-line summary of the result.
+func (r Result) String() string {
+	if r.ExitCode == 0 {
+		return "exit 0"
+	}
+	return fmt.Sprintf("exit %d (%s): %s", r.ExitCode, r.Class, strings.TrimSpace(r.Error))
+}
+
+// Outcome represents the result of executing a program along one path.
+type Outcome struct {
+	Path   string // The name of the path.
+	Result Result // The result, if the path could execute the program.
+	Err    error  // Why the path could not execute the program, or nil.
+}
+
+// Mismatch represents a program on which two paths disagree.
+type Mismatch struct {
+	Source    string    // The program, reduced to the statements needed to disagree.
+	Outcomes  []Outcome // The outcomes of every path on the reduced program.
+	Reference string    // The first path that executed the program.
+	Other     string    // The first path that disagrees with the reference.
+	Diff      string    // The differences between their outputs.
+}
+
+// String returns a report of the mismatch.
+func (m *Mismatch) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s disagrees with %s on:\n", m.Other, m.Reference)
+	for _, line := range strings.Split(strings.TrimRight(m.Source, "\n"), "\n") {
+		fmt.Fprintf(&b, "\t%s\n", line)
+	}
+	for _, o := range m.Outcomes {
+		if o.Err != nil {
+			fmt.Fprintf(&b, "%s: skipped: %s\n", o.Path, o.Err)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", o.Path, o.Result)
+		}
+	}
+	if m.Diff != "" {
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n%s", m.Reference, m.Other, m.Diff)
+	}
+	return b.String()
+}
+
+// Check executes the program along every path. It returns nil if all the
+// paths that could execute it agree, and the mismatch otherwise. It returns
+// an error if no path could execute the program, such as one that does not
+// parse.
+func Check(source string, paths []Path) (*Mismatch, error) {
+	first := run(source, paths)
+	if err := unexecuted(first); err != nil {
+		return nil, err
+	}
+	if _, _, ok := disagreement(first); !ok {
+		return nil, nil
+	}
+	source = minimize(source, paths)
+	outcomes := run(source, paths)
+	ref, other, _ := disagreement(outcomes)
+	return &Mismatch{
+		Source:    source,
+		Outcomes:  outcomes,
+		Reference: outcomes[ref].Path,
+		Other:     outcomes[other].Path,
+		Diff:      diff.Unified(outcomes[ref].Result.Stdout, outcomes[other].Result.Stdout, diffContext),
+	}, nil
+}
+
+// run executes the program along every path.
+func run(source string, paths []Path) []Outcome {
+	var outcomes []Outcome
+	for _, p := range paths {
+		result, err := p.Run(source)
+		outcomes = append(outcomes, Outcome{Path: p.Name, Result: result, Err: err})
+	}
+	return outcomes
+}
+
+// unexecuted returns an error if no path executed the program, naming why
+// the first one could not.
+func unexecuted(outcomes []Outcome) error {
+	for _, o := range outcomes {
+		if o.Err == nil {
+			return nil
+		}
+	}
+	if len(outcomes) == 0 {
+		return fmt.Errorf("no execution paths")
+	}
+	return fmt.Errorf("no path could execute the program: %s: %s", outcomes[0].Path, outcomes[0].Err)
+}
+
+// disagreement returns the index of the first outcome of a path that
+// executed the program and of the first one disagreeing with it, and whether
+// there is one.
+func disagreement(outcomes []Outcome) (int, int, bool) {
+	ref := -1
+	for n, o := range outcomes {
+		switch {
+		case o.Err != nil:
+		case ref < 0:
+			ref = n
+		case !o.Result.agrees(outcomes[ref].Result):
+			return ref, n, true
+		}
+	}
+	return 0, 0, false
+}
+
+// minimize removes top-level statements from a program on which the paths
+// disagree for as long as they still disagree, starting from the last
+// statement, and returns the reduced program.
+func minimize(source string, paths []Path) string {
+	stmts := split(source)
+	for changed := true; changed; {
+		changed = false
+		for n := len(stmts) - 1; n >= 0 && len(stmts) > 1; n-- {
+			candidate := append(append([]string(nil), stmts[:n]...), stmts[n+1:]...)
+			if _, _, ok := disagreement(run(strings.Join(candidate, ""), paths)); ok {
+				stmts = candidate
+				changed = true
+			}
+		}
+	}
+	return strings.Join(stmts, "")
+}
+
+// split returns the text of every top-level statement of a program, with the
+// text before the first one included in it. A program that does not parse is
+// one piece.
+func split(source string) []string {
+	program, err := parse(source)
+	if err != nil || len(program.Statements) == 0 {
+		return []string{source}
+	}
+	var pieces []string
+	start := 0
+	for _, stmt := range program.Statements[1:] {
+		end := parser.Pos(stmt).Offset
+		pieces = append(pieces, source[start:end])
+		start = end
+	}
+	return append(pieces, source[start:])
+}
@@ -0,0 +1,135 @@
+package difftest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// corpus returns the programs of the directory, by file name.
+func corpus(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.mk"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no programs in %s", dir)
+	}
+	result := make(map[string]string)
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[filepath.Base(file)] = string(source)
+	}
+	return result
+}
+
+// TestCorpus checks that every path available on this machine executes the
+// programs of testdata and agrees on them.
+func TestCorpus(t *testing.T) {
+	paths := Paths(t.TempDir())
+	for name, source := range corpus(t, "testdata") {
+		for _, o := range run(source, paths) {
+			if o.Err != nil {
+				t.Errorf("%s: %s cannot execute it: %s", name, o.Path, o.Err)
+			}
+		}
+		m, err := Check(source, paths)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if m != nil {
+			t.Errorf("%s: %s", name, m)
+		}
+	}
+}
+
+// TestCorpusRejected checks that the compiled paths reject the programs of
+// testdata/rejected with an error at a position, since their values have
+// other types in the evaluator, and that the interpreters execute them.
+func TestCorpusRejected(t *testing.T) {
+	positioned := regexp.MustCompile(`^\d+:\d+: `)
+	paths := Paths(t.TempDir())
+	for name, source := range corpus(t, filepath.Join("testdata", "rejected")) {
+		for _, o := range run(source, paths) {
+			switch o.Path {
+			case "evaluator", "vm":
+				if o.Err != nil {
+					t.Errorf("%s: %s cannot execute it: %s", name, o.Path, o.Err)
+				}
+			default:
+				if o.Err == nil || !positioned.MatchString(o.Err.Error()) {
+					t.Errorf("%s: %s: got %v, %s; want an error at a position", name, o.Path, o.Err, o.Result)
+				}
+			}
+		}
+		m, err := Check(source, paths)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if m != nil {
+			t.Errorf("%s: %s", name, m)
+		}
+	}
+}
+
+// TestRuntimeErrors checks that every path reports a division error with
+// the same exit status and class, after the output printed before it.
+func TestRuntimeErrors(t *testing.T) {
+	paths := Paths(t.TempDir())
+	for name, want := range map[string]string{"division_by_zero.mk": "1\n", "division_overflow.mk": "-9223372036854775808\n"} {
+		source := corpus(t, "testdata")[name]
+		for _, o := range run(source, paths) {
+			if o.Err != nil {
+				t.Errorf("%s: %s cannot execute it: %s", name, o.Path, o.Err)
+				continue
+			}
+			if o.Result.Stdout != want || o.Result.ExitCode != RuntimeError || o.Result.Class != ClassDivision {
+				t.Errorf("%s: %s: %q, %s; want %q, exit %d (%s)", name, o.Path, o.Result.Stdout, o.Result, want, RuntimeError, ClassDivision)
+			}
+		}
+	}
+}
+
+// fake returns a path that gives the result for every program.
+func fake(name string, result Result) Path {
+	return Path{Name: name, Run: func(string) (Result, error) { return result, nil }}
+}
+
+func TestCheckComparesFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  Result
+		agree bool
+	}{
+		{"same output", Result{Stdout: "1\n"}, Result{Stdout: "1\n"}, true},
+		{"different output", Result{Stdout: "1\n"}, Result{Stdout: "2\n"}, false},
+		{"same class", failed("1\n", "division by zero"), failed("1\n", "monkey: integer division error\n"), true},
+		{"different class", failed("", "division by zero"), failed("", "stack overflow"), false},
+		{"failure and completion", failed("", "division by zero"), Result{}, false},
+		{"different status", failed("", "division by zero"), Result{ExitCode: 2, Class: ClassDivision}, false},
+	}
+	for _, tt := range tests {
+		m, err := Check("puts(1);", []Path{fake("a", tt.a), fake("b", tt.b)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (m == nil) != tt.agree {
+			t.Errorf("%s: got mismatch %v, want agreement %v", tt.name, m, tt.agree)
+		}
+	}
+}
+
+func TestCheckRejectsUnexecutablePrograms(t *testing.T) {
+	paths := Paths(t.TempDir())
+	for _, source := range []string{"let = 1;", "puts(1"} {
+		m, err := Check(source, paths)
+		if err == nil {
+			t.Errorf("%q: no error, mismatch %v", source, m)
+		}
+	}
+	if _, err := Check("puts(1);", nil); err == nil {
+		t.Error("no error without paths")
+	}
+}
@@ -0,0 +1,102 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/user/golang-interpreter/diff"
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// MaxSteps is the number of IR instructions after which CheckPasses stops
+// interpreting a program.
+var MaxSteps int64 = 1 << 30
+
+// PassMismatch represents an optimization pass after which the intermediate
+// representation of a program behaves differently.
+type PassMismatch struct {
+	Pass   string // The name of the pass.
+	Index  int    // The position of the pass in the pipeline, from 0.
+	Before Result // The behaviour before the pass.
+	After  Result // The behaviour after the pass.
+	Diff   string // The differences between the outputs.
+	IR     string // The intermediate representation before the pass.
+}
+
+// String returns a report of the mismatch.
+func (m *PassMismatch) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pass %d (%s) changes the behaviour: %s before, %s after\n", m.Index, m.Pass, m.Before, m.After)
+	if m.Diff != "" {
+		fmt.Fprintf(&b, "--- before %s\n+++ after %s\n%s", m.Pass, m.Pass, m.Diff)
+	}
+	fmt.Fprintf(&b, "IR before %s:\n", m.Pass)
+	for _, line := range strings.Split(strings.TrimRight(m.IR, "\n"), "\n") {
+		fmt.Fprintf(&b, "\t%s\n", line)
+	}
+	return b.String()
+}
+
+// CheckPasses lowers the program and interprets its intermediate
+// representation before the optimization passes of the options and after
+// each of them. It returns nil if every pass preserves the output and the
+// failure of the program, and the first pass that does not otherwise. It
+// returns an error if the program cannot be lowered.
+//
+// A run that exhausts the stack or the steps of the interpreter only shows
+// the start of the behaviour, so a pass may complete it: eliminating tail
+// calls makes deep recursion run in constant space.
+func CheckPasses(source string, opts intermediate.Options) (*PassMismatch, error) {
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		return nil, err
+	}
+
+	before, partial := interpret(module)
+	for n, pass := range intermediate.Passes(opts) {
+		g := intermediate.NewCodeGenerator()
+		g.Renumber = true
+		g.GenerateModule(module)
+
+		pass.Run(module)
+		if err := intermediate.VerifyModule(module); err != nil {
+			return &PassMismatch{Pass: pass.Name, Index: n, Before: before, After: failed("", err.Error()), IR: g.GetCode()}, nil
+		}
+		after, afterPartial := interpret(module)
+		preserved := before.agrees(after)
+		if partial {
+			preserved = strings.HasPrefix(after.Stdout, before.Stdout)
+		}
+		if !preserved {
+			return &PassMismatch{
+				Pass:   pass.Name,
+				Index:  n,
+				Before: before,
+				After:  after,
+				Diff:   diff.Unified(before.Stdout, after.Stdout, diffContext),
+				IR:     g.GetCode(),
+			}, nil
+		}
+		before, partial = after, afterPartial
+	}
+	return nil, nil
+}
+
+// interpret executes the module with the IR interpreter. It also returns
+// true if the interpreter ran out of stack or steps.
+func interpret(module *intermediate.Module) (Result, bool) {
+	var out bytes.Buffer
+	it := intermediate.NewInterpreter(module, &out)
+	it.MaxSteps = MaxSteps
+	err := it.Run()
+	if err != nil {
+		partial := err == intermediate.ErrStackOverflow || err == intermediate.ErrStepLimit
+		return failed(out.String(), err.Error()), partial
+	}
+	return Result{Stdout: out.String()}, false
+}
@@ -0,0 +1,85 @@
+package difftest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// goldenPrograms returns the programs of the testdata of this package and of
+// the golden tests of the backends, by path.
+func goldenPrograms(t *testing.T) map[string]string {
+	t.Helper()
+	result := make(map[string]string)
+	for _, pattern := range []string{"testdata/*.mk", "../backend/testdata/*/*.mk", "../cgen/testdata/*.mk", "../llvm/testdata/*.mk"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[file] = string(source)
+		}
+	}
+	if len(result) == 0 {
+		t.Fatal("no golden programs")
+	}
+	return result
+}
+
+// TestPassesPreserveBehaviour interprets the IR of every golden program
+// before and after each pass of every optimization level, and with a
+// threshold inlining every function that can be.
+func TestPassesPreserveBehaviour(t *testing.T) {
+	options := []intermediate.Options{
+		{Level: 0, InlineThreshold: intermediate.DefaultInlineThreshold},
+		{Level: 1, InlineThreshold: intermediate.DefaultInlineThreshold},
+		{Level: 2, InlineThreshold: intermediate.DefaultInlineThreshold},
+		{Level: 2, InlineThreshold: 1000},
+	}
+	for path, source := range goldenPrograms(t) {
+		for _, opts := range options {
+			m, err := CheckPasses(source, opts)
+			if err != nil {
+				t.Errorf("%s: %s", path, err)
+			}
+			if m != nil {
+				t.Errorf("%s at -O%d, inline threshold %d: %s", path, opts.Level, opts.InlineThreshold, strings.TrimSpace(m.String()))
+			}
+		}
+	}
+}
+
+// TestPassesReportChanges checks that a change of behaviour between the
+// interpretations is found, so that the test above cannot pass vacuously.
+func TestPassesReportChanges(t *testing.T) {
+	before, _ := interpret(lowerModule(t, `puts(1); puts(2);`))
+	after, _ := interpret(lowerModule(t, `puts(1); puts(3);`))
+	if before.agrees(after) {
+		t.Errorf("%s and %s agree", before, after)
+	}
+	failing, _ := interpret(lowerModule(t, `let zero = fn() { 0 }; puts(1); puts(1 / zero());`))
+	if failing.ExitCode != RuntimeError || failing.Class != ClassDivision || failing.Stdout != "1\n" {
+		t.Errorf("division by zero interpreted as %q, %s", failing.Stdout, failing)
+	}
+}
+
+// lowerModule lowers a program without optimizing it.
+func lowerModule(t *testing.T, source string) *intermediate.Module {
+	t.Helper()
+	program, err := parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module
+}
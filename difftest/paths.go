@@ -0,0 +1,198 @@
+package difftest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/user/golang-interpreter/backend"
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/cgen"
+	"github.com/user/golang-interpreter/evaluator"
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+	"github.com/user/golang-interpreter/vm"
+)
+
+// Timeout is how long a compiled program may run before it is killed and
+// counted as failed.
+var Timeout = 10 * time.Second
+
+// Path represents a way of executing Monkey programs.
+type Path struct {
+	Name string // The name of the path in reports.
+
+	// Run executes the program. It returns an error if the path cannot
+	// execute it at all, such as a program the native backends do not
+	// support, and the outcome otherwise.
+	Run func(source string) (Result, error)
+}
+
+// Paths returns the execution paths available on this machine. The compiled
+// programs are written to dir.
+//
+// The evaluator and the virtual machine are always available, the native
+// backend at -O0 and -O2 on x86-64 Linux, and the C backend when a C compiler
+// is installed.
+func Paths(dir string) []Path {
+	paths := []Path{
+		{Name: "evaluator", Run: runEvaluator},
+		{Name: "vm", Run: runVM},
+	}
+	if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+		paths = append(paths, nativePath(0, dir), nativePath(2, dir))
+	}
+	for _, cc := range []string{"cc", "gcc", "clang"} {
+		if path, err := exec.LookPath(cc); err == nil {
+			paths = append(paths, cPath(path, dir))
+			break
+		}
+	}
+	return paths
+}
+
+// parse parses a program.
+func parse(source string) (*parser.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s", errs[0])
+	}
+	return program, nil
+}
+
+// runEvaluator executes a program with the tree-walking evaluator.
+func runEvaluator(source string) (Result, error) {
+	program, err := parse(source)
+	if err != nil {
+		return Result{}, err
+	}
+	var out bytes.Buffer
+	result := evaluator.Eval(program, evaluator.NewEnvironment(&out))
+	if rerr, ok := result.(*object.Error); ok {
+		return failed(out.String(), rerr.Message), nil
+	}
+	return Result{Stdout: out.String()}, nil
+}
+
+// runVM executes a program on the bytecode virtual machine.
+func runVM(source string) (Result, error) {
+	program, err := parse(source)
+	if err != nil {
+		return Result{}, err
+	}
+	compiler := bytecode.New()
+	if err := compiler.Compile(program); err != nil {
+		return Result{}, err
+	}
+	var out bytes.Buffer
+	if err := vm.New(compiler.Bytecode(), &out).Run(); err != nil {
+		return failed(out.String(), err.Error()), nil
+	}
+	return Result{Stdout: out.String()}, nil
+}
+
+// lower translates a program to the intermediate representation optimized at
+// the level.
+func lower(source string, level int) (*intermediate.Module, error) {
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		return nil, err
+	}
+	intermediate.Optimize(module, intermediate.Passes(intermediate.Options{Level: level, InlineThreshold: intermediate.DefaultInlineThreshold}))
+	return module, nil
+}
+
+// nativePath returns the path compiling programs at the optimization level to
+// x86-64 executables, with the register allocator the compiler uses at that
+// level.
+func nativePath(level int, dir string) Path {
+	name := fmt.Sprintf("native-O%d", level)
+	allocator := backend.Allocators["linear"]
+	if level >= 2 {
+		allocator = backend.Allocators["color"]
+	}
+	return Path{Name: name, Run: func(source string) (Result, error) {
+		module, err := lower(source, level)
+		if err != nil {
+			return Result{}, err
+		}
+		exe := filepath.Join(dir, name)
+		err = backend.GenerateCode(module, exe, backend.Options{Allocator: allocator, Emit: backend.EmitExe})
+		if err != nil {
+			return Result{}, err
+		}
+		return execute(exe)
+	}}
+}
+
+// cPath returns the path compiling programs to C and then with the C compiler,
+// optimizing so that tail calls do not grow the stack.
+func cPath(cc string, dir string) Path {
+	return Path{Name: "c", Run: func(source string) (Result, error) {
+		module, err := lower(source, 2)
+		if err != nil {
+			return Result{}, err
+		}
+		src := filepath.Join(dir, "c.c")
+		exe := filepath.Join(dir, "c")
+		if err := cgen.GenerateCode(module, src, cgen.TargetName); err != nil {
+			return Result{}, err
+		}
+		if out, err := exec.Command(cc, "-O2", "-o", exe, src).CombinedOutput(); err != nil {
+			return Result{}, fmt.Errorf("%s: %s%s", cc, err, out)
+		}
+		return execute(exe)
+	}}
+}
+
+// execute runs a compiled program. A program killed by a signal or by the
+// timeout failed with a runtime error: the trap of a division or the guard
+// page below the stack, which only deep recursion reaches, are the errors of
+// the evaluator, and other signals are crashes. A program exiting with a
+// status of its own, as the C runtime does, reports the error on stderr.
+func execute(exe string) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return Result{Stdout: stdout.String()}, nil
+	case ctx.Err() != nil:
+		return Result{Stdout: stdout.String(), ExitCode: RuntimeError, Error: "timed out", Class: ClassTimeout}, nil
+	case errors.As(err, &exit):
+		status, ok := exit.Sys().(syscall.WaitStatus)
+		if !ok || !status.Signaled() {
+			result := failed(stdout.String(), stderr.String())
+			result.ExitCode = exit.ExitCode()
+			return result, nil
+		}
+		result := Result{Stdout: stdout.String(), ExitCode: RuntimeError, Error: status.Signal().String(), Class: ClassCrash}
+		switch status.Signal() {
+		case syscall.SIGFPE:
+			result.Class = ClassDivision
+		case syscall.SIGSEGV:
+			result.Class = ClassStackOverflow
+		}
+		return result, nil
+	}
+	return Result{}, err
+}
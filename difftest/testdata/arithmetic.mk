@@ -0,0 +1,5 @@
+puts(1 + 2 * 3 - 4 / 2);
+puts(0 - 42);
+puts(-7 / 2);
+puts(9223372036854775807 + 1);
+puts(3 * (4 + 5) - 6 / (1 + 1));
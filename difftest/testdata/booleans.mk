@@ -0,0 +1,7 @@
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+let positive = fn(x) { x > 0 };
+puts(even(10001));
+puts(!odd(3));
+puts(positive(5) == positive(0 - 5));
+puts(1 < 2 != false);
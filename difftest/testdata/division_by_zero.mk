@@ -0,0 +1,4 @@
+let zero = fn() { 0 };
+puts(1);
+puts(10 / zero());
+puts(2);
@@ -0,0 +1,3 @@
+let min = fn() { 0 - 9223372036854775807 - 1 };
+puts(min());
+puts(min() / (0 - 1));
@@ -0,0 +1,6 @@
+let base = 40;
+let big = base > 10;
+let add = fn(x) { base + x };
+puts(add(2));
+puts(big);
+puts(add(add(0)));
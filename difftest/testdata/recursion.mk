@@ -0,0 +1,6 @@
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+puts(fib(22));
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+puts(sum(1000000, 0));
+let gcd = fn(a, b) { if (b == 0) { a } else { gcd(b, a - a / b * b) } };
+puts(gcd(1071, 462));
@@ -0,0 +1,2 @@
+let f = fn(x) { if (x > 0) { 1 } };
+puts(f(1));
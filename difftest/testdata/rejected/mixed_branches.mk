@@ -0,0 +1,3 @@
+let f = fn(c) { if (c) { true } else { 1 } };
+puts(f(true));
+puts(f(false));
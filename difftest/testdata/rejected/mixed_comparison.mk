@@ -0,0 +1 @@
+puts(1 == true);
@@ -0,0 +1,7 @@
+let clamp = fn(x) { if (x > 100) { return 100; } if (x < 0) { return 0; } x };
+puts(clamp(250));
+puts(clamp(0 - 3));
+puts(clamp(42));
+let f = fn(c) { let x = if (c) { return 1; } else { 2 }; x + 10 };
+puts(f(true));
+puts(f(false));
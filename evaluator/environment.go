@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"io"
+
+	"github.com/user/golang-interpreter/object"
+)
+
+// interpreter represents the state shared by all environments of a program.
+type interpreter struct {
+	out   io.Writer // The destination of puts.
+	depth int       // The number of calls being evaluated.
+}
+
+// Environment represents the bindings visible in a block of the program.
+type Environment struct {
+	store map[string]object.Object // The values bound in the block.
+	outer *Environment             // The enclosing environment, or nil for the top level.
+	*interpreter
+}
+
+// NewEnvironment returns the environment of the top level of a program that
+// prints to out.
+func NewEnvironment(out io.Writer) *Environment {
+	return &Environment{store: make(map[string]object.Object), interpreter: &interpreter{out: out}}
+}
+
+// NewEnclosedEnvironment returns the environment of a block or a call
+// enclosed by outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	return &Environment{store: make(map[string]object.Object), outer: outer, interpreter: outer.interpreter}
+}
+
+// Get returns the value bound to name in the environment or any enclosing
+// one.
+func (e *Environment) Get(name string) (object.Object, bool) {
+	for ; e != nil; e = e.outer {
+		if obj, ok := e.store[name]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// Set binds name to a value in the environment and returns the value.
+func (e *Environment) Set(name string, val object.Object) object.Object {
+	e.store[name] = val
+	return val
+}
@@ -0,0 +1,296 @@
+// Package evaluator interprets parsed programs by walking their syntax tree.
+// It is the reference for the semantics of Monkey that the bytecode virtual
+// machine and the compiled backends are checked against, so it favours
+// obviousness over speed.
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// BackendName is the name of the evaluator accepted by the --backend flag of
+// monkey run.
+const BackendName = "evaluator"
+
+// MaxDepth is the depth of nested calls beyond which evaluation fails with a
+// stack overflow, like the virtual machine.
+const MaxDepth = 1 << 16
+
+// Eval evaluates a node of a program in the environment and returns its
+// value, or nil for a let statement or a program ending with one. A runtime
+// error ends the evaluation and is returned as an *object.Error.
+func Eval(node parser.Node, env *Environment) object.Object {
+	return force(eval(node, env, false))
+}
+
+// eval evaluates a node. A call in tail position, whose value is the result
+// of the function being evaluated, is not made but returned as a *tailCall
+// for applyFunction to make, so that tail recursion runs in constant space.
+func eval(node parser.Node, env *Environment, tail bool) object.Object {
+	switch node := node.(type) {
+	case *parser.Program:
+		return evalProgram(node, env)
+
+	case *parser.BlockStatement:
+		return evalStatements(node.Statements, NewEnclosedEnvironment(env), tail)
+
+	case *parser.ExpressionStatement:
+		if node.Expression == nil {
+			return object.NullValue
+		}
+		return eval(node.Expression, env, tail)
+
+	case *parser.LetStatement:
+		val := eval(node.Value, env, false)
+		if stops(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+		return nil
+
+	case *parser.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &ReturnValue{Value: object.NullValue}
+		}
+		val := eval(node.ReturnValue, env, true)
+		if stops(val) {
+			return val
+		}
+		return &ReturnValue{Value: val}
+
+	case *parser.Identifier:
+		if val, ok := env.Get(node.Value); ok {
+			return val
+		}
+		if b := object.LookupBuiltin(node.Value); b != nil {
+			return b
+		}
+		pos := parser.Pos(node)
+		return object.Errorf("%d:%d: identifier not found: %s", pos.Line, pos.Column, node.Value)
+
+	case *parser.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *parser.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *parser.Boolean:
+		return object.Bool(node.Value)
+
+	case *parser.PrefixExpression:
+		right := eval(node.Right, env, false)
+		if stops(right) {
+			return right
+		}
+		return object.Prefix(node.Operator, right)
+
+	case *parser.InfixExpression:
+		left := eval(node.Left, env, false)
+		if stops(left) {
+			return left
+		}
+		right := eval(node.Right, env, false)
+		if stops(right) {
+			return right
+		}
+		return object.Infix(node.Operator, left, right)
+
+	case *parser.IfExpression:
+		cond := eval(node.Condition, env, false)
+		if stops(cond) {
+			return cond
+		}
+		if object.Truthy(cond) {
+			return evalBranch(node.Consequence, env, tail)
+		}
+		return evalBranch(node.Alternative, env, tail)
+
+	case *parser.FunctionLiteral:
+		return &Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *parser.CallExpression:
+		fn := eval(node.Function, env, false)
+		if stops(fn) {
+			return fn
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && stops(args[0]) {
+			return args[0]
+		}
+		if tail {
+			return &tailCall{fn: fn, args: args, env: env}
+		}
+		return applyFunction(fn, args, env)
+
+	case *parser.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && stops(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *parser.IndexExpression:
+		left := eval(node.Left, env, false)
+		if stops(left) {
+			return left
+		}
+		index := eval(node.Index, env, false)
+		if stops(index) {
+			return index
+		}
+		return object.Index(left, index)
+
+	case *parser.HashLiteral:
+		return evalHash(node, env)
+	}
+	return object.Errorf("unsupported node %T", node)
+}
+
+// evalProgram evaluates the top-level statements. A return statement ends
+// the program.
+func evalProgram(program *parser.Program, env *Environment) object.Object {
+	var result object.Object = object.NullValue
+	for _, stmt := range program.Statements {
+		result = force(eval(stmt, env, false))
+		switch r := result.(type) {
+		case *ReturnValue:
+			return force(r.Value)
+		case *object.Error:
+			return r
+		}
+	}
+	return result
+}
+
+// evalStatements evaluates a sequence of statements, the last one in tail
+// position if the sequence is, and returns the value of the last one. A
+// return statement or an error ends the sequence early.
+func evalStatements(stmts []parser.Statement, env *Environment, tail bool) object.Object {
+	var result object.Object = object.NullValue
+	for n, stmt := range stmts {
+		result = eval(stmt, env, tail && n == len(stmts)-1)
+		switch result.(type) {
+		case *ReturnValue, *object.Error:
+			return result
+		}
+	}
+	if result == nil {
+		// The block ends with a let statement.
+		return object.NullValue
+	}
+	return result
+}
+
+// evalBranch evaluates a branch of an if expression, which may be missing.
+func evalBranch(block *parser.BlockStatement, env *Environment, tail bool) object.Object {
+	if block == nil {
+		return object.NullValue
+	}
+	return eval(block, env, tail)
+}
+
+// evalExpressions evaluates expressions from left to right. If one fails or
+// returns, the result is just its error or return value.
+func evalExpressions(exprs []parser.Expression, env *Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exprs {
+		val := eval(e, env, false)
+		if stops(val) {
+			return []object.Object{val}
+		}
+		result = append(result, val)
+	}
+	return result
+}
+
+// evalHash evaluates a hash literal. The pairs are evaluated in source order,
+// whatever the order of the map holding them.
+func evalHash(node *parser.HashLiteral, env *Environment) object.Object {
+	var keys []parser.Expression
+	for k := range node.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return parser.Pos(keys[i]).Offset < parser.Pos(keys[j]).Offset })
+	var pairs []object.Object
+	for _, k := range keys {
+		key := eval(k, env, false)
+		if stops(key) {
+			return key
+		}
+		val := eval(node.Pairs[k], env, false)
+		if stops(val) {
+			return val
+		}
+		pairs = append(pairs, key, val)
+	}
+	return object.NewHash(pairs)
+}
+
+// applyFunction calls a function with the arguments. The calls in tail
+// position of the function are made here in turn rather than nested.
+func applyFunction(fn object.Object, args []object.Object, env *Environment) object.Object {
+	if env.depth >= MaxDepth {
+		return object.Errorf("stack overflow")
+	}
+	env.depth++
+	defer func() { env.depth-- }()
+
+	for {
+		switch f := fn.(type) {
+		case *Function:
+			if len(args) != len(f.Parameters) {
+				return object.Errorf("wrong number of arguments: want=%d, got=%d", len(f.Parameters), len(args))
+			}
+			callEnv := NewEnclosedEnvironment(f.Env)
+			for n, p := range f.Parameters {
+				callEnv.Set(p.Value, args[n])
+			}
+			var result object.Object = object.NullValue
+			if f.Body != nil {
+				result = evalStatements(f.Body.Statements, callEnv, true)
+			}
+			if rv, ok := result.(*ReturnValue); ok {
+				result = rv.Value
+			}
+			tc, ok := result.(*tailCall)
+			if !ok {
+				return result
+			}
+			fn, args = tc.fn, tc.args
+
+		case *object.Builtin:
+			return f.Fn(env.out, args...)
+
+		default:
+			return object.Errorf("calling non-function: %s", fn.Type())
+		}
+	}
+}
+
+// force makes the call of a value that is a *tailCall, which the top level
+// receives from a return statement.
+func force(obj object.Object) object.Object {
+	switch o := obj.(type) {
+	case *tailCall:
+		return applyFunction(o.fn, o.args, o.env)
+	case *ReturnValue:
+		if tc, ok := o.Value.(*tailCall); ok {
+			return &ReturnValue{Value: force(tc)}
+		}
+	}
+	return obj
+}
+
+// stops returns true if the value of a subexpression ends the evaluation of
+// the expressions around it: a runtime error, or the value of a return
+// statement nested in it on its way out of the function.
+func stops(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *ReturnValue:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package evaluator_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/evaluator"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+	"github.com/user/golang-interpreter/vm"
+)
+
+// returns are programs with return statements nested in the expressions
+// whose values they replace: let values, operands, callees and arguments.
+var returns = []struct {
+	name   string
+	source string
+	want   string
+}{
+	{"let", `
+let f = fn(c) { let x = if (c) { return 1; } else { 2 }; x + 10 };
+puts(f(true)); puts(f(false));
+`, "1\n12\n"},
+	{"argument", `
+let f = fn(c) { puts(if (c) { return 5; } else { 0 }); 7 };
+puts(f(true)); puts(f(false));
+`, "5\n0\n7\n"},
+	{"prefix", `
+let f = fn(c) { -(if (c) { return 3; } else { 4 }) };
+puts(f(true)); puts(f(false));
+`, "3\n-4\n"},
+	{"left operand", `
+let f = fn(c) { (if (c) { return 3; } else { 4 }) * 10 };
+puts(f(true)); puts(f(false));
+`, "3\n40\n"},
+	{"right operand", `
+let f = fn(c) { 10 - if (c) { return 3; } else { 4 } };
+puts(f(true)); puts(f(false));
+`, "3\n6\n"},
+	{"callee", `
+let g = fn(x) { x * 2 };
+let f = fn(c) { (if (c) { return 9; } else { g })(21) };
+puts(f(true)); puts(f(false));
+`, "9\n42\n"},
+	{"condition", `
+let f = fn(c) { if (if (c) { return 8; } else { false }) { 1 } else { 2 } };
+puts(f(true)); puts(f(false));
+`, "8\n2\n"},
+	{"tail call", `
+let g = fn(x) { x + 1 };
+let f = fn(c) { let x = if (c) { return g(1); } else { 5 }; x * 3 };
+puts(f(true)); puts(f(false));
+`, "2\n15\n"},
+	{"array", `
+let f = fn(c) { [1, if (c) { return 6; } else { 2 }][1] };
+puts(f(true)); puts(f(false));
+`, "6\n2\n"},
+	{"top level", `
+puts(1);
+let x = if (true) { return 2; } else { 3 };
+puts(x);
+`, "1\n"},
+}
+
+// parse parses a program, failing the test on syntax errors.
+func parse(t *testing.T, source string) *parser.Program {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	return program
+}
+
+// runVM runs a program on the virtual machine and returns its output and
+// error.
+func runVM(t *testing.T, source string) (string, error) {
+	t.Helper()
+	compiler := bytecode.New()
+	if err := compiler.Compile(parse(t, source)); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err := vm.New(compiler.Bytecode(), &out).Run()
+	return out.String(), err
+}
+
+func TestNestedReturns(t *testing.T) {
+	for _, tt := range returns {
+		var out bytes.Buffer
+		result := evaluator.Eval(parse(t, tt.source), evaluator.NewEnvironment(&out))
+		if err, ok := result.(*object.Error); ok {
+			t.Errorf("%s: evaluator failed: %s", tt.name, err.Message)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: evaluator printed\n%swant\n%s", tt.name, out.String(), tt.want)
+		}
+
+		vmOut, err := runVM(t, tt.source)
+		if err != nil {
+			t.Errorf("%s: virtual machine failed: %s", tt.name, err)
+		}
+		if vmOut != out.String() {
+			t.Errorf("%s: virtual machine printed\n%sevaluator\n%s", tt.name, vmOut, out.String())
+		}
+	}
+}
+
+// eval evaluates a program and returns what it printed and its value.
+func eval(t *testing.T, source string) (string, object.Object) {
+	t.Helper()
+	var out bytes.Buffer
+	result := evaluator.Eval(parse(t, source), evaluator.NewEnvironment(&out))
+	return out.String(), result
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string // The value of the program.
+	}{
+		{"integers", "(5 + 10 * 2 + 15 / 3) * 2 + -10", "50"},
+		{"wrapping", "9223372036854775807 + 1", "-9223372036854775808"},
+		{"booleans", "(1 < 2) == true != (3 > 4)", "true"},
+		{"truthiness", "if (0) { 1 } else { 2 }", "2"},
+		{"missing branch", "if (false) { 1 }", "null"},
+		{"values of different types", `1 == true`, "false"},
+		{"string concatenation", `"Hello" + ", " + "World!"`, "Hello, World!"},
+		{"string comparison", `"a" == "a" != ("a" == "b")`, "true"},
+		{"array", "[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"array index", "let a = [1, 2, 3]; a[0] + a[a[1]]", "4"},
+		{"array index out of range", "[1, 2, 3][3]", "null"},
+		{"negative array index", "[1, 2, 3][-1]", "null"},
+		{"hash", `let two = "two"; {"one": 10 - 9, two: 1 + 1, 3: 3, true: 4}["two"]`, "2"},
+		{"hash keys of every type", `let h = {"k": 1, 2: 2, false: 3}; [h["k"], h[2], h[false]]`, "[1, 2, 3]"},
+		{"missing hash key", `{"a": 1}["b"]`, "null"},
+		{"len", `[len(""), len("four"), len([1, 2])]`, "[0, 4, 2]"},
+		{"first and last", "[first([1, 2, 3]), last([1, 2, 3]), first([])]", "[1, 3, null]"},
+		{"rest", "[rest([1, 2, 3]), rest([])]", "[[2, 3], null]"},
+		{"push", "let a = [1]; [push(a, 2), a]", "[[1, 2], [1]]"},
+		{"builtin as a value", "let f = len; f([1, 2, 3])", "3"},
+		{"closure", "let add = fn(a) { fn(b) { a + b } }; add(2)(3)", "5"},
+		{"redefinition seen by closures", "let a = 1; let f = fn() { a }; let a = 2; f()", "2"},
+		{"higher-order function", `
+let map = fn(arr, f) {
+	let iter = fn(arr, acc) { if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) } };
+	iter(arr, [])
+};
+map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+	}
+	for _, tt := range tests {
+		_, result := eval(t, tt.source)
+		if err, ok := result.(*object.Error); ok {
+			t.Errorf("%s: %s", tt.name, err.Message)
+			continue
+		}
+		if result == nil || result.Inspect() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, result, tt.want)
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	out, result := eval(t, `puts(1, "two", [3], true); puts();`)
+	if want := "1\ntwo\n[3]\ntrue\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if result != object.NullValue {
+		t.Errorf("puts returned %v, want null", result)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		out    string // What the program prints before the error.
+		want   string
+	}{
+		{"5 + true; 5;", "", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "", "unknown operator: -BOOLEAN"},
+		{"true + false;", "", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "", "unknown operator: STRING - STRING"},
+		{"if (10 > 1) { if (true) { return true + 1; } return 1; }", "", "type mismatch: BOOLEAN + INTEGER"},
+		{"puts(1); 1 / 0; puts(2);", "1\n", "division by zero"},
+		{"(-9223372036854775807 - 1) / -1", "", "integer overflow in division"},
+		{"foobar", "", "1:1: identifier not found: foobar"},
+		{"let f = fn(x) { x }; f(1, 2)", "", "wrong number of arguments: want=1, got=2"},
+		{"1(2)", "", "calling non-function: INTEGER"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "", "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "", "unusable as hash key: ARRAY"},
+		{"1[0]", "", "index operator not supported: INTEGER[INTEGER]"},
+		{"len(1)", "", "argument to len not supported, got INTEGER"},
+		{`len("one", "two")`, "", "wrong number of arguments to len: got 2, want 1"},
+		{"first(1)", "", "argument to first must be ARRAY, got INTEGER"},
+		{"push([1])", "", "wrong number of arguments to push: got 1, want 2"},
+	}
+	for _, tt := range tests {
+		out, result := eval(t, tt.source)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: got %v, want error %q", tt.source, result, tt.want)
+			continue
+		}
+		if err.Message != tt.want {
+			t.Errorf("%s: got error %q, want %q", tt.source, err.Message, tt.want)
+		}
+		if out != tt.out {
+			t.Errorf("%s: printed %q before the error, want %q", tt.source, out, tt.out)
+		}
+	}
+}
+
+// TestMaxDepth checks that calls nested deeper than MaxDepth fail with a
+// stack overflow, and that tail calls, which do not nest, do not.
+func TestMaxDepth(t *testing.T) {
+	source := fmt.Sprintf(`
+let down = fn(n) { if (n == 0) { 0 } else { 1 + down(n - 1) } };
+let tail = fn(n) { if (n == 0) { 0 } else { tail(n - 1) } };
+puts(down(%d));
+puts(tail(%d));
+down(%d);
+`, evaluator.MaxDepth-1, 4*evaluator.MaxDepth, evaluator.MaxDepth)
+	out, result := eval(t, source)
+	if want := fmt.Sprintf("%d\n0\n", evaluator.MaxDepth-1); out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if err, ok := result.(*object.Error); !ok || err.Message != "stack overflow" {
+		t.Errorf("got %v, want a stack overflow", result)
+	}
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"strings"
+
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// Function represents a function value: a function literal and the
+// environment it was evaluated in.
+type Function struct {
+	Parameters []*parser.Identifier   // The parameters.
+	Body       *parser.BlockStatement // The body.
+	Env        *Environment           // The environment the body is evaluated in.
+}
+
+func (f *Function) Type() object.Type { return object.FunctionType }
+func (f *Function) Inspect() string {
+	var params []string
+	for _, p := range f.Parameters {
+		params = append(params, p.Value)
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+// ReturnValue represents the value of a return statement on its way out of
+// the function it returns from.
+type ReturnValue struct {
+	Value object.Object // The returned value.
+}
+
+func (rv *ReturnValue) Type() object.Type { return "RETURN_VALUE" }
+func (rv *ReturnValue) Inspect() string   { return rv.Value.Inspect() }
+
+// tailCall represents a call in tail position, on its way out of the function
+// it is the result of, to be made by the caller so that the stack does not
+// grow.
+type tailCall struct {
+	fn   object.Object   // The function called.
+	args []object.Object // The arguments.
+	env  *Environment    // The environment of the call.
+}
+
+func (tc *tailCall) Type() object.Type { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string   { return "tail call of " + tc.fn.Inspect() }
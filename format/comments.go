@@ -0,0 +1,143 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// comment represents a comment of the source waiting to be printed.
+type comment struct {
+	text     string // The text of the comment, without trailing spaces.
+	offset   int    // The byte offset of the comment in the source.
+	trailing bool   // Whether the comment follows code on its line.
+	inside   int    // The offset of the innermost bracket around the comment that is not a grouping parenthesis, or -1.
+}
+
+// scan lexes the source for what the syntax tree lacks: the comments, where
+// each block, list and call ends and where the parameters of each function
+// start.
+func (p *printer) scan(source string) {
+	p.closes = make(map[int]int)
+	p.params = make(map[int]int)
+	first := make(map[int]int) // The offset of the first token of each line.
+	var opens []int            // The offsets of the brackets open at the token.
+	var prev lexer.Token
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; prev, tok = tok, l.NextToken() {
+		if _, ok := first[tok.Pos.Line]; !ok {
+			first[tok.Pos.Line] = tok.Pos.Offset
+		}
+		switch tok.Type {
+		case lexer.LBRACE, lexer.LBRACKET, lexer.LPAREN:
+			opens = append(opens, tok.Pos.Offset)
+			if tok.Type == lexer.LPAREN && prev.Type == lexer.FUNCTION {
+				p.params[prev.Pos.Offset] = tok.Pos.Offset
+			}
+			if tok.Type == lexer.LPAREN && grouping(prev.Type) {
+				p.grouping = append(p.grouping, tok.Pos.Offset)
+			}
+		case lexer.RBRACE, lexer.RBRACKET, lexer.RPAREN:
+			if len(opens) == 0 {
+				break
+			}
+			p.closes[opens[len(opens)-1]] = tok.Pos.Offset
+			opens = opens[:len(opens)-1]
+		}
+	}
+	for _, c := range l.Comments() {
+		start, ok := first[c.Pos.Line]
+		p.comments = append(p.comments, comment{
+			text:     strings.TrimRight(c.Text, " \t\r"),
+			offset:   c.Pos.Offset,
+			trailing: ok && start < c.Pos.Offset,
+			inside:   p.innermost(c.Pos.Offset),
+		})
+	}
+}
+
+// grouping returns true if a parenthesis following a token of the type
+// groups an expression, rather than opening the arguments of a call, the
+// parameters of a function or the condition of an if expression.
+func grouping(prev lexer.TokenType) bool {
+	switch prev {
+	case lexer.IDENT, lexer.INT, lexer.STRING, lexer.TRUE, lexer.FALSE,
+		lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE, lexer.FUNCTION, lexer.IF:
+		return false
+	}
+	return true
+}
+
+// innermost returns the offset of the innermost bracket around the offset
+// that is not a grouping parenthesis, or -1 if there is none.
+func (p *printer) innermost(offset int) int {
+	inside := -1
+	for open, close := range p.closes {
+		if open < offset && offset < close && open > inside && !p.groups(open) {
+			inside = open
+		}
+	}
+	return inside
+}
+
+// groups returns true if the parenthesis at the offset groups an expression.
+func (p *printer) groups(open int) bool {
+	for _, g := range p.grouping {
+		if g == open {
+			return true
+		}
+	}
+	return false
+}
+
+// commentsOf returns the comments of the source.
+func commentsOf(source string) []lexer.Comment {
+	l := lexer.New(source)
+	for l.NextToken().Type != lexer.EOF {
+	}
+	return l.Comments()
+}
+
+// end returns the offset of the closing brace of a block, or 0 if the
+// source was not scanned.
+func (p *printer) end(block *parser.BlockStatement) int {
+	return p.closes[block.Token.Pos.Offset]
+}
+
+// commentsBefore returns true if the next comment to print comes before the
+// offset.
+func (p *printer) commentsBefore(offset int) bool {
+	return len(p.comments) > 0 && p.comments[0].offset < offset
+}
+
+// commentsInside returns true if a comment still to print is directly inside
+// the bracket at the offset, rather than inside a nested one.
+func (p *printer) commentsInside(open int) bool {
+	for _, c := range p.comments {
+		if c.inside == open {
+			return true
+		}
+	}
+	return false
+}
+
+// leading prints the comments before the offset on lines of their own, at
+// the current indentation.
+func (p *printer) leading(offset int) {
+	for len(p.comments) > 0 && p.comments[0].offset < offset {
+		p.b.WriteString(strings.Repeat("\t", p.indent) + p.comments[0].text + "\n")
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailing prints the next comment at the end of the current line if it
+// followed code on its line in the source and comes before the offset. A
+// line has at most one trailing comment, since it runs to the end of the
+// line.
+func (p *printer) trailing(offset int) {
+	if len(p.comments) > 0 && p.comments[0].trailing && p.comments[0].offset < offset {
+		p.b.WriteString(" " + p.comments[0].text)
+		p.comments = p.comments[1:]
+	}
+}
@@ -0,0 +1,10 @@
+package format
+
+import "github.com/user/golang-interpreter/diff"
+
+// Diff returns the changes formatting turns the text a into the text b as the
+// hunks of a unified diff, which patch applies, or the empty string if the
+// texts are equal.
+func Diff(a, b string) string {
+	return diff.Unified(a, b, diff.DefaultContext)
+}
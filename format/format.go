@@ -0,0 +1,332 @@
+// Package format prints Monkey programs in their canonical form: one
+// statement per line, blocks indented with tabs, opening braces on the line
+// of their if or fn, single spaces around infix operators and only the
+// parentheses the precedence of the operators needs. Comments keep their
+// place: on a line of their own before the statement they precede, or at the
+// end of the line of the statement they follow. Comments inside a list of
+// arguments, elements, pairs or parameters put every item on a line of its
+// own, and comments before the right operand of an infix operator put the
+// operand on the next line.
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// The precedences of the expressions, from the loosest to the tightest
+// binding, as the parser gives them.
+const (
+	lowest = iota
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	index
+)
+
+// infixPrecedences maps the infix operators to their precedence.
+var infixPrecedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+// printer represents the state of the formatting of a program.
+type printer struct {
+	b        strings.Builder
+	indent   int         // The depth of the block being printed.
+	comments []comment   // The comments not printed yet, in source order.
+	closes   map[int]int // The offsets of the closing brackets by those of the opening ones.
+	params   map[int]int // The offsets of the parentheses around parameters by those of their fn.
+	grouping []int       // The offsets of the parentheses grouping expressions.
+}
+
+// Source returns the canonical source of the program, without comments.
+func Source(program *parser.Program) string {
+	p := &printer{}
+	p.statements(program.Statements, 0)
+	return p.b.String()
+}
+
+// File returns the canonical source of the program parsed from the source,
+// with the comments of the source. It returns an error if the result would
+// not parse back to the same program with the same comments, or would
+// format differently again, which are bugs of the formatter.
+func File(program *parser.Program, source string) (string, error) {
+	formatted := file(program, source)
+
+	l := lexer.New(formatted)
+	p := parser.New(l)
+	reparsed := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return "", fmt.Errorf("formatted program does not parse: %s", errs[0])
+	}
+	if parser.Dump(reparsed) != parser.Dump(program) {
+		return "", fmt.Errorf("formatting changes the program")
+	}
+	if !sameComments(l.Comments(), commentsOf(source)) {
+		return "", fmt.Errorf("formatting changes the comments")
+	}
+	if file(reparsed, formatted) != formatted {
+		return "", fmt.Errorf("formatting is not idempotent")
+	}
+	return formatted, nil
+}
+
+// file returns the canonical source of the program with the comments of the
+// source.
+func file(program *parser.Program, source string) string {
+	p := &printer{}
+	p.scan(source)
+	p.statements(program.Statements, len(source))
+	return p.b.String()
+}
+
+// sameComments returns true if two lists of comments have the same texts,
+// but for trailing spaces.
+func sameComments(a, b []lexer.Comment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if strings.TrimRight(a[n].Text, " \t\r") != strings.TrimRight(b[n].Text, " \t\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// statements prints statements, one per line at the current indentation,
+// and the comments before the offset where they end.
+func (p *printer) statements(stmts []parser.Statement, end int) {
+	for n, stmt := range stmts {
+		p.leading(parser.Pos(stmt).Offset)
+		p.b.WriteString(strings.Repeat("\t", p.indent))
+		p.statement(stmt)
+		if n+1 < len(stmts) {
+			p.trailing(parser.Pos(stmts[n+1]).Offset)
+		} else {
+			p.trailing(end)
+		}
+		p.b.WriteString("\n")
+	}
+	p.leading(end)
+}
+
+// statement prints a statement. Statements end with a semicolon, except the
+// expression statements that end with a block.
+func (p *printer) statement(stmt parser.Statement) {
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		p.b.WriteString("let " + s.Name.Value + " = ")
+		p.expression(s.Value, lowest)
+		p.b.WriteString(";")
+	case *parser.ReturnStatement:
+		p.b.WriteString("return")
+		if s.ReturnValue != nil {
+			p.b.WriteString(" ")
+			p.expression(s.ReturnValue, lowest)
+		}
+		p.b.WriteString(";")
+	case *parser.ExpressionStatement:
+		if s.Expression == nil {
+			return
+		}
+		p.expression(s.Expression, lowest)
+		if _, ok := s.Expression.(*parser.IfExpression); !ok {
+			p.b.WriteString(";")
+		}
+	case *parser.BlockStatement:
+		p.block(s)
+	default:
+		panic(fmt.Sprintf("format: unexpected statement %T", stmt))
+	}
+}
+
+// block prints a block, with its statements and comments on their own lines
+// unless it has none.
+func (p *printer) block(block *parser.BlockStatement) {
+	if block == nil {
+		p.b.WriteString("{}")
+		return
+	}
+	end := p.end(block)
+	if len(block.Statements) == 0 && (len(p.comments) == 0 || p.comments[0].offset >= end) {
+		p.b.WriteString("{}")
+		return
+	}
+	p.b.WriteString("{")
+	if len(block.Statements) > 0 {
+		p.trailing(parser.Pos(block.Statements[0]).Offset)
+	} else {
+		p.trailing(end)
+	}
+	p.b.WriteString("\n")
+	p.indent++
+	p.statements(block.Statements, end)
+	p.indent--
+	p.b.WriteString(strings.Repeat("\t", p.indent) + "}")
+}
+
+// expression prints an expression appearing where an expression of the given
+// precedence is expected, in parentheses if it binds more loosely.
+func (p *printer) expression(expr parser.Expression, precedence int) {
+	if own := precedenceOf(expr); own < precedence {
+		p.b.WriteString("(")
+		defer p.b.WriteString(")")
+	}
+
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		p.b.WriteString(e.Value)
+	case *parser.IntegerLiteral:
+		fmt.Fprintf(&p.b, "%d", e.Value)
+	case *parser.StringLiteral:
+		p.b.WriteString(`"` + e.Value + `"`)
+	case *parser.Boolean:
+		fmt.Fprintf(&p.b, "%t", e.Value)
+	case *parser.PrefixExpression:
+		p.b.WriteString(e.Operator)
+		if right, ok := e.Right.(*parser.PrefixExpression); ok && right.Operator == e.Operator && e.Operator == "-" {
+			// -(-a) rather than --a, which reads as a decrement.
+			p.b.WriteString("(")
+			p.expression(e.Right, lowest)
+			p.b.WriteString(")")
+			break
+		}
+		p.expression(e.Right, prefix)
+	case *parser.InfixExpression:
+		// Infix operators are left associative, so a right operand of the
+		// same precedence needs parentheses.
+		own := infixPrecedences[e.Operator]
+		p.expression(e.Left, own)
+		p.b.WriteString(" " + e.Operator)
+		right := parser.Pos(e.Right).Offset
+		if !p.commentsBefore(right) {
+			p.b.WriteString(" ")
+			p.expression(e.Right, own+1)
+			break
+		}
+		p.trailing(right)
+		p.indent++
+		p.b.WriteString("\n")
+		p.leading(right)
+		p.b.WriteString(strings.Repeat("\t", p.indent))
+		p.expression(e.Right, own+1)
+		p.indent--
+	case *parser.IfExpression:
+		p.b.WriteString("if (")
+		p.expression(e.Condition, lowest)
+		p.b.WriteString(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.b.WriteString(" else ")
+			p.block(e.Alternative)
+		}
+	case *parser.FunctionLiteral:
+		p.b.WriteString("fn(")
+		var params []parser.Expression
+		for _, param := range e.Parameters {
+			params = append(params, param)
+		}
+		p.list(params, p.params[e.Token.Pos.Offset], p.expressionItem)
+		p.b.WriteString(") ")
+		p.block(e.Body)
+	case *parser.CallExpression:
+		p.expression(e.Function, call)
+		p.b.WriteString("(")
+		p.list(e.Arguments, e.Token.Pos.Offset, p.expressionItem)
+		p.b.WriteString(")")
+	case *parser.ArrayLiteral:
+		p.b.WriteString("[")
+		p.list(e.Elements, e.Token.Pos.Offset, p.expressionItem)
+		p.b.WriteString("]")
+	case *parser.IndexExpression:
+		// Calls and indexing chain from left to right: f(x)[0] and a[0](x).
+		p.expression(e.Left, call)
+		p.b.WriteString("[")
+		p.expression(e.Index, lowest)
+		p.b.WriteString("]")
+	case *parser.HashLiteral:
+		// The pairs are printed in source order, whatever the order of the
+		// map holding them.
+		var keys []parser.Expression
+		for k := range e.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return parser.Pos(keys[i]).Offset < parser.Pos(keys[j]).Offset })
+		p.b.WriteString("{")
+		p.list(keys, e.Token.Pos.Offset, func(k parser.Expression) {
+			p.expression(k, lowest)
+			p.b.WriteString(": ")
+			p.expression(e.Pairs[k], lowest)
+		})
+		p.b.WriteString("}")
+	default:
+		panic(fmt.Sprintf("format: unexpected expression %T", expr))
+	}
+}
+
+// list prints the items of a list separated by commas, each with the
+// function item, inside the bracket at the offset open. If comments of the
+// source are inside the brackets but not inside an item, every item goes on
+// a line of its own with them, one level deeper than the brackets.
+func (p *printer) list(items []parser.Expression, open int, item func(parser.Expression)) {
+	if !p.commentsInside(open) {
+		for n, it := range items {
+			if n > 0 {
+				p.b.WriteString(", ")
+			}
+			item(it)
+		}
+		return
+	}
+	end := p.closes[open]
+	p.indent++
+	for n, it := range items {
+		p.trailing(parser.Pos(it).Offset)
+		p.b.WriteString("\n")
+		p.leading(parser.Pos(it).Offset)
+		p.b.WriteString(strings.Repeat("\t", p.indent))
+		item(it)
+		if n+1 < len(items) {
+			p.b.WriteString(",")
+		}
+	}
+	p.trailing(end)
+	p.b.WriteString("\n")
+	p.leading(end)
+	p.indent--
+	p.b.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// expressionItem prints an expression as an item of a list.
+func (p *printer) expressionItem(expr parser.Expression) {
+	p.expression(expr, lowest)
+}
+
+// precedenceOf returns the precedence of an expression: how tightly its
+// operator binds, or index for the expressions without one.
+func precedenceOf(expr parser.Expression) int {
+	switch e := expr.(type) {
+	case *parser.PrefixExpression:
+		return prefix
+	case *parser.InfixExpression:
+		return infixPrecedences[e.Operator]
+	case *parser.CallExpression:
+		return call
+	}
+	return index
+}
@@ -0,0 +1,199 @@
+package format
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// parse parses a program, failing the test on syntax errors.
+func parse(t *testing.T, source string) *parser.Program {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors in %q: %v", source, errs)
+	}
+	return program
+}
+
+// format formats a program with its comments, failing the test if File
+// finds the result does not parse back to it or is not idempotent.
+func format(t *testing.T, source string) string {
+	t.Helper()
+	formatted, err := File(parse(t, source), source)
+	if err != nil {
+		t.Fatalf("%q: %s", source, err)
+	}
+	return formatted
+}
+
+var files = []struct {
+	name   string
+	source string
+	want   string
+}{
+	{"spacing", "let a=1+2*3;puts(a)", "let a = 1 + 2 * 3;\nputs(a);\n"},
+	{"parentheses", "let a = (1 + 2) * (3 - (4 - 5)); let b = (a * 2) + 1;",
+		"let a = (1 + 2) * (3 - (4 - 5));\nlet b = a * 2 + 1;\n"},
+	{"negation", "let a = -(-1); let b = !!true; let c = -(0 - a);",
+		"let a = -(-1);\nlet b = !!true;\nlet c = -(0 - a);\n"},
+	{"blocks", "let f = fn(x) { if (x > 0) { x } else { return 0 - x; } }; if (true) {}",
+		"let f = fn(x) {\n\tif (x > 0) {\n\t\tx;\n\t} else {\n\t\treturn 0 - x;\n\t}\n};\nif (true) {}\n"},
+	{"comments", "// header\nlet a = 1; // one\n\n// before f\nlet f = fn() {\n// inside\n1 };\n// end\n",
+		"// header\nlet a = 1; // one\n// before f\nlet f = fn() {\n\t// inside\n\t1;\n};\n// end\n"},
+	{"array comments", "let a = [1, // one\n2, // two\n3];\nputs(a);",
+		"let a = [\n\t1, // one\n\t2, // two\n\t3\n];\nputs(a);\n"},
+	{"call comments", "puts(add(1, // first\n2));",
+		"puts(add(\n\t1, // first\n\t2\n));\n"},
+	{"hash comments", "let h = {\"a\": 1, // a\n// before b\n\"b\": 2};",
+		"let h = {\n\t\"a\": 1, // a\n\t// before b\n\t\"b\": 2\n};\n"},
+	{"parameter comments", "let f = fn(a, // first\nb) { a + b };",
+		"let f = fn(\n\ta, // first\n\tb\n) {\n\ta + b;\n};\n"},
+	{"operand comments", "let y = 1 +\n// why\n2;",
+		"let y = 1 +\n\t// why\n\t2;\n"},
+	{"nested comments", "puts(f(1), [2, fn() {\n// inside\n3 }]);",
+		"puts(f(1), [2, fn() {\n\t// inside\n\t3;\n}]);\n"},
+}
+
+func TestFile(t *testing.T) {
+	for _, tt := range files {
+		if got := format(t, tt.source); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// corpus returns the sources of the table above and of the Monkey programs
+// of the testdata of the repository, by name.
+func corpus(t *testing.T) map[string]string {
+	t.Helper()
+	result := make(map[string]string)
+	for _, tt := range files {
+		result[tt.name] = tt.source
+	}
+	for _, pattern := range []string{"../*/testdata/*.mk", "../*/testdata/*/*.mk"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range matches {
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[file] = string(source)
+		}
+	}
+	return result
+}
+
+func TestIdempotent(t *testing.T) {
+	for name, source := range corpus(t) {
+		once := format(t, source)
+		if twice := format(t, once); twice != once {
+			t.Errorf("%s: formatting again changes\n%s\ninto\n%s", name, once, twice)
+		}
+	}
+}
+
+func TestPreservesProgram(t *testing.T) {
+	for name, source := range corpus(t) {
+		program := parse(t, source)
+		formatted := format(t, source)
+		if got, want := parser.Dump(parse(t, formatted)), parser.Dump(program); got != want {
+			t.Errorf("%s: the formatted program parses to\n%s\nwant\n%s", name, got, want)
+		}
+		if got, want := parser.Dump(parse(t, Source(program))), parser.Dump(program); got != want {
+			t.Errorf("%s: the source without comments parses to\n%s\nwant\n%s", name, got, want)
+		}
+		if got, want := len(commentsOf(formatted)), len(commentsOf(source)); got != want {
+			t.Errorf("%s: %d comments after formatting, want %d", name, got, want)
+		}
+	}
+}
+
+// apply applies the hunks of a unified diff to a text, checking that the
+// lines each hunk deletes and keeps are those of the text and that its
+// header counts them.
+func apply(t *testing.T, text, diff string) string {
+	t.Helper()
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out []string
+	next := 0 // The index of the next line of text to copy.
+	hunks := strings.Split(diff, "@@ -")[1:]
+	for _, hunk := range hunks {
+		var aStart, aCount, bStart, bCount int
+		if _, err := fmt.Sscanf(hunk, "%d,%d +%d,%d @@", &aStart, &aCount, &bStart, &bCount); err != nil {
+			t.Fatalf("bad hunk header in\n%s", diff)
+		}
+		if aCount > 0 {
+			aStart--
+		}
+		out = append(out, lines[next:aStart]...)
+		next = aStart
+		body := strings.SplitAfter(hunk[strings.Index(hunk, "\n")+1:], "\n")
+		deleted, inserted := 0, 0
+		for n, l := range body {
+			if l == "" || strings.HasPrefix(l, `\`) {
+				continue
+			}
+			noNewline := n+1 < len(body) && strings.HasPrefix(body[n+1], `\`)
+			content := l[1:]
+			if noNewline {
+				content = strings.TrimSuffix(content, "\n")
+			}
+			switch l[0] {
+			case ' ', '-':
+				if next >= len(lines) || lines[next] != content {
+					t.Fatalf("hunk does not match line %d in\n%s", next+1, diff)
+				}
+				next++
+				deleted++
+				if l[0] == ' ' {
+					out = append(out, content)
+					inserted++
+				}
+			case '+':
+				out = append(out, content)
+				inserted++
+			}
+		}
+		if deleted != aCount || inserted != bCount {
+			t.Fatalf("hunk header counts %d and %d lines, the hunk has %d and %d in\n%s", aCount, bCount, deleted, inserted, diff)
+		}
+	}
+	return strings.Join(append(out, lines[next:]...), "")
+}
+
+func TestDiff(t *testing.T) {
+	long := strings.Repeat("let a = 1;\n", 20)
+	tests := []struct{ a, b string }{
+		{"let a=1;", "let a = 1;\n"},
+		{"", "let a = 1;\n"},
+		{"let a = 1;\n", ""},
+		{long + "let b=2;\n" + long + "let c=3;\n" + long, long + "let b = 2;\n" + long + "let c = 3;\n" + long},
+		{"let a = 1;\nlet b = 2;\n", "let a = 1;\nlet x = 0;\nlet b = 2;\n"},
+	}
+	for _, source := range corpus(t) {
+		tests = append(tests, struct{ a, b string }{source, format(t, source)})
+	}
+	for _, tt := range tests {
+		diff := Diff(tt.a, tt.b)
+		if (diff == "") != (tt.a == tt.b) {
+			t.Errorf("Diff(%q, %q) = %q", tt.a, tt.b, diff)
+			continue
+		}
+		if got := apply(t, tt.a, diff); got != tt.b {
+			t.Errorf("applying\n%sto %q gives %q, want %q", diff, tt.a, got, tt.b)
+		}
+	}
+}
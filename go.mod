@@ -1,3 +1,3 @@
-module compiler
+module github.com/user/golang-interpreter
 
 go 1.20
@@ -1,7 +1,5 @@
 package intermediate
 
-package intermediate
-
 import "fmt"
 
 // Node represents a node in the intermediate code AST.
@@ -45,7 +43,7 @@ func (i *Integer) String() string {
 
 // UnaryOp represents a unary operation in the AST.
 type UnaryOp struct {
-	Op    string // The operator of the unary operation.
+	Op      string // The operator of the unary operation.
 	Operand Node   // The operand of the unary operation.
 }
 
@@ -53,4 +51,3 @@ type UnaryOp struct {
 func (u *UnaryOp) String() string {
 	return fmt.Sprintf("(%s%s)", u.Op, u.Operand.String())
 }
-
@@ -0,0 +1,65 @@
+package intermediate
+
+// SimplifyCFG merges every block into its predecessor when the predecessor
+// jumps unconditionally to it and is its only predecessor, which removes the
+// chains of jumps left behind by inlining. It returns true if any block was
+// merged.
+func SimplifyCFG(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		if simplifyFunctionCFG(fn) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// simplifyFunctionCFG merges the blocks of a single function.
+func simplifyFunctionCFG(fn *Function) bool {
+	merged := make(map[*Block]bool)
+	for _, b := range fn.Blocks {
+		if merged[b] {
+			continue
+		}
+		for {
+			t := b.Terminator()
+			if t == nil || t.Op != OpJump {
+				break
+			}
+			succ := t.Targets[0]
+			if succ == b || succ == fn.Entry() || len(succ.Preds) != 1 {
+				break
+			}
+
+			// A phi with a single predecessor has a single operand.
+			for _, phi := range succ.Phis() {
+				fn.ReplaceUses(phi, phi.Args[0])
+			}
+			b.Instrs = b.Instrs[:len(b.Instrs)-1]
+			for _, in := range succ.Instrs[len(succ.Phis()):] {
+				b.Append(in)
+			}
+			for _, s := range b.Succs() {
+				for n, p := range s.Preds {
+					if p == succ {
+						s.Preds[n] = b
+					}
+				}
+			}
+			succ.Instrs = nil
+			merged[succ] = true
+		}
+	}
+	if len(merged) == 0 {
+		return false
+	}
+
+	var kept []*Block
+	for _, b := range fn.Blocks {
+		if !merged[b] {
+			kept = append(kept, b)
+		}
+	}
+	fn.Blocks = kept
+	return true
+}
@@ -5,16 +5,14 @@ import (
 	"fmt"
 )
 
-package intermediate
-
-import (
-"bytes"
-"fmt"
-)
-
 // CodeGenerator represents a code generator for the intermediate code.
 type CodeGenerator struct {
 	buffer bytes.Buffer // The buffer to hold the generated code.
+
+	// Renumber makes the generator number the registers and blocks of every
+	// function in order of appearance, so that the text does not depend on
+	// the numbers the optimization passes happen to leave.
+	Renumber bool
 }
 
 // NewCodeGenerator creates a new code generator.
@@ -40,3 +38,43 @@ func (c *CodeGenerator) Generate(node Node) {
 func (c *CodeGenerator) GetCode() string {
 	return c.buffer.String()
 }
+
+// GenerateModule generates the textual form of every global and function of
+// the module.
+func (c *CodeGenerator) GenerateModule(m *Module) {
+	for _, g := range m.Globals {
+		c.buffer.WriteString(fmt.Sprintf("global @%s\n", g))
+	}
+	for n, fn := range m.Functions {
+		if n > 0 || len(m.Globals) > 0 {
+			c.buffer.WriteString("\n")
+		}
+		c.GenerateFunction(fn)
+	}
+}
+
+// GenerateFunction generates the textual form of a function.
+func (c *CodeGenerator) GenerateFunction(fn *Function) {
+	var num *numbering
+	if c.Renumber {
+		num = newNumbering(fn)
+	}
+	c.buffer.WriteString(fmt.Sprintf("func @%s(", fn.Name))
+	for n, p := range fn.Params {
+		if n > 0 {
+			c.buffer.WriteString(", ")
+		}
+		c.buffer.WriteString(fmt.Sprintf("%s %s", num.ref(p), p.Type))
+	}
+	c.buffer.WriteString(fmt.Sprintf(") %s {\n", fn.ReturnType))
+	for _, b := range fn.Blocks {
+		c.buffer.WriteString(num.label(b) + ":\n")
+		for _, in := range b.Instrs {
+			if in.Op == OpParam {
+				continue
+			}
+			c.buffer.WriteString("  " + in.format(num) + "\n")
+		}
+	}
+	c.buffer.WriteString("}\n")
+}
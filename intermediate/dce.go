@@ -0,0 +1,177 @@
+package intermediate
+
+// EliminateDeadCode removes unreachable blocks, instructions whose values are
+// never used and stores to globals that are never loaded from every function
+// of the module. It returns true if anything was removed.
+func EliminateDeadCode(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		if RemoveUnreachableBlocks(fn) {
+			changed = true
+		}
+	}
+	if eliminateDeadStores(m) {
+		changed = true
+	}
+	for _, fn := range m.Functions {
+		if EliminateDeadInstrs(fn) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// RemoveUnreachableBlocks removes the blocks that cannot be reached from the
+// entry block, such as the code following a return statement, and simplifies
+// the phis that are left with a single operand. It returns true if any block
+// was removed.
+func RemoveUnreachableBlocks(fn *Function) bool {
+	reachable := make(map[*Block]bool)
+	work := []*Block{fn.Entry()}
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		if reachable[b] {
+			continue
+		}
+		reachable[b] = true
+		work = append(work, b.Succs()...)
+	}
+
+	if len(reachable) == len(fn.Blocks) {
+		return false
+	}
+
+	var kept []*Block
+	for _, b := range fn.Blocks {
+		if reachable[b] {
+			kept = append(kept, b)
+		}
+	}
+	fn.Blocks = kept
+	fn.RecomputePreds()
+	simplifyPhis(fn)
+	return true
+}
+
+// simplifyPhis replaces every phi whose operands are all the same value, or
+// the phi itself, with that value.
+func simplifyPhis(fn *Function) {
+	for changed := true; changed; {
+		changed = false
+		for _, b := range fn.Blocks {
+			// Removing a phi shifts the instructions of the block, which
+			// Phis returns a part of, so the phis are copied first.
+			for _, phi := range append([]*Instr(nil), b.Phis()...) {
+				if phi.Block == nil {
+					continue
+				}
+				var same *Instr
+				trivial := true
+				for _, arg := range phi.Args {
+					if arg == phi || arg == same {
+						continue
+					}
+					if same != nil {
+						trivial = false
+						break
+					}
+					same = arg
+				}
+				if !trivial || same == nil {
+					continue
+				}
+				fn.ReplaceUses(phi, same)
+				phi.Remove()
+				changed = true
+			}
+		}
+	}
+}
+
+// EliminateDeadInstrs removes the instructions whose values are never used.
+//
+// An instruction is live if it has side effects or if a live instruction uses
+// its value; everything else is dead. Liveness is propagated backwards from
+// the side-effecting instructions, so that chains of dead temporaries, and
+// phis only used by themselves, are removed in one pass. Parameters are
+// always kept since they are part of the function signature. It returns true
+// if any instruction was removed.
+func EliminateDeadInstrs(fn *Function) bool {
+	live := make([]bool, fn.NumInstrs())
+	var work []*Instr
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			if in.Op == OpParam || in.HasSideEffects() {
+				live[in.ID] = true
+				work = append(work, in)
+			}
+		}
+	}
+	for len(work) > 0 {
+		in := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, arg := range in.Args {
+			if !live[arg.ID] {
+				live[arg.ID] = true
+				work = append(work, arg)
+			}
+		}
+	}
+
+	changed := false
+	for _, b := range fn.Blocks {
+		var kept []*Instr
+		for _, in := range b.Instrs {
+			if live[in.ID] {
+				kept = append(kept, in)
+			} else {
+				in.Block = nil
+				changed = true
+			}
+		}
+		b.Instrs = kept
+	}
+	return changed
+}
+
+// eliminateDeadStores removes the stores to globals that no function ever
+// loads, together with the globals themselves. It returns true if any store
+// was removed.
+func eliminateDeadStores(m *Module) bool {
+	loaded := make(map[string]bool)
+	for _, fn := range m.Functions {
+		for _, b := range fn.Blocks {
+			for _, in := range b.Instrs {
+				if in.Op == OpLoadGlobal {
+					loaded[in.Name] = true
+				}
+			}
+		}
+	}
+
+	changed := false
+	for _, fn := range m.Functions {
+		for _, b := range fn.Blocks {
+			var kept []*Instr
+			for _, in := range b.Instrs {
+				if in.Op == OpStoreGlobal && !loaded[in.Name] {
+					in.Block = nil
+					changed = true
+					continue
+				}
+				kept = append(kept, in)
+			}
+			b.Instrs = kept
+		}
+	}
+
+	var globals []string
+	for _, g := range m.Globals {
+		if loaded[g] {
+			globals = append(globals, g)
+		}
+	}
+	m.Globals = globals
+	return changed
+}
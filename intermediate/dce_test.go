@@ -0,0 +1,71 @@
+package intermediate
+
+import "testing"
+
+// trivial returns true if the operands of the phi are all the same value, or
+// the phi itself.
+func trivial(phi *Instr) bool {
+	var same *Instr
+	for _, arg := range phi.Args {
+		if arg != phi && arg != same {
+			if same != nil {
+				return false
+			}
+			same = arg
+		}
+	}
+	return true
+}
+
+// TestSimplifyAdjacentPhis runs the tail recursions of functions passing
+// several parameters on unchanged, whose loops start with adjacent phis of
+// themselves, and checks that every pass leaves valid IR computing the same
+// result.
+func TestSimplifyAdjacentPhis(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"seven parameters", `
+let q = fn(a, b, c, d, e, g, h) { if (a == 0) { h } else { q(a - 1, b, c, d, e, g, h + 1) } };
+puts(q(10, 2, 3, 4, 5, 6, 7));
+`, "17\n"},
+		{"eight parameters", `
+let q = fn(a, b, c, d, e, g, h, i) { if (a == 0) { h + i } else { q(a - 1, b, c, d, e, g, h + 1, i) } };
+puts(q(10, 2, 3, 4, 5, 6, 7, 8));
+`, "25\n"},
+		{"all unchanged but the counter", `
+let q = fn(a, b, c, d) { if (a == 0) { b + c + d } else { q(a - 1, b, c, d) } };
+puts(q(5, 1, 2, 3));
+`, "6\n"},
+	}
+	for _, tt := range tests {
+		for level := 0; level <= 2; level++ {
+			opts := Options{Level: level, InlineThreshold: DefaultInlineThreshold}
+			module := lowerOnly(t, tt.source)
+			for _, pass := range Passes(opts) {
+				pass.Run(module)
+				if err := VerifyModule(module); err != nil {
+					t.Fatalf("%s at -O%d: after pass %s: %s", tt.name, level, pass.Name, err)
+				}
+			}
+			for _, fn := range module.Functions {
+				for _, b := range fn.Blocks {
+					for _, phi := range b.Phis() {
+						if trivial(phi) {
+							t.Errorf("%s at -O%d: phi left of a single value: %s", tt.name, level, phi)
+						}
+					}
+				}
+			}
+			got, err := interpret(module)
+			if err != nil {
+				t.Fatalf("%s at -O%d: %s", tt.name, level, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s at -O%d: printed %q, want %q", tt.name, level, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build monkeydebug
+
+package intermediate
+
+// verifyPasses makes Optimize verify the module after every pass. It is set
+// in debug builds, made with -tags monkeydebug.
+const verifyPasses = true
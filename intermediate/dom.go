@@ -0,0 +1,107 @@
+package intermediate
+
+// DomTree represents the dominator tree of a function.
+type DomTree struct {
+	Idom     map[*Block]*Block   // The immediate dominator of every reachable block except the entry.
+	Children map[*Block][]*Block // The blocks immediately dominated by each block.
+	Order    []*Block            // The reachable blocks in reverse postorder.
+
+	number map[*Block]int // The reverse postorder number of every reachable block.
+}
+
+// Dominators computes the dominator tree of the function using the iterative
+// algorithm of Cooper, Harvey and Kennedy.
+func Dominators(fn *Function) *DomTree {
+	t := &DomTree{
+		Idom:     make(map[*Block]*Block),
+		Children: make(map[*Block][]*Block),
+		number:   make(map[*Block]int),
+	}
+	t.Order = ReversePostorder(fn)
+	for n, b := range t.Order {
+		t.number[b] = n
+	}
+
+	entry := fn.Entry()
+	t.Idom[entry] = entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range t.Order[1:] {
+			var idom *Block
+			for _, p := range b.Preds {
+				if _, ok := t.Idom[p]; !ok {
+					continue
+				}
+				if idom == nil {
+					idom = p
+				} else {
+					idom = t.intersect(p, idom)
+				}
+			}
+			if idom != nil && t.Idom[b] != idom {
+				t.Idom[b] = idom
+				changed = true
+			}
+		}
+	}
+	delete(t.Idom, entry)
+
+	for _, b := range t.Order[1:] {
+		if idom, ok := t.Idom[b]; ok {
+			t.Children[idom] = append(t.Children[idom], b)
+		}
+	}
+	return t
+}
+
+// intersect returns the nearest common dominator of a and b.
+func (t *DomTree) intersect(a, b *Block) *Block {
+	for a != b {
+		for t.number[a] > t.number[b] {
+			a = t.Idom[a]
+		}
+		for t.number[b] > t.number[a] {
+			b = t.Idom[b]
+		}
+	}
+	return a
+}
+
+// Dominates returns true if every path from the entry block to b goes
+// through a.
+func (t *DomTree) Dominates(a, b *Block) bool {
+	for {
+		if a == b {
+			return true
+		}
+		idom, ok := t.Idom[b]
+		if !ok {
+			return false
+		}
+		b = idom
+	}
+}
+
+// ReversePostorder returns the blocks reachable from the entry block in
+// reverse postorder, so that every block comes before its successors except
+// along back edges.
+func ReversePostorder(fn *Function) []*Block {
+	visited := make(map[*Block]bool)
+	var post []*Block
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		visited[b] = true
+		for _, s := range b.Succs() {
+			if !visited[s] {
+				visit(s)
+			}
+		}
+		post = append(post, b)
+	}
+	visit(fn.Entry())
+
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
@@ -0,0 +1,138 @@
+package intermediate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// valueKey identifies the value computed by a pure instruction: two
+// instructions with the same key compute the same value.
+type valueKey struct {
+	op    Op
+	typ   Type
+	args  string // The register numbers of the operands.
+	c     int64  // The constant of OpConst.
+	name  string // The global of OpLoadGlobal.
+	block int    // The block of OpPhi, whose operands depend on the predecessors.
+}
+
+// isPure returns true if the instruction computes a value that only depends on
+// its operands, so that it can be replaced by an equivalent instruction that
+// dominates it. Globals are bound by let statements and never reassigned, so
+// loading the same global twice yields the same value.
+func (i *Instr) isPure() bool {
+	switch i.Op {
+	case OpConst, OpAdd, OpSub, OpMul, OpDiv, OpNeg, OpNot,
+		OpEq, OpNe, OpLt, OpGt, OpZext, OpPhi, OpLoadGlobal:
+		// A division that traps is only replaced by an identical
+		// division that dominates it and would have trapped first.
+		return true
+	}
+	return false
+}
+
+// key returns the value key of a pure instruction. The operands of
+// commutative operations are put in a canonical order, and "a > b" is
+// numbered like "b < a".
+func (i *Instr) key() valueKey {
+	k := valueKey{op: i.Op, typ: i.Type, c: i.Const, name: i.Name, block: -1}
+	args := i.Args
+	switch i.Op {
+	case OpAdd, OpMul, OpEq, OpNe:
+		if args[0].ID > args[1].ID {
+			args = []*Instr{args[1], args[0]}
+		}
+	case OpGt:
+		k.op = OpLt
+		args = []*Instr{args[1], args[0]}
+	case OpPhi:
+		k.block = i.Block.ID
+	}
+	ids := make([]string, len(args))
+	for n, arg := range args {
+		ids[n] = fmt.Sprint(arg.ID)
+	}
+	k.args = strings.Join(ids, ",")
+	return k
+}
+
+// NumberValues performs dominator-based global value numbering on every
+// function of the module and returns true if any instruction was removed.
+func NumberValues(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		if NumberFunctionValues(fn) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// NumberFunctionValues removes every pure instruction that computes the same
+// value as an instruction dominating it, such as a repeated infix expression
+// or constant, and rewrites its uses to the dominating instruction.
+//
+// The dominator tree is walked in preorder with a scoped table of the values
+// available at each block: a value computed in a block is available in the
+// blocks it dominates and nowhere else. It returns true if any instruction
+// was removed.
+func NumberFunctionValues(fn *Function) bool {
+	dom := Dominators(fn)
+	available := make(map[valueKey]*Instr)
+	repl := make(map[*Instr]*Instr)
+	changed := false
+
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		var added []valueKey
+		var kept []*Instr
+		for _, in := range b.Instrs {
+			for n, arg := range in.Args {
+				if r, ok := repl[arg]; ok {
+					in.Args[n] = r
+				}
+			}
+			if !in.isPure() {
+				kept = append(kept, in)
+				continue
+			}
+			k := in.key()
+			if prev, ok := available[k]; ok {
+				repl[in] = prev
+				in.Block = nil
+				changed = true
+				continue
+			}
+			available[k] = in
+			added = append(added, k)
+			kept = append(kept, in)
+		}
+		b.Instrs = kept
+
+		for _, child := range dom.Children[b] {
+			visit(child)
+		}
+		for _, k := range added {
+			delete(available, k)
+		}
+	}
+	visit(fn.Entry())
+
+	// Phi operands flow in from predecessors, which may have been visited
+	// after the phi itself, so they are rewritten once every block is done.
+	for _, b := range fn.Blocks {
+		for _, phi := range b.Phis() {
+			for n, arg := range phi.Args {
+				for {
+					r, ok := repl[arg]
+					if !ok {
+						break
+					}
+					arg = r
+				}
+				phi.Args[n] = arg
+			}
+		}
+	}
+	return changed
+}
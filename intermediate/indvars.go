@@ -0,0 +1,179 @@
+package intermediate
+
+// InductionVariable represents a basic induction variable of a loop: a phi in
+// the header that starts at Init and is increased by the constant Step on
+// every iteration.
+type InductionVariable struct {
+	Phi  *Instr // The phi in the loop header.
+	Init *Instr // The value on entry to the loop, coming from the preheader.
+	Next *Instr // The instruction computing the value for the next iteration.
+	Step int64  // The amount added on every iteration.
+}
+
+// FindInductionVariables returns the basic induction variables of a loop with
+// a preheader and a single latch.
+func FindInductionVariables(l *Loop) []*InductionVariable {
+	if l.Preheader == nil || len(l.Latches) != 1 || len(l.Header.Preds) != 2 || l.Header.Preds[0] != l.Preheader {
+		return nil
+	}
+
+	var ivs []*InductionVariable
+	for _, phi := range l.Header.Phis() {
+		next := phi.Args[1]
+		if !l.Defines(next) || len(next.Args) != 2 {
+			continue
+		}
+		var step *Instr
+		switch {
+		case next.Op == OpAdd && next.Args[0] == phi:
+			step = next.Args[1]
+		case next.Op == OpAdd && next.Args[1] == phi:
+			step = next.Args[0]
+		case next.Op == OpSub && next.Args[0] == phi:
+			step = next.Args[1]
+		}
+		if step == nil || step.Op != OpConst {
+			continue
+		}
+		iv := &InductionVariable{Phi: phi, Init: phi.Args[0], Next: next, Step: step.Const}
+		if next.Op == OpSub {
+			iv.Step = -iv.Step
+		}
+		ivs = append(ivs, iv)
+	}
+	return ivs
+}
+
+// OptimizeInductionVariables simplifies the induction variables of every loop
+// and applies strength reduction to their multiplications. It returns true if
+// the module changed.
+func OptimizeInductionVariables(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		for _, l := range FindLoops(fn, Dominators(fn)) {
+			EnsurePreheader(fn, l)
+			if mergeInductionVariables(fn, l) {
+				changed = true
+			}
+			if reduceStrength(fn, l) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// mergeInductionVariables replaces induction variables that have the same
+// initial value and step as another one with that one.
+func mergeInductionVariables(fn *Function, l *Loop) bool {
+	type shape struct {
+		init *Instr
+		step int64
+	}
+	seen := make(map[shape]*InductionVariable)
+	changed := false
+	for _, iv := range FindInductionVariables(l) {
+		s := shape{iv.Init, iv.Step}
+		first, ok := seen[s]
+		if !ok {
+			seen[s] = iv
+			continue
+		}
+		fn.ReplaceUses(iv.Phi, first.Phi)
+		fn.ReplaceUses(iv.Next, first.Next)
+		changed = true
+	}
+	return changed
+}
+
+// reduceStrength replaces every multiplication of an induction variable by a
+// loop-invariant value k with a new induction variable that starts at
+// Init*k and is increased by Step*k on every iteration, turning the
+// multiplication in the loop into an addition.
+func reduceStrength(fn *Function, l *Loop) bool {
+	ivs := FindInductionVariables(l)
+	if len(ivs) == 0 {
+		return false
+	}
+	byPhi := make(map[*Instr]*InductionVariable)
+	for _, iv := range ivs {
+		byPhi[iv.Phi] = iv
+	}
+
+	type product struct {
+		iv *InductionVariable
+		k  *Instr
+	}
+	reduced := make(map[product]*Instr)
+	pre := l.Preheader
+	changed := false
+
+	for _, b := range fn.Blocks {
+		if !l.Contains(b) {
+			continue
+		}
+		for _, in := range append([]*Instr(nil), b.Instrs...) {
+			if in.Op != OpMul {
+				continue
+			}
+			iv, k := byPhi[in.Args[0]], in.Args[1]
+			if iv == nil {
+				iv, k = byPhi[in.Args[1]], in.Args[0]
+			}
+			if iv == nil || l.Defines(k) {
+				continue
+			}
+
+			p := product{iv, k}
+			phi, ok := reduced[p]
+			if !ok {
+				init := multiplyInPreheader(fn, pre, iv.Init, k)
+				step := fn.NewInstr(OpConst, TypeInt)
+				step.Const = iv.Step
+				stepK := multiplyInPreheader(fn, pre, step, k)
+
+				phi = fn.NewInstr(OpPhi, TypeInt, init)
+				phi.Pos = in.Pos
+				l.Header.InsertBefore(phi, l.Header.Instrs[0])
+				next := fn.NewInstr(OpAdd, TypeInt, phi, stepK)
+				next.Pos = in.Pos
+				insertAfter(next, iv.Next)
+				phi.Args = append(phi.Args, next)
+				reduced[p] = phi
+			}
+			fn.ReplaceUses(in, phi)
+			in.Remove()
+			changed = true
+		}
+	}
+	return changed
+}
+
+// multiplyInPreheader emits the product of a and b at the end of the
+// preheader, folding it to a constant if both are constants.
+func multiplyInPreheader(fn *Function, pre *Block, a, b *Instr) *Instr {
+	var p *Instr
+	if a.Op == OpConst && b.Op == OpConst {
+		p = fn.NewInstr(OpConst, TypeInt)
+		p.Const = a.Const * b.Const
+	} else {
+		if a.Block == nil {
+			pre.InsertBefore(a, pre.Terminator())
+		}
+		p = fn.NewInstr(OpMul, TypeInt, a, b)
+	}
+	pre.InsertBefore(p, pre.Terminator())
+	return p
+}
+
+// insertAfter inserts the instruction into the block of pos right after pos.
+func insertAfter(i, pos *Instr) {
+	b := pos.Block
+	for n, in := range b.Instrs {
+		if in == pos {
+			i.Block = b
+			b.Instrs = append(b.Instrs[:n+1], append([]*Instr{i}, b.Instrs[n+1:]...)...)
+			return
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package intermediate
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/diagnostic"
+)
+
+// DefaultInlineThreshold is the largest cost of a function that is inlined
+// unless another threshold is given.
+const DefaultInlineThreshold = 25
+
+// CodeInline is the code of the remarks produced by the inliner.
+const CodeInline = "inline"
+
+// Inliner replaces calls of small functions with a copy of their body.
+type Inliner struct {
+	Threshold int                         // The largest cost of a function that is inlined.
+	Remark    func(diagnostic.Diagnostic) // Receives a remark for every call site, may be nil.
+}
+
+// InlineCost returns the estimated size of the function: one for every
+// instruction, with calls counting more since they also set up arguments.
+// Parameters and unconditional jumps are free.
+func InlineCost(fn *Function) int {
+	cost := 0
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			switch in.Op {
+			case OpParam, OpJump:
+			case OpCall:
+				cost += 1 + len(in.Args)
+			default:
+				cost++
+			}
+		}
+	}
+	return cost
+}
+
+// Run inlines calls in every function of the module and returns true if any
+// call was inlined.
+//
+// Functions are processed callees first, so that a function is inlined with
+// the calls it makes already inlined and costed accordingly. Functions that
+// are part of a cycle in the call graph are never inlined, which guards
+// against unbounded expansion of direct and mutual recursion.
+func (in *Inliner) Run(m *Module) bool {
+	order, recursive := callGraphOrder(m)
+	changed := false
+	for _, fn := range order {
+		seen := make(map[*Instr]bool)
+		for in.inlineCall(m, fn, recursive, seen) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// inlineCall inlines the first call in fn that passes the cost model and
+// returns true if it did. Calls that are not inlined are added to seen, so
+// that they are only remarked on once.
+func (in *Inliner) inlineCall(m *Module, fn *Function, recursive map[*Function]bool, seen map[*Instr]bool) bool {
+	for _, b := range fn.Blocks {
+		for _, call := range b.Instrs {
+			if call.Op != OpCall || seen[call] {
+				continue
+			}
+			callee := m.Function(call.Name)
+			if callee == nil {
+				// Builtins have no body to inline.
+				seen[call] = true
+				continue
+			}
+			ok, reason := in.shouldInline(fn, callee, recursive)
+			if !ok {
+				seen[call] = true
+				in.remark(call, fmt.Sprintf("%s not inlined into %s: %s", call.Name, fn.Name, reason))
+				continue
+			}
+			in.remark(call, fmt.Sprintf("%s inlined into %s: %s", call.Name, fn.Name, reason))
+			InlineCall(fn, call, callee)
+			return true
+		}
+	}
+	return false
+}
+
+// shouldInline applies the cost model to a call of callee from caller and
+// returns the decision with a reason for the remark.
+func (in *Inliner) shouldInline(caller, callee *Function, recursive map[*Function]bool) (bool, string) {
+	switch {
+	case callee == caller:
+		return false, "recursive call"
+	case recursive[callee]:
+		return false, "callee is recursive"
+	case len(callee.Entry().Preds) > 0:
+		return false, "callee entry block is a loop header"
+	}
+	cost := InlineCost(callee)
+	if cost > in.Threshold {
+		return false, fmt.Sprintf("cost %d exceeds threshold %d", cost, in.Threshold)
+	}
+	return true, fmt.Sprintf("cost %d within threshold %d", cost, in.Threshold)
+}
+
+// remark reports a remark about a call site.
+func (in *Inliner) remark(call *Instr, msg string) {
+	if in.Remark == nil {
+		return
+	}
+	in.Remark(diagnostic.Diagnostic{
+		Severity: diagnostic.Note,
+		Code:     CodeInline,
+		Span:     diagnostic.Span{Start: call.Pos, End: call.Pos},
+		Message:  msg,
+	})
+}
+
+// InlineCall replaces the call instruction in caller with a copy of the body
+// of callee.
+//
+// The block containing the call is split after the call; the copied entry
+// block is jumped to from the first half, and every copied return jumps to
+// the second half, where a phi merges the returned values if there is more
+// than one return.
+func InlineCall(caller *Function, call *Instr, callee *Function) {
+	// Allocate the copies of the blocks of the callee and the block that
+	// receives the instructions following the call.
+	blocks := make(map[*Block]*Block)
+	for _, b := range callee.Blocks {
+		blocks[b] = caller.NewBlock()
+	}
+	before := call.Block
+	after := caller.NewBlock()
+
+	// Move everything following the call into the new block.
+	n := 0
+	for before.Instrs[n] != call {
+		n++
+	}
+	for _, i := range before.Instrs[n+1:] {
+		after.Append(i)
+	}
+	before.Instrs = before.Instrs[:n]
+	for _, s := range after.Succs() {
+		for k, p := range s.Preds {
+			if p == before {
+				s.Preds[k] = after
+			}
+		}
+	}
+
+	// Copy the blocks of the callee, with the parameters replaced by the
+	// arguments and the returns replaced by jumps to the second half.
+	values := make(map[*Instr]*Instr)
+	for _, p := range callee.Params {
+		values[p] = call.Args[p.Const]
+	}
+
+	var copies []*Instr
+	var results []*Instr
+	for _, b := range callee.Blocks {
+		nb := blocks[b]
+		for _, p := range b.Preds {
+			nb.Preds = append(nb.Preds, blocks[p])
+		}
+		for _, i := range b.Instrs {
+			if i.Op == OpParam {
+				continue
+			}
+			switch {
+			case i.Op == OpTailCall:
+				// The call no longer happens in tail position.
+				c := caller.NewInstr(OpCall, callee.ReturnType, i.Args...)
+				c.Name = i.Name
+				c.Pos = i.Pos
+				values[i] = c
+				copies = append(copies, c)
+				nb.Append(c)
+				results = append(results, i)
+			case i.Op == OpReturn && len(i.Args) > 0:
+				results = append(results, i.Args[0])
+			}
+			if i.Op == OpReturn || i.Op == OpTailCall {
+				jmp := caller.NewInstr(OpJump, TypeVoid)
+				jmp.Pos = call.Pos
+				jmp.Targets = []*Block{after}
+				nb.Append(jmp)
+				after.Preds = append(after.Preds, nb)
+				continue
+			}
+			c := caller.NewInstr(i.Op, i.Type, i.Args...)
+			c.Const = i.Const
+			c.Name = i.Name
+			c.Pos = i.Pos
+			for _, t := range i.Targets {
+				c.Targets = append(c.Targets, blocks[t])
+			}
+			values[i] = c
+			copies = append(copies, c)
+			nb.Append(c)
+		}
+	}
+
+	// Operands are remapped once every instruction has been copied, since
+	// phis may refer to values defined later in the block order.
+	for _, c := range copies {
+		args := make([]*Instr, len(c.Args))
+		for n, a := range c.Args {
+			args[n] = values[a]
+		}
+		c.Args = args
+	}
+
+	entry := blocks[callee.Entry()]
+	jmp := caller.NewInstr(OpJump, TypeVoid)
+	jmp.Pos = call.Pos
+	jmp.Targets = []*Block{entry}
+	before.Append(jmp)
+	entry.Preds = append(entry.Preds, before)
+
+	var result *Instr
+	switch len(results) {
+	case 0:
+	case 1:
+		result = values[results[0]]
+	default:
+		result = caller.NewInstr(OpPhi, call.Type)
+		result.Pos = call.Pos
+		for _, r := range results {
+			result.Args = append(result.Args, values[r])
+		}
+		after.Instrs = append([]*Instr{result}, after.Instrs...)
+		result.Block = after
+	}
+	if result != nil {
+		caller.ReplaceUses(call, result)
+	}
+	call.Block = nil
+}
+
+// callGraphOrder returns the functions of the module with callees before
+// their callers, and the set of functions that are part of a cycle of calls.
+// It uses Tarjan's strongly connected components algorithm, which yields the
+// components in reverse topological order.
+func callGraphOrder(m *Module) ([]*Function, map[*Function]bool) {
+	callees := make(map[*Function][]*Function)
+	for _, fn := range m.Functions {
+		for _, b := range fn.Blocks {
+			for _, i := range b.Instrs {
+				if i.Op == OpCall || i.Op == OpTailCall {
+					if c := m.Function(i.Name); c != nil {
+						callees[fn] = append(callees[fn], c)
+					}
+				}
+			}
+		}
+	}
+
+	index := make(map[*Function]int)
+	low := make(map[*Function]int)
+	onStack := make(map[*Function]bool)
+	var stack, order []*Function
+	recursive := make(map[*Function]bool)
+
+	var connect func(fn *Function)
+	connect = func(fn *Function) {
+		index[fn] = len(index)
+		low[fn] = index[fn]
+		stack = append(stack, fn)
+		onStack[fn] = true
+		for _, c := range callees[fn] {
+			if _, seen := index[c]; !seen {
+				connect(c)
+				if low[c] < low[fn] {
+					low[fn] = low[c]
+				}
+			} else if onStack[c] && index[c] < low[fn] {
+				low[fn] = index[c]
+			}
+			if c == fn {
+				recursive[fn] = true
+			}
+		}
+		if low[fn] != index[fn] {
+			return
+		}
+		var component []*Function
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == fn {
+				break
+			}
+		}
+		if len(component) > 1 {
+			for _, c := range component {
+				recursive[c] = true
+			}
+		}
+		order = append(order, component...)
+	}
+	for _, fn := range m.Functions {
+		if _, seen := index[fn]; !seen {
+			connect(fn)
+		}
+	}
+	return order, recursive
+}
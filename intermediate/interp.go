@@ -0,0 +1,211 @@
+package intermediate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxDepth is the depth of nested calls beyond which interpretation fails
+// with ErrStackOverflow, like the other interpreters.
+const MaxDepth = 1 << 16
+
+// The errors of an interpreter running out of resources rather than of the
+// program failing: the same program may complete once optimized.
+var (
+	ErrStackOverflow = errors.New("stack overflow")
+	ErrStepLimit     = errors.New("step limit exceeded")
+)
+
+// Interpreter represents an interpreter executing a module directly, so that
+// the behaviour of a program can be compared before and after each
+// optimization pass.
+//
+// Values are 64-bit integers, booleans being 0 or 1, held in the virtual
+// registers of each call. The globals of the module are the only memory.
+// Calls of the functions of the module nest up to MaxDepth, and tail calls
+// replace the calling function. Arithmetic wraps, and division by zero or of
+// the smallest integer by -1 is a runtime error.
+type Interpreter struct {
+	module  *Module
+	out     io.Writer        // Receives what puts prints.
+	globals map[string]int64 // The values of the globals.
+	steps   int64            // The number of instructions executed.
+
+	// MaxSteps is the number of instructions after which execution stops
+	// with ErrStepLimit, so that programs that do not terminate can be compared.
+	// There is no limit if it is 0.
+	MaxSteps int64
+}
+
+// NewInterpreter creates an interpreter of the module printing to out.
+func NewInterpreter(m *Module, out io.Writer) *Interpreter {
+	return &Interpreter{module: m, out: out, globals: make(map[string]int64)}
+}
+
+// Run executes the main function of the module and returns the runtime
+// error that ended it, if any.
+func (it *Interpreter) Run() error {
+	main := it.module.Function(MainFunction)
+	if main == nil {
+		return fmt.Errorf("no function @%s", MainFunction)
+	}
+	_, err := it.call(main, nil, 1)
+	return err
+}
+
+// call executes a function with the arguments at the depth of nested calls
+// and returns its result, 0 for void functions.
+func (it *Interpreter) call(fn *Function, args []int64, depth int) (int64, error) {
+	if depth > MaxDepth {
+		return 0, ErrStackOverflow
+	}
+
+tailCall:
+	for {
+		if len(args) != len(fn.Params) {
+			return 0, fmt.Errorf("@%s takes %d arguments, not %d", fn.Name, len(fn.Params), len(args))
+		}
+		regs := make([]int64, fn.NumInstrs())
+		for n, p := range fn.Params {
+			regs[p.ID] = args[n]
+		}
+
+		var prev *Block
+		b := fn.Entry()
+		for {
+			// The phis of a block read their operands together, as if on the
+			// edge from the predecessor.
+			phis := b.Phis()
+			if len(phis) > 0 {
+				pred := b.PredIndex(prev)
+				if pred < 0 {
+					return 0, fmt.Errorf("@%s: %s entered from a block that is not a predecessor", fn.Name, b.Label())
+				}
+				values := make([]int64, len(phis))
+				for n, phi := range phis {
+					values[n] = regs[phi.Args[pred].ID]
+				}
+				for n, phi := range phis {
+					regs[phi.ID] = values[n]
+				}
+			}
+
+			var next *Block
+			for _, in := range b.Instrs[len(phis):] {
+				it.steps++
+				if it.MaxSteps > 0 && it.steps > it.MaxSteps {
+					return 0, ErrStepLimit
+				}
+				arg := func(n int) int64 { return regs[in.Args[n].ID] }
+
+				switch in.Op {
+				case OpConst:
+					regs[in.ID] = in.Const
+				case OpParam:
+				case OpAdd:
+					regs[in.ID] = arg(0) + arg(1)
+				case OpSub:
+					regs[in.ID] = arg(0) - arg(1)
+				case OpMul:
+					regs[in.ID] = arg(0) * arg(1)
+				case OpDiv:
+					if arg(1) == 0 {
+						return 0, fmt.Errorf("division by zero")
+					}
+					if arg(0) == math.MinInt64 && arg(1) == -1 {
+						return 0, fmt.Errorf("integer overflow in division")
+					}
+					regs[in.ID] = arg(0) / arg(1)
+				case OpNeg:
+					regs[in.ID] = -arg(0)
+				case OpNot:
+					regs[in.ID] = 1 - arg(0)
+				case OpEq:
+					regs[in.ID] = boolValue(arg(0) == arg(1))
+				case OpNe:
+					regs[in.ID] = boolValue(arg(0) != arg(1))
+				case OpLt:
+					regs[in.ID] = boolValue(arg(0) < arg(1))
+				case OpGt:
+					regs[in.ID] = boolValue(arg(0) > arg(1))
+				case OpZext:
+					regs[in.ID] = arg(0)
+				case OpCall, OpTailCall:
+					values := make([]int64, len(in.Args))
+					for n := range in.Args {
+						values[n] = arg(n)
+					}
+					callee := it.module.Function(in.Name)
+					if callee == nil {
+						result, err := it.builtin(in, values)
+						if err != nil {
+							return 0, err
+						}
+						if in.Op == OpTailCall {
+							return result, nil
+						}
+						regs[in.ID] = result
+						continue
+					}
+					if in.Op == OpTailCall {
+						fn, args = callee, values
+						continue tailCall
+					}
+					result, err := it.call(callee, values, depth+1)
+					if err != nil {
+						return 0, err
+					}
+					regs[in.ID] = result
+				case OpLoadGlobal:
+					regs[in.ID] = it.globals[in.Name]
+				case OpStoreGlobal:
+					it.globals[in.Name] = arg(0)
+				case OpJump:
+					next = in.Targets[0]
+				case OpBranch:
+					next = in.Targets[1]
+					if arg(0) != 0 {
+						next = in.Targets[0]
+					}
+				case OpReturn:
+					if len(in.Args) == 0 {
+						return 0, nil
+					}
+					return arg(0), nil
+				default:
+					return 0, fmt.Errorf("@%s: cannot interpret %s", fn.Name, in)
+				}
+			}
+			if next == nil {
+				return 0, fmt.Errorf("@%s: %s does not end with a terminator", fn.Name, b.Label())
+			}
+			prev, b = b, next
+		}
+	}
+}
+
+// builtin executes a call of a builtin function.
+func (it *Interpreter) builtin(in *Instr, args []int64) (int64, error) {
+	switch in.Name {
+	case "puts":
+		for n, a := range args {
+			if in.Args[n].Type == TypeBool {
+				fmt.Fprintln(it.out, a != 0)
+			} else {
+				fmt.Fprintln(it.out, a)
+			}
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("call of unknown function @%s", in.Name)
+}
+
+// boolValue returns the value of a boolean: 1 for true and 0 for false.
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
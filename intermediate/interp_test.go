@@ -0,0 +1,101 @@
+package intermediate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// lowerOnly parses and lowers a Monkey program.
+func lowerOnly(t *testing.T, source string) *Module {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	module, err := Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module
+}
+
+// lower parses and lowers a Monkey program, and optimizes it with the options.
+func lower(t *testing.T, source string, opts Options) *Module {
+	t.Helper()
+	module := lowerOnly(t, source)
+	Optimize(module, Passes(opts))
+	return module
+}
+
+// interpret runs the module and returns what it printed and its error.
+func interpret(module *Module) (string, error) {
+	var out bytes.Buffer
+	it := NewInterpreter(module, &out)
+	it.MaxSteps = 1 << 26
+	err := it.Run()
+	return out.String(), err
+}
+
+// TestInterpreterGolden runs the golden programs the compiled backends are
+// checked with, and compares what they print with the golden output.
+func TestInterpreterGolden(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../cgen/testdata/*.out", "../backend/testdata/*/*.out"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden programs")
+	}
+	for _, file := range files {
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source, err := ioutil.ReadFile(strings.TrimSuffix(file, ".out") + ".mk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, level := range []int{0, 1, 2} {
+			out, err := interpret(lower(t, string(source), Options{Level: level, InlineThreshold: DefaultInlineThreshold}))
+			if err != nil {
+				t.Errorf("%s at -O%d: %s", file, level, err)
+			}
+			if out != string(want) {
+				t.Errorf("%s at -O%d printed\n%swant\n%s", file, level, out, want)
+			}
+		}
+	}
+}
+
+func TestInterpreterErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		out    string
+		err    string
+	}{
+		{`let zero = fn() { 0 }; puts(1); puts(1 / zero());`, "1\n", "division by zero"},
+		{`let min = fn() { 0 - 9223372036854775807 - 1 }; puts(min() / (0 - 1));`, "", "integer overflow in division"},
+		{`let f = fn(n) { 1 + f(n + 1) }; puts(f(0));`, "", ErrStackOverflow.Error()},
+		{`let loop = fn(n) { loop(n + 1) }; puts(1); puts(loop(0));`, "1\n", ErrStepLimit.Error()},
+	}
+	for _, tt := range tests {
+		out, err := interpret(lower(t, tt.source, Options{}))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v, want %s", tt.source, err, tt.err)
+		}
+		if out != tt.out {
+			t.Errorf("%s: printed %q, want %q", tt.source, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package intermediate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// Type represents the type of a value in the intermediate representation.
+type Type int
+
+const (
+	// TypeVoid represents the absence of a value.
+	TypeVoid Type = iota
+	// TypeInt represents a 64-bit signed integer.
+	TypeInt
+	// TypeBool represents a boolean.
+	TypeBool
+)
+
+// String returns the textual name of the type.
+func (t Type) String() string {
+	switch t {
+	case TypeInt:
+		return "i64"
+	case TypeBool:
+		return "i1"
+	default:
+		return "void"
+	}
+}
+
+// Op represents the operation performed by an instruction.
+type Op int
+
+const (
+	// OpConst produces the constant stored in Instr.Const.
+	OpConst Op = iota
+	// OpParam produces the function parameter with index Instr.Const.
+	OpParam
+	// OpAdd produces the sum of its two operands.
+	OpAdd
+	// OpSub produces the difference of its two operands.
+	OpSub
+	// OpMul produces the product of its two operands.
+	OpMul
+	// OpDiv produces the quotient of its two operands.
+	OpDiv
+	// OpNeg produces the negation of its operand.
+	OpNeg
+	// OpNot produces the logical complement of its boolean operand.
+	OpNot
+	// OpEq produces true if its two operands are equal.
+	OpEq
+	// OpNe produces true if its two operands are not equal.
+	OpNe
+	// OpLt produces true if the first operand is less than the second.
+	OpLt
+	// OpGt produces true if the first operand is greater than the second.
+	OpGt
+	// OpZext widens a boolean operand to an integer.
+	OpZext
+	// OpPhi selects the operand matching the predecessor control came from.
+	OpPhi
+	// OpCall calls the function named Instr.Name with its operands as arguments.
+	OpCall
+	// OpLoadGlobal reads the global named Instr.Name.
+	OpLoadGlobal
+	// OpStoreGlobal writes its operand to the global named Instr.Name.
+	OpStoreGlobal
+	// OpJump transfers control to Instr.Targets[0].
+	OpJump
+	// OpBranch transfers control to Instr.Targets[0] if its operand is true
+	// and to Instr.Targets[1] otherwise.
+	OpBranch
+	// OpReturn returns from the function, with its operand as the result if present.
+	OpReturn
+	// OpTailCall calls the function named Instr.Name in place of the current
+	// function and returns its result.
+	OpTailCall
+)
+
+// opNames maps each Op to its textual mnemonic.
+var opNames = map[Op]string{
+	OpConst:       "const",
+	OpParam:       "param",
+	OpAdd:         "add",
+	OpSub:         "sub",
+	OpMul:         "mul",
+	OpDiv:         "div",
+	OpNeg:         "neg",
+	OpNot:         "not",
+	OpEq:          "eq",
+	OpNe:          "ne",
+	OpLt:          "lt",
+	OpGt:          "gt",
+	OpZext:        "zext",
+	OpPhi:         "phi",
+	OpCall:        "call",
+	OpLoadGlobal:  "load",
+	OpStoreGlobal: "store",
+	OpJump:        "jmp",
+	OpBranch:      "br",
+	OpReturn:      "ret",
+	OpTailCall:    "tailcall",
+}
+
+// String returns the textual mnemonic of the operation.
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// IsTerminator returns true if the operation ends a basic block.
+func (op Op) IsTerminator() bool {
+	return op == OpJump || op == OpBranch || op == OpReturn || op == OpTailCall
+}
+
+// IsBinary returns true if the operation takes two operands of the same type.
+func (op Op) IsBinary() bool {
+	switch op {
+	case OpAdd, OpSub, OpMul, OpDiv, OpEq, OpNe, OpLt, OpGt:
+		return true
+	}
+	return false
+}
+
+// HasSideEffects returns true if the instruction cannot be removed even if its
+// result is never used.
+func (i *Instr) HasSideEffects() bool {
+	switch i.Op {
+	case OpCall, OpStoreGlobal, OpJump, OpBranch, OpReturn, OpTailCall:
+		return true
+	case OpDiv:
+		// Division by zero traps, so a division is only removable if its
+		// divisor is a non-zero constant.
+		return !(i.Args[1].Op == OpConst && i.Args[1].Const != 0)
+	}
+	return false
+}
+
+// Instr represents an instruction in the intermediate representation. Every
+// instruction that produces a value defines a virtual register, which is
+// assigned exactly once.
+type Instr struct {
+	ID      int            // The number of the virtual register defined by the instruction.
+	Op      Op             // The operation performed by the instruction.
+	Type    Type           // The type of the value produced by the instruction.
+	Args    []*Instr       // The operands of the instruction.
+	Const   int64          // The constant value of OpConst or the index of OpParam.
+	Name    string         // The callee of OpCall or the global of OpLoadGlobal and OpStoreGlobal.
+	Targets []*Block       // The successor blocks of a terminator.
+	Block   *Block         // The block containing the instruction.
+	Pos     lexer.Position // The source position the instruction was generated from.
+}
+
+// Block represents a basic block: a sequence of instructions that ends in
+// exactly one terminator.
+type Block struct {
+	ID     int       // The number of the block, unique within its function.
+	Instrs []*Instr  // The instructions of the block, the last one being a terminator.
+	Preds  []*Block  // The predecessor blocks, in the order used by phi operands.
+	Func   *Function // The function containing the block.
+}
+
+// Label returns the textual name of the block.
+func (b *Block) Label() string {
+	return "b" + strconv.Itoa(b.ID)
+}
+
+// Terminator returns the last instruction of the block, or nil if the block
+// is not terminated yet.
+func (b *Block) Terminator() *Instr {
+	if len(b.Instrs) == 0 {
+		return nil
+	}
+	last := b.Instrs[len(b.Instrs)-1]
+	if !last.Op.IsTerminator() {
+		return nil
+	}
+	return last
+}
+
+// Succs returns the successor blocks of the block.
+func (b *Block) Succs() []*Block {
+	if t := b.Terminator(); t != nil {
+		return t.Targets
+	}
+	return nil
+}
+
+// Phis returns the phi instructions at the start of the block.
+func (b *Block) Phis() []*Instr {
+	n := 0
+	for n < len(b.Instrs) && b.Instrs[n].Op == OpPhi {
+		n++
+	}
+	return b.Instrs[:n]
+}
+
+// PredIndex returns the index of pred in the predecessor list of the block, or
+// -1 if pred is not a predecessor.
+func (b *Block) PredIndex(pred *Block) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+	return -1
+}
+
+// Function represents a function in the intermediate representation.
+type Function struct {
+	Name       string         // The name of the function.
+	Params     []*Instr       // The OpParam instructions, in parameter order.
+	ReturnType Type           // The type of the value returned by the function.
+	Blocks     []*Block       // The basic blocks, the first one being the entry block.
+	Pos        lexer.Position // The source position of the function literal.
+
+	nextInstr int // The number of the next virtual register.
+	nextBlock int // The number of the next block.
+}
+
+// NewFunction creates a new function with an empty entry block.
+func NewFunction(name string) *Function {
+	fn := &Function{Name: name}
+	fn.NewBlock()
+	return fn
+}
+
+// Entry returns the entry block of the function.
+func (fn *Function) Entry() *Block {
+	return fn.Blocks[0]
+}
+
+// NewBlock appends a new empty block to the function.
+func (fn *Function) NewBlock() *Block {
+	b := &Block{ID: fn.nextBlock, Func: fn}
+	fn.nextBlock++
+	fn.Blocks = append(fn.Blocks, b)
+	return b
+}
+
+// NewInstr creates a new instruction that is not yet part of any block.
+func (fn *Function) NewInstr(op Op, typ Type, args ...*Instr) *Instr {
+	i := &Instr{ID: fn.nextInstr, Op: op, Type: typ, Args: args}
+	fn.nextInstr++
+	return i
+}
+
+// NumInstrs returns an upper bound on the virtual register numbers used in the
+// function.
+func (fn *Function) NumInstrs() int {
+	return fn.nextInstr
+}
+
+// Module represents a whole program in the intermediate representation.
+type Module struct {
+	Globals   []string    // The names of the global variables.
+	Functions []*Function // The functions, including the "main" entry point.
+}
+
+// Function returns the function with the given name, or nil if there is none.
+func (m *Module) Function(name string) *Function {
+	for _, fn := range m.Functions {
+		if fn.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Append adds the instruction to the end of the block.
+func (b *Block) Append(i *Instr) *Instr {
+	i.Block = b
+	b.Instrs = append(b.Instrs, i)
+	return i
+}
+
+// InsertBefore inserts the instruction into the block in front of pos.
+func (b *Block) InsertBefore(i, pos *Instr) {
+	for n, in := range b.Instrs {
+		if in == pos {
+			i.Block = b
+			b.Instrs = append(b.Instrs[:n], append([]*Instr{i}, b.Instrs[n:]...)...)
+			return
+		}
+	}
+	b.Append(i)
+}
+
+// Remove deletes the instruction from its block.
+func (i *Instr) Remove() {
+	b := i.Block
+	for n, in := range b.Instrs {
+		if in == i {
+			b.Instrs = append(b.Instrs[:n], b.Instrs[n+1:]...)
+			break
+		}
+	}
+	i.Block = nil
+}
+
+// ReplaceUses rewrites every use of old in the function to use new instead.
+func (fn *Function) ReplaceUses(old, new *Instr) {
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			for n, arg := range in.Args {
+				if arg == old {
+					in.Args[n] = new
+				}
+			}
+		}
+	}
+}
+
+// Uses returns the number of uses of every instruction in the function, indexed
+// by virtual register number.
+func (fn *Function) Uses() []int {
+	uses := make([]int, fn.nextInstr)
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			for _, arg := range in.Args {
+				uses[arg.ID]++
+			}
+		}
+	}
+	return uses
+}
+
+// RecomputePreds rebuilds the predecessor lists of all blocks from the
+// terminators, keeping the existing order where possible so that phi operands
+// stay aligned, and dropping phi operands of removed edges.
+func (fn *Function) RecomputePreds() {
+	preds := make(map[*Block][]*Block)
+	for _, b := range fn.Blocks {
+		for _, s := range b.Succs() {
+			preds[s] = append(preds[s], b)
+		}
+	}
+	for _, b := range fn.Blocks {
+		var kept []*Block
+		keep := make(map[int]bool)
+		for n, p := range b.Preds {
+			if containsBlock(preds[b], p) && !containsBlock(kept, p) {
+				kept = append(kept, p)
+				keep[n] = true
+			}
+		}
+		for _, phi := range b.Phis() {
+			var args []*Instr
+			for n, arg := range phi.Args {
+				if keep[n] {
+					args = append(args, arg)
+				}
+			}
+			phi.Args = args
+		}
+		for _, p := range preds[b] {
+			if !containsBlock(kept, p) {
+				kept = append(kept, p)
+			}
+		}
+		b.Preds = kept
+	}
+}
+
+// containsBlock returns true if blocks contains b.
+func containsBlock(blocks []*Block, b *Block) bool {
+	for _, x := range blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Ref returns the textual name of the virtual register defined by the
+// instruction.
+func (i *Instr) Ref() string {
+	return "%" + strconv.Itoa(i.ID)
+}
+
+// String returns the textual form of the instruction.
+func (i *Instr) String() string {
+	return i.format(nil)
+}
+
+// format returns the textual form of the instruction, with the registers and
+// blocks named by the numbering, or by their own numbers if it is nil.
+func (i *Instr) format(num *numbering) string {
+	var b strings.Builder
+	if i.Type != TypeVoid {
+		fmt.Fprintf(&b, "%s = ", num.ref(i))
+	}
+	b.WriteString(i.Op.String())
+
+	switch i.Op {
+	case OpConst:
+		fmt.Fprintf(&b, " %s %d", i.Type, i.Const)
+	case OpParam:
+		fmt.Fprintf(&b, " %s %d", i.Type, i.Const)
+	case OpPhi:
+		fmt.Fprintf(&b, " %s", i.Type)
+		for n, arg := range i.Args {
+			if n > 0 {
+				b.WriteString(",")
+			}
+			label := "?"
+			if i.Block != nil && n < len(i.Block.Preds) {
+				label = num.label(i.Block.Preds[n])
+			}
+			fmt.Fprintf(&b, " [%s, %s]", num.ref(arg), label)
+		}
+	case OpCall:
+		fmt.Fprintf(&b, " %s @%s(%s)", i.Type, i.Name, num.refs(i.Args))
+	case OpTailCall:
+		fmt.Fprintf(&b, " @%s(%s)", i.Name, num.refs(i.Args))
+	case OpLoadGlobal:
+		fmt.Fprintf(&b, " %s @%s", i.Type, i.Name)
+	case OpStoreGlobal:
+		fmt.Fprintf(&b, " @%s, %s", i.Name, num.refs(i.Args))
+	case OpJump:
+		fmt.Fprintf(&b, " %s", num.target(i, 0))
+	case OpBranch:
+		fmt.Fprintf(&b, " %s, %s, %s", num.refs(i.Args), num.target(i, 0), num.target(i, 1))
+	case OpReturn:
+		if len(i.Args) > 0 {
+			fmt.Fprintf(&b, " %s", num.refs(i.Args))
+		}
+	default:
+		fmt.Fprintf(&b, " %s %s", i.Type, num.refs(i.Args))
+	}
+	return b.String()
+}
+
+// numbering represents the numbers the registers and blocks of a function are
+// printed with when they are renumbered in order of appearance.
+type numbering struct {
+	regs   map[*Instr]int
+	blocks map[*Block]int
+}
+
+// newNumbering numbers the parameters of the function, then its blocks and
+// the registers they define in order.
+func newNumbering(fn *Function) *numbering {
+	num := &numbering{regs: make(map[*Instr]int), blocks: make(map[*Block]int)}
+	for _, p := range fn.Params {
+		num.ref(p)
+	}
+	for _, b := range fn.Blocks {
+		num.label(b)
+		for _, in := range b.Instrs {
+			if in.Type != TypeVoid {
+				num.ref(in)
+			}
+		}
+	}
+	return num
+}
+
+// ref returns the textual name of the register defined by the instruction,
+// numbering it if it has no number yet. A missing instruction is printed as
+// %?, so that the verifier can show broken instructions.
+func (num *numbering) ref(i *Instr) string {
+	if i == nil {
+		return "%?"
+	}
+	if num == nil {
+		return i.Ref()
+	}
+	id, ok := num.regs[i]
+	if !ok {
+		id = len(num.regs)
+		num.regs[i] = id
+	}
+	return "%" + strconv.Itoa(id)
+}
+
+// label returns the textual name of the block, numbering it if it has no
+// number yet.
+func (num *numbering) label(b *Block) string {
+	if num == nil {
+		return b.Label()
+	}
+	id, ok := num.blocks[b]
+	if !ok {
+		id = len(num.blocks)
+		num.blocks[b] = id
+	}
+	return "b" + strconv.Itoa(id)
+}
+
+// target returns the label of the nth target of the terminator, or b? if it
+// is missing.
+func (num *numbering) target(i *Instr, n int) string {
+	if n >= len(i.Targets) || i.Targets[n] == nil {
+		return "b?"
+	}
+	return num.label(i.Targets[n])
+}
+
+// refs returns the comma-separated register names of the instructions.
+func (num *numbering) refs(args []*Instr) string {
+	names := make([]string, len(args))
+	for n, arg := range args {
+		names[n] = num.ref(arg)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,73 @@
+package intermediate
+
+// HoistLoopInvariants performs loop-invariant code motion on every function
+// of the module and returns true if any instruction was moved. The phis that
+// only merge a value with themselves, like those of the parameters a tail
+// recursive function passes on unchanged, are replaced by the value first,
+// so that the computations using them are invariant.
+func HoistLoopInvariants(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		simplifyPhis(fn)
+		for _, l := range FindLoops(fn, Dominators(fn)) {
+			if hoistLoop(fn, l) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// hoistLoop moves the instructions of the loop whose operands are all defined
+// outside the loop, or are themselves invariant, into the preheader. Loops
+// are visited innermost first, so an invariant computation can be hoisted
+// through several levels of nesting by successive loops.
+//
+// Only pure instructions that cannot trap are moved: the preheader runs even
+// when the loop body would not have reached the instruction.
+func hoistLoop(fn *Function, l *Loop) bool {
+	var candidates []*Instr
+	for _, b := range ReversePostorder(fn) {
+		if !l.Contains(b) {
+			continue
+		}
+		for _, in := range b.Instrs {
+			if in.Op != OpPhi && in.isPure() && !in.HasSideEffects() {
+				candidates = append(candidates, in)
+			}
+		}
+	}
+
+	var hoisted []*Instr
+	moved := make(map[*Instr]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, in := range candidates {
+			if moved[in] {
+				continue
+			}
+			invariant := true
+			for _, arg := range in.Args {
+				if l.Defines(arg) && !moved[arg] {
+					invariant = false
+					break
+				}
+			}
+			if invariant {
+				moved[in] = true
+				hoisted = append(hoisted, in)
+				changed = true
+			}
+		}
+	}
+	if len(hoisted) == 0 {
+		return false
+	}
+
+	pre := EnsurePreheader(fn, l)
+	for _, in := range hoisted {
+		in.Remove()
+		pre.InsertBefore(in, pre.Terminator())
+	}
+	return true
+}
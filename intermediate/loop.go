@@ -0,0 +1,156 @@
+package intermediate
+
+import "sort"
+
+// Loop represents a natural loop: a header block that dominates every block of
+// the loop, and the blocks from which a back edge to the header is reachable
+// without going through the header.
+type Loop struct {
+	Header    *Block          // The block every iteration starts at.
+	Blocks    map[*Block]bool // The blocks of the loop, including the header.
+	Latches   []*Block        // The blocks with a back edge to the header.
+	Preheader *Block          // The only block outside the loop jumping to the header, once inserted.
+	Parent    *Loop           // The innermost loop containing this one, or nil.
+}
+
+// Contains returns true if the block is part of the loop.
+func (l *Loop) Contains(b *Block) bool {
+	return l.Blocks[b]
+}
+
+// Defines returns true if the instruction is defined inside the loop.
+func (l *Loop) Defines(i *Instr) bool {
+	return i.Block != nil && l.Blocks[i.Block]
+}
+
+// FindLoops returns the natural loops of the function, innermost loops first.
+// Back edges to the same header are merged into a single loop.
+func FindLoops(fn *Function, dom *DomTree) []*Loop {
+	byHeader := make(map[*Block]*Loop)
+	var loops []*Loop
+	for _, b := range dom.Order {
+		for _, s := range b.Succs() {
+			if !dom.Dominates(s, b) {
+				continue
+			}
+			l, ok := byHeader[s]
+			if !ok {
+				l = &Loop{Header: s, Blocks: map[*Block]bool{s: true}}
+				byHeader[s] = l
+				loops = append(loops, l)
+			}
+			l.Latches = append(l.Latches, b)
+
+			// Walk backwards from the latch up to the header.
+			work := []*Block{b}
+			for len(work) > 0 {
+				x := work[len(work)-1]
+				work = work[:len(work)-1]
+				if l.Blocks[x] {
+					continue
+				}
+				l.Blocks[x] = true
+				work = append(work, x.Preds...)
+			}
+		}
+	}
+
+	// A loop is nested in the smallest other loop containing its header.
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].Blocks) < len(loops[j].Blocks)
+	})
+	for i, l := range loops {
+		for _, outer := range loops[i+1:] {
+			if outer.Contains(l.Header) {
+				l.Parent = outer
+				break
+			}
+		}
+	}
+	return loops
+}
+
+// EnsurePreheader makes sure the loop has a single block outside the loop
+// that jumps to the header and nowhere else, so that code can be hoisted out
+// of the loop into it. Phis of the header get their operands from outside
+// the loop through the preheader.
+func EnsurePreheader(fn *Function, l *Loop) *Block {
+	var outside []*Block
+	for _, p := range l.Header.Preds {
+		if !l.Contains(p) {
+			outside = append(outside, p)
+		}
+	}
+	if len(outside) == 1 && len(outside[0].Succs()) == 1 {
+		l.Preheader = outside[0]
+		return l.Preheader
+	}
+
+	pre := fn.NewBlock()
+	if l.Header == fn.Entry() {
+		// The entry block cannot have predecessors from outside, so the
+		// preheader becomes the new entry block and takes the parameters.
+		var params, rest []*Instr
+		for _, in := range l.Header.Instrs {
+			if in.Op == OpParam {
+				params = append(params, in)
+			} else {
+				rest = append(rest, in)
+			}
+		}
+		for _, p := range params {
+			pre.Append(p)
+		}
+		l.Header.Instrs = rest
+		fn.Blocks = append([]*Block{pre}, fn.Blocks[:len(fn.Blocks)-1]...)
+	}
+
+	// Split the phis: the operands from outside the loop are merged in the
+	// preheader, and the header only distinguishes the preheader from the
+	// latches.
+	var preds []*Block
+	keep := make([]bool, len(l.Header.Preds))
+	for n, p := range l.Header.Preds {
+		if l.Contains(p) {
+			keep[n] = true
+			preds = append(preds, p)
+		}
+	}
+	for _, phi := range l.Header.Phis() {
+		var inner, outer []*Instr
+		for n, arg := range phi.Args {
+			if keep[n] {
+				inner = append(inner, arg)
+			} else {
+				outer = append(outer, arg)
+			}
+		}
+		in := outer[0]
+		if len(outer) > 1 {
+			in = fn.NewInstr(OpPhi, phi.Type, outer...)
+			in.Pos = phi.Pos
+			pre.Append(in)
+		}
+		phi.Args = append([]*Instr{in}, inner...)
+	}
+	pre.Preds = outside
+	l.Header.Preds = append([]*Block{pre}, preds...)
+
+	for _, p := range outside {
+		t := p.Terminator()
+		for n, target := range t.Targets {
+			if target == l.Header {
+				t.Targets[n] = pre
+			}
+		}
+	}
+	jmp := fn.NewInstr(OpJump, TypeVoid)
+	jmp.Targets = []*Block{l.Header}
+	pre.Append(jmp)
+
+	for outer := l.Parent; outer != nil; outer = outer.Parent {
+		outer.Blocks[pre] = true
+	}
+	l.Preheader = pre
+	return pre
+}
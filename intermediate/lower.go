@@ -0,0 +1,723 @@
+package intermediate
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// MainFunction is the name of the function holding the top-level statements
+// of a program.
+const MainFunction = "main"
+
+// Builtins maps the names of the builtin functions known to the intermediate
+// representation to the type of their result.
+var Builtins = map[string]Type{
+	"puts": TypeVoid,
+}
+
+// scope represents the bindings visible in a block of the source program.
+type scope struct {
+	vars  map[string]*Instr // The values bound by let statements and parameters.
+	outer *scope            // The enclosing scope, or nil for the outermost one.
+}
+
+// lookup returns the value bound to name in the scope or any enclosing scope.
+func (s *scope) lookup(name string) (*Instr, bool) {
+	for ; s != nil; s = s.outer {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// signature represents the types of the parameters and of the result of a
+// function, and whether some path through it produces no value.
+type signature struct {
+	params  []Type
+	result  Type
+	noValue bool
+}
+
+// lowerer translates a parser.Program into a Module.
+type lowerer struct {
+	module    *Module
+	functions map[string]*parser.FunctionLiteral // The top-level functions, by name.
+	toplevel  map[string]bool                    // The names bound by top-level let statements.
+	globals   map[string]bool                    // The top-level names read from inside functions.
+
+	signatures  map[string]*signature // The assumed types of the functions, by name.
+	globalTypes map[string]Type       // The assumed types of the globals, by name.
+	seen        map[string]*signature // The types the arguments and results of the functions were given.
+	seenGlobals map[string]Type       // The types the values of the globals were given.
+
+	fn    *Function       // The function being generated.
+	block *Block          // The block instructions are appended to.
+	scope *scope          // The innermost scope.
+	dead  map[*Block]bool // The blocks that follow a return statement.
+
+	mismatch error // The first boolean given where an integer is expected, if any.
+}
+
+// Lower translates a parsed program into the intermediate representation.
+//
+// Every top-level `let name = fn(...) { ... }` becomes a function of the
+// module, and the remaining top-level statements become the body of
+// MainFunction. Top-level bindings read from inside functions become globals.
+// Closures, strings, arrays and hashes are not supported yet and produce an
+// error.
+//
+// The parameters and the result of a function, and the globals, are booleans
+// if they are only ever given booleans, and integers otherwise. Since the
+// type of a call depends on the function called, the program is lowered
+// again with the types the previous lowering found until they settle: every
+// type starts as a boolean and can only widen to an integer, so this ends.
+//
+// A value the evaluator would give a different type than the compiled code
+// is an error: a boolean where the settled type is an integer, such as an
+// operand of arithmetic, an argument or a return value, and the value of a
+// call of a function that produces no value on some path, which is null in
+// the evaluator.
+func Lower(program *parser.Program) (*Module, error) {
+	l := &lowerer{
+		functions:   make(map[string]*parser.FunctionLiteral),
+		toplevel:    make(map[string]bool),
+		signatures:  make(map[string]*signature),
+		globalTypes: make(map[string]Type),
+	}
+
+	var order []string
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*parser.LetStatement)
+		if !ok {
+			continue
+		}
+		if lit, ok := let.Value.(*parser.FunctionLiteral); ok {
+			if _, dup := l.functions[let.Name.Value]; !dup {
+				order = append(order, let.Name.Value)
+			}
+			l.functions[let.Name.Value] = lit
+			continue
+		}
+		l.toplevel[let.Name.Value] = true
+		l.globalTypes[let.Name.Value] = TypeBool
+	}
+	for name, lit := range l.functions {
+		sig := &signature{result: TypeBool}
+		for range lit.Parameters {
+			sig.params = append(sig.params, TypeBool)
+		}
+		l.signatures[name] = sig
+	}
+
+	for {
+		if err := l.lowerModule(program, order); err != nil {
+			return nil, err
+		}
+		if !l.widen() {
+			// Only the types of the last lowering are settled: before
+			// that, a boolean may be given where a type that has yet to
+			// widen is assumed.
+			if l.mismatch != nil {
+				return nil, l.mismatch
+			}
+			return l.module, nil
+		}
+	}
+}
+
+// lowerModule translates the program with the types currently assumed for
+// the functions and globals, recording the types they are given.
+func (l *lowerer) lowerModule(program *parser.Program, order []string) error {
+	l.module = &Module{}
+	l.globals = make(map[string]bool)
+	l.seen = make(map[string]*signature)
+	for name, sig := range l.signatures {
+		l.seen[name] = &signature{params: make([]Type, len(sig.params))}
+	}
+	l.seenGlobals = make(map[string]Type)
+	l.mismatch = nil
+
+	for _, name := range order {
+		fn, err := l.lowerFunction(name, l.functions[name])
+		if err != nil {
+			return err
+		}
+		l.module.Functions = append(l.module.Functions, fn)
+	}
+
+	main, err := l.lowerMain(program)
+	if err != nil {
+		return err
+	}
+	l.module.Functions = append(l.module.Functions, main)
+
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*parser.LetStatement); ok && l.globals[let.Name.Value] && !containsString(l.module.Globals, let.Name.Value) {
+			l.module.Globals = append(l.module.Globals, let.Name.Value)
+		}
+	}
+	return nil
+}
+
+// widen widens the types assumed for the functions and globals to those they
+// were given, and returns true if any of them changed. A parameter no call
+// gives a value is an integer. A function that produced no value on some path
+// keeps doing so.
+func (l *lowerer) widen() bool {
+	changed := false
+	update := func(t *Type, seen Type) {
+		if seen == TypeVoid {
+			seen = TypeInt
+		}
+		if joined := joinTypes(*t, seen); joined != *t {
+			*t = joined
+			changed = true
+		}
+	}
+	for name, sig := range l.signatures {
+		for n := range sig.params {
+			update(&sig.params[n], l.seen[name].params[n])
+		}
+		update(&sig.result, l.seen[name].result)
+		if l.seen[name].noValue && !sig.noValue {
+			sig.noValue = true
+			changed = true
+		}
+	}
+	for name, typ := range l.globalTypes {
+		if seen, ok := l.seenGlobals[name]; ok {
+			update(&typ, seen)
+			l.globalTypes[name] = typ
+		}
+	}
+	return changed
+}
+
+// joinTypes returns the type of values of either type: void is no value,
+// and booleans widen to integers.
+func joinTypes(a, b Type) Type {
+	switch {
+	case a == TypeVoid:
+		return b
+	case b == TypeVoid || a == b:
+		return a
+	}
+	return TypeInt
+}
+
+// lowerFunction translates a top-level function literal.
+func (l *lowerer) lowerFunction(name string, lit *parser.FunctionLiteral) (*Function, error) {
+	sig := l.signatures[name]
+	l.fn = NewFunction(name)
+	l.fn.ReturnType = sig.result
+	l.fn.Pos = lit.Token.Pos
+	l.block = l.fn.Entry()
+	l.scope = &scope{vars: make(map[string]*Instr)}
+	l.dead = make(map[*Block]bool)
+
+	for n, param := range lit.Parameters {
+		p := l.fn.NewInstr(OpParam, sig.params[n])
+		p.Const = int64(n)
+		p.Pos = param.Token.Pos
+		l.block.Append(p)
+		l.fn.Params = append(l.fn.Params, p)
+		l.scope.vars[param.Value] = p
+	}
+
+	result, err := l.lowerStatements(lit.Body.Statements)
+	if err != nil {
+		return nil, err
+	}
+	l.emitReturn(result, lit.Body.Token.Pos)
+	return l.fn, nil
+}
+
+// lowerMain translates the top-level statements that are not function
+// definitions.
+func (l *lowerer) lowerMain(program *parser.Program) (*Function, error) {
+	l.fn = NewFunction(MainFunction)
+	l.fn.ReturnType = TypeVoid
+	l.block = l.fn.Entry()
+	l.scope = nil
+	l.dead = make(map[*Block]bool)
+
+	var stmts []parser.Statement
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*parser.LetStatement); ok {
+			if _, ok := let.Value.(*parser.FunctionLiteral); ok {
+				continue
+			}
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	if _, err := l.lowerStatements(stmts); err != nil {
+		return nil, err
+	}
+	l.emitReturn(nil, lexer.Position{})
+	return l.fn, nil
+}
+
+// lowerStatements translates a sequence of statements in a new scope and
+// returns the value of the last expression statement, or nil if the sequence
+// does not end in one.
+func (l *lowerer) lowerStatements(stmts []parser.Statement) (*Instr, error) {
+	l.scope = &scope{vars: make(map[string]*Instr), outer: l.scope}
+	defer func() { l.scope = l.scope.outer }()
+
+	var result *Instr
+	for _, stmt := range stmts {
+		result = nil
+		switch s := stmt.(type) {
+		case *parser.LetStatement:
+			v, err := l.lowerValue(s.Value)
+			if err != nil {
+				return nil, err
+			}
+			l.scope.vars[s.Name.Value] = v
+			if l.fn.Name == MainFunction && l.scope.outer == nil && l.toplevel[s.Name.Value] {
+				l.seenGlobals[s.Name.Value] = joinTypes(l.seenGlobals[s.Name.Value], v.Type)
+				if l.globals[s.Name.Value] {
+					if v.Type != l.globalTypes[s.Name.Value] {
+						l.mismatchf(s.Name.Token.Pos, "%s is given both booleans and integers, but is read from a function", s.Name.Value)
+					}
+					// Globals are stored as integers, whatever their type.
+					store := l.emit(OpStoreGlobal, TypeVoid, s.Token.Pos, l.toInt(v))
+					store.Name = s.Name.Value
+				}
+			}
+		case *parser.ReturnStatement:
+			var v *Instr
+			if s.ReturnValue != nil {
+				var err error
+				if v, err = l.lowerExpression(s.ReturnValue); err != nil {
+					return nil, err
+				}
+			}
+			l.emitReturn(v, s.Token.Pos)
+			// Statements after a return are unreachable; they are still
+			// lowered into a block without predecessors, which dead code
+			// elimination removes.
+			l.block = l.fn.NewBlock()
+			l.dead[l.block] = true
+		case *parser.ExpressionStatement:
+			v, err := l.lowerExpression(s.Expression)
+			if err != nil {
+				return nil, err
+			}
+			result = v
+		default:
+			return nil, l.errorf(parser.Pos(stmt), "unsupported statement %T", stmt)
+		}
+	}
+	return result, nil
+}
+
+// lowerValue translates an expression that must produce a value.
+func (l *lowerer) lowerValue(expr parser.Expression) (*Instr, error) {
+	v, err := l.lowerExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, l.errorf(parser.Pos(expr), "expression does not produce a value")
+	}
+	if l.valueless(v) {
+		return nil, l.errorf(parser.Pos(expr), "%s does not produce a value on every path", v.Name)
+	}
+	return v, nil
+}
+
+// lowerExpression translates an expression and returns the instruction
+// producing its value, or nil if the expression does not produce one.
+func (l *lowerer) lowerExpression(expr parser.Expression) (*Instr, error) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		c := l.emit(OpConst, TypeInt, e.Token.Pos)
+		c.Const = e.Value
+		return c, nil
+
+	case *parser.Boolean:
+		return l.boolConst(e.Value, e.Token.Pos), nil
+
+	case *parser.Identifier:
+		return l.lowerIdentifier(e)
+
+	case *parser.PrefixExpression:
+		right, err := l.lowerValue(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Operator {
+		case "-":
+			if right.Type != TypeInt {
+				l.mismatchf(e.Token.Pos, "operand of - is a boolean")
+			}
+			return l.emit(OpNeg, TypeInt, e.Token.Pos, l.toInt(right)), nil
+		case "!":
+			return l.emit(OpNot, TypeBool, e.Token.Pos, l.toBool(right)), nil
+		}
+		return nil, l.errorf(e.Token.Pos, "unknown operator %s", e.Operator)
+
+	case *parser.InfixExpression:
+		return l.lowerInfix(e)
+
+	case *parser.IfExpression:
+		return l.lowerIf(e)
+
+	case *parser.CallExpression:
+		return l.lowerCall(e)
+
+	case *parser.FunctionLiteral:
+		return nil, l.errorf(e.Token.Pos, "function literals are only supported as top-level let bindings")
+
+	case *parser.StringLiteral:
+		return nil, l.errorf(e.Token.Pos, "strings are not supported by the compiler yet")
+
+	case *parser.ArrayLiteral:
+		return nil, l.errorf(e.Token.Pos, "arrays are not supported by the compiler yet")
+
+	case *parser.HashLiteral:
+		return nil, l.errorf(e.Token.Pos, "hashes are not supported by the compiler yet")
+
+	case *parser.IndexExpression:
+		return nil, l.errorf(e.Token.Pos, "index expressions are not supported by the compiler yet")
+	}
+
+	return nil, l.errorf(parser.Pos(expr), "unsupported expression %T", expr)
+}
+
+// lowerIdentifier translates a reference to a local binding or a global.
+func (l *lowerer) lowerIdentifier(id *parser.Identifier) (*Instr, error) {
+	if v, ok := l.scope.lookup(id.Value); ok {
+		return v, nil
+	}
+	if l.toplevel[id.Value] && l.fn.Name != MainFunction {
+		l.globals[id.Value] = true
+		load := l.emit(OpLoadGlobal, TypeInt, id.Token.Pos)
+		load.Name = id.Value
+		if l.globalTypes[id.Value] == TypeBool {
+			return l.toBool(load), nil
+		}
+		return load, nil
+	}
+	if _, ok := l.functions[id.Value]; ok {
+		return nil, l.errorf(id.Token.Pos, "function %s can only be called, not used as a value", id.Value)
+	}
+	return nil, l.errorf(id.Token.Pos, "identifier not found: %s", id.Value)
+}
+
+// infixOps maps the infix operators of the source language to operations.
+var infixOps = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEq,
+	"!=": OpNe,
+	"<":  OpLt,
+	">":  OpGt,
+}
+
+// lowerInfix translates an infix expression.
+func (l *lowerer) lowerInfix(e *parser.InfixExpression) (*Instr, error) {
+	op, ok := infixOps[e.Operator]
+	if !ok {
+		return nil, l.errorf(e.Token.Pos, "unknown operator %s", e.Operator)
+	}
+	left, err := l.lowerValue(e.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := l.lowerValue(e.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case OpEq, OpNe:
+		if left.Type != right.Type {
+			l.mismatchf(e.Token.Pos, "%s compares a boolean with an integer", e.Operator)
+			left, right = l.toInt(left), l.toInt(right)
+		}
+		return l.emit(op, TypeBool, e.Token.Pos, left, right), nil
+	}
+	if left.Type != TypeInt || right.Type != TypeInt {
+		l.mismatchf(e.Token.Pos, "operand of %s is a boolean", e.Operator)
+	}
+	switch op {
+	case OpLt, OpGt:
+		return l.emit(op, TypeBool, e.Token.Pos, l.toInt(left), l.toInt(right)), nil
+	}
+	return l.emit(op, TypeInt, e.Token.Pos, l.toInt(left), l.toInt(right)), nil
+}
+
+// lowerIf translates an if expression into a diamond of blocks joined by a phi
+// when both branches produce a value.
+func (l *lowerer) lowerIf(e *parser.IfExpression) (*Instr, error) {
+	cond, err := l.lowerValue(e.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	thenBlock := l.newBlock()
+	elseBlock := l.newBlock()
+	join := l.newBlock()
+	br := l.emit(OpBranch, TypeVoid, e.Token.Pos, l.toBool(cond))
+	br.Targets = []*Block{thenBlock, elseBlock}
+	l.link(l.block, thenBlock)
+	l.link(l.block, elseBlock)
+
+	type arm struct {
+		block *Block
+		value *Instr
+	}
+	var arms []arm
+
+	l.block = thenBlock
+	v, err := l.lowerStatements(e.Consequence.Statements)
+	if err != nil {
+		return nil, err
+	}
+	arms = append(arms, arm{l.block, l.value(v)})
+
+	l.block = elseBlock
+	v = nil
+	if e.Alternative != nil {
+		if v, err = l.lowerStatements(e.Alternative.Statements); err != nil {
+			return nil, err
+		}
+	}
+	arms = append(arms, arm{l.block, l.value(v)})
+
+	// Arms ending in a return statement do not contribute to the value of
+	// the if expression. The value is only defined if every other arm
+	// produces one.
+	typ := TypeVoid
+	live := 0
+	for _, a := range arms {
+		if l.dead[a.block] && !l.dead[join] {
+			continue
+		}
+		live++
+		if a.value == nil {
+			typ = TypeVoid
+			break
+		}
+		if live == 1 {
+			typ = a.value.Type
+		} else if typ != a.value.Type {
+			l.mismatchf(e.Token.Pos, "one branch of the if expression gives a boolean and another an integer")
+			typ = TypeInt
+		}
+	}
+	if live == 0 {
+		l.dead[join] = true
+	}
+
+	var phi *Instr
+	if typ != TypeVoid {
+		phi = l.fn.NewInstr(OpPhi, typ)
+		phi.Pos = e.Token.Pos
+	}
+	for _, a := range arms {
+		l.block = a.block
+		if phi != nil {
+			v := a.value
+			if v != nil && typ == TypeInt {
+				v = l.toInt(v)
+			}
+			if v == nil || v.Type != typ {
+				// Only possible for an arm ending in a return statement,
+				// whose value never reaches the phi.
+				v = l.emit(OpConst, typ, e.Token.Pos)
+			}
+			phi.Args = append(phi.Args, v)
+		}
+		jmp := l.emit(OpJump, TypeVoid, e.Token.Pos)
+		jmp.Targets = []*Block{join}
+		l.link(l.block, join)
+	}
+
+	l.block = join
+	if phi == nil {
+		return nil, nil
+	}
+	return join.Append(phi), nil
+}
+
+// lowerCall translates a call of a top-level function or a builtin.
+func (l *lowerer) lowerCall(e *parser.CallExpression) (*Instr, error) {
+	callee, ok := e.Function.(*parser.Identifier)
+	if !ok {
+		return nil, l.errorf(e.Token.Pos, "only calls of named functions are supported")
+	}
+
+	var args []*Instr
+	for _, a := range e.Arguments {
+		v, err := l.lowerValue(a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	if lit, ok := l.functions[callee.Value]; ok {
+		if _, shadowed := l.scope.lookup(callee.Value); !shadowed {
+			if len(args) != len(lit.Parameters) {
+				return nil, l.errorf(callee.Token.Pos, "wrong number of arguments to %s: want=%d, got=%d", callee.Value, len(lit.Parameters), len(args))
+			}
+			sig, seen := l.signatures[callee.Value], l.seen[callee.Value]
+			for n := range args {
+				seen.params[n] = joinTypes(seen.params[n], args[n].Type)
+				if args[n].Type != sig.params[n] && sig.params[n] == TypeInt {
+					l.mismatchf(parser.Pos(e.Arguments[n]), "argument %d of %s is a boolean here and an integer elsewhere", n+1, callee.Value)
+				}
+				args[n] = l.convert(args[n], sig.params[n])
+			}
+			call := l.emit(OpCall, sig.result, callee.Token.Pos, args...)
+			call.Name = callee.Value
+			return call, nil
+		}
+	}
+
+	if typ, ok := Builtins[callee.Value]; ok {
+		// puts prints each of its arguments on a line of its own, so it is
+		// lowered to one call per argument.
+		for _, a := range args {
+			call := l.emit(OpCall, typ, callee.Token.Pos, a)
+			call.Name = callee.Value
+		}
+		return nil, nil
+	}
+
+	return nil, l.errorf(callee.Token.Pos, "%s is not a function", callee.Value)
+}
+
+// emitReturn terminates the current block with a return of v, converted to
+// the return type of the function. Returning no value from a reachable block
+// marks the function as producing none, which makes using its calls as values
+// an error; the value returned in its place is never used.
+func (l *lowerer) emitReturn(v *Instr, pos lexer.Position) {
+	if l.fn.ReturnType == TypeVoid {
+		l.emit(OpReturn, TypeVoid, pos)
+		return
+	}
+	seen := l.seen[l.fn.Name]
+	if v = l.value(v); v == nil {
+		if !l.dead[l.block] {
+			seen.noValue = true
+		}
+		l.emit(OpReturn, TypeVoid, pos, l.emit(OpConst, l.fn.ReturnType, pos))
+		return
+	}
+	seen.result = joinTypes(seen.result, v.Type)
+	if v.Type != l.fn.ReturnType && l.fn.ReturnType == TypeInt {
+		l.mismatchf(pos, "%s returns a boolean here and an integer elsewhere", l.fn.Name)
+	}
+	l.emit(OpReturn, TypeVoid, pos, l.convert(v, l.fn.ReturnType))
+}
+
+// valueless returns true if v is the result of a call of a function that
+// produces no value on some path.
+func (l *lowerer) valueless(v *Instr) bool {
+	if v.Op != OpCall {
+		return false
+	}
+	sig, ok := l.signatures[v.Name]
+	return ok && sig.noValue
+}
+
+// value returns v, or nil if v is nil or may be no value.
+func (l *lowerer) value(v *Instr) *Instr {
+	if v == nil || l.valueless(v) {
+		return nil
+	}
+	return v
+}
+
+// newBlock creates a new block, which is dead if the current block is.
+func (l *lowerer) newBlock() *Block {
+	b := l.fn.NewBlock()
+	if l.dead[l.block] {
+		l.dead[b] = true
+	}
+	return b
+}
+
+// emit appends a new instruction to the current block.
+func (l *lowerer) emit(op Op, typ Type, pos lexer.Position, args ...*Instr) *Instr {
+	i := l.fn.NewInstr(op, typ, args...)
+	i.Pos = pos
+	return l.block.Append(i)
+}
+
+// boolConst emits a boolean constant.
+func (l *lowerer) boolConst(value bool, pos lexer.Position) *Instr {
+	c := l.emit(OpConst, TypeBool, pos)
+	if value {
+		c.Const = 1
+	}
+	return c
+}
+
+// toInt widens a boolean value to an integer.
+func (l *lowerer) toInt(v *Instr) *Instr {
+	if v.Type == TypeBool {
+		return l.emit(OpZext, TypeInt, v.Pos, v)
+	}
+	return v
+}
+
+// toBool converts a value to a boolean using the truthiness of integers.
+func (l *lowerer) toBool(v *Instr) *Instr {
+	if v.Type == TypeInt {
+		zero := l.emit(OpConst, TypeInt, v.Pos)
+		return l.emit(OpNe, TypeBool, v.Pos, v, zero)
+	}
+	return v
+}
+
+// convert converts a value to the given type. Only widening to integers
+// happens once the types have settled.
+func (l *lowerer) convert(v *Instr, typ Type) *Instr {
+	if typ == TypeBool {
+		return l.toBool(v)
+	}
+	return l.toInt(v)
+}
+
+// link records from as a predecessor of to.
+func (l *lowerer) link(from, to *Block) {
+	to.Preds = append(to.Preds, from)
+}
+
+// mismatchf records a boolean given where an integer is expected, an error
+// if it is still there once the types have settled.
+func (l *lowerer) mismatchf(pos lexer.Position, format string, args ...interface{}) {
+	if l.mismatch == nil {
+		l.mismatch = l.errorf(pos, format, args...)
+	}
+}
+
+// errorf returns an error prefixed with the source position.
+func (l *lowerer) errorf(pos lexer.Position, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if pos.Line == 0 {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%d:%d: %s", pos.Line, pos.Column, msg)
+}
+
+// containsString returns true if list contains s.
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package intermediate
+
+import (
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// TestLowerRejectsValuesOfOtherTypes checks that values the evaluator would
+// give another type than the compiled code, null or a boolean where the
+// compiled code has an integer, are errors at their position.
+func TestLowerRejectsValuesOfOtherTypes(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"let f = fn(x) { if (x > 0) { 1 } }; puts(f(1));", "1:42: f does not produce a value on every path"},
+		{"let f = fn(x) { if (x > 0) { 1 } }; let g = fn(x) { f(x) }; puts(g(1));", "1:66: g does not produce a value on every path"},
+		{"let f = fn(x) { if (x > 0) { return 1; } }; let a = f(1);", "1:53: f does not produce a value on every path"},
+		{"let f = fn(c) { if (c) { true } else { 1 } }; puts(f(true));", "1:17: one branch of the if expression gives a boolean and another an integer"},
+		{"puts(1 == true);", "1:8: == compares a boolean with an integer"},
+		{"let f = fn(x) { x != 1 }; puts(f(false));", "1:19: != compares a boolean with an integer"},
+		{"puts(true + 1);", "1:11: operand of + is a boolean"},
+		{"puts(1 < false);", "1:8: operand of < is a boolean"},
+		{"puts(-true);", "1:6: operand of - is a boolean"},
+		{"let f = fn(x) { x }; puts(f(1)); puts(f(true));", "1:41: argument 1 of f is a boolean here and an integer elsewhere"},
+		{"let f = fn(x) { if (x) { return true; } 1 };", "1:26: f returns a boolean here and an integer elsewhere"},
+		{"let a = true; let f = fn() { a }; let a = 1; puts(f());", "1:5: a is given both booleans and integers, but is read from a function"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.source))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatalf("%s: parse errors: %v", tt.source, errs)
+		}
+		_, err := Lower(program)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+// TestLowerAcceptsValuesOfOneType checks that booleans and integers flowing
+// through variables of the types they settle to, and functions producing no
+// value whose calls are not used as values, are not errors.
+func TestLowerAcceptsValuesOfOneType(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"let f = fn(x) { x + 1 }; puts(f(2));", "3\n"},
+		{"let f = fn(n) { if (n == 0) { true } else { f(n - 1) } }; puts(f(3));", "true\n"},
+		{"let f = fn(x) { if (x > 0) { puts(x); } }; f(1); f(0); puts(2);", "1\n2\n"},
+		{"let f = fn(n, acc) { if (n == 0) { return acc; } return f(n - 1, acc + 1); }; puts(f(5, 0));", "5\n"},
+		{"let f = fn(c) { if (c) { return 1; } 2 }; puts(f(true) + f(false));", "3\n"},
+		{"let a = 1; let f = fn() { a * 2 }; let a = 3; puts(f());", "6\n"},
+	}
+	for _, tt := range tests {
+		got, err := interpret(lowerOnly(t, tt.source))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.source, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: printed %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+// TestLowerRejectsUnsupportedExpressions checks that the expressions the
+// compiler does not support yet are errors at their position.
+func TestLowerRejectsUnsupportedExpressions(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`puts("a");`, "1:6: strings are not supported by the compiler yet"},
+		{"let a = [1, 2];", "1:9: arrays are not supported by the compiler yet"},
+		{"let f = fn() { {1: 2} };", "1:16: hashes are not supported by the compiler yet"},
+		{"let a = 1; puts(a[0]);", "1:18: index expressions are not supported by the compiler yet"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.source))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatalf("%s: parse errors: %v", tt.source, errs)
+		}
+		_, err := Lower(program)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
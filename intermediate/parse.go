@@ -0,0 +1,633 @@
+package intermediate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// ParseModule reads a module in the textual form the CodeGenerator prints,
+// so that passes can be run on hand-written IR and printed IR can be read
+// back. The syntax is:
+//
+//	module   = { global | function } .
+//	global   = "global" symbol .
+//	function = "func" symbol "(" [ param { "," param } ] ")" type "{" { block } "}" .
+//	param    = register type .
+//	block    = label ":" { instruction } .
+//	type     = "i64" | "i1" | "void" .
+//
+// The instructions are:
+//
+//	%r = const T n             %r = phi T [%a, bA], [%b, bB]
+//	%r = add T %a, %b          %r = call T @f(%a, %b)   call void @f(%a)
+//	%r = neg T %a              tailcall @f(%a, %b)
+//	%r = load T @g             store @g, %a
+//	jmp bT                     br %c, bT, bF
+//	ret                        ret %a
+//
+// with sub, mul, div, eq, ne, lt and gt written like add, and not and zext
+// like neg. Registers are written % followed by a number or a name, and
+// blocks b followed by a number, unique within their function; both are
+// renumbered when read. A register may be used before the instruction
+// defining it, as phis of loops do. The first block is the entry of the
+// function. The predecessors of a block are the blocks branching to it, in
+// the order of the operands of its phis if it has any. A semicolon starts a
+// comment running to the end of the line.
+//
+// Errors are reported with the line and column in the text.
+func ParseModule(text string) (*Module, error) {
+	p := &irParser{}
+	if err := p.tokenize(text); err != nil {
+		return nil, err
+	}
+	m := &Module{}
+	for !p.at(irEOF, "") {
+		switch {
+		case p.at(irWord, "global"):
+			p.next()
+			name, err := p.symbol()
+			if err != nil {
+				return nil, err
+			}
+			m.Globals = append(m.Globals, name)
+		case p.at(irWord, "func"):
+			fn, err := p.function()
+			if err != nil {
+				return nil, err
+			}
+			if m.Function(fn.Name) != nil {
+				return nil, p.errorf(fn.Pos, "function @%s is defined twice", fn.Name)
+			}
+			m.Functions = append(m.Functions, fn)
+		default:
+			return nil, p.unexpected("global or func")
+		}
+	}
+	return m, nil
+}
+
+// irTokenKind represents the kind of a token of the textual IR.
+type irTokenKind int
+
+const (
+	irEOF      irTokenKind = iota
+	irWord                 // A type, an opcode, a keyword or a block label.
+	irRegister             // A register, without its %.
+	irSymbol               // A function or a global, without its @.
+	irInt                  // An integer, possibly negative.
+	irPunct                // One of ( ) [ ] { } , = :
+)
+
+// irToken represents a token of the textual IR.
+type irToken struct {
+	kind irTokenKind
+	text string
+	pos  lexer.Position
+}
+
+// irParser represents the state of the parsing of a module.
+type irParser struct {
+	tokens []irToken
+	pos    int // The index of the current token.
+
+	// The state of the function being parsed.
+	fn     *Function
+	regs   map[string]*Instr    // The instructions defining each register.
+	blocks map[string]*Block    // The blocks with each label.
+	order  []*Block             // The blocks in the order they are defined.
+	uses   []regUse             // The operands to resolve once all registers are defined.
+	labels map[*Instr][]irToken // The block labels of the operands of every phi.
+}
+
+// regUse represents an operand of an instruction naming a register that may
+// not be defined yet.
+type regUse struct {
+	instr *Instr
+	index int     // The index of the operand.
+	tok   irToken // The register.
+}
+
+// tokenize splits the text into tokens.
+func (p *irParser) tokenize(text string) error {
+	line, col := 1, 1
+	for i := 0; i < len(text); {
+		c := text[i]
+		pos := lexer.Position{Offset: i, Line: line, Column: col}
+		start := i
+		switch {
+		case c == '\n':
+			line++
+			col = 1
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			col++
+			continue
+		case c == ';':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			col += i - start
+			continue
+		case strings.IndexByte("()[]{},=:", c) >= 0:
+			i++
+			p.tokens = append(p.tokens, irToken{irPunct, string(c), pos})
+		case c == '%' || c == '@':
+			i++
+			for i < len(text) && isWordChar(text[i]) {
+				i++
+			}
+			kind := irRegister
+			if c == '@' {
+				kind = irSymbol
+			}
+			if i == start+1 {
+				return fmt.Errorf("%d:%d: expected a name after %c", line, col, c)
+			}
+			p.tokens = append(p.tokens, irToken{kind, text[start+1 : i], pos})
+		case c == '-' || unicode.IsDigit(rune(c)):
+			i++
+			for i < len(text) && unicode.IsDigit(rune(text[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, irToken{irInt, text[start:i], pos})
+		case isWordChar(c):
+			for i < len(text) && isWordChar(text[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, irToken{irWord, text[start:i], pos})
+		default:
+			return fmt.Errorf("%d:%d: unexpected character %q", line, col, c)
+		}
+		col += i - start
+	}
+	p.tokens = append(p.tokens, irToken{kind: irEOF, pos: lexer.Position{Offset: len(text), Line: line, Column: col}})
+	return nil
+}
+
+// isWordChar returns true if the character can be part of a word or a name.
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// at returns true if the current token is of the kind and, unless text is
+// empty, has the text.
+func (p *irParser) at(kind irTokenKind, text string) bool {
+	tok := p.tokens[p.pos]
+	return tok.kind == kind && (text == "" || tok.text == text)
+}
+
+// next returns the current token and moves to the next one.
+func (p *irParser) next() irToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != irEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// errorf returns an error prefixed with the position.
+func (p *irParser) errorf(pos lexer.Position, format string, args ...interface{}) error {
+	return fmt.Errorf("%d:%d: %s", pos.Line, pos.Column, fmt.Sprintf(format, args...))
+}
+
+// unexpected returns the error for a current token that is not what was
+// expected.
+func (p *irParser) unexpected(expected string) error {
+	tok := p.tokens[p.pos]
+	if tok.kind == irEOF {
+		return p.errorf(tok.pos, "expected %s, got end of input", expected)
+	}
+	return p.errorf(tok.pos, "expected %s, got %q", expected, tok.text)
+}
+
+// expect consumes the punctuation, or returns an error if it is not the
+// current token.
+func (p *irParser) expect(punct string) error {
+	if !p.at(irPunct, punct) {
+		return p.unexpected(strconv.Quote(punct))
+	}
+	p.next()
+	return nil
+}
+
+// symbol parses the name of a function or a global.
+func (p *irParser) symbol() (string, error) {
+	if !p.at(irSymbol, "") {
+		return "", p.unexpected("a @name")
+	}
+	return p.next().text, nil
+}
+
+// typ parses a type.
+func (p *irParser) typ() (Type, error) {
+	if p.at(irWord, "") {
+		switch p.tokens[p.pos].text {
+		case "i64":
+			p.next()
+			return TypeInt, nil
+		case "i1":
+			p.next()
+			return TypeBool, nil
+		case "void":
+			p.next()
+			return TypeVoid, nil
+		}
+	}
+	return TypeVoid, p.unexpected("a type")
+}
+
+// isLabel returns true if the token is the label of a block.
+func isLabel(tok irToken) bool {
+	if tok.kind != irWord || len(tok.text) < 2 || tok.text[0] != 'b' {
+		return false
+	}
+	_, err := strconv.Atoi(tok.text[1:])
+	return err == nil
+}
+
+// block returns the block with the label of the current token, creating it
+// on its first mention.
+func (p *irParser) block() (*Block, error) {
+	if !isLabel(p.tokens[p.pos]) {
+		return nil, p.unexpected("a block label")
+	}
+	tok := p.next()
+	b, ok := p.blocks[tok.text]
+	if !ok {
+		b = &Block{Func: p.fn}
+		p.blocks[tok.text] = b
+	}
+	return b, nil
+}
+
+// define records the register the current token names as defined by the
+// instruction.
+func (p *irParser) define(tok irToken, in *Instr) error {
+	if _, ok := p.regs[tok.text]; ok {
+		return p.errorf(tok.pos, "register %%%s is defined twice", tok.text)
+	}
+	p.regs[tok.text] = in
+	return nil
+}
+
+// operand parses a register operand of the instruction, resolved once the
+// function is parsed.
+func (p *irParser) operand(in *Instr) error {
+	if !p.at(irRegister, "") {
+		return p.unexpected("a %register")
+	}
+	p.uses = append(p.uses, regUse{instr: in, index: len(in.Args), tok: p.next()})
+	in.Args = append(in.Args, nil)
+	return nil
+}
+
+// operands parses registers separated by commas up to the closing
+// punctuation, which is consumed.
+func (p *irParser) operands(in *Instr, closing string) error {
+	for !p.at(irPunct, closing) {
+		if len(in.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+		}
+		if err := p.operand(in); err != nil {
+			return err
+		}
+	}
+	p.next()
+	return nil
+}
+
+// function parses a function.
+func (p *irParser) function() (*Function, error) {
+	start := p.next().pos
+	name, err := p.symbol()
+	if err != nil {
+		return nil, err
+	}
+	p.fn = &Function{Name: name, Pos: start}
+	p.regs = make(map[string]*Instr)
+	p.blocks = make(map[string]*Block)
+	p.order = nil
+	p.uses = nil
+	p.labels = make(map[*Instr][]irToken)
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.at(irPunct, ")") {
+		if len(p.fn.Params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if !p.at(irRegister, "") {
+			return nil, p.unexpected("a %register")
+		}
+		tok := p.next()
+		typ, err := p.typ()
+		if err != nil {
+			return nil, err
+		}
+		param := p.fn.NewInstr(OpParam, typ)
+		param.Const = int64(len(p.fn.Params))
+		param.Pos = tok.pos
+		if err := p.define(tok, param); err != nil {
+			return nil, err
+		}
+		p.fn.Params = append(p.fn.Params, param)
+	}
+	p.next()
+	if p.fn.ReturnType, err = p.typ(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var current *Block
+	for !p.at(irPunct, "}") {
+		if p.at(irEOF, "") {
+			return nil, p.unexpected(`"}"`)
+		}
+		if isLabel(p.tokens[p.pos]) && p.tokens[p.pos+1].kind == irPunct && p.tokens[p.pos+1].text == ":" {
+			tok := p.tokens[p.pos]
+			b, _ := p.block()
+			for _, defined := range p.order {
+				if defined == b {
+					return nil, p.errorf(tok.pos, "block %s is defined twice", tok.text)
+				}
+			}
+			p.next()
+			p.order = append(p.order, b)
+			current = b
+			continue
+		}
+		if current == nil {
+			return nil, p.unexpected("a block label")
+		}
+		if t := current.Terminator(); t != nil {
+			return nil, p.errorf(p.tokens[p.pos].pos, "instruction after the terminator of a block")
+		}
+		in, err := p.instruction()
+		if err != nil {
+			return nil, err
+		}
+		current.Append(in)
+	}
+	end := p.next()
+	if err := p.finish(end.pos); err != nil {
+		return nil, err
+	}
+	return p.fn, nil
+}
+
+// finish completes the function once all its instructions are parsed:
+// orders its blocks, resolves the operands and computes the predecessors.
+func (p *irParser) finish(end lexer.Position) error {
+	fn := p.fn
+	if len(p.order) == 0 {
+		return p.errorf(end, "function @%s has no blocks", fn.Name)
+	}
+	for label, b := range p.blocks {
+		found := false
+		for _, defined := range p.order {
+			found = found || defined == b
+		}
+		if !found {
+			return p.errorf(end, "block %s is used but not defined in @%s", label, fn.Name)
+		}
+	}
+	for n, b := range p.order {
+		b.ID = n
+		if b.Terminator() == nil {
+			return p.errorf(end, "block b%d of @%s does not end with a terminator", n, fn.Name)
+		}
+	}
+	fn.Blocks = p.order
+	fn.nextBlock = len(p.order)
+
+	// The parameters come first in the entry block, as lowering puts them.
+	entry := fn.Entry()
+	entry.Instrs = append(append([]*Instr(nil), fn.Params...), entry.Instrs...)
+	for _, param := range fn.Params {
+		param.Block = entry
+	}
+
+	for _, use := range p.uses {
+		def, ok := p.regs[use.tok.text]
+		if !ok {
+			return p.errorf(use.tok.pos, "register %%%s is not defined", use.tok.text)
+		}
+		use.instr.Args[use.index] = def
+	}
+
+	// The predecessors follow the order of the blocks branching to a block,
+	// or the order of the phi operands if there are phis.
+	for _, b := range fn.Blocks {
+		for _, s := range b.Succs() {
+			if !containsBlock(s.Preds, b) {
+				s.Preds = append(s.Preds, b)
+			}
+		}
+	}
+	for _, b := range fn.Blocks {
+		phis := b.Phis()
+		if len(phis) == 0 {
+			continue
+		}
+		var preds []*Block
+		for _, tok := range p.labels[phis[0]] {
+			preds = append(preds, p.blocks[tok.text])
+		}
+		for _, phi := range phis {
+			labels := p.labels[phi]
+			if len(labels) != len(b.Preds) {
+				return p.errorf(phi.Pos, "phi has %d operands but b%d has %d predecessors", len(labels), b.ID, len(b.Preds))
+			}
+			for n, tok := range labels {
+				if p.blocks[tok.text] != preds[n] {
+					return p.errorf(tok.pos, "phi operands of b%d name their predecessors in different orders", b.ID)
+				}
+				if !containsBlock(b.Preds, preds[n]) {
+					return p.errorf(tok.pos, "%s is not a predecessor of b%d", tok.text, b.ID)
+				}
+			}
+		}
+		b.Preds = preds
+	}
+	return nil
+}
+
+// instruction parses an instruction.
+func (p *irParser) instruction() (*Instr, error) {
+	var result *irToken
+	if p.at(irRegister, "") {
+		tok := p.next()
+		result = &tok
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+	}
+	if !p.at(irWord, "") {
+		return nil, p.unexpected("an instruction")
+	}
+	opTok := p.next()
+	op, ok := opcode(opTok.text)
+	if !ok {
+		return nil, p.errorf(opTok.pos, "unknown instruction %q", opTok.text)
+	}
+	in := p.fn.NewInstr(op, TypeVoid)
+	in.Pos = opTok.pos
+
+	var err error
+	switch op {
+	case OpConst:
+		if in.Type, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if !p.at(irInt, "") {
+			return nil, p.unexpected("an integer")
+		}
+		tok := p.next()
+		if in.Const, err = strconv.ParseInt(tok.text, 10, 64); err != nil {
+			return nil, p.errorf(tok.pos, "invalid integer %s", tok.text)
+		}
+	case OpParam:
+		return nil, p.errorf(opTok.pos, "parameters are declared in the function header")
+	case OpPhi:
+		if in.Type, err = p.typ(); err != nil {
+			return nil, err
+		}
+		for len(in.Args) == 0 || p.at(irPunct, ",") {
+			if len(in.Args) > 0 {
+				p.next()
+			}
+			if err := p.expect("["); err != nil {
+				return nil, err
+			}
+			if err := p.operand(in); err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if !isLabel(p.tokens[p.pos]) {
+				return nil, p.unexpected("a block label")
+			}
+			label := p.tokens[p.pos]
+			if _, err := p.block(); err != nil {
+				return nil, err
+			}
+			p.labels[in] = append(p.labels[in], label)
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+	case OpCall, OpTailCall:
+		if op == OpCall {
+			if in.Type, err = p.typ(); err != nil {
+				return nil, err
+			}
+		}
+		if in.Name, err = p.symbol(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if err := p.operands(in, ")"); err != nil {
+			return nil, err
+		}
+	case OpLoadGlobal:
+		if in.Type, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if in.Name, err = p.symbol(); err != nil {
+			return nil, err
+		}
+	case OpStoreGlobal:
+		if in.Name, err = p.symbol(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if err := p.operand(in); err != nil {
+			return nil, err
+		}
+	case OpJump:
+		b, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		in.Targets = []*Block{b}
+	case OpBranch:
+		if err := p.operand(in); err != nil {
+			return nil, err
+		}
+		for n := 0; n < 2; n++ {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			b, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			in.Targets = append(in.Targets, b)
+		}
+	case OpReturn:
+		// The operand is optional, so it must be on the line of the ret.
+		if p.at(irRegister, "") && p.tokens[p.pos].pos.Line == opTok.pos.Line {
+			if err := p.operand(in); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if in.Type, err = p.typ(); err != nil {
+			return nil, err
+		}
+		count := 1
+		if op.IsBinary() {
+			count = 2
+		}
+		for n := 0; n < count; n++ {
+			if n > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.operand(in); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case result == nil && in.Type != TypeVoid:
+		return nil, p.errorf(opTok.pos, "%s of type %s needs a result register", op, in.Type)
+	case result != nil && in.Type == TypeVoid:
+		return nil, p.errorf(result.pos, "%s produces no value for %%%s", op, result.text)
+	case result != nil:
+		if err := p.define(*result, in); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// opcode returns the operation with the mnemonic.
+func opcode(name string) (Op, bool) {
+	for op, mnemonic := range opNames {
+		if mnemonic == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package intermediate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// text returns the textual form of the module.
+func text(module *Module) string {
+	g := NewCodeGenerator()
+	g.Renumber = true
+	g.GenerateModule(module)
+	return g.GetCode()
+}
+
+// TestParseModuleRoundTrip prints the golden programs at every level, reads
+// them back and checks that the module read prints the same and runs the
+// same.
+func TestParseModuleRoundTrip(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../cgen/testdata/*.mk", "../backend/testdata/*/*.mk", "../llvm/testdata/*.mk", "../difftest/testdata/*.mk"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden programs")
+	}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, level := range []int{0, 1, 2} {
+			module := lower(t, string(source), Options{Level: level, InlineThreshold: DefaultInlineThreshold})
+			printed := text(module)
+			read, err := ParseModule(printed)
+			if err != nil {
+				t.Errorf("%s at -O%d: %s in\n%s", file, level, err, printed)
+				continue
+			}
+			if err := VerifyModule(read); err != nil {
+				t.Errorf("%s at -O%d: module read is invalid: %s", file, level, err)
+				continue
+			}
+			if again := text(read); again != printed {
+				t.Errorf("%s at -O%d: printed\n%swant\n%s", file, level, again, printed)
+			}
+			want, wantErr := interpret(module)
+			got, err := interpret(read)
+			if got != want || (err == nil) != (wantErr == nil) {
+				t.Errorf("%s at -O%d: module read printed %q and failed with %v, want %q and %v", file, level, got, err, want, wantErr)
+			}
+		}
+	}
+}
+
+func TestParseModuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"unexpected character", "func @f() void {\nb0:\n  ret $\n}\n", "3:7: unexpected character '$'"},
+		{"global without @", "global g\n", "1:8: expected a @name, got \"g\""},
+		{"neither global nor func", "const i64 1\n", "1:1: expected global or func, got \"const\""},
+		{"unknown type", "func @f() i32 {\nb0:\n  ret\n}\n", "1:11: expected a type, got \"i32\""},
+		{"parameter without register", "func @f( void {\n", "1:10: expected a %register, got \"void\""},
+		{"unknown instruction", "func @f() void {\nb0:\n  %0 = frob i64 1\n  ret\n}\n", "3:8: unknown instruction \"frob\""},
+		{"instruction before a label", "func @f() void {\n  ret\n}\n", "2:3: expected a block label, got \"ret\""},
+		{"register defined twice", "func @f() i64 {\nb0:\n  %0 = const i64 1\n  %0 = const i64 2\n  ret %0\n}\n", "4:3: register %0 is defined twice"},
+		{"register not defined", "func @f() i64 {\nb0:\n  ret %1\n}\n", "3:7: register %1 is not defined"},
+		{"block not defined", "func @f() void {\nb0:\n  jmp b7\n}\n", "4:1: block b7 is used but not defined in @f"},
+		{"block without terminator", "func @f() void {\nb0:\n  %0 = const i64 1\n}\n", "4:1: block b0 of @f does not end with a terminator"},
+		{"instruction after the terminator", "func @f() void {\nb0:\n  ret\n  ret\n}\n", "4:3: instruction after the terminator of a block"},
+		{"phi of too few operands", "func @f(%0 i64) i64 {\nb0:\n  br %0, b1, b2\nb1:\n  jmp b2\nb2:\n  %1 = phi i64 [%0, b0]\n  ret %1\n}\n", "7:8: phi has 1 operands but b2 has 2 predecessors"},
+		{"function defined twice", "func @main() void {\nb0:\n  ret\n}\nfunc @main() void {\nb0:\n  ret\n}\n", "5:1: function @main is defined twice"},
+		{"end of input in a function", "func @f() void {\nb0:\n  ret\n", "4:1: expected \"}\", got end of input"},
+	}
+	for _, tt := range tests {
+		_, err := ParseModule(tt.text)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package intermediate
+
+import "github.com/user/golang-interpreter/diagnostic"
+
+// Pass represents an optimization pass over a module.
+type Pass struct {
+	Name string               // The name of the pass, used in diagnostics.
+	Run  func(m *Module) bool // Runs the pass and returns true if the module changed.
+}
+
+// Options controls the optimization pipeline.
+type Options struct {
+	Level           int                         // The optimization level.
+	InlineThreshold int                         // The largest cost of a function that is inlined.
+	Remark          func(diagnostic.Diagnostic) // Receives optimization remarks, may be nil.
+}
+
+// Passes returns the optimization pipeline for the given options. Level 0
+// only removes dead code and eliminates tail calls, level 1 adds inlining and
+// value numbering, and level 2 adds the loop optimizations.
+func Passes(opts Options) []Pass {
+	passes := []Pass{
+		{Name: "dce", Run: EliminateDeadCode},
+	}
+	if opts.Level == 0 {
+		// Deep recursion relies on tail calls at every level.
+		passes = append(passes, Pass{Name: "tailcall", Run: EliminateTailCalls})
+	}
+	if opts.Level >= 1 {
+		inliner := &Inliner{Threshold: opts.InlineThreshold, Remark: opts.Remark}
+		passes = append(passes,
+			Pass{Name: "inline", Run: inliner.Run},
+			Pass{Name: "simplifycfg", Run: SimplifyCFG},
+			Pass{Name: "tailcall", Run: EliminateTailCalls},
+			Pass{Name: "gvn", Run: NumberValues},
+			Pass{Name: "dce", Run: EliminateDeadCode},
+		)
+	}
+	if opts.Level >= 2 {
+		passes = append(passes,
+			Pass{Name: "licm", Run: HoistLoopInvariants},
+			Pass{Name: "indvars", Run: OptimizeInductionVariables},
+			Pass{Name: "gvn", Run: NumberValues},
+			Pass{Name: "dce", Run: EliminateDeadCode},
+		)
+	}
+	return passes
+}
+
+// PassNames lists the names of the passes PassNamed knows.
+var PassNames = []string{"dce", "tailcall", "inline", "simplifycfg", "gvn", "licm", "indvars"}
+
+// PassNamed returns the pass with the name, configured by the options, so
+// that passes can be run one at a time.
+func PassNamed(name string, opts Options) (Pass, bool) {
+	switch name {
+	case "dce":
+		return Pass{Name: name, Run: EliminateDeadCode}, true
+	case "tailcall":
+		return Pass{Name: name, Run: EliminateTailCalls}, true
+	case "inline":
+		inliner := &Inliner{Threshold: opts.InlineThreshold, Remark: opts.Remark}
+		return Pass{Name: name, Run: inliner.Run}, true
+	case "simplifycfg":
+		return Pass{Name: name, Run: SimplifyCFG}, true
+	case "gvn":
+		return Pass{Name: name, Run: NumberValues}, true
+	case "licm":
+		return Pass{Name: name, Run: HoistLoopInvariants}, true
+	case "indvars":
+		return Pass{Name: name, Run: OptimizeInductionVariables}, true
+	}
+	return Pass{}, false
+}
+
+// Optimize runs the passes over the module in order. Debug builds verify the
+// module before the first pass and after every pass.
+func Optimize(m *Module, passes []Pass) {
+	if verifyPasses {
+		verifyPass(m, "before optimization")
+	}
+	for _, p := range passes {
+		p.Run(m)
+		if verifyPasses {
+			verifyPass(m, "after pass "+p.Name)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package intermediate
+
+// EliminateTailCalls optimizes the calls in tail position of every function
+// of the module and returns true if any call was changed.
+//
+// A call is in tail position if the function returns its result right away,
+// which is the case for `return f(x);` and for a call that is the last
+// expression of the function body, including through the arms of an if
+// expression. A tail call of the function itself becomes a jump back to the
+// start of the function, turning the recursion into a loop. A tail call of
+// another function becomes an OpTailCall, which the backend emits as a jump
+// reusing the frame of the caller; this is only done when the callee takes no
+// more parameters than the caller, so that its arguments fit wherever the
+// caller's arguments were passed.
+func EliminateTailCalls(m *Module) bool {
+	changed := false
+	for _, fn := range m.Functions {
+		if fn.ReturnType == TypeVoid {
+			continue
+		}
+		duplicateReturns(fn)
+		var loop *tailLoop
+		optimized := false
+		for _, b := range append([]*Block(nil), fn.Blocks...) {
+			call := tailCall(b)
+			if call == nil {
+				continue
+			}
+			if call.Name == fn.Name {
+				if loop == nil {
+					loop = newTailLoop(fn)
+				}
+				loop.jumpFrom(call)
+				optimized = true
+				continue
+			}
+			callee := m.Function(call.Name)
+			if callee == nil || len(callee.Params) > len(fn.Params) {
+				continue
+			}
+			ret := b.Terminator()
+			tail := fn.NewInstr(OpTailCall, TypeVoid, call.Args...)
+			tail.Name = call.Name
+			tail.Pos = call.Pos
+			ret.Remove()
+			call.Remove()
+			b.Append(tail)
+			optimized = true
+		}
+		if optimized {
+			RemoveUnreachableBlocks(fn)
+			// A parameter passed on unchanged leaves a phi of itself.
+			simplifyPhis(fn)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// duplicateReturns copies a block that only returns the value of a phi into
+// each predecessor jumping to it, so that a call whose value reaches the
+// return through the phi returns it directly.
+func duplicateReturns(fn *Function) {
+	for _, b := range fn.Blocks {
+		if len(b.Instrs) != 2 || b.Instrs[0].Op != OpPhi {
+			continue
+		}
+		phi, ret := b.Instrs[0], b.Instrs[1]
+		if ret.Op != OpReturn || len(ret.Args) != 1 || ret.Args[0] != phi {
+			continue
+		}
+		for n, p := range b.Preds {
+			jmp := p.Terminator()
+			if jmp.Op != OpJump {
+				continue
+			}
+			r := fn.NewInstr(OpReturn, TypeVoid, phi.Args[n])
+			r.Pos = ret.Pos
+			jmp.Remove()
+			p.Append(r)
+		}
+		fn.RecomputePreds()
+	}
+	RemoveUnreachableBlocks(fn)
+}
+
+// tailCall returns the call of a user function whose value the block
+// returns, or nil if there is none. Pure instructions between the call and
+// the return that do not use its value are moved before the call.
+func tailCall(b *Block) *Instr {
+	ret := b.Terminator()
+	if ret == nil || ret.Op != OpReturn || len(ret.Args) != 1 {
+		return nil
+	}
+	call := ret.Args[0]
+	if call.Op != OpCall || call.Block != b {
+		return nil
+	}
+	if _, builtin := Builtins[call.Name]; builtin {
+		return nil
+	}
+
+	var n int
+	for n = range b.Instrs {
+		if b.Instrs[n] == call {
+			break
+		}
+	}
+	var between []*Instr
+	for _, in := range b.Instrs[n+1 : len(b.Instrs)-1] {
+		if in.HasSideEffects() || !in.isPure() {
+			return nil
+		}
+		for _, arg := range in.Args {
+			if arg == call {
+				return nil
+			}
+		}
+		between = append(between, in)
+	}
+	for _, in := range between {
+		in.Remove()
+		b.InsertBefore(in, call)
+	}
+
+	// The value of the call must not be used anywhere but in the return.
+	for _, other := range b.Func.Blocks {
+		for _, in := range other.Instrs {
+			if in == ret {
+				continue
+			}
+			for _, arg := range in.Args {
+				if arg == call {
+					return nil
+				}
+			}
+		}
+	}
+	return call
+}
+
+// tailLoop represents the loop that self tail calls of a function are turned
+// into: the body of the function moves into a header block, where a phi per
+// parameter selects between the incoming argument and the arguments of each
+// tail call.
+type tailLoop struct {
+	header *Block   // The block the body of the function starts in.
+	phis   []*Instr // The phis replacing the parameters, in parameter order.
+}
+
+// newTailLoop moves the body of the entry block of the function into a new
+// header block, leaving only the parameters and a jump in the entry block.
+func newTailLoop(fn *Function) *tailLoop {
+	entry := fn.Entry()
+	header := fn.NewBlock()
+	var params []*Instr
+	for _, in := range entry.Instrs {
+		if in.Op == OpParam {
+			params = append(params, in)
+		} else {
+			header.Append(in)
+		}
+	}
+	entry.Instrs = params
+	for _, s := range header.Succs() {
+		for n, p := range s.Preds {
+			if p == entry {
+				s.Preds[n] = header
+			}
+		}
+	}
+
+	jmp := fn.NewInstr(OpJump, TypeVoid)
+	jmp.Targets = []*Block{header}
+	entry.Append(jmp)
+	header.Preds = []*Block{entry}
+
+	l := &tailLoop{header: header}
+	for _, p := range fn.Params {
+		phi := fn.NewInstr(OpPhi, p.Type)
+		phi.Pos = p.Pos
+		fn.ReplaceUses(p, phi)
+		phi.Args = []*Instr{p}
+		l.phis = append(l.phis, phi)
+	}
+	header.Instrs = append(append([]*Instr(nil), l.phis...), header.Instrs...)
+	for _, phi := range l.phis {
+		phi.Block = header
+	}
+	return l
+}
+
+// jumpFrom replaces the self tail call and the return ending its block with a
+// jump to the loop header passing the arguments of the call. The block is
+// the header itself when the call was in the entry block.
+func (l *tailLoop) jumpFrom(call *Instr) {
+	b := call.Block
+	ret := b.Terminator()
+	for n, phi := range l.phis {
+		phi.Args = append(phi.Args, call.Args[n])
+	}
+	ret.Remove()
+	call.Remove()
+	jmp := b.Func.NewInstr(OpJump, TypeVoid)
+	jmp.Pos = call.Pos
+	jmp.Targets = []*Block{l.header}
+	b.Append(jmp)
+	l.header.Preds = append(l.header.Preds, b)
+}
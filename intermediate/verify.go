@@ -0,0 +1,378 @@
+package intermediate
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/diagnostic"
+)
+
+// CodeInvalidIR is the code of the diagnostic for a module that breaks the
+// invariants of the intermediate representation.
+const CodeInvalidIR = "invalid-ir"
+
+// Verify checks the structural invariants of a function: every block ends in
+// its only terminator, every instruction belongs to the block holding it,
+// operands are defined by instructions of the function that dominate their
+// uses, the types of the operands and results match the operations, phis
+// come first and have one operand per predecessor, the predecessors are the
+// blocks branching to a block, and branches only target blocks of the
+// function. It returns an error describing the first violation, or nil.
+func Verify(fn *Function) error {
+	v := &verifier{fn: fn, blocks: make(map[*Block]bool), instrs: make(map[*Instr]int)}
+	return v.verify()
+}
+
+// VerifyModule verifies every function of the module, and that the calls to
+// the functions of the module and the accesses to its globals agree with
+// their definitions.
+func VerifyModule(m *Module) error {
+	for _, fn := range m.Functions {
+		if err := verifyInModule(m, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyInModule verifies a function of the module and its references to the
+// rest of the module.
+func verifyInModule(m *Module, fn *Function) error {
+	if err := Verify(fn); err != nil {
+		return err
+	}
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			switch in.Op {
+			case OpCall, OpTailCall:
+				callee := m.Function(in.Name)
+				if callee == nil {
+					// Calls of builtins like puts are not declared.
+					continue
+				}
+				if len(in.Args) != len(callee.Params) {
+					return instrErrorf(fn, b, in, "@%s takes %d arguments, not %d", in.Name, len(callee.Params), len(in.Args))
+				}
+				for n, arg := range in.Args {
+					if arg.Type != callee.Params[n].Type {
+						return instrErrorf(fn, b, in, "argument %d of @%s is %s, not %s", n, in.Name, callee.Params[n].Type, arg.Type)
+					}
+				}
+				result := in.Type
+				if in.Op == OpTailCall {
+					result = fn.ReturnType
+				}
+				if callee.ReturnType != result {
+					return instrErrorf(fn, b, in, "@%s returns %s, not %s", in.Name, callee.ReturnType, result)
+				}
+			case OpLoadGlobal, OpStoreGlobal:
+				found := false
+				for _, g := range m.Globals {
+					found = found || g == in.Name
+				}
+				if !found {
+					return instrErrorf(fn, b, in, "@%s is not a global", in.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifier represents the state of the verification of a function.
+type verifier struct {
+	fn     *Function
+	blocks map[*Block]bool     // The blocks of the function.
+	instrs map[*Instr]int      // The index of every instruction of the function in its block.
+	dom    *DomTree            // The dominator tree, once the control flow is known to be sound.
+	preds  map[*Block][]*Block // The blocks branching to each block.
+}
+
+// instrErrorf returns an error about an instruction, naming its function and
+// block.
+func instrErrorf(fn *Function, b *Block, in *Instr, format string, args ...interface{}) error {
+	return fmt.Errorf("@%s: %s: %s: %s", fn.Name, b.Label(), in, fmt.Sprintf(format, args...))
+}
+
+// blockErrorf returns an error about a block, naming its function.
+func blockErrorf(fn *Function, b *Block, format string, args ...interface{}) error {
+	return fmt.Errorf("@%s: %s: %s", fn.Name, b.Label(), fmt.Sprintf(format, args...))
+}
+
+// verify runs the checks in an order where each relies only on the previous
+// ones: the blocks and their instructions, the control flow, then the
+// operands.
+func (v *verifier) verify() error {
+	fn := v.fn
+	if len(fn.Blocks) == 0 {
+		return fmt.Errorf("@%s: no blocks", fn.Name)
+	}
+
+	ids := make(map[int]bool)
+	for _, b := range fn.Blocks {
+		if v.blocks[b] {
+			return blockErrorf(fn, b, "appears twice in the function")
+		}
+		if ids[b.ID] {
+			return blockErrorf(fn, b, "another block has the same number")
+		}
+		v.blocks[b] = true
+		ids[b.ID] = true
+	}
+
+	regs := make(map[int]bool)
+	for _, b := range fn.Blocks {
+		if b.Func != fn {
+			return blockErrorf(fn, b, "belongs to another function")
+		}
+		if b.Terminator() == nil {
+			return blockErrorf(fn, b, "does not end with a terminator")
+		}
+		for n, in := range b.Instrs {
+			if in.Block != b {
+				return instrErrorf(fn, b, in, "is recorded in another block")
+			}
+			if _, ok := v.instrs[in]; ok {
+				return instrErrorf(fn, b, in, "appears twice in the function")
+			}
+			if in.ID < 0 || in.ID >= fn.NumInstrs() || regs[in.ID] {
+				return instrErrorf(fn, b, in, "register number %d is not unique below %d", in.ID, fn.NumInstrs())
+			}
+			v.instrs[in] = n
+			regs[in.ID] = true
+			if in.Op.IsTerminator() && n != len(b.Instrs)-1 {
+				return instrErrorf(fn, b, in, "terminator in the middle of the block")
+			}
+			if in.Op == OpPhi && n > 0 && b.Instrs[n-1].Op != OpPhi {
+				return instrErrorf(fn, b, in, "phi after other instructions")
+			}
+			if in.Op == OpParam && b != fn.Entry() {
+				return instrErrorf(fn, b, in, "parameter outside the entry block")
+			}
+		}
+	}
+	for n, p := range fn.Params {
+		if p.Op != OpParam || p.Const != int64(n) {
+			return fmt.Errorf("@%s: parameter %d is %s", fn.Name, n, p)
+		}
+		if _, ok := v.instrs[p]; !ok {
+			return fmt.Errorf("@%s: parameter %d is not in the entry block", fn.Name, n)
+		}
+	}
+
+	if err := v.verifyControlFlow(); err != nil {
+		return err
+	}
+	v.dom = Dominators(fn)
+	for _, b := range fn.Blocks {
+		for _, in := range b.Instrs {
+			if err := v.verifyTypes(b, in); err != nil {
+				return err
+			}
+			if err := v.verifyOperands(b, in); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyControlFlow checks that the terminators target blocks of the
+// function and that the predecessors of every block are the blocks branching
+// to it.
+func (v *verifier) verifyControlFlow() error {
+	fn := v.fn
+	v.preds = make(map[*Block][]*Block)
+	for _, b := range fn.Blocks {
+		t := b.Terminator()
+		want := map[Op]int{OpJump: 1, OpBranch: 2}[t.Op]
+		if len(t.Targets) != want {
+			return instrErrorf(fn, b, t, "has %d targets, not %d", len(t.Targets), want)
+		}
+		for _, s := range t.Targets {
+			if s == nil || !v.blocks[s] {
+				return instrErrorf(fn, b, t, "targets a block outside the function")
+			}
+			if !containsBlock(v.preds[s], b) {
+				v.preds[s] = append(v.preds[s], b)
+			}
+		}
+	}
+	for _, b := range fn.Blocks {
+		if len(b.Preds) != len(v.preds[b]) {
+			return blockErrorf(fn, b, "has %d predecessors recorded but %d blocks branch to it", len(b.Preds), len(v.preds[b]))
+		}
+		for n, p := range b.Preds {
+			if !containsBlock(v.preds[b], p) || containsBlock(b.Preds[:n], p) {
+				return blockErrorf(fn, b, "predecessor %s does not branch to it once", p.Label())
+			}
+		}
+	}
+	if len(fn.Entry().Phis()) > 0 {
+		// Control also enters the entry block from the caller, which no
+		// phi operand stands for.
+		return blockErrorf(fn, fn.Entry(), "entry block with phis")
+	}
+	return nil
+}
+
+// verifyTypes checks the number and types of the operands of an instruction
+// and the type of its result.
+func (v *verifier) verifyTypes(b *Block, in *Instr) error {
+	fn := v.fn
+	args := func(n int) error {
+		if len(in.Args) != n {
+			return instrErrorf(fn, b, in, "has %d operands, not %d", len(in.Args), n)
+		}
+		for _, arg := range in.Args {
+			if arg == nil {
+				return instrErrorf(fn, b, in, "has a missing operand")
+			}
+		}
+		return nil
+	}
+	typed := func(result Type, operands ...Type) error {
+		if err := args(len(operands)); err != nil {
+			return err
+		}
+		if in.Type != result {
+			return instrErrorf(fn, b, in, "produces %s, not %s", in.Type, result)
+		}
+		for n, arg := range in.Args {
+			if arg.Type != operands[n] {
+				return instrErrorf(fn, b, in, "operand %s is %s, not %s", arg.Ref(), arg.Type, operands[n])
+			}
+		}
+		return nil
+	}
+
+	switch in.Op {
+	case OpConst:
+		if err := args(0); err != nil {
+			return err
+		}
+		if in.Type == TypeVoid || (in.Type == TypeBool && in.Const != 0 && in.Const != 1) {
+			return instrErrorf(fn, b, in, "is not a constant of its type")
+		}
+		return nil
+	case OpParam:
+		if in.Type == TypeVoid {
+			return instrErrorf(fn, b, in, "parameter of type void")
+		}
+		return args(0)
+	case OpAdd, OpSub, OpMul, OpDiv:
+		return typed(TypeInt, TypeInt, TypeInt)
+	case OpLt, OpGt:
+		return typed(TypeBool, TypeInt, TypeInt)
+	case OpEq, OpNe:
+		if err := args(2); err != nil {
+			return err
+		}
+		if in.Args[0].Type == TypeVoid {
+			return instrErrorf(fn, b, in, "compares void operands")
+		}
+		return typed(TypeBool, in.Args[0].Type, in.Args[0].Type)
+	case OpNeg:
+		return typed(TypeInt, TypeInt)
+	case OpNot:
+		return typed(TypeBool, TypeBool)
+	case OpZext:
+		return typed(TypeInt, TypeBool)
+	case OpPhi:
+		if in.Type == TypeVoid {
+			return instrErrorf(fn, b, in, "phi of type void")
+		}
+		operands := make([]Type, len(b.Preds))
+		for n := range operands {
+			operands[n] = in.Type
+		}
+		if len(in.Args) != len(b.Preds) {
+			return instrErrorf(fn, b, in, "has %d operands for %d predecessors", len(in.Args), len(b.Preds))
+		}
+		return typed(in.Type, operands...)
+	case OpCall, OpTailCall:
+		if in.Name == "" {
+			return instrErrorf(fn, b, in, "calls no function")
+		}
+		if in.Op == OpTailCall && in.Type != TypeVoid {
+			return instrErrorf(fn, b, in, "tail call producing a value")
+		}
+		for _, arg := range in.Args {
+			if arg == nil || arg.Type == TypeVoid {
+				return instrErrorf(fn, b, in, "has a missing or void argument")
+			}
+		}
+		return nil
+	case OpLoadGlobal:
+		if in.Type == TypeVoid {
+			return instrErrorf(fn, b, in, "load of type void")
+		}
+		return args(0)
+	case OpStoreGlobal:
+		if err := args(1); err != nil {
+			return err
+		}
+		return typed(TypeVoid, in.Args[0].Type)
+	case OpJump:
+		return typed(TypeVoid)
+	case OpBranch:
+		return typed(TypeVoid, TypeBool)
+	case OpReturn:
+		if fn.ReturnType == TypeVoid {
+			return typed(TypeVoid)
+		}
+		return typed(TypeVoid, fn.ReturnType)
+	}
+	return instrErrorf(fn, b, in, "unknown operation %d", in.Op)
+}
+
+// verifyOperands checks that the operands of an instruction are defined in
+// the function before they are used: in an earlier instruction of the same
+// block or in a dominating block, and for the operands of phis at the end of
+// the matching predecessor. Uses in unreachable blocks are not checked for
+// dominance, since nothing dominates them.
+func (v *verifier) verifyOperands(b *Block, in *Instr) error {
+	for n, arg := range in.Args {
+		index, ok := v.instrs[arg]
+		if !ok {
+			return instrErrorf(v.fn, b, in, "operand %s is not an instruction of the function", arg.Ref())
+		}
+		if arg.Type == TypeVoid {
+			return instrErrorf(v.fn, b, in, "operand %s produces no value", arg.Ref())
+		}
+
+		use := b
+		if in.Op == OpPhi {
+			use = b.Preds[n]
+		}
+		if _, reachable := v.dom.number[use]; !reachable {
+			continue
+		}
+		if arg.Block == b && in.Op != OpPhi {
+			if index >= v.instrs[in] {
+				return instrErrorf(v.fn, b, in, "operand %s is used before it is defined", arg.Ref())
+			}
+			continue
+		}
+		if !v.dom.Dominates(arg.Block, use) {
+			return instrErrorf(v.fn, b, in, "operand %s is defined in %s, which does not dominate %s", arg.Ref(), arg.Block.Label(), use.Label())
+		}
+	}
+	return nil
+}
+
+// verifyPass verifies the module at a point of the optimization pipeline and
+// panics with a diagnostic naming the point, such as the pass that just ran,
+// if an invariant is broken, since that is a bug of the compiler. The
+// diagnostic is about the source of the broken function.
+func verifyPass(m *Module, point string) {
+	for _, fn := range m.Functions {
+		if err := verifyInModule(m, fn); err != nil {
+			panic(diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     CodeInvalidIR,
+				Span:     diagnostic.Span{Start: fn.Pos, End: fn.Pos},
+				Message:  fmt.Sprintf("invalid IR %s: %s", point, err),
+			})
+		}
+	}
+}
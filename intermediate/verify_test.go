@@ -0,0 +1,97 @@
+package intermediate
+
+import "testing"
+
+// valid is a function the tests of Verify break by hand.
+const valid = `
+func @f(%a i64) i64 {
+b0:
+  %one = const i64 1
+  %c = gt i1 %a, %one
+  br %c, b1, b2
+b1:
+  %x = add i64 %a, %one
+  jmp b2
+b2:
+  %r = phi i64 [%one, b0], [%x, b1]
+  ret %r
+}
+`
+
+// instr returns the instruction at an index of a block of the function; the
+// parameters come first in the entry block.
+func instr(fn *Function, block, index int) *Instr {
+	return fn.Blocks[block].Instrs[index]
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(fn *Function)
+		want   string
+	}{
+		{"missing terminator", func(fn *Function) {
+			b := fn.Blocks[1]
+			b.Instrs = b.Instrs[:len(b.Instrs)-1]
+		}, "@f: b1: does not end with a terminator"},
+		{"terminator in the middle", func(fn *Function) {
+			b := fn.Blocks[1]
+			b.InsertBefore(fn.NewInstr(OpJump, TypeVoid), b.Instrs[0])
+			b.Instrs[0].Targets = []*Block{fn.Blocks[2]}
+		}, "@f: b1: jmp b2: terminator in the middle of the block"},
+		{"phi after other instructions", func(fn *Function) {
+			b := fn.Blocks[2]
+			b.InsertBefore(fn.NewInstr(OpConst, TypeInt), b.Instrs[0])
+		}, "@f: b2: %6 = phi i64 [%1, b0], [%4, b1]: phi after other instructions"},
+		{"use before definition", func(fn *Function) {
+			b := fn.Blocks[1]
+			two := fn.NewInstr(OpConst, TypeInt)
+			two.Const = 2
+			b.InsertBefore(two, b.Terminator())
+			instr(fn, 1, 0).Args[1] = two
+		}, "@f: b1: %4 = add i64 %0, %8: operand %8 is used before it is defined"},
+		{"use outside the dominated blocks", func(fn *Function) {
+			instr(fn, 2, 1).Args[0] = instr(fn, 1, 0)
+		}, "@f: b2: ret %4: operand %4 is defined in b1, which does not dominate b2"},
+		{"operand of another function", func(fn *Function) {
+			other := NewFunction("g")
+			instr(fn, 1, 0).Args[1] = other.NewInstr(OpConst, TypeInt)
+		}, "@f: b1: %4 = add i64 %0, %0: operand %0 is not an instruction of the function"},
+		{"phi and predecessor counts", func(fn *Function) {
+			phi := instr(fn, 2, 0)
+			phi.Args = phi.Args[:1]
+		}, "@f: b2: %6 = phi i64 [%1, b0]: has 1 operands for 2 predecessors"},
+		{"predecessors not recorded", func(fn *Function) {
+			fn.Blocks[1].Preds = nil
+		}, "@f: b1: has 0 predecessors recorded but 1 blocks branch to it"},
+		{"dangling block", func(fn *Function) {
+			dangling := &Block{ID: 9, Func: fn}
+			dangling.Append(fn.NewInstr(OpReturn, TypeVoid, instr(fn, 0, 1)))
+			instr(fn, 1, 1).Targets[0] = dangling
+		}, "@f: b1: jmp b9: targets a block outside the function"},
+		{"operand type", func(fn *Function) {
+			instr(fn, 1, 0).Args[1] = instr(fn, 0, 2)
+		}, "@f: b1: %4 = add i64 %0, %2: operand %2 is i1, not i64"},
+		{"result type", func(fn *Function) {
+			instr(fn, 0, 2).Type = TypeInt
+		}, "@f: b0: %2 = gt i64 %0, %1: produces i64, not i1"},
+		{"missing operand", func(fn *Function) {
+			add := instr(fn, 1, 0)
+			add.Args = add.Args[:1]
+		}, "@f: b1: %4 = add i64 %0: has 1 operands, not 2"},
+	}
+	for _, tt := range tests {
+		m, err := ParseModule(valid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := m.Functions[0]
+		if err := Verify(fn); err != nil {
+			t.Fatalf("%s: the function is invalid before it is broken: %s", tt.name, err)
+		}
+		tt.mutate(fn)
+		if err := Verify(fn); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package lexer
+
+import (
+	"sort"
+	"strings"
+)
+
+// Edit represents a change of an input: the bytes from Start up to End
+// replaced by Text.
+type Edit struct {
+	Start int    // The offset of the first byte replaced.
+	End   int    // The offset just after the last byte replaced.
+	Text  string // The text replacing them.
+}
+
+// Apply returns the input with the edit made.
+func (e Edit) Apply(input string) string {
+	return input[:e.Start] + e.Text + input[e.End:]
+}
+
+// Damage represents the tokens an edit changed: the new tokens from First up
+// to End were lexed again, and replace the old ones from First up to OldEnd.
+// The tokens before First are the same, and those from OldEnd on only moved.
+type Damage struct {
+	First  int // The index of the first token lexed again.
+	End    int // The index just after the last token lexed again.
+	OldEnd int // The index of the old token that became the new one at End.
+
+	from Position // The position of the old token at OldEnd.
+	to   Position // The position of the new token at End.
+}
+
+// Shift returns where a position of the old input at or after the old token
+// at OldEnd is in the new input. The text from there on is unchanged, so
+// the position moves by as many bytes and lines as the token did, and by as
+// many columns if it is on the same line.
+func (d Damage) Shift(p Position) Position {
+	if p.Line == d.from.Line {
+		p.Column += d.to.Column - d.from.Column
+	}
+	p.Offset += d.to.Offset - d.from.Offset
+	p.Line += d.to.Line - d.from.Line
+	return p
+}
+
+// Tokens lexes the whole input and returns its tokens, the last of which is
+// EOF. The lexer keeps them, so that Edit can lex only what an edit damages.
+func (l *Lexer) Tokens() []Token {
+	if l.tokens == nil {
+		for {
+			tok := l.NextToken()
+			l.tokens = append(l.tokens, tok)
+			if tok.Type == EOF {
+				break
+			}
+		}
+	}
+	return l.tokens
+}
+
+// Edit returns a lexer of the input after the edit that has lexed it all,
+// like after Tokens, and which tokens changed. Rather than lexing the whole
+// new input, it lexes again from the end of the last token before the edit
+// until a token starts after the edit where an old one did: the lexer only
+// depends on where a token starts, so the following tokens are the old ones,
+// moved. Only an unclosed quote looks further than its token, to the end of
+// its line. Comments are kept, lexed again or moved alike.
+func (l *Lexer) Edit(e Edit) (*Lexer, Damage) {
+	old := l.Tokens()
+	input := e.Apply(l.input)
+	shift := len(e.Text) - (e.End - e.Start)
+
+	// Restart after the last token that ends before the edit, which it
+	// cannot reach. The EOF token is never kept, since the text after a
+	// NUL byte is only lexed once the NUL is gone. A quote that does not
+	// close on its line is an illegal token, which the edit may close, so
+	// lexing restarts before the first one on the line of the edit.
+	first := sort.Search(len(old)-1, func(n int) bool { return end(old[n]).Offset >= e.Start })
+	for n := first - 1; n >= 0 && !strings.Contains(l.input[old[n].Pos.Offset:e.Start], "\n"); n-- {
+		if old[n].Type == ILLEGAL && old[n].Literal == `"` {
+			first = n
+		}
+	}
+	start := Position{Offset: 0, Line: 1, Column: 1}
+	if first > 0 {
+		start = end(old[first-1])
+	}
+
+	nl := newAt(input, start)
+	nl.tokens = append(nl.tokens, old[:first]...)
+	for _, c := range l.comments {
+		if c.Pos.Offset < start.Offset {
+			nl.comments = append(nl.comments, c)
+		}
+	}
+
+	d := Damage{First: first, OldEnd: len(old)}
+	for {
+		tok := nl.NextToken()
+		if tok.Pos.Offset >= e.Start+len(e.Text) {
+			at := tok.Pos.Offset - shift
+			n := sort.Search(len(old), func(n int) bool { return old[n].Pos.Offset >= at })
+			if n < len(old) && old[n].Pos.Offset == at {
+				d.OldEnd, d.from, d.to = n, old[n].Pos, tok.Pos
+				break
+			}
+		}
+		nl.tokens = append(nl.tokens, tok)
+		if tok.Type == EOF {
+			break
+		}
+	}
+	d.End = len(nl.tokens)
+
+	if d.OldEnd < len(old) {
+		for _, tok := range old[d.OldEnd:] {
+			tok.Pos = d.Shift(tok.Pos)
+			nl.tokens = append(nl.tokens, tok)
+		}
+		for _, c := range l.comments {
+			if c.Pos.Offset > d.from.Offset {
+				c.Pos = d.Shift(c.Pos)
+				nl.comments = append(nl.comments, c)
+			}
+		}
+		// The lexer stopped at the token where they met: make it return EOF
+		// from now on, as if it had lexed the rest.
+		nl.replay = nl.tokens[len(nl.tokens)-1:]
+	}
+	return nl, d
+}
+
+// FromTokens creates a lexer that returns the given tokens instead of
+// lexing, so that tokens lexed before can be parsed. The last token must be
+// EOF, which it keeps returning.
+func FromTokens(tokens []Token) *Lexer {
+	return &Lexer{replay: tokens}
+}
+
+// replayToken returns the next of the tokens of FromTokens.
+func (l *Lexer) replayToken() Token {
+	tok := l.replay[0]
+	if len(l.replay) > 1 {
+		l.replay = l.replay[1:]
+	}
+	return tok
+}
+
+// newAt creates a lexer for the given input that starts at the given
+// position rather than at the beginning.
+func newAt(input string, pos Position) *Lexer {
+	l := &Lexer{input: input, line: pos.Line, column: pos.Column - 1, readPosition: pos.Offset}
+	l.readChar()
+	return l
+}
+
+// end returns the position just after a token, which never spans lines. An
+// illegal token is a single byte, whatever its literal.
+func end(tok Token) Position {
+	width := len(tok.Literal)
+	if tok.Type == ILLEGAL {
+		width = 1
+	}
+	return Position{Offset: tok.Pos.Offset + width, Line: tok.Pos.Line, Column: tok.Pos.Column + width}
+}
@@ -1,98 +1,47 @@
 package lexer
 
-import "unicode"
-
-package lexer
-
 import (
-"fmt"
-"unicode"
-"unicode/utf8"
-)
-
-// TokenType represents the type of a token.
-type TokenType int
-
-const (
-	// ILLEGAL represents an illegal token.
-	ILLEGAL TokenType = iota
-	// EOF represents the end of file.
-	EOF
-	// INT represents an integer constant.
-	INT
-	// ASSIGN represents an assignment operator.
-	ASSIGN
-	// PLUS represents an addition operator.
-	PLUS
-	// MINUS represents a subtraction operator.
-	MINUS
-	// BANG represents a logical NOT operator.
-	BANG
-	// ASTERISK represents a multiplication operator.
-	ASTERISK
-	// SLASH represents a division operator.
-	SLASH
-	// LT represents a less-than operator.
-	LT
-	// GT represents a greater-than operator.
-	GT
-	// EQ represents an equality operator.
-	EQ
-	// NEQ represents a non-equality operator.
-	NEQ
-	// COMMA represents a comma separator.
-	COMMA
-	// SEMICOLON represents a semicolon separator.
-	SEMICOLON
-	// LPAREN represents a left parenthesis.
-	LPAREN
-	// RPAREN represents a right parenthesis.
-	RPAREN
-	// LBRACE represents a left brace.
-	LBRACE
-	// RBRACE represents a right brace.
-	RBRACE
-	// FUNCTION represents the function keyword.
-	FUNCTION
-	// LET represents the let keyword.
-	LET
-	// TRUE represents the true boolean constant.
-	TRUE
-	// FALSE represents the false boolean constant.
-	FALSE
-	// IF represents the if keyword.
-	IF
-	// ELSE represents the else keyword.
-	ELSE
+	"unicode"
 )
 
-// Token represents a token in the source code.
-type Token struct {
-	Type    TokenType // The type of the token.
-	Literal string    // The literal value of the token.
-}
-
 // Lexer represents a lexer for the Monkey programming language.
 type Lexer struct {
-	input        string  // The input string.
-	position     int     // The current position in the input.
-	readPosition int     // The current read position in the input.
-	ch           rune    // The current character being read.
+	input        string    // The input string.
+	position     int       // The current position in the input.
+	readPosition int       // The current read position in the input.
+	ch           rune      // The current character being read.
+	line         int       // The line of the current character, starting at 1.
+	column       int       // The column of the current character, starting at 1.
+	comments     []Comment // The comments skipped so far.
+	tokens       []Token   // The tokens lexed by Tokens, kept for Edit.
+	replay       []Token   // The tokens to return instead of lexing, for FromTokens.
 }
 
 // New creates a new lexer for the given input string.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// Comments returns the comments the lexer has skipped so far, in the order
+// they appear in the input.
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
 // NextToken reads the next token from the input and returns it.
 func (l *Lexer) NextToken() Token {
+	if l.replay != nil {
+		return l.replayToken()
+	}
+
 	var tok Token
 
 	l.skipWhitespace()
 
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -126,6 +75,8 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(COMMA, l.ch)
 	case ';':
 		tok = newToken(SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(COLON, l.ch)
 	case '(':
 		tok = newToken(LPAREN, l.ch)
 	case ')':
@@ -134,6 +85,16 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(LBRACE, l.ch)
 	case '}':
 		tok = newToken(RBRACE, l.ch)
+	case '[':
+		tok = newToken(LBRACKET, l.ch)
+	case ']':
+		tok = newToken(RBRACKET, l.ch)
+	case '"':
+		if str, ok := l.readString(); ok {
+			tok = Token{Type: STRING, Literal: str}
+		} else {
+			tok = newToken(ILLEGAL, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = EOF
@@ -141,10 +102,12 @@ func (l *Lexer) NextToken() Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = lookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(ILLEGAL, l.ch)
@@ -153,6 +116,7 @@ func (l *Lexer) NextToken() Token {
 
 	l.readChar()
 
+	tok.Pos = pos
 	return tok
 
 }
@@ -160,6 +124,13 @@ func (l *Lexer) NextToken() Token {
 // readChar reads the next character from the input.
 // It sets l.ch to 0 if the end of the input has been reached.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -171,6 +142,11 @@ func (l *Lexer) readChar() {
 
 }
 
+// currentPosition returns the position of the current character.
+func (l *Lexer) currentPosition() Position {
+	return Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
 // peekChar returns the next character from the input without consuming it.
 func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
@@ -197,11 +173,46 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-// skipWhitespace skips whitespace characters in the input.
+// readString reads a string literal, quotes included, from the input. A
+// string ends on the line it starts: if it is not closed there, readString
+// reads nothing and returns false.
+func (l *Lexer) readString() (string, bool) {
+	position := l.position
+	n := l.readPosition
+	for n < len(l.input) && l.input[n] != '"' && l.input[n] != '\n' {
+		n++
+	}
+	if n >= len(l.input) || l.input[n] != '"' {
+		return "", false
+	}
+	for l.position < n {
+		l.readChar()
+	}
+	return l.input[position : n+1], true
+}
+
+// skipWhitespace skips whitespace characters and comments in the input.
 func (l *Lexer) skipWhitespace() {
-	for unicode.IsSpace(l.ch) {
+	for {
+		switch {
+		case unicode.IsSpace(l.ch):
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment, from its // to the end of its line, and
+// records it.
+func (l *Lexer) readComment() {
+	pos := l.currentPosition()
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	l.comments = append(l.comments, Comment{Text: l.input[pos.Offset:l.position], Pos: pos})
 }
 
 // newToken creates a new Token with the given TokenType and literal value.
@@ -211,7 +222,10 @@ func newToken(tokenType TokenType, ch rune) Token {
 
 // isLetter returns true if the given rune is a letter or underscore.
 func isLetter(ch rune) bool {
-	return unicode
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-
+// isDigit returns true if the given rune is a decimal digit.
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
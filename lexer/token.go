@@ -1,14 +1,27 @@
 package lexer
 
-package lexer
-
 // TokenType represents the type of a token.
 type TokenType string
 
+// Position represents a location in the input.
+type Position struct {
+	Offset int // The byte offset, starting at 0.
+	Line   int // The line number, starting at 1.
+	Column int // The column number in bytes, starting at 1.
+}
+
 // Token represents a token in the input.
 type Token struct {
 	Type    TokenType // The type of the token.
 	Literal string    // The literal value of the token.
+	Pos     Position  // The position of the first character of the token.
+}
+
+// Comment represents a comment in the input, running from // to the end of
+// its line. Comments are not tokens: the lexer skips them like whitespace.
+type Comment struct {
+	Text string   // The text of the comment, starting with //.
+	Pos  Position // The position of the first slash.
 }
 
 // TokenType constants.
@@ -17,8 +30,9 @@ const (
 	EOF     = "EOF"     // End-of-file token.
 
 	// Identifiers and literals.
-	IDENT = "IDENT" // Identifier token.
-	INT   = "INT"   // Integer literal token.
+	IDENT  = "IDENT"  // Identifier token.
+	INT    = "INT"    // Integer literal token.
+	STRING = "STRING" // String literal token, quotes included.
 
 	// Operators.
 	ASSIGN   = "="
@@ -36,10 +50,13 @@ const (
 	// Delimiters.
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 	FUNCTION  = "FUNCTION"
 	LET       = "LET"
 	TRUE      = "TRUE"
@@ -0,0 +1,325 @@
+// Package llvm translates the intermediate representation into the textual
+// form of LLVM IR, so that LLVM can optimize Monkey programs and generate
+// code for any machine it supports.
+//
+// The SSA form of the intermediate representation maps onto LLVM IR almost
+// one to one: every function becomes an LLVM function on i64 and i1 values,
+// every basic block an LLVM basic block and every phi a phi node. The
+// runtime routines are defined in the module on top of the C library, and
+// line table debug metadata maps the instructions back to the source.
+//
+// The output uses opaque pointers, so it needs LLVM 15 or later; LLVM 14
+// reads it only with -opaque-pointers, and older versions not at all:
+//
+//	llc -O2 -filetype=obj -relocation-model=pic -o prog.o prog.ll && cc -o prog prog.o
+//	llc-14 -opaque-pointers -O2 -filetype=obj -relocation-model=pic -o prog.o prog.ll && cc -o prog prog.o
+package llvm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// EmitName is the output format accepted by the --emit flag.
+const EmitName = "llvm"
+
+// The symbols of the runtime routines.
+const (
+	putsInt  = "@rt.puts_int"
+	putsBool = "@rt.puts_bool"
+	divide   = "@rt.div"
+)
+
+// runtime defines the runtime routines: printing integers and booleans
+// followed by a newline, and a division that ends the program on a zero
+// divisor or an overflow like the trap of the native targets, where LLVM
+// leaves them undefined. Like the C runtime, it flushes what the program
+// printed, reports the error and exits with status 1.
+const runtime = `@.str.int = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.str.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.str.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.str.div = private unnamed_addr constant [32 x i8] c"monkey: integer division error\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @puts(ptr)
+declare i32 @fflush(ptr)
+declare i64 @write(i32, ptr, i64)
+declare void @exit(i32) noreturn
+
+define internal void @rt.puts_int(i64 %v) {
+  %r = call i32 (ptr, ...) @printf(ptr @.str.int, i64 %v)
+  ret void
+}
+
+define internal void @rt.puts_bool(i1 %v) {
+  %s = select i1 %v, ptr @.str.true, ptr @.str.false
+  %r = call i32 @puts(ptr %s)
+  ret void
+}
+
+define internal i64 @rt.div(i64 %a, i64 %b) {
+  %zero = icmp eq i64 %b, 0
+  %min = icmp eq i64 %a, -9223372036854775808
+  %minus1 = icmp eq i64 %b, -1
+  %overflow = and i1 %min, %minus1
+  %invalid = or i1 %zero, %overflow
+  br i1 %invalid, label %error, label %ok
+error:
+  %f = call i32 @fflush(ptr null)
+  %w = call i64 @write(i32 2, ptr @.str.div, i64 31)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+`
+
+// GenerateCode translates the module to LLVM IR and writes it to the output
+// file. The source file is named in the debug metadata.
+func GenerateCode(module *intermediate.Module, outputFile, sourceFile string) error {
+	return ioutil.WriteFile(outputFile, []byte(Translate(module, sourceFile)), 0644)
+}
+
+// funcSymbol returns the LLVM symbol of a Monkey function. Symbols are
+// prefixed so that Monkey names cannot clash with the C library or main.
+func funcSymbol(name string) string {
+	return "@monkey_" + name
+}
+
+// globalSymbol returns the LLVM symbol of a global.
+func globalSymbol(name string) string {
+	return "@global_" + name
+}
+
+// llvmType returns the LLVM type of values of the type.
+func llvmType(t intermediate.Type) string {
+	switch t {
+	case intermediate.TypeInt:
+		return "i64"
+	case intermediate.TypeBool:
+		return "i1"
+	}
+	return "void"
+}
+
+// translator builds the module, numbering the metadata nodes as they are
+// created.
+type translator struct {
+	b         strings.Builder
+	metadata  []string       // The metadata nodes, by number.
+	locations map[string]int // The number of every location node, by its contents.
+	file      int            // The number of the file node.
+	unit      int            // The number of the compile unit node.
+	subType   int            // The number of the subroutine type node shared by all functions.
+	scope     int            // The number of the subprogram of the function being translated.
+	fn        *intermediate.Function
+}
+
+// node adds a metadata node and returns its number.
+func (t *translator) node(format string, args ...interface{}) int {
+	t.metadata = append(t.metadata, fmt.Sprintf(format, args...))
+	return len(t.metadata) - 1
+}
+
+// Translate returns the LLVM IR of the module.
+func Translate(module *intermediate.Module, sourceFile string) string {
+	t := &translator{locations: make(map[string]int)}
+	dir, err := filepath.Abs(filepath.Dir(sourceFile))
+	if err != nil {
+		dir = filepath.Dir(sourceFile)
+	}
+	t.file = t.node("!DIFile(filename: %q, directory: %q)", filepath.Base(sourceFile), dir)
+	t.unit = t.node("distinct !DICompileUnit(language: DW_LANG_C99, file: !%d, producer: \"monkey\", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)", t.file)
+	t.subType = t.node("!DISubroutineType(types: !{})")
+	debugVersion := t.node("!{i32 2, !\"Debug Info Version\", i32 3}")
+	dwarfVersion := t.node("!{i32 2, !\"Dwarf Version\", i32 4}")
+
+	fmt.Fprintf(&t.b, "; ModuleID = %q\nsource_filename = %q\n\n", filepath.Base(sourceFile), filepath.Base(sourceFile))
+	for _, g := range module.Globals {
+		fmt.Fprintf(&t.b, "%s = internal global i64 0\n", globalSymbol(g))
+	}
+	if len(module.Globals) > 0 {
+		t.b.WriteString("\n")
+	}
+	for _, fn := range module.Functions {
+		t.function(fn)
+		t.b.WriteString("\n")
+	}
+	fmt.Fprintf(&t.b, "define i32 @main() {\n  call void %s()\n  ret i32 0\n}\n\n", funcSymbol(intermediate.MainFunction))
+	t.b.WriteString(runtime)
+
+	fmt.Fprintf(&t.b, "\n!llvm.dbg.cu = !{!%d}\n!llvm.module.flags = !{!%d, !%d}\n\n", t.unit, debugVersion, dwarfVersion)
+	for n, md := range t.metadata {
+		fmt.Fprintf(&t.b, "!%d = %s\n", n, md)
+	}
+	return t.b.String()
+}
+
+// function writes the definition of a function. LLVM does not allow
+// branches to the entry block, so a block jumping to the first one is added
+// when a loop starts there.
+func (t *translator) function(fn *intermediate.Function) {
+	t.fn = fn
+	t.scope = t.node("distinct !DISubprogram(name: %q, linkageName: %q, scope: !%d, file: !%d, line: %d, type: !%d, scopeLine: %d, spFlags: DISPFlagDefinition, unit: !%d)",
+		fn.Name, funcSymbol(fn.Name)[1:], t.file, t.file, fn.Pos.Line, t.subType, fn.Pos.Line, t.unit)
+
+	var params []string
+	for _, p := range fn.Params {
+		params = append(params, fmt.Sprintf("%s %s", llvmType(p.Type), value(p)))
+	}
+	fmt.Fprintf(&t.b, "define %s %s(%s) !dbg !%d {\n", llvmType(fn.ReturnType), funcSymbol(fn.Name), strings.Join(params, ", "), t.scope)
+	if len(fn.Entry().Preds) > 0 {
+		fmt.Fprintf(&t.b, "entry:\n  br label %%%s\n", fn.Entry().Label())
+	}
+	for _, b := range fn.Blocks {
+		fmt.Fprintf(&t.b, "%s:\n", b.Label())
+		for _, in := range b.Instrs {
+			if s := t.instr(in); s != "" {
+				fmt.Fprintf(&t.b, "  %s, !dbg !%d\n", s, t.location(in))
+			}
+		}
+	}
+	t.b.WriteString("}\n")
+}
+
+// location returns the number of the location node of the instruction.
+func (t *translator) location(in *intermediate.Instr) int {
+	key := fmt.Sprintf("!DILocation(line: %d, column: %d, scope: !%d)", in.Pos.Line, in.Pos.Column, t.scope)
+	if n, ok := t.locations[key]; ok {
+		return n
+	}
+	n := t.node("%s", key)
+	t.locations[key] = n
+	return n
+}
+
+// value returns the name of the value of an instruction.
+func value(v *intermediate.Instr) string {
+	return fmt.Sprintf("%%v%d", v.ID)
+}
+
+// operand returns the LLVM operand of a value, without its type.
+func operand(v *intermediate.Instr) string {
+	if v.Op != intermediate.OpConst {
+		return value(v)
+	}
+	if v.Type == intermediate.TypeBool {
+		if v.Const != 0 {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprint(v.Const)
+}
+
+// typed returns the LLVM operand of a value preceded by its type.
+func typed(v *intermediate.Instr) string {
+	return llvmType(v.Type) + " " + operand(v)
+}
+
+// instructions maps the arithmetic operations to LLVM instructions, and the
+// comparisons to the predicates of icmp.
+var (
+	instructions = map[intermediate.Op]string{
+		intermediate.OpAdd: "add",
+		intermediate.OpSub: "sub",
+		intermediate.OpMul: "mul",
+	}
+	predicates = map[intermediate.Op]string{
+		intermediate.OpEq: "eq",
+		intermediate.OpNe: "ne",
+		intermediate.OpLt: "slt",
+		intermediate.OpGt: "sgt",
+	}
+)
+
+// instr returns the LLVM instruction of an instruction, or the empty string
+// if it has none.
+func (t *translator) instr(in *intermediate.Instr) string {
+	def := value(in) + " = "
+	switch in.Op {
+	case intermediate.OpConst, intermediate.OpParam:
+		// Constants are written where they are used, and parameters are
+		// those of the LLVM function.
+		return ""
+
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul:
+		return fmt.Sprintf("%s%s i64 %s, %s", def, instructions[in.Op], operand(in.Args[0]), operand(in.Args[1]))
+
+	case intermediate.OpDiv:
+		return fmt.Sprintf("%scall i64 %s(%s, %s)", def, divide, typed(in.Args[0]), typed(in.Args[1]))
+
+	case intermediate.OpEq, intermediate.OpNe, intermediate.OpLt, intermediate.OpGt:
+		return fmt.Sprintf("%sicmp %s %s, %s", def, predicates[in.Op], typed(in.Args[0]), operand(in.Args[1]))
+
+	case intermediate.OpNeg:
+		return fmt.Sprintf("%ssub i64 0, %s", def, operand(in.Args[0]))
+
+	case intermediate.OpNot:
+		return fmt.Sprintf("%sxor i1 %s, true", def, operand(in.Args[0]))
+
+	case intermediate.OpZext:
+		return fmt.Sprintf("%szext %s to i64", def, typed(in.Args[0]))
+
+	case intermediate.OpPhi:
+		var incoming []string
+		for n, a := range in.Args {
+			incoming = append(incoming, fmt.Sprintf("[ %s, %%%s ]", operand(a), in.Block.Preds[n].Label()))
+		}
+		return fmt.Sprintf("%sphi %s %s", def, llvmType(in.Type), strings.Join(incoming, ", "))
+
+	case intermediate.OpCall:
+		if in.Type == intermediate.TypeVoid {
+			return call(in, in.Type)
+		}
+		return def + call(in, in.Type)
+
+	case intermediate.OpLoadGlobal:
+		return fmt.Sprintf("%sload i64, ptr %s", def, globalSymbol(in.Name))
+
+	case intermediate.OpStoreGlobal:
+		return fmt.Sprintf("store %s, ptr %s", typed(in.Args[0]), globalSymbol(in.Name))
+
+	case intermediate.OpJump:
+		return fmt.Sprintf("br label %%%s", in.Targets[0].Label())
+
+	case intermediate.OpBranch:
+		return fmt.Sprintf("br %s, label %%%s, label %%%s", typed(in.Args[0]), in.Targets[0].Label(), in.Targets[1].Label())
+
+	case intermediate.OpReturn:
+		if len(in.Args) == 0 {
+			return "ret void"
+		}
+		return "ret " + typed(in.Args[0])
+
+	case intermediate.OpTailCall:
+		// The return needs a location of its own, so it is written here.
+		result := fmt.Sprintf("%%t%d", in.ID)
+		fmt.Fprintf(&t.b, "  %s = tail %s, !dbg !%d\n", result, call(in, t.fn.ReturnType), t.location(in))
+		return fmt.Sprintf("ret %s %s", llvmType(t.fn.ReturnType), result)
+	}
+	return ""
+}
+
+// call returns the LLVM call of the callee of the instruction, which returns
+// the given type. Calls of puts go to the runtime routine printing the type
+// of the argument.
+func call(in *intermediate.Instr, result intermediate.Type) string {
+	if in.Name == "puts" {
+		routine := putsInt
+		if in.Args[0].Type == intermediate.TypeBool {
+			routine = putsBool
+		}
+		return fmt.Sprintf("call void %s(%s)", routine, typed(in.Args[0]))
+	}
+	var args []string
+	for _, a := range in.Args {
+		args = append(args, typed(a))
+	}
+	return fmt.Sprintf("call %s %s(%s)", llvmType(result), funcSymbol(in.Name), strings.Join(args, ", "))
+}
@@ -0,0 +1,173 @@
+package llvm
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// update makes the tests rewrite their golden files instead of comparing
+// against them: go test ./llvm -update.
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// lower parses and lowers a Monkey program, and optimizes it at the level.
+func lower(t *testing.T, source string, level int) *intermediate.Module {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate.Optimize(module, intermediate.Passes(intermediate.Options{Level: level, InlineThreshold: intermediate.DefaultInlineThreshold}))
+	return module
+}
+
+// golden compares got with the golden file at path, or writes it there with
+// -update.
+func golden(t *testing.T, path string, got string) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (run go test -update to accept it):\n%s", path, got)
+	}
+}
+
+// programs returns the Monkey programs of testdata, by the path of their
+// golden files without the extension.
+func programs(t *testing.T) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mk"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	result := make(map[string]string)
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[strings.TrimSuffix(file, ".mk")] = string(source)
+	}
+	return result
+}
+
+// llcVersion matches the major version in the output of llc --version.
+var llcVersion = regexp.MustCompile(`LLVM version (\d+)`)
+
+// build compiles the LLVM IR with llc and links it with the C compiler, and
+// returns the executable. LLVM 14 is told to read opaque pointers.
+func build(t *testing.T, ir string) string {
+	t.Helper()
+	llc, err := exec.LookPath("llc")
+	if err != nil {
+		t.Skip("llc is not installed")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("cc is not installed")
+	}
+	version, err := exec.Command(llc, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := llcVersion.FindSubmatch(version)
+	if m == nil {
+		t.Fatalf("cannot tell the version of llc from:\n%s", version)
+	}
+	major, _ := strconv.Atoi(string(m[1]))
+	if major < 14 {
+		t.Skipf("llc is LLVM %d, which cannot read opaque pointers", major)
+	}
+	args := []string{"-O2", "-filetype=obj", "-relocation-model=pic"}
+	if major == 14 {
+		args = append(args, "-opaque-pointers")
+	}
+
+	dir := t.TempDir()
+	source, object, exe := filepath.Join(dir, "prog.ll"), filepath.Join(dir, "prog.o"), filepath.Join(dir, "prog")
+	if err := ioutil.WriteFile(source, []byte(ir), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(llc, append(args, "-o", object, source)...).CombinedOutput(); err != nil {
+		t.Fatalf("llc: %s\n%s", err, out)
+	}
+	if out, err := exec.Command(cc, "-o", exe, object).CombinedOutput(); err != nil {
+		t.Fatalf("cc: %s\n%s", err, out)
+	}
+	return exe
+}
+
+// TestGolden compares the LLVM IR of the programs at -O2 with the .ll golden
+// files. The source is named by a fixed path so that the debug metadata
+// does not depend on where the tests run.
+func TestGolden(t *testing.T) {
+	for path, source := range programs(t) {
+		golden(t, path+".ll", Translate(lower(t, source, 2), "/src/"+filepath.Base(path)+".mk"))
+	}
+}
+
+func TestRun(t *testing.T) {
+	for path, source := range programs(t) {
+		for _, level := range []int{0, 2} {
+			exe := build(t, Translate(lower(t, source, level), path+".mk"))
+			out, err := exec.Command(exe).Output()
+			if err != nil {
+				t.Fatalf("%s at -O%d: %s", path, level, err)
+			}
+			if level == 0 {
+				golden(t, path+".out", string(out))
+				continue
+			}
+			want, _ := ioutil.ReadFile(path + ".out")
+			if string(out) != string(want) {
+				t.Errorf("%s at -O%d printed\n%swant\n%s", path, level, out, want)
+			}
+		}
+	}
+}
+
+func TestDivisionError(t *testing.T) {
+	for _, source := range []string{
+		`let zero = fn() { 0 }; puts(1); puts(1 / zero());`,
+		`let min = fn() { 0 - 9223372036854775807 - 1 }; puts(1); puts(min() / (0 - 1));`,
+	} {
+		exe := build(t, Translate(lower(t, source, 0), "div.mk"))
+		cmd := exec.Command(exe)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+			t.Errorf("%s: got %v, want exit status 1", source, err)
+		}
+		if string(out) != "1\n" {
+			t.Errorf("%s: printed %q before the error, want %q", source, out, "1\n")
+		}
+		if !strings.Contains(stderr.String(), "integer division error") {
+			t.Errorf("%s: stderr %q does not report the division", source, stderr.String())
+		}
+	}
+}
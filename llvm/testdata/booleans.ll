@@ -0,0 +1,114 @@
+; ModuleID = "booleans.mk"
+source_filename = "booleans.mk"
+
+define i1 @monkey_even(i64 %v0) !dbg !5 {
+b0:
+  %v2 = icmp eq i64 %v0, 0, !dbg !6
+  br i1 %v2, label %b1, label %b2, !dbg !7
+b1:
+  ret i1 true, !dbg !8
+b2:
+  %v6 = sub i64 %v0, 1, !dbg !9
+  %t14 = tail call i1 @monkey_odd(i64 %v6), !dbg !10
+  ret i1 %t14, !dbg !10
+}
+
+define i1 @monkey_odd(i64 %v0) !dbg !11 {
+b0:
+  %v2 = icmp eq i64 %v0, 0, !dbg !12
+  br i1 %v2, label %b1, label %b2, !dbg !13
+b1:
+  ret i1 false, !dbg !14
+b2:
+  %v6 = sub i64 %v0, 1, !dbg !15
+  %t14 = tail call i1 @monkey_even(i64 %v6), !dbg !16
+  ret i1 %t14, !dbg !16
+}
+
+define void @monkey_main() !dbg !17 {
+b0:
+  %v1 = call i1 @monkey_even(i64 100001), !dbg !18
+  call void @rt.puts_bool(i1 %v1), !dbg !19
+  %v4 = call i1 @monkey_odd(i64 3), !dbg !20
+  %v5 = xor i1 %v4, true, !dbg !21
+  call void @rt.puts_bool(i1 %v5), !dbg !22
+  %v9 = icmp slt i64 1, 2, !dbg !23
+  %v11 = icmp eq i1 %v9, true, !dbg !24
+  call void @rt.puts_bool(i1 %v11), !dbg !25
+  ret void, !dbg !26
+}
+
+define i32 @main() {
+  call void @monkey_main()
+  ret i32 0
+}
+
+@.str.int = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.str.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.str.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.str.div = private unnamed_addr constant [32 x i8] c"monkey: integer division error\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @puts(ptr)
+declare i32 @fflush(ptr)
+declare i64 @write(i32, ptr, i64)
+declare void @exit(i32) noreturn
+
+define internal void @rt.puts_int(i64 %v) {
+  %r = call i32 (ptr, ...) @printf(ptr @.str.int, i64 %v)
+  ret void
+}
+
+define internal void @rt.puts_bool(i1 %v) {
+  %s = select i1 %v, ptr @.str.true, ptr @.str.false
+  %r = call i32 @puts(ptr %s)
+  ret void
+}
+
+define internal i64 @rt.div(i64 %a, i64 %b) {
+  %zero = icmp eq i64 %b, 0
+  %min = icmp eq i64 %a, -9223372036854775808
+  %minus1 = icmp eq i64 %b, -1
+  %overflow = and i1 %min, %minus1
+  %invalid = or i1 %zero, %overflow
+  br i1 %invalid, label %error, label %ok
+error:
+  %f = call i32 @fflush(ptr null)
+  %w = call i64 @write(i32 2, ptr @.str.div, i64 31)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+
+!llvm.dbg.cu = !{!1}
+!llvm.module.flags = !{!3, !4}
+
+!0 = !DIFile(filename: "booleans.mk", directory: "/src")
+!1 = distinct !DICompileUnit(language: DW_LANG_C99, file: !0, producer: "monkey", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!2 = !DISubroutineType(types: !{})
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "even", linkageName: "monkey_even", scope: !0, file: !0, line: 1, type: !2, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !1)
+!6 = !DILocation(line: 1, column: 26, scope: !5)
+!7 = !DILocation(line: 1, column: 20, scope: !5)
+!8 = !DILocation(line: 1, column: 18, scope: !5)
+!9 = !DILocation(line: 1, column: 54, scope: !5)
+!10 = !DILocation(line: 1, column: 48, scope: !5)
+!11 = distinct !DISubprogram(name: "odd", linkageName: "monkey_odd", scope: !0, file: !0, line: 2, type: !2, scopeLine: 2, spFlags: DISPFlagDefinition, unit: !1)
+!12 = !DILocation(line: 2, column: 25, scope: !11)
+!13 = !DILocation(line: 2, column: 19, scope: !11)
+!14 = !DILocation(line: 2, column: 17, scope: !11)
+!15 = !DILocation(line: 2, column: 55, scope: !11)
+!16 = !DILocation(line: 2, column: 48, scope: !11)
+!17 = distinct !DISubprogram(name: "main", linkageName: "monkey_main", scope: !0, file: !0, line: 0, type: !2, scopeLine: 0, spFlags: DISPFlagDefinition, unit: !1)
+!18 = !DILocation(line: 3, column: 6, scope: !17)
+!19 = !DILocation(line: 3, column: 1, scope: !17)
+!20 = !DILocation(line: 4, column: 7, scope: !17)
+!21 = !DILocation(line: 4, column: 6, scope: !17)
+!22 = !DILocation(line: 4, column: 1, scope: !17)
+!23 = !DILocation(line: 5, column: 8, scope: !17)
+!24 = !DILocation(line: 5, column: 12, scope: !17)
+!25 = !DILocation(line: 5, column: 1, scope: !17)
+!26 = !DILocation(line: 0, column: 0, scope: !17)
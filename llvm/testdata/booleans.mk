@@ -0,0 +1,5 @@
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+puts(even(100001));
+puts(!odd(3));
+puts(1 < 2 == true);
@@ -0,0 +1,149 @@
+; ModuleID = "branches.mk"
+source_filename = "branches.mk"
+
+define i64 @monkey_sign(i64 %v0) !dbg !5 {
+b0:
+  %v2 = icmp slt i64 %v0, 0, !dbg !6
+  br i1 %v2, label %b1, label %b2, !dbg !7
+b1:
+  %v6 = sub i64 0, 1, !dbg !8
+  ret i64 %v6, !dbg !9
+b2:
+  %v8 = icmp eq i64 %v0, 0, !dbg !10
+  br i1 %v8, label %b4, label %b5, !dbg !11
+b4:
+  ret i64 0, !dbg !9
+b5:
+  ret i64 1, !dbg !9
+}
+
+define void @monkey_main() !dbg !12 {
+b0:
+  %v2 = sub i64 0, 5, !dbg !13
+  %v13 = icmp slt i64 %v2, 0, !dbg !14
+  br i1 %v13, label %b2, label %b3, !dbg !15
+b2:
+  %v17 = sub i64 0, 1, !dbg !16
+  br label %b4, !dbg !15
+b3:
+  %v20 = icmp eq i64 %v2, 0, !dbg !17
+  br i1 %v20, label %b5, label %b6, !dbg !18
+b4:
+  %v22 = phi i64 [ %v17, %b2 ], [ %v28, %b7 ], !dbg !15
+  call void @rt.puts_int(i64 %v22), !dbg !19
+  %v32 = icmp slt i64 0, 0, !dbg !14
+  br i1 %v32, label %b10, label %b11, !dbg !15
+b5:
+  br label %b7, !dbg !18
+b6:
+  br label %b7, !dbg !18
+b7:
+  %v28 = phi i64 [ 0, %b5 ], [ 1, %b6 ], !dbg !18
+  br label %b4, !dbg !15
+b10:
+  %v36 = sub i64 0, 1, !dbg !16
+  br label %b12, !dbg !15
+b11:
+  %v39 = icmp eq i64 0, 0, !dbg !17
+  br i1 %v39, label %b13, label %b14, !dbg !18
+b12:
+  %v41 = phi i64 [ %v36, %b10 ], [ %v47, %b15 ], !dbg !15
+  call void @rt.puts_int(i64 %v41), !dbg !20
+  %v51 = icmp slt i64 5, 0, !dbg !14
+  br i1 %v51, label %b18, label %b19, !dbg !15
+b13:
+  br label %b15, !dbg !18
+b14:
+  br label %b15, !dbg !18
+b15:
+  %v47 = phi i64 [ 0, %b13 ], [ 1, %b14 ], !dbg !18
+  br label %b12, !dbg !15
+b18:
+  %v55 = sub i64 0, 1, !dbg !16
+  br label %b20, !dbg !15
+b19:
+  %v58 = icmp eq i64 5, 0, !dbg !17
+  br i1 %v58, label %b21, label %b22, !dbg !18
+b20:
+  %v60 = phi i64 [ %v55, %b18 ], [ %v66, %b23 ], !dbg !15
+  call void @rt.puts_int(i64 %v60), !dbg !21
+  ret void, !dbg !22
+b21:
+  br label %b23, !dbg !18
+b22:
+  br label %b23, !dbg !18
+b23:
+  %v66 = phi i64 [ 0, %b21 ], [ 1, %b22 ], !dbg !18
+  br label %b20, !dbg !15
+}
+
+define i32 @main() {
+  call void @monkey_main()
+  ret i32 0
+}
+
+@.str.int = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.str.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.str.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.str.div = private unnamed_addr constant [32 x i8] c"monkey: integer division error\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @puts(ptr)
+declare i32 @fflush(ptr)
+declare i64 @write(i32, ptr, i64)
+declare void @exit(i32) noreturn
+
+define internal void @rt.puts_int(i64 %v) {
+  %r = call i32 (ptr, ...) @printf(ptr @.str.int, i64 %v)
+  ret void
+}
+
+define internal void @rt.puts_bool(i1 %v) {
+  %s = select i1 %v, ptr @.str.true, ptr @.str.false
+  %r = call i32 @puts(ptr %s)
+  ret void
+}
+
+define internal i64 @rt.div(i64 %a, i64 %b) {
+  %zero = icmp eq i64 %b, 0
+  %min = icmp eq i64 %a, -9223372036854775808
+  %minus1 = icmp eq i64 %b, -1
+  %overflow = and i1 %min, %minus1
+  %invalid = or i1 %zero, %overflow
+  br i1 %invalid, label %error, label %ok
+error:
+  %f = call i32 @fflush(ptr null)
+  %w = call i64 @write(i32 2, ptr @.str.div, i64 31)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+
+!llvm.dbg.cu = !{!1}
+!llvm.module.flags = !{!3, !4}
+
+!0 = !DIFile(filename: "branches.mk", directory: "/src")
+!1 = distinct !DICompileUnit(language: DW_LANG_C99, file: !0, producer: "monkey", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!2 = !DISubroutineType(types: !{})
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "sign", linkageName: "monkey_sign", scope: !0, file: !0, line: 1, type: !2, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !1)
+!6 = !DILocation(line: 1, column: 26, scope: !5)
+!7 = !DILocation(line: 1, column: 20, scope: !5)
+!8 = !DILocation(line: 1, column: 35, scope: !5)
+!9 = !DILocation(line: 1, column: 18, scope: !5)
+!10 = !DILocation(line: 1, column: 54, scope: !5)
+!11 = !DILocation(line: 1, column: 48, scope: !5)
+!12 = distinct !DISubprogram(name: "main", linkageName: "monkey_main", scope: !0, file: !0, line: 0, type: !2, scopeLine: 0, spFlags: DISPFlagDefinition, unit: !1)
+!13 = !DILocation(line: 2, column: 13, scope: !12)
+!14 = !DILocation(line: 1, column: 26, scope: !12)
+!15 = !DILocation(line: 1, column: 20, scope: !12)
+!16 = !DILocation(line: 1, column: 35, scope: !12)
+!17 = !DILocation(line: 1, column: 54, scope: !12)
+!18 = !DILocation(line: 1, column: 48, scope: !12)
+!19 = !DILocation(line: 2, column: 1, scope: !12)
+!20 = !DILocation(line: 3, column: 1, scope: !12)
+!21 = !DILocation(line: 4, column: 1, scope: !12)
+!22 = !DILocation(line: 0, column: 0, scope: !12)
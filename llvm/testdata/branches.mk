@@ -0,0 +1,4 @@
+let sign = fn(x) { if (x < 0) { 0 - 1 } else { if (x == 0) { 0 } else { 1 } } };
+puts(sign(0 - 5));
+puts(sign(0));
+puts(sign(5));
@@ -0,0 +1,87 @@
+; ModuleID = "globals.mk"
+source_filename = "globals.mk"
+
+@global_base = internal global i64 0
+
+define i64 @monkey_add(i64 %v0) !dbg !5 {
+b0:
+  %v1 = load i64, ptr @global_base, !dbg !6
+  %v2 = add i64 %v1, %v0, !dbg !7
+  ret i64 %v2, !dbg !8
+}
+
+define void @monkey_main() !dbg !9 {
+b0:
+  store i64 40, ptr @global_base, !dbg !10
+  %v3 = icmp sgt i64 40, 10, !dbg !11
+  %v9 = load i64, ptr @global_base, !dbg !12
+  %v10 = add i64 %v9, 2, !dbg !13
+  call void @rt.puts_int(i64 %v10), !dbg !14
+  call void @rt.puts_bool(i1 %v3), !dbg !15
+  ret void, !dbg !16
+}
+
+define i32 @main() {
+  call void @monkey_main()
+  ret i32 0
+}
+
+@.str.int = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.str.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.str.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.str.div = private unnamed_addr constant [32 x i8] c"monkey: integer division error\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @puts(ptr)
+declare i32 @fflush(ptr)
+declare i64 @write(i32, ptr, i64)
+declare void @exit(i32) noreturn
+
+define internal void @rt.puts_int(i64 %v) {
+  %r = call i32 (ptr, ...) @printf(ptr @.str.int, i64 %v)
+  ret void
+}
+
+define internal void @rt.puts_bool(i1 %v) {
+  %s = select i1 %v, ptr @.str.true, ptr @.str.false
+  %r = call i32 @puts(ptr %s)
+  ret void
+}
+
+define internal i64 @rt.div(i64 %a, i64 %b) {
+  %zero = icmp eq i64 %b, 0
+  %min = icmp eq i64 %a, -9223372036854775808
+  %minus1 = icmp eq i64 %b, -1
+  %overflow = and i1 %min, %minus1
+  %invalid = or i1 %zero, %overflow
+  br i1 %invalid, label %error, label %ok
+error:
+  %f = call i32 @fflush(ptr null)
+  %w = call i64 @write(i32 2, ptr @.str.div, i64 31)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+
+!llvm.dbg.cu = !{!1}
+!llvm.module.flags = !{!3, !4}
+
+!0 = !DIFile(filename: "globals.mk", directory: "/src")
+!1 = distinct !DICompileUnit(language: DW_LANG_C99, file: !0, producer: "monkey", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!2 = !DISubroutineType(types: !{})
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "add", linkageName: "monkey_add", scope: !0, file: !0, line: 3, type: !2, scopeLine: 3, spFlags: DISPFlagDefinition, unit: !1)
+!6 = !DILocation(line: 3, column: 19, scope: !5)
+!7 = !DILocation(line: 3, column: 24, scope: !5)
+!8 = !DILocation(line: 3, column: 17, scope: !5)
+!9 = distinct !DISubprogram(name: "main", linkageName: "monkey_main", scope: !0, file: !0, line: 0, type: !2, scopeLine: 0, spFlags: DISPFlagDefinition, unit: !1)
+!10 = !DILocation(line: 1, column: 1, scope: !9)
+!11 = !DILocation(line: 2, column: 17, scope: !9)
+!12 = !DILocation(line: 3, column: 19, scope: !9)
+!13 = !DILocation(line: 3, column: 24, scope: !9)
+!14 = !DILocation(line: 4, column: 1, scope: !9)
+!15 = !DILocation(line: 5, column: 1, scope: !9)
+!16 = !DILocation(line: 0, column: 0, scope: !9)
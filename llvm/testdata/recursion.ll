@@ -0,0 +1,120 @@
+; ModuleID = "recursion.mk"
+source_filename = "recursion.mk"
+
+define i64 @monkey_fib(i64 %v0) !dbg !5 {
+b0:
+  %v2 = icmp slt i64 %v0, 2, !dbg !6
+  br i1 %v2, label %b1, label %b2, !dbg !7
+b1:
+  ret i64 %v0, !dbg !8
+b2:
+  %v5 = sub i64 %v0, 1, !dbg !9
+  %v6 = call i64 @monkey_fib(i64 %v5), !dbg !10
+  %v8 = sub i64 %v0, 2, !dbg !11
+  %v9 = call i64 @monkey_fib(i64 %v8), !dbg !12
+  %v10 = add i64 %v6, %v9, !dbg !13
+  ret i64 %v10, !dbg !8
+}
+
+define i64 @monkey_sum(i64 %v0, i64 %v1) !dbg !14 {
+b0:
+  br label %b4, !dbg !15
+b1:
+  ret i64 %v17, !dbg !16
+b2:
+  %v6 = sub i64 %v16, 1, !dbg !17
+  %v7 = add i64 %v17, %v16, !dbg !18
+  br label %b4, !dbg !19
+b4:
+  %v16 = phi i64 [ %v0, %b0 ], [ %v6, %b2 ], !dbg !20
+  %v17 = phi i64 [ %v1, %b0 ], [ %v7, %b2 ], !dbg !21
+  %v3 = icmp eq i64 %v16, 0, !dbg !22
+  br i1 %v3, label %b1, label %b2, !dbg !23
+}
+
+define void @monkey_main() !dbg !24 {
+b0:
+  %v1 = call i64 @monkey_fib(i64 25), !dbg !25
+  call void @rt.puts_int(i64 %v1), !dbg !26
+  %v5 = call i64 @monkey_sum(i64 1000000, i64 0), !dbg !27
+  call void @rt.puts_int(i64 %v5), !dbg !28
+  ret void, !dbg !29
+}
+
+define i32 @main() {
+  call void @monkey_main()
+  ret i32 0
+}
+
+@.str.int = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.str.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.str.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.str.div = private unnamed_addr constant [32 x i8] c"monkey: integer division error\0A\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @puts(ptr)
+declare i32 @fflush(ptr)
+declare i64 @write(i32, ptr, i64)
+declare void @exit(i32) noreturn
+
+define internal void @rt.puts_int(i64 %v) {
+  %r = call i32 (ptr, ...) @printf(ptr @.str.int, i64 %v)
+  ret void
+}
+
+define internal void @rt.puts_bool(i1 %v) {
+  %s = select i1 %v, ptr @.str.true, ptr @.str.false
+  %r = call i32 @puts(ptr %s)
+  ret void
+}
+
+define internal i64 @rt.div(i64 %a, i64 %b) {
+  %zero = icmp eq i64 %b, 0
+  %min = icmp eq i64 %a, -9223372036854775808
+  %minus1 = icmp eq i64 %b, -1
+  %overflow = and i1 %min, %minus1
+  %invalid = or i1 %zero, %overflow
+  br i1 %invalid, label %error, label %ok
+error:
+  %f = call i32 @fflush(ptr null)
+  %w = call i64 @write(i32 2, ptr @.str.div, i64 31)
+  call void @exit(i32 1)
+  unreachable
+ok:
+  %q = sdiv i64 %a, %b
+  ret i64 %q
+}
+
+!llvm.dbg.cu = !{!1}
+!llvm.module.flags = !{!3, !4}
+
+!0 = !DIFile(filename: "recursion.mk", directory: "/src")
+!1 = distinct !DICompileUnit(language: DW_LANG_C99, file: !0, producer: "monkey", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!2 = !DISubroutineType(types: !{})
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "fib", linkageName: "monkey_fib", scope: !0, file: !0, line: 1, type: !2, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !1)
+!6 = !DILocation(line: 1, column: 25, scope: !5)
+!7 = !DILocation(line: 1, column: 19, scope: !5)
+!8 = !DILocation(line: 1, column: 17, scope: !5)
+!9 = !DILocation(line: 1, column: 49, scope: !5)
+!10 = !DILocation(line: 1, column: 43, scope: !5)
+!11 = !DILocation(line: 1, column: 62, scope: !5)
+!12 = !DILocation(line: 1, column: 56, scope: !5)
+!13 = !DILocation(line: 1, column: 54, scope: !5)
+!14 = distinct !DISubprogram(name: "sum", linkageName: "monkey_sum", scope: !0, file: !0, line: 3, type: !2, scopeLine: 3, spFlags: DISPFlagDefinition, unit: !1)
+!15 = !DILocation(line: 0, column: 0, scope: !14)
+!16 = !DILocation(line: 3, column: 22, scope: !14)
+!17 = !DILocation(line: 3, column: 57, scope: !14)
+!18 = !DILocation(line: 3, column: 66, scope: !14)
+!19 = !DILocation(line: 3, column: 51, scope: !14)
+!20 = !DILocation(line: 3, column: 14, scope: !14)
+!21 = !DILocation(line: 3, column: 17, scope: !14)
+!22 = !DILocation(line: 3, column: 30, scope: !14)
+!23 = !DILocation(line: 3, column: 24, scope: !14)
+!24 = distinct !DISubprogram(name: "main", linkageName: "monkey_main", scope: !0, file: !0, line: 0, type: !2, scopeLine: 0, spFlags: DISPFlagDefinition, unit: !1)
+!25 = !DILocation(line: 2, column: 6, scope: !24)
+!26 = !DILocation(line: 2, column: 1, scope: !24)
+!27 = !DILocation(line: 4, column: 6, scope: !24)
+!28 = !DILocation(line: 4, column: 1, scope: !24)
+!29 = !DILocation(line: 0, column: 0, scope: !24)
@@ -0,0 +1,147 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Client represents a client of a language server running in the same
+// process, connected to it through pipes, for tests and tools.
+type Client struct {
+	conn  *conn
+	input io.Closer  // The end of the pipe the server reads.
+	done  chan error // Receives the result of Serve.
+
+	mu            sync.Mutex
+	changed       *sync.Cond          // Signalled when a message arrives or the connection ends.
+	nextID        int                 // The ID of the next request.
+	responses     map[string]*Message // The responses not yet claimed, by ID.
+	notifications []*Message          // The notifications not yet claimed, in order.
+	err           error               // Why the connection ended, or nil.
+}
+
+// Connect starts the server on an in-process connection and returns a client
+// talking to it.
+func Connect(s *Server) *Client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &Client{
+		conn:      newConn(clientIn, clientOut),
+		input:     clientOut,
+		done:      make(chan error, 1),
+		responses: make(map[string]*Message),
+	}
+	c.changed = sync.NewCond(&c.mu)
+	go func() {
+		err := s.Serve(serverIn, serverOut)
+		serverOut.Close()
+		serverIn.Close()
+		c.done <- err
+	}()
+	go c.receive()
+	return c
+}
+
+// receive reads the messages of the server until the connection ends, and
+// keeps them until they are claimed. Reading them as they come keeps the
+// server from blocking on the notifications it sends.
+func (c *Client) receive() {
+	for {
+		m, err := c.conn.read()
+		c.mu.Lock()
+		switch {
+		case err != nil:
+			c.err = err
+		case m.ID == nil:
+			c.notifications = append(c.notifications, m)
+		default:
+			c.responses[string(*m.ID)] = m
+		}
+		c.changed.Broadcast()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Call sends a request and decodes the result of its response into result,
+// which may be nil. It returns a *ResponseError if the request failed.
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	c.mu.Unlock()
+
+	if err := c.send(&id, method, params); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.responses[string(id)] == nil && c.err == nil {
+		c.changed.Wait()
+	}
+	m := c.responses[string(id)]
+	if m == nil {
+		return fmt.Errorf("no response to %s: %v", method, c.err)
+	}
+	delete(c.responses, string(id))
+	if m.Error != nil {
+		return m.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(m.Result, result)
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(method string, params interface{}) error {
+	return c.send(nil, method, params)
+}
+
+// send writes a request, or a notification if the ID is nil.
+func (c *Client) send(id *json.RawMessage, method string, params interface{}) error {
+	raw, err := marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.conn.write(&Message{ID: id, Method: method, Params: raw})
+}
+
+// Wait returns the first notification of the method the server has sent
+// since the last one claimed, waiting for it to arrive if need be, and
+// decodes its parameters into params, which may be nil. Notifications of
+// other methods that came before it are dropped.
+func (c *Client) Wait(method string, params interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		for len(c.notifications) > 0 {
+			m := c.notifications[0]
+			c.notifications = c.notifications[1:]
+			if m.Method != method {
+				continue
+			}
+			if params == nil {
+				return nil
+			}
+			return json.Unmarshal(m.Params, params)
+		}
+		if c.err != nil {
+			return fmt.Errorf("no %s notification: %v", method, c.err)
+		}
+		c.changed.Wait()
+	}
+}
+
+// Close closes the connection and returns the result of Serve: nil if the
+// client shut the server down and sent exit first.
+func (c *Client) Close() error {
+	c.input.Close()
+	return <-c.done
+}
@@ -0,0 +1,316 @@
+package lsp
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/user/golang-interpreter/analysis"
+	"github.com/user/golang-interpreter/diagnostic"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// document represents an open document, parsed and analysed after every
+// change.
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []int // The offsets of the starts of the lines.
+
+	tree    *parser.Tree // Parsed again incrementally after each change.
+	program *parser.Program
+	errors  []string // The errors of the parser.
+	res     *analysis.Resolution
+	types   *analysis.Types
+
+	tokens []lexer.Token
+	closes map[int]int  // The offsets of the closing braces by those of the opening ones.
+	bodies map[int]bool // The offsets of the opening braces of function bodies.
+}
+
+// newDocument analyses a document, given its syntax tree.
+func newDocument(uri string, version int, tree *parser.Tree) *document {
+	d := &document{uri: uri, version: version, text: tree.Source, lines: lineStarts(tree.Source), tree: tree}
+
+	d.program = tree.Program
+	d.errors = tree.Errors
+	d.res = analysis.Resolve(d.program)
+	d.types = analysis.Infer(d.program, d.res)
+	d.scan()
+	return d
+}
+
+// lineStarts returns the offsets of the starts of the lines of a text.
+func lineStarts(text string) []int {
+	lines := []int{0}
+	for n := 0; n < len(text); n++ {
+		if text[n] == '\n' {
+			lines = append(lines, n+1)
+		}
+	}
+	return lines
+}
+
+// scan goes through the tokens for what the syntax tree lacks: where each
+// token and block ends, and which blocks are function bodies.
+func (d *document) scan() {
+	d.closes = make(map[int]int)
+	d.bodies = make(map[int]bool)
+	var opens []int
+	function := false // Whether the next opening brace starts a function body.
+	d.tokens = d.tree.Tokens()
+	d.tokens = d.tokens[:len(d.tokens)-1]
+	for _, tok := range d.tokens {
+		switch {
+		case tok.Type == lexer.FUNCTION:
+			function = true
+		case tok.Type == lexer.LBRACE:
+			opens = append(opens, tok.Pos.Offset)
+			if function {
+				d.bodies[tok.Pos.Offset] = true
+				function = false
+			}
+		case tok.Type == lexer.RBRACE && len(opens) > 0:
+			d.closes[opens[len(opens)-1]] = tok.Pos.Offset
+			opens = opens[:len(opens)-1]
+		}
+	}
+}
+
+// position returns the protocol position of a line and a byte column of the
+// lexer, both from 1.
+func (d *document) position(line, column int) Position {
+	if line < 1 {
+		return Position{}
+	}
+	if line > len(d.lines) {
+		return d.position(len(d.lines), len(d.text)-d.lines[len(d.lines)-1]+1)
+	}
+	start := d.lines[line-1]
+	end := start + column - 1
+	if end > len(d.text) {
+		end = len(d.text)
+	}
+	if end < start {
+		end = start
+	}
+	return Position{Line: line - 1, Character: utf16Len(d.text[start:end])}
+}
+
+// positionOf returns the protocol position of a byte offset.
+func (d *document) positionOf(offset int) Position {
+	line := sort.Search(len(d.lines), func(n int) bool { return d.lines[n] > offset })
+	return d.position(line, offset-d.lines[line-1]+1)
+}
+
+// offset returns the byte offset of a protocol position, clamped to the
+// line and to the text.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[p.Line]
+	for units := 0; offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		if units > p.Character {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+// utf16Len returns the length of a string in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// span returns the range of a span of the lexer.
+func (d *document) span(s diagnostic.Span) Range {
+	return Range{Start: d.position(s.Start.Line, s.Start.Column), End: d.position(s.End.Line, s.End.Column)}
+}
+
+// identRange returns the range of an identifier.
+func (d *document) identRange(id *parser.Identifier) Range {
+	return d.span(diagnostic.TokenSpan(id.Token))
+}
+
+// diagnostics returns the errors and warnings of the document: the errors of
+// the parser if there are any, and those of the analyses otherwise.
+func (d *document) diagnostics() []Diagnostic {
+	var diags []diagnostic.Diagnostic
+	for _, msg := range d.errors {
+		diags = append(diags, diagnostic.FromError(msg))
+	}
+	if len(diags) == 0 {
+		diags = append(analysis.Undefined(d.program), analysis.Unused(d.program)...)
+	}
+
+	result := []Diagnostic{}
+	for _, diag := range diags {
+		severity := SeverityError
+		switch diag.Severity {
+		case diagnostic.Warning:
+			severity = SeverityWarning
+		case diagnostic.Note:
+			severity = SeverityInformation
+		}
+		result = append(result, Diagnostic{
+			Range:    d.span(diag.Span),
+			Severity: severity,
+			Code:     diag.Code,
+			Source:   "monkey",
+			Message:  diag.Message,
+		})
+	}
+	return result
+}
+
+// identifierAt returns the identifier at the offset, touching it at either
+// end, and its binding, nil for builtins and undefined names.
+func (d *document) identifierAt(offset int) (*parser.Identifier, *analysis.Binding) {
+	at := func(id *parser.Identifier) bool {
+		start := id.Token.Pos.Offset
+		return start <= offset && offset <= start+len(id.Token.Literal)
+	}
+	for _, b := range d.res.Bindings {
+		if at(b.Decl) {
+			return b.Decl, b
+		}
+	}
+	for id, b := range d.res.Uses {
+		if at(id) {
+			return id, b
+		}
+	}
+	for _, id := range d.res.Unresolved {
+		if at(id) {
+			return id, nil
+		}
+	}
+	return nil, nil
+}
+
+// prefix returns the part of the identifier before the offset, the one
+// being typed.
+func (d *document) prefix(offset int) string {
+	start := offset
+	for start > 0 && (unicode.IsLetter(rune(d.text[start-1])) || d.text[start-1] == '_') {
+		start--
+	}
+	return d.text[start:offset]
+}
+
+// occurrences returns the declaration and the uses of a binding, in order.
+func (d *document) occurrences(b *analysis.Binding, declaration bool) []*parser.Identifier {
+	var ids []*parser.Identifier
+	if declaration {
+		ids = append(ids, b.Decl)
+	}
+	ids = append(ids, b.Uses...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Token.Pos.Offset < ids[j].Token.Pos.Offset })
+	return ids
+}
+
+// extent returns the offsets between which the bindings of a block are
+// visible: from its opening brace to its closing one, and the whole text
+// for the top level.
+func (d *document) extent(block *parser.BlockStatement) (int, int) {
+	if block == nil {
+		return 0, len(d.text)
+	}
+	return d.braces(block.Token.Pos.Offset)
+}
+
+// braces returns the offsets of an opening brace and of its closing one, or
+// of the end of the text if it is not closed yet.
+func (d *document) braces(open int) (int, int) {
+	if end, ok := d.closes[open]; ok {
+		return open, end
+	}
+	return open, len(d.text)
+}
+
+// visible returns true if the binding is in scope at the offset. A let
+// binding is in scope after its name and, like for the resolver, in the
+// bodies of the functions of its block, which run once the whole block has
+// been evaluated.
+func (d *document) visible(b *analysis.Binding, offset int) bool {
+	start, end := d.extent(b.Block)
+	if offset <= start || offset > end {
+		return false
+	}
+	if b.Kind == analysis.ParamBinding || b.Decl.Token.Pos.Offset < offset {
+		return true
+	}
+	for body := range d.bodies {
+		if bodyStart, bodyEnd := d.braces(body); bodyStart > start && bodyStart < offset && offset <= bodyEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// shadows returns true if a binding would hide another of the same name
+// where both are visible: if its block is nested in the other's, or is the
+// same block and it is the later binding. The parameters of a function are
+// bound before the let statements of its body, which hide them.
+func (d *document) shadows(b, other *analysis.Binding) bool {
+	start, end := d.extent(b.Block)
+	otherStart, otherEnd := d.extent(other.Block)
+	if start < otherStart || end > otherEnd {
+		return false
+	}
+	if b.Block != other.Block {
+		return true
+	}
+	switch {
+	case b.Kind == analysis.ParamBinding:
+		return other.Kind == analysis.ParamBinding
+	case other.Kind == analysis.ParamBinding:
+		return true
+	}
+	return b.Decl.Token.Pos.Offset > other.Decl.Token.Pos.Offset
+}
+
+// statementRange returns the range of a top-level statement, from its
+// first token to its last.
+func (d *document) statementRange(n int) Range {
+	stmts := d.program.Statements
+	start := parser.Pos(stmts[n]).Offset
+	next := len(d.text)
+	if n+1 < len(stmts) {
+		next = parser.Pos(stmts[n+1]).Offset
+	}
+	last := sort.Search(len(d.tokens), func(i int) bool { return d.tokens[i].Pos.Offset >= next }) - 1
+	end := start
+	if last >= 0 && d.tokens[last].Pos.Offset >= start {
+		end = d.tokens[last].Pos.Offset + len(d.tokens[last].Literal)
+	}
+	return Range{Start: d.positionOf(start), End: d.positionOf(end)}
+}
+
+// validName returns true if the name is an identifier rather than a keyword
+// or anything else.
+func validName(name string) bool {
+	tok := lexer.New(name).NextToken()
+	return tok.Type == lexer.IDENT && tok.Literal == name
+}
@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// The error codes of JSON-RPC and of the protocol.
+const (
+	ParseError           = -32700 // The message is not JSON.
+	InvalidRequest       = -32600 // The message is not a request.
+	MethodNotFound       = -32601 // The server does not implement the method.
+	InvalidParams        = -32602 // The parameters do not suit the method.
+	InternalError        = -32603 // The server failed.
+	ServerNotInitialized = -32002 // A request came before initialize.
+	RequestFailed        = -32803 // A valid request could not be carried out.
+)
+
+// Message represents a JSON-RPC message: a request if it has a method and an
+// ID, a notification if it has a method only, and a response otherwise.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+// ResponseError represents the error of a failed request.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the message of the error with its code.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// conn represents one end of a JSON-RPC connection, reading and writing
+// messages framed by a Content-Length header.
+type conn struct {
+	r  *textproto.Reader
+	w  io.Writer
+	mu sync.Mutex // Serializes the writes.
+}
+
+// newConn creates a connection reading from r and writing to w.
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// read reads the next message. It returns io.EOF at the end of the input,
+// and a *ResponseError with code ParseError for a message that is not
+// JSON, after which reading can go on.
+func (c *conn) read() (*Message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, fmt.Errorf("reading body: %v", err)
+	}
+	var m Message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, &ResponseError{Code: ParseError, Message: err.Error()}
+	}
+	return &m, nil
+}
+
+// write writes a message.
+func (c *conn) write(m *Message) error {
+	m.JSONRPC = "2.0"
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+// marshal returns the JSON encoding of a value, or null.
+func marshal(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(v)
+}
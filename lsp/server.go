@@ -0,0 +1,451 @@
+// Package lsp implements the Language Server Protocol for Monkey programs:
+// diagnostics as documents change, hover with the inferred types,
+// go-to-definition, references, document symbols, completion and rename.
+// The server talks JSON-RPC over any reader and writer, standard input and
+// output for editors, and Connect runs it in process for tests and tools.
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/analysis"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// ServerName is the name the server gives the client on initialization.
+const ServerName = "monkey-lsp"
+
+// keywords lists the keywords completion offers.
+var keywords = []string{"fn", "let", "true", "false", "if", "else", "return"}
+
+// Server represents a language server and the documents the client opened.
+type Server struct {
+	conn        *conn
+	documents   map[string]*document // The open documents by URI.
+	initialized bool                 // Whether the client has called initialize.
+	shutdown    bool                 // Whether the client has called shutdown.
+}
+
+// NewServer creates a language server.
+func NewServer() *Server {
+	return &Server{documents: make(map[string]*document)}
+}
+
+// handler represents the implementation of a method. Notifications have no
+// result.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+// handlers maps the methods the server implements to their implementation.
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"initialized":                 (*Server).ignore,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/didSave":        (*Server).ignore,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/prepareRename":  (*Server).prepareRename,
+	"textDocument/rename":         (*Server).rename,
+}
+
+// Serve reads messages from r and writes the responses and notifications to
+// w until the client sends exit or closes the input. It returns nil if the
+// client shut the server down first, as the protocol asks.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+	for {
+		m, err := s.conn.read()
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return fmt.Errorf("connection closed without shutdown")
+		}
+		if rerr, ok := err.(*ResponseError); ok {
+			if err := s.conn.write(&Message{ID: &nullID, Error: rerr}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return fmt.Errorf("exit without shutdown")
+		}
+		if m.ID == nil {
+			// Notifications have no response, even when they fail.
+			s.handle(m)
+			continue
+		}
+		response := &Message{ID: m.ID}
+		result, rerr := s.handle(m)
+		if rerr == nil {
+			if response.Result, err = marshal(result); err != nil {
+				rerr = &ResponseError{Code: InternalError, Message: err.Error()}
+			}
+		}
+		response.Error = rerr
+		if err := s.conn.write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// nullID is the ID of the response to a message that cannot be read.
+var nullID = json.RawMessage("null")
+
+// handle calls the handler of a message. A panic is a bug of the server,
+// which reports it as an internal error rather than stopping.
+func (s *Server) handle(m *Message) (result interface{}, rerr *ResponseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			rerr = &ResponseError{Code: InternalError, Message: fmt.Sprintf("internal error: %v\n%s", r, debug.Stack())}
+		}
+	}()
+
+	h, ok := handlers[m.Method]
+	switch {
+	case !ok:
+		return nil, &ResponseError{Code: MethodNotFound, Message: fmt.Sprintf("method not found: %s", m.Method)}
+	case !s.initialized && m.Method != "initialize":
+		return nil, &ResponseError{Code: ServerNotInitialized, Message: "server not initialized"}
+	case s.shutdown:
+		return nil, &ResponseError{Code: InvalidRequest, Message: "server is shut down"}
+	}
+	result, err := h(s, m.Params)
+	if err != nil {
+		if rerr, ok := err.(*ResponseError); ok {
+			return nil, rerr
+		}
+		return nil, &ResponseError{Code: RequestFailed, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// decode decodes the parameters of a method.
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// document returns the open document with the URI.
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+	return d, nil
+}
+
+// initialize answers the first request of the client with the features of
+// the server.
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	s.initialized = true
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       TextDocumentSyncOptions{OpenClose: true, Change: SyncIncremental},
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			ReferencesProvider:     true,
+			DocumentSymbolProvider: true,
+			CompletionProvider:     CompletionOptions{},
+			RenameProvider:         RenameOptions{PrepareProvider: true},
+		},
+		ServerInfo: ServerInfo{Name: ServerName},
+	}, nil
+}
+
+// ignore handles the notifications the server has nothing to do for.
+func (s *Server) ignore(params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+// shutdownRequest prepares the server to exit.
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	s.documents = make(map[string]*document)
+	return nil, nil
+}
+
+// didOpen analyses a document the client opened.
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, parser.NewTree(p.TextDocument.Text)))
+}
+
+// didChange analyses a document again after the client changed it. The
+// client sends the edited ranges, and the syntax tree is parsed again only
+// where they damaged it.
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	tree := d.tree
+	for _, change := range p.ContentChanges {
+		if change.Range == nil {
+			tree = parser.NewTree(change.Text)
+			continue
+		}
+		lines := &document{text: tree.Source, lines: lineStarts(tree.Source)}
+		tree.Edit(lexer.Edit{Start: lines.offset(change.Range.Start), End: lines.offset(change.Range.End), Text: change.Text})
+	}
+	return nil, s.update(newDocument(d.uri, p.TextDocument.Version, tree))
+}
+
+// didClose forgets a document the client closed, and its diagnostics.
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.publish(p.TextDocument.URI, 0, []Diagnostic{})
+}
+
+// update replaces a document and publishes its diagnostics.
+func (s *Server) update(d *document) error {
+	s.documents[d.uri] = d
+	return s.publish(d.uri, d.version, d.diagnostics())
+}
+
+// publish sends the diagnostics of a document to the client.
+func (s *Server) publish(uri string, version int, diags []Diagnostic) error {
+	params, err := json.Marshal(&PublishDiagnosticsParams{URI: uri, Version: version, Diagnostics: diags})
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&Message{Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// at returns the document of the parameters of a request about a position,
+// the identifier at the position and its binding.
+func (s *Server) at(params json.RawMessage) (*document, *parser.Identifier, *analysis.Binding, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, nil, nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	id, b := d.identifierAt(d.offset(p.Position))
+	return d, id, b, nil
+}
+
+// hover describes the identifier at a position with its type.
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	d, id, b, err := s.at(params)
+	if err != nil || id == nil {
+		return nil, err
+	}
+	var text string
+	switch {
+	case b == nil && analysis.BuiltinType(id.Value) != nil:
+		text = fmt.Sprintf("builtin %s: %s", id.Value, analysis.BuiltinType(id.Value))
+	case b == nil:
+		return nil, nil
+	case b.Kind == analysis.ParamBinding:
+		text = fmt.Sprintf("param %s: %s", b.Name, d.types.OfBinding(b))
+	default:
+		text = fmt.Sprintf("let %s: %s", b.Name, d.types.OfBinding(b))
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```\n" + text + "\n```"},
+		Range:    d.identRange(id),
+	}, nil
+}
+
+// definition returns where the identifier at a position is declared.
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	d, _, b, err := s.at(params)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return &Location{URI: d.uri, Range: d.identRange(b.Decl)}, nil
+}
+
+// references returns the uses of the binding of the identifier at a
+// position, and its declaration if the client asks for it.
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, _, b, err := s.at(params)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	locations := []Location{}
+	for _, id := range d.occurrences(b, p.Context.IncludeDeclaration) {
+		locations = append(locations, Location{URI: d.uri, Range: d.identRange(id)})
+	}
+	return locations, nil
+}
+
+// documentSymbol lists the top-level let statements of a document.
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []DocumentSymbol{}
+	for n, stmt := range d.program.Statements {
+		let, ok := stmt.(*parser.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		kind := SymbolVariable
+		if _, ok := let.Value.(*parser.FunctionLiteral); ok {
+			kind = SymbolFunction
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           let.Name.Value,
+			Detail:         d.types.Of(let.Value).String(),
+			Kind:           kind,
+			Range:          d.statementRange(n),
+			SelectionRange: d.identRange(let.Name),
+		})
+	}
+	return symbols, nil
+}
+
+// completion lists the names in scope at a position that start like the
+// identifier being typed, the builtin functions and the keywords.
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset := d.offset(p.Position)
+
+	// The innermost binding of a name shadows the others, and comes last
+	// among the visible ones since blocks nest.
+	bindings := make(map[string]*analysis.Binding)
+	for _, b := range d.res.Bindings {
+		if d.visible(b, offset) {
+			if other, ok := bindings[b.Name]; !ok || other.Decl.Token.Pos.Offset < b.Decl.Token.Pos.Offset {
+				bindings[b.Name] = b
+			}
+		}
+	}
+
+	list := &CompletionList{Items: []CompletionItem{}}
+	for name, b := range bindings {
+		typ := d.types.OfBinding(b)
+		kind := CompletionVariable
+		if typ.Kind == analysis.FunctionType {
+			kind = CompletionFunction
+		}
+		list.Items = append(list.Items, CompletionItem{Label: name, Kind: kind, Detail: typ.String()})
+	}
+	for _, builtin := range object.Builtins {
+		if _, ok := bindings[builtin.Name]; !ok {
+			list.Items = append(list.Items, CompletionItem{Label: builtin.Name, Kind: CompletionFunction, Detail: analysis.BuiltinType(builtin.Name).String()})
+		}
+	}
+	for _, keyword := range keywords {
+		list.Items = append(list.Items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+
+	prefix := d.prefix(offset)
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if strings.HasPrefix(item.Label, prefix) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Label < list.Items[j].Label })
+	return list, nil
+}
+
+// prepareRename returns the range of the identifier at a position if it can
+// be renamed.
+func (s *Server) prepareRename(params json.RawMessage) (interface{}, error) {
+	d, id, b, err := s.at(params)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return &PrepareRenameResult{Range: d.identRange(id), Placeholder: id.Value}, nil
+}
+
+// rename renames the binding of the identifier at a position, at its
+// declaration and at every use.
+func (s *Server) rename(params json.RawMessage) (interface{}, error) {
+	var p RenameParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if !validName(p.NewName) {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("%q is not a valid identifier", p.NewName)}
+	}
+	d, id, b, err := s.at(params)
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		return nil, fmt.Errorf("no identifier at the position")
+	}
+	if b == nil {
+		return nil, fmt.Errorf("%s is not declared in the document", id.Value)
+	}
+	for _, other := range d.res.Bindings {
+		if other == b || other.Name != p.NewName {
+			continue
+		}
+		for _, use := range b.Uses {
+			if d.visible(other, use.Token.Pos.Offset) {
+				return nil, fmt.Errorf("renaming %s to %s would make it refer to another binding", b.Name, p.NewName)
+			}
+		}
+		if !d.shadows(b, other) {
+			continue
+		}
+		for _, use := range other.Uses {
+			if d.visible(b, use.Token.Pos.Offset) {
+				return nil, fmt.Errorf("renaming %s to %s would capture the uses of another %s", b.Name, p.NewName, p.NewName)
+			}
+		}
+	}
+	var edits []TextEdit
+	for _, id := range d.occurrences(b, true) {
+		edits = append(edits, TextEdit{Range: d.identRange(id), NewText: p.NewName})
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+}
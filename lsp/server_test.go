@@ -0,0 +1,277 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// uri is the URI of the document the tests open.
+const uri = "file:///test.mk"
+
+// open starts a server, initializes it and opens a document with the text,
+// and returns the client and the diagnostics published for the document.
+func open(t *testing.T, text string) (*Client, PublishDiagnosticsParams) {
+	t.Helper()
+	c := Connect(NewServer())
+	t.Cleanup(func() {
+		if err := c.Call("shutdown", nil, nil); err != nil {
+			t.Error(err)
+		}
+		if err := c.Notify("exit", nil); err != nil {
+			t.Error(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	var result InitializeResult
+	if err := c.Call("initialize", map[string]interface{}{}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ServerInfo.Name != ServerName {
+		t.Errorf("server name %q, want %q", result.ServerInfo.Name, ServerName)
+	}
+	item := TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text}
+	if err := c.Notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: item}); err != nil {
+		t.Fatal(err)
+	}
+	var diags PublishDiagnosticsParams
+	if err := c.Wait("textDocument/publishDiagnostics", &diags); err != nil {
+		t.Fatal(err)
+	}
+	return c, diags
+}
+
+// at returns the position in the text of the nth occurrence, from 0, of a
+// substring of it.
+func at(t *testing.T, text, sub string, nth int) Position {
+	t.Helper()
+	offset := -1
+	for n := 0; n <= nth; n++ {
+		next := strings.Index(text[offset+1:], sub)
+		if next < 0 {
+			t.Fatalf("no occurrence %d of %q", nth, sub)
+		}
+		offset += 1 + next
+	}
+	line := strings.Count(text[:offset], "\n")
+	return Position{Line: line, Character: offset - (strings.LastIndex(text[:offset], "\n") + 1)}
+}
+
+// position returns the parameters of a request about a position.
+func position(pos Position) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: pos}
+}
+
+func TestDiagnostics(t *testing.T) {
+	text := "let x = 1;\nputs(y);\n"
+	c, diags := open(t, text)
+	var codes []string
+	for _, d := range diags.Diagnostics {
+		codes = append(codes, d.Code)
+		if d.Source != "monkey" {
+			t.Errorf("diagnostic from %q", d.Source)
+		}
+	}
+	sort.Strings(codes)
+	if len(diags.Diagnostics) != 2 || codes[1] != "unused-let" {
+		t.Fatalf("got diagnostics %+v, want an undefined name and an unused let", diags.Diagnostics)
+	}
+	for _, d := range diags.Diagnostics {
+		want := at(t, text, "y", 0)
+		if d.Code == "unused-let" {
+			want = at(t, text, "x", 0)
+		}
+		if d.Range.Start != want {
+			t.Errorf("%s at %+v, want %+v", d.Message, d.Range.Start, want)
+		}
+	}
+
+	// Fixing the program clears the diagnostics.
+	change := DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Range: &Range{Start: at(t, text, "y", 0), End: at(t, text, ");", 0)}, Text: "x"}},
+	}
+	if err := c.Notify("textDocument/didChange", change); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait("textDocument/publishDiagnostics", &diags); err != nil {
+		t.Fatal(err)
+	}
+	if diags.Version != 2 || len(diags.Diagnostics) != 0 {
+		t.Errorf("got version %d diagnostics %+v, want none for version 2", diags.Version, diags.Diagnostics)
+	}
+
+	// Syntax errors are reported alone.
+	change = DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let = 1;"}},
+	}
+	if err := c.Notify("textDocument/didChange", change); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait("textDocument/publishDiagnostics", &diags); err != nil {
+		t.Fatal(err)
+	}
+	if len(diags.Diagnostics) == 0 || diags.Diagnostics[0].Severity != SeverityError {
+		t.Errorf("got diagnostics %+v, want a syntax error", diags.Diagnostics)
+	}
+}
+
+// program is the document of the tests of the requests about positions.
+const program = `let add = fn(a, b) { a + b };
+let total = add(1, 2);
+puts(total);
+`
+
+func TestHover(t *testing.T) {
+	c, _ := open(t, program)
+	tests := []struct {
+		pos  Position
+		want string
+	}{
+		{at(t, program, "add", 1), "let add: fn(a any, b any) any"},
+		{at(t, program, "a +", 0), "param a: any"},
+		{at(t, program, "total", 1), "let total: any"},
+		{at(t, program, "puts", 0), "builtin puts"},
+	}
+	for _, tt := range tests {
+		var hover Hover
+		if err := c.Call("textDocument/hover", position(tt.pos), &hover); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(hover.Contents.Value, tt.want) {
+			t.Errorf("hover at %+v: %q, want %q", tt.pos, hover.Contents.Value, tt.want)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c, _ := open(t, program)
+	var loc Location
+	if err := c.Call("textDocument/definition", position(at(t, program, "total", 1)), &loc); err != nil {
+		t.Fatal(err)
+	}
+	if want := at(t, program, "total", 0); loc.URI != uri || loc.Range.Start != want {
+		t.Errorf("definition at %s %+v, want %+v", loc.URI, loc.Range.Start, want)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	c, _ := open(t, program)
+	for _, declaration := range []bool{false, true} {
+		var p ReferenceParams
+		p.TextDocumentPositionParams = position(at(t, program, "a", 1))
+		p.Context.IncludeDeclaration = declaration
+		var locs []Location
+		if err := c.Call("textDocument/references", p, &locs); err != nil {
+			t.Fatal(err)
+		}
+		want := []Position{at(t, program, "a +", 0)}
+		if declaration {
+			want = append([]Position{at(t, program, "a,", 0)}, want...)
+		}
+		if len(locs) != len(want) {
+			t.Fatalf("got %d references, want %d", len(locs), len(want))
+		}
+		for n := range locs {
+			if locs[n].Range.Start != want[n] {
+				t.Errorf("reference %d at %+v, want %+v", n, locs[n].Range.Start, want[n])
+			}
+		}
+	}
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	c, _ := open(t, program)
+	var symbols []DocumentSymbol
+	if err := c.Call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 2 || symbols[0].Name != "add" || symbols[0].Kind != SymbolFunction || symbols[1].Name != "total" || symbols[1].Kind != SymbolVariable {
+		t.Fatalf("got symbols %+v", symbols)
+	}
+	if symbols[1].Range.Start.Line != 1 || symbols[1].SelectionRange.Start != at(t, program, "total", 0) {
+		t.Errorf("total at %+v, selection %+v", symbols[1].Range, symbols[1].SelectionRange)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	text := "let apple = 1;\nlet f = fn(avocado) { a };\n"
+	c, _ := open(t, text)
+	pos := at(t, text, "a }", 0)
+	pos.Character++
+	var list CompletionList
+	if err := c.Call("textDocument/completion", position(pos), &list); err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, item := range list.Items {
+		labels = append(labels, item.Label)
+	}
+	if got, want := strings.Join(labels, " "), "apple avocado"; got != want {
+		t.Errorf("completions %q, want %q", got, want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	c, _ := open(t, program)
+	var prepared PrepareRenameResult
+	if err := c.Call("textDocument/prepareRename", position(at(t, program, "add", 1)), &prepared); err != nil {
+		t.Fatal(err)
+	}
+	if prepared.Placeholder != "add" || prepared.Range.Start != at(t, program, "add", 1) {
+		t.Errorf("prepared %+v", prepared)
+	}
+
+	var edit WorkspaceEdit
+	p := RenameParams{TextDocumentPositionParams: position(at(t, program, "add", 0)), NewName: "sum"}
+	if err := c.Call("textDocument/rename", p, &edit); err != nil {
+		t.Fatal(err)
+	}
+	edits := edit.Changes[uri]
+	if len(edits) != 2 {
+		t.Fatalf("got edits %+v, want the declaration and the use", edits)
+	}
+	for n, e := range edits {
+		if e.NewText != "sum" || e.Range.Start != at(t, program, "add", n) {
+			t.Errorf("edit %d: %+v", n, e)
+		}
+	}
+
+	p.NewName = "let"
+	if err := c.Call("textDocument/rename", p, &edit); err == nil {
+		t.Error("renamed to a keyword")
+	}
+}
+
+func TestRenameConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		from   string // The identifier renamed, at its first occurrence.
+		to     string
+		reject bool
+	}{
+		{"captured by the parameter", "let y = 10;\nlet f = fn(x) { y };\nputs(f(1));\n", "x", "y", true},
+		{"captured by a used parameter", "let y = 10;\nlet f = fn(x) { y + x };\nputs(f(1));\n", "x", "y", true},
+		{"captured by an unused let", "let y = 10;\nlet f = fn() { let x = 1; y };\nputs(f());\n", "x", "y", true},
+		{"capturing its uses", "let y = 10;\nlet f = fn(x) { let y = 2; x + y };\nputs(f(1));\n", "x", "y", true},
+		{"capture of a top-level use", "let x = 1;\nlet y = 2;\nputs(y);\nputs(x);\n", "x", "y", true},
+		{"shadowing nothing", "let x = 1;\nlet f = fn() { let y = 2; y };\nputs(x + f());\n", "x", "y", false},
+		{"parameter hidden by a let", "let f = fn(x) { let y = 2; y };\nputs(f(1));\n", "x", "y", false},
+		{"other function", "let f = fn(x) { x };\nlet g = fn(y) { y };\nputs(f(1) + g(2));\n", "x", "y", false},
+	}
+	for _, tt := range tests {
+		c, _ := open(t, tt.text)
+		var edit WorkspaceEdit
+		err := c.Call("textDocument/rename", RenameParams{TextDocumentPositionParams: position(at(t, tt.text, tt.from, 0)), NewName: tt.to}, &edit)
+		if tt.reject && err == nil {
+			t.Errorf("%s: renamed %s to %s: %+v", tt.name, tt.from, tt.to, edit.Changes[uri])
+		}
+		if !tt.reject && err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
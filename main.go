@@ -1,145 +1,856 @@
-package compiler
+package main
 
 import (
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-)
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 
-package main
+	"github.com/user/golang-interpreter/analysis"
+	"github.com/user/golang-interpreter/backend"
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/cgen"
+	"github.com/user/golang-interpreter/diagnostic"
+	"github.com/user/golang-interpreter/difftest"
+	"github.com/user/golang-interpreter/evaluator"
+	"github.com/user/golang-interpreter/format"
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/llvm"
+	"github.com/user/golang-interpreter/lsp"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+	"github.com/user/golang-interpreter/repl"
+	"github.com/user/golang-interpreter/vm"
+	"github.com/user/golang-interpreter/wasm"
+)
 
-import (
-"flag"
-"fmt"
-"io/ioutil"
-"os"
+// The exit statuses of monkey. Errors in the program or on the command line
+// are the user's to fix; an internal error is a bug in the compiler.
+const (
+	exitOK       = 0 // Success.
+	exitError    = 1 // The program has errors, or failed when run.
+	exitUsage    = 2 // The command line is invalid.
+	exitInternal = 3 // The compiler failed on a program it accepted.
 )
 
+// command represents a subcommand of monkey.
+type command struct {
+	name string                  // The name of the command.
+	help string                  // What the command does.
+	run  func(args []string) int // Runs the command and returns the exit status.
+}
+
+// commands lists the subcommands of monkey. It is filled in by init, since
+// the usage of the commands refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"build", "compile the program", build},
+		{"run", "interpret the program", run},
+		{"check", "report the errors and warnings of the program", check},
+		{"fmt", "print the programs in canonical form", formatFiles},
+		{"repl", "read, evaluate and print inputs interactively", startREPL},
+		{"dump", "print a stage of the compilation of the program", dump},
+		{"opt", "optimize a module of textual intermediate representation", optimizeIR},
+		{"difftest", "check that every way of executing the programs agrees", diffTest},
+		{"lsp", "serve the Language Server Protocol on the standard input and output", serveLSP},
+	}
+}
+
 func main() {
-	// Define command-line flags
-	infile := flag.String("in", "", "input source file")
-	outfile := flag.String("out", "", "output file")
+	// A panic is a bug in the compiler rather than in the program
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "internal compiler error: %v\n%s", r, debug.Stack())
+			os.Exit(exitInternal)
+		}
+	}()
 
-	// Parse command-line flags
-	flag.Parse()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	switch os.Args[1] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(exitUsage)
+}
 
-	// Validate command-line flags
-	if *infile == "" {
-		fmt.Fprintln(os.Stderr, "Error: no input file specified")
-		os.Exit(1)
+// usage prints the commands of monkey.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: monkey command [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", c.name, c.help)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "A file named - is the standard input. Run monkey command -h for the flags of a command.")
+}
 
-	if *outfile == "" {
-		fmt.Fprintln(os.Stderr, "Error: no output file specified")
-		os.Exit(1)
+// newFlagSet returns the flag set of a command, whose errors are returned
+// rather than exiting.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: monkey %s %s\n", name, args)
+		fs.PrintDefaults()
 	}
+	return fs
+}
+
+// parseFlags parses the arguments of a command, which must leave between min
+// and max arguments, or any number if max is negative. It returns the
+// arguments, or false with the exit status if they are invalid.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) ([]string, int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, exitOK, false
+		}
+		return nil, exitUsage, false
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return nil, exitUsage, false
+	}
+	return fs.Args(), exitOK, true
+}
 
-	// Read input source code from file
-	input, err := ioutil.ReadFile(*infile)
+// frontendFlags represents the flags of the commands reading a program.
+type frontendFlags struct {
+	diagnostics *string // The format of the diagnostics.
+	nowarn      *string // The codes of the warnings not to report.
+}
+
+// addFrontendFlags defines the flags of the commands reading a program.
+func addFrontendFlags(fs *flag.FlagSet) *frontendFlags {
+	return &frontendFlags{
+		diagnostics: fs.String("diagnostics", diagnostic.FormatText, "format of errors and warnings (text or json)"),
+		nowarn:      fs.String("nowarn", "", "comma-separated warning codes to suppress (unused-let, unreachable)"),
+	}
+}
+
+// compileFlags represents the flags of the commands compiling a program.
+type compileFlags struct {
+	optLevel        *int    // The optimization level.
+	inlineThreshold *int    // The largest cost of an inlined function.
+	remarks         *string // The codes of the optimization remarks to report.
+	target          *string // The name of the target machine.
+	regalloc        *string // The name of the register allocator.
+}
+
+// addCompileFlags defines the flags of the commands compiling a program.
+func addCompileFlags(fs *flag.FlagSet) *compileFlags {
+	return &compileFlags{
+		optLevel:        fs.Int("O", 1, "optimization level (0, 1 or 2)"),
+		inlineThreshold: fs.Int("inline-threshold", intermediate.DefaultInlineThreshold, "largest cost of a function that is inlined"),
+		remarks:         fs.String("remarks", "", "comma-separated optimization remarks to report (inline)"),
+		target:          fs.String("target", backend.DefaultTarget.Name(), "target machine (x86_64-linux, aarch64-linux, wasm or c)"),
+		regalloc:        fs.String("regalloc", "", "register allocator (naive, linear or color); color at -O2, linear otherwise"),
+	}
+}
+
+// checkOptLevel returns an error if the optimization level is not one of the
+// levels of the passes.
+func checkOptLevel(level int) error {
+	if level < 0 || level > 2 {
+		return fmt.Errorf("invalid optimization level %d, want 0, 1 or 2", level)
+	}
+	return nil
+}
+
+// check returns an error if the flags ask for an unknown optimization level
+// or target, or for an output format the target cannot emit.
+func (c *compileFlags) check(format string) error {
+	if err := checkOptLevel(*c.optLevel); err != nil {
+		return err
+	}
+	var formats []string
+	switch *c.target {
+	case wasm.TargetName:
+		formats = []string{backend.EmitAsm, wasm.EmitWat, wasm.EmitWasm}
+	case cgen.TargetName:
+		formats = []string{backend.EmitAsm, cgen.TargetName}
+	default:
+		machine, ok := backend.Targets[*c.target]
+		if !ok {
+			return fmt.Errorf("unknown target %q", *c.target)
+		}
+		formats = backend.Formats(machine)
+	}
+	// LLVM IR is written whatever the target
+	if format == "" || format == llvm.EmitName {
+		return nil
+	}
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("target %s cannot emit %s files, only %s", *c.target, format, strings.Join(formats, ", "))
+}
+
+// input represents a program read by a command.
+type input struct {
+	name    string          // The name of the file in diagnostics.
+	source  string          // The source of the program.
+	program *parser.Program // The parsed program.
+}
+
+// read returns the source in the file, or the standard input for "-", and
+// the name of the file in diagnostics.
+func read(file string) (string, string, error) {
+	if file == "-" {
+		source, err := ioutil.ReadAll(os.Stdin)
+		return "<stdin>", string(source), err
+	}
+	source, err := ioutil.ReadFile(file)
+	return file, string(source), err
+}
+
+// report writes the diagnostics about a file to the standard error in the
+// format of the flags.
+func (f *frontendFlags) report(name string, diags []diagnostic.Diagnostic) {
+	for _, d := range diags {
+		diagnostic.Write(os.Stderr, *f.diagnostics, name, d)
+	}
+}
+
+// load reads and parses the program in the file and reports its syntax
+// errors. It returns the program, or false with the exit status if it has
+// errors.
+func (f *frontendFlags) load(file string) (*input, int, bool) {
+	name, source, err := read(file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading input file: %s\n", err)
-		os.Exit(1)
+		return nil, exitError, false
 	}
+	return f.parse(name, source)
+}
 
-	// Invoke lexer
-	tokens, err := lex(string(input))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error lexing input: %s\n", err)
-		os.Exit(1)
+// parse parses the source of the file named name in diagnostics, like load.
+func (f *frontendFlags) parse(name, source string) (*input, int, bool) {
+	if *f.diagnostics != diagnostic.FormatText && *f.diagnostics != diagnostic.FormatJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown diagnostics format %q\n", *f.diagnostics)
+		return nil, exitUsage, false
 	}
 
-	// Invoke parser
-	ast, err := parse(tokens)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing input: %s\n", err)
-		os.Exit(1)
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, msg := range errs {
+			f.report(name, []diagnostic.Diagnostic{diagnostic.FromError(msg)})
+		}
+		return nil, exitError, false
 	}
+	return &input{name: name, source: source, program: program}, exitOK, true
+}
 
-	// Invoke intermediate code generator
-	intermediate, err := generateIntermediateCode(ast)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating intermediate code: %s\n", err)
-		os.Exit(1)
+// warn reports the warnings about the program that the flags do not
+// suppress.
+func (f *frontendFlags) warn(in *input) {
+	suppressed := make(map[string]bool)
+	for _, code := range strings.Split(*f.nowarn, ",") {
+		suppressed[strings.TrimSpace(code)] = true
 	}
+	f.report(in.name, diagnostic.Filter(analysis.Unused(in.program), suppressed))
+}
 
-	// Invoke backend code generator
-	machineCode, err := generateMachineCode(intermediate)
+// lower translates the program to the intermediate representation optimized
+// as the flags say, reporting the remarks asked for. It returns the module,
+// or false with the exit status if the program cannot be compiled.
+func (c *compileFlags) lower(in *input, f *frontendFlags) (*intermediate.Module, int, bool) {
+	opts := intermediate.Options{Level: *c.optLevel, InlineThreshold: *c.inlineThreshold}
+	if *c.remarks != "" {
+		enabled := make(map[string]bool)
+		for _, code := range strings.Split(*c.remarks, ",") {
+			enabled[strings.TrimSpace(code)] = true
+		}
+		opts.Remark = func(d diagnostic.Diagnostic) {
+			if enabled[d.Code] {
+				f.report(in.name, []diagnostic.Diagnostic{d})
+			}
+		}
+	}
+	module, err := generateIntermediateCode(in.program, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating machine code: %s\n", err)
-		os.Exit(1)
+		f.report(in.name, []diagnostic.Diagnostic{diagnostic.FromError(err.Error())})
+		return nil, exitError, false
 	}
+	return module, exitOK, true
+}
 
-	// Write machine code to output file
-	err = ioutil.WriteFile(*outfile, []byte(machineCode), 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output file: %s\n", err)
-		os.Exit(1)
+// backendOptions returns the options of the machine code generator for the
+// flags, or false if they name an unknown target or register allocator.
+func (c *compileFlags) backendOptions(emit string) (backend.Options, bool) {
+	regalloc := *c.regalloc
+	if regalloc == "" {
+		regalloc = "linear"
+		if *c.optLevel >= 2 {
+			regalloc = "color"
+		}
+	}
+	allocator, ok := backend.Allocators[regalloc]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown register allocator %q\n", regalloc)
+		return backend.Options{}, false
+	}
+	machine, ok := backend.Targets[*c.target]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown target %q\n", *c.target)
+		return backend.Options{}, false
+	}
+	return backend.Options{Target: machine, Allocator: allocator, Emit: emit}, true
+}
+
+// The stages of the compilation that -emit prints, in the order they are
+// reached.
+const (
+	stageTokens = "tokens" // The tokens with their positions.
+	stageAST    = "ast"    // The syntax tree as an S-expression.
+	stageIR     = "ir"     // The optimized intermediate representation.
+	stageAsm    = "asm"    // The assembly, unless written to -out.
+)
+
+// outputFormats is the set of the output formats of the code generators.
+var outputFormats = map[string]bool{
+	backend.EmitAsm: true,
+	backend.EmitObj: true,
+	backend.EmitExe: true,
+	wasm.EmitWat:    true,
+	wasm.EmitWasm:   true,
+	cgen.TargetName: true,
+	llvm.EmitName:   true,
+}
+
+// emission represents what -emit asks build for.
+type emission struct {
+	stages map[string]bool // The stages to print.
+	format string          // The output format written to -out, or "" for none.
+}
+
+// parseEmit splits the value of -emit into the stages to print and the output
+// format. The asm stage is the output format if there is an output file.
+func parseEmit(value string, outfile string) (emission, error) {
+	e := emission{stages: make(map[string]bool)}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == stageTokens || name == stageAST || name == stageIR || (name == stageAsm && outfile == ""):
+			e.stages[name] = true
+		case !outputFormats[name]:
+			return e, fmt.Errorf("unknown stage or output format %q", name)
+		case e.format != "":
+			return e, fmt.Errorf("more than one output format: %s and %s", e.format, name)
+		default:
+			e.format = name
+		}
+	}
+	if e.format != "" && outfile == "" {
+		return e, fmt.Errorf("no output file specified for %s", e.format)
+	}
+	return e, nil
+}
+
+// printStage prints the text of a stage on the standard output, under a
+// header if several stages are printed.
+func (e emission) printStage(stage, text string) {
+	if !e.stages[stage] {
+		return
 	}
+	if len(e.stages) > 1 {
+		fmt.Printf("==> %s <==\n", stage)
+	}
+	fmt.Print(text)
+	if len(e.stages) > 1 && stage != stageAsm {
+		fmt.Println()
+	}
+}
 
-	fmt.Println("Compilation successful")
+// tokens returns the tokens of the source, one per line with its position.
+func tokens(source string) string {
+	var b strings.Builder
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		fmt.Fprintf(&b, "%d:%d\t%v\t%q\n", tok.Pos.Line, tok.Pos.Column, tok.Type, tok.Literal)
+	}
+	return b.String()
 }
 
-func lex(input string) ([]Token, error) {
-	var tokens []Token
-	var currentToken Token
+// build compiles the program named by the arguments to the output file, and
+// prints the stages of the compilation -emit asks for.
+func build(args []string) int {
+	fs := newFlagSet("build", "[flags] file")
+	ff := addFrontendFlags(fs)
+	cf := addCompileFlags(fs)
+	outfile := fs.String("out", "", "output file")
+	emitFlag := fs.String("emit", backend.EmitAsm, "comma-separated stages to print (tokens, ast, ir, asm) and output format written to -out (asm, obj or exe; wat or wasm for the wasm target; llvm for LLVM IR, read by LLVM 15 or later)")
+	files, status, ok := parseFlags(fs, args, 1, 1)
+	if !ok {
+		return status
+	}
+	emit, err := parseEmit(*emitFlag, *outfile)
+	if err == nil {
+		err = cf.check(emit.format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsage
+	}
+
+	name, source, err := read(files[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input file: %s\n", err)
+		return exitError
+	}
+
+	// The tokens are printed even for a program that does not parse
+	emit.printStage(stageTokens, tokens(source))
+	if len(emit.stages) == 1 && emit.stages[stageTokens] && emit.format == "" {
+		return exitOK
+	}
 
-	// Initialize the state machine
-	state := initialState
+	in, status, ok := ff.parse(name, source)
+	if !ok {
+		return status
+	}
+	ff.warn(in)
+	emit.printStage(stageAST, parser.Dump(in.program))
+	if !emit.stages[stageIR] && !emit.stages[stageAsm] && emit.format == "" {
+		return exitOK
+	}
 
-	// Loop over each character in the input string
-	for i := 0; i < len(input); i++ {
-		character := input[i]
+	module, status, ok := cf.lower(in, ff)
+	if !ok {
+		return status
+	}
+	if emit.stages[stageIR] {
+		g := intermediate.NewCodeGenerator()
+		g.Renumber = true
+		g.GenerateModule(module)
+		emit.printStage(stageIR, g.GetCode())
+	}
+	if emit.stages[stageAsm] {
+		opts, ok := cf.backendOptions(backend.EmitAsm)
+		if !ok {
+			return exitUsage
+		}
+		assembly, err := backend.GenerateAssembly(module, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating machine code: %s\n", err)
+			return exitInternal
+		}
+		emit.printStage(stageAsm, assembly)
+	}
+	if emit.format == "" {
+		return exitOK
+	}
 
-		// Check if the current state is a final state
-		if isFinalState(state) {
-			// If it is, append the current token to the slice of tokens
-			tokens = append(tokens, currentToken)
+	// LLVM IR is translated from the intermediate representation whatever
+	// the target, since LLVM generates the machine code
+	if emit.format == llvm.EmitName {
+		if err := llvm.GenerateCode(module, *outfile, in.name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating LLVM IR: %s\n", err)
+			return exitInternal
+		}
+		fmt.Fprintln(os.Stderr, "Compilation successful")
+		return exitOK
+	}
 
-			// Reset the current token and state
-			currentToken = Token{}
-			state = initialState
+	// WebAssembly and C have code generators of their own, since neither
+	// needs registers allocated
+	switch *cf.target {
+	case wasm.TargetName:
+		if err := wasm.GenerateCode(module, *outfile, emit.format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating WebAssembly: %s\n", err)
+			return exitInternal
+		}
+		fmt.Fprintln(os.Stderr, "Compilation successful")
+		return exitOK
+	case cgen.TargetName:
+		if err := cgen.GenerateCode(module, *outfile, emit.format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating C: %s\n", err)
+			return exitInternal
 		}
+		fmt.Fprintln(os.Stderr, "Compilation successful")
+		return exitOK
+	}
+
+	// Invoke backend code generator and write the code to the output file
+	opts, ok := cf.backendOptions(emit.format)
+	if !ok {
+		return exitUsage
+	}
+	if err := backend.GenerateCode(module, *outfile, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating machine code: %s\n", err)
+		return exitInternal
+	}
+
+	fmt.Fprintln(os.Stderr, "Compilation successful")
+	return exitOK
+}
+
+// run interprets the program named by the arguments with the evaluator or the
+// virtual machine.
+func run(args []string) int {
+	fs := newFlagSet("run", "[flags] file")
+	ff := addFrontendFlags(fs)
+	backendName := fs.String("backend", evaluator.BackendName, "interpreter (evaluator walks the syntax tree, vm runs bytecode)")
+	files, status, ok := parseFlags(fs, args, 1, 1)
+	if !ok {
+		return status
+	}
+	if *backendName != evaluator.BackendName && *backendName != vm.BackendName {
+		fmt.Fprintf(os.Stderr, "Error: unknown backend %q\n", *backendName)
+		return exitUsage
+	}
 
-		// Look up the next state based on the current state and input character
-		nextState, tokenType := nextState(state, character)
+	in, status, ok := ff.load(files[0])
+	if !ok {
+		return status
+	}
+	ff.warn(in)
 
-		// If the next state is invalid, return an error
-		if nextState == invalidState {
-			return []Token{{Error, "Invalid character: " + string(character)}}
+	// The virtual machine runs the program compiled to bytecode
+	if *backendName == vm.BackendName {
+		compiler := bytecode.New()
+		if err := compiler.Compile(in.program); err != nil {
+			ff.report(in.name, []diagnostic.Diagnostic{diagnostic.FromError(err.Error())})
+			return exitError
+		}
+		if err := vm.New(compiler.Bytecode(), os.Stdout).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running program: %s\n", err)
+			return exitError
 		}
+		return exitOK
+	}
+
+	result := evaluator.Eval(in.program, evaluator.NewEnvironment(os.Stdout))
+	if rerr, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "Error running program: %s\n", rerr.Message)
+		return exitError
+	}
+	return exitOK
+}
+
+// check reports the errors and warnings of the program named by the
+// arguments without compiling it.
+func check(args []string) int {
+	fs := newFlagSet("check", "[flags] file")
+	ff := addFrontendFlags(fs)
+	files, status, ok := parseFlags(fs, args, 1, 1)
+	if !ok {
+		return status
+	}
+
+	in, status, ok := ff.load(files[0])
+	if !ok {
+		return status
+	}
+	ff.warn(in)
+	if errs := analysis.Undefined(in.program); len(errs) > 0 {
+		ff.report(in.name, errs)
+		return exitError
+	}
+	return exitOK
+}
+
+// formatFiles prints the programs named by the arguments in canonical form,
+// or rewrites their files. With -check or -diff it returns 1 if any program
+// is not in canonical form, for continuous integration.
+func formatFiles(args []string) int {
+	fs := newFlagSet("fmt", "[flags] file...")
+	ff := addFrontendFlags(fs)
+	write := fs.Bool("w", false, "write the result to the file instead of the standard output")
+	check := fs.Bool("check", false, "list the files that are not formatted instead of printing them")
+	showDiff := fs.Bool("diff", false, "print the changes formatting makes instead of the result")
+	files, status, ok := parseFlags(fs, args, 1, -1)
+	if !ok {
+		return status
+	}
 
-		// If the next state is a final state, update the current token type and value
-		if isFinalState(nextState) {
-			currentToken.Type = tokenType
-			currentToken.Value += string(character)
-		} else {
-			// Otherwise, append the current character to the current token value
-			currentToken.Value += string(character)
+	status = exitOK
+	for _, file := range files {
+		in, s, ok := ff.load(file)
+		if !ok {
+			status = s
+			continue
 		}
+		formatted, err := format.File(in.program, in.source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting %s: %s\n", in.name, err)
+			status = exitInternal
+			continue
+		}
+		changed := formatted != in.source
+		if *check && changed {
+			fmt.Println(in.name)
+		}
+		if *showDiff && changed {
+			fmt.Printf("--- %s.orig\n+++ %s\n%s", in.name, in.name, format.Diff(in.source, formatted))
+		}
+		if (*check || *showDiff) && changed && status == exitOK {
+			status = exitError
+		}
+		if !*write || file == "-" {
+			if !*check && !*showDiff {
+				fmt.Print(formatted)
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := ioutil.WriteFile(file, []byte(formatted), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output file: %s\n", err)
+			status = exitError
+		}
+	}
+	return status
+}
 
-		// Update the current state to the next state
-		state = nextState
+// startREPL runs the interactive loop on the standard input and output.
+func startREPL(args []string) int {
+	fs := newFlagSet("repl", "")
+	if _, status, ok := parseFlags(fs, args, 0, 0); !ok {
+		return status
 	}
+	repl.Start(os.Stdin, os.Stdout)
+	return exitOK
+}
 
-	// If the final state is a valid final state, append the current token to the slice of tokens
-	if isFinalState(state) && state != initialState {
-		tokens = append(tokens, currentToken)
+// serveLSP runs the language server on the standard input and output until
+// the editor stops it.
+func serveLSP(args []string) int {
+	fs := newFlagSet("lsp", "")
+	if _, status, ok := parseFlags(fs, args, 0, 0); !ok {
+		return status
+	}
+	if err := lsp.NewServer().Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitError
 	}
+	return exitOK
+}
 
-	return tokens
-	// Implementation of lexer goes here
+// dump prints a stage of the compilation of the program named by the
+// arguments, like build with -emit set to the stage.
+func dump(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: monkey dump tokens|ast|ir|asm [flags] file")
+		return exitUsage
+	}
+	switch args[0] {
+	case stageTokens, stageAST, stageIR, stageAsm:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown stage %q\n", args[0])
+		return exitUsage
+	}
+	return build(append([]string{"-emit=" + args[0]}, args[1:]...))
+}
+
+// optimizeIR reads the module of textual intermediate representation named
+// by the arguments, runs the optimization passes of a level or the passes
+// named, and prints the result.
+func optimizeIR(args []string) int {
+	fs := newFlagSet("opt", "[flags] file.ir")
+	optLevel := fs.Int("O", 1, "optimization level (0, 1 or 2)")
+	passNames := fs.String("passes", "", "comma-separated passes to run instead of those of the level ("+strings.Join(intermediate.PassNames, ", ")+")")
+	inlineThreshold := fs.Int("inline-threshold", intermediate.DefaultInlineThreshold, "largest cost of a function that is inlined")
+	outfile := fs.String("out", "", "output file; the standard output if empty")
+	files, status, ok := parseFlags(fs, args, 1, 1)
+	if !ok {
+		return status
+	}
+	if err := checkOptLevel(*optLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsage
+	}
+
+	opts := intermediate.Options{Level: *optLevel, InlineThreshold: *inlineThreshold}
+	passes := intermediate.Passes(opts)
+	if *passNames != "" {
+		passes = nil
+		for _, name := range strings.Split(*passNames, ",") {
+			pass, ok := intermediate.PassNamed(strings.TrimSpace(name), opts)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Error: unknown pass %q\n", name)
+				return exitUsage
+			}
+			passes = append(passes, pass)
+		}
+	}
+
+	name, source, err := read(files[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input file: %s\n", err)
+		return exitError
+	}
+	module, err := intermediate.ParseModule(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", name, err)
+		return exitError
+	}
+	if err := intermediate.VerifyModule(module); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid IR: %s\n", name, err)
+		return exitError
+	}
+	intermediate.Optimize(module, passes)
+
+	g := intermediate.NewCodeGenerator()
+	g.Renumber = true
+	g.GenerateModule(module)
+	if *outfile == "" {
+		fmt.Print(g.GetCode())
+		return exitOK
+	}
+	if err := ioutil.WriteFile(*outfile, []byte(g.GetCode()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output file: %s\n", err)
+		return exitError
+	}
+	return exitOK
 }
 
-func parse(tokens []Token) (*AST, error) {
-	// Implementation of parser goes here
+// diffTest runs the programs named by the arguments, or the .mk files in the
+// directories named, through every execution path and reports those on which
+// the paths disagree. With -passes it instead interprets the intermediate
+// representation of the programs after every optimization pass and reports
+// the passes that change their behaviour. It returns 1 if there is any.
+func diffTest(args []string) int {
+	fs := newFlagSet("difftest", "[flags] file-or-directory...")
+	checkPasses := fs.Bool("passes", false, "check that every optimization pass preserves the behaviour of the intermediate representation")
+	optLevel := fs.Int("O", 2, "optimization level of the passes checked with -passes (0, 1 or 2)")
+	inlineThreshold := fs.Int("inline-threshold", intermediate.DefaultInlineThreshold, "largest cost of a function that is inlined")
+	args, status, ok := parseFlags(fs, args, 1, -1)
+	if !ok {
+		return status
+	}
+	if err := checkOptLevel(*optLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsage
+	}
+
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitError
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(arg, "*.mk"))
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no programs to test")
+		return exitUsage
+	}
+	if *checkPasses {
+		return diffTestPasses(files, intermediate.Options{Level: *optLevel, InlineThreshold: *inlineThreshold})
+	}
+
+	dir, err := ioutil.TempDir("", "monkey-difftest")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitError
+	}
+	defer os.RemoveAll(dir)
+	paths := difftest.Paths(dir)
+	var names []string
+	for _, p := range paths {
+		names = append(names, p.Name)
+	}
+	fmt.Printf("Execution paths: %s\n", strings.Join(names, ", "))
+
+	failed := 0
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input file: %s\n", err)
+			return exitError
+		}
+		m, err := difftest.Check(string(input), paths)
+		switch {
+		case err != nil:
+			fmt.Printf("FAIL %s: %s\n", file, err)
+			failed++
+		case m != nil:
+			fmt.Printf("FAIL %s: %s", file, m)
+			failed++
+		default:
+			fmt.Printf("ok   %s\n", file)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d programs disagree or cannot be executed\n", failed, len(files))
+		return exitError
+	}
+	return exitOK
 }
 
-func generateIntermediateCode(ast *AST) ([]IntermediateCodeNode, error) {
-	// Implementation of intermediate code generator goes here
+// diffTestPasses checks that the optimization passes of the options preserve
+// the behaviour of the programs, and returns 1 if any does not.
+func diffTestPasses(files []string, opts intermediate.Options) int {
+	fmt.Printf("Passes: %s\n", passList(intermediate.Passes(opts)))
+	failed := 0
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input file: %s\n", err)
+			return exitError
+		}
+		m, err := difftest.CheckPasses(string(input), opts)
+		switch {
+		case err != nil:
+			fmt.Printf("skip %s: %s\n", file, err)
+		case m != nil:
+			fmt.Printf("FAIL %s: %s", file, m)
+			failed++
+		default:
+			fmt.Printf("ok   %s\n", file)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d programs change behaviour\n", failed, len(files))
+		return exitError
+	}
+	return exitOK
 }
 
-func generateMachineCode(intermediate []IntermediateCodeNode) (string, error) {
-	// Implementation of backend code generator goes here
+// passList returns the names of the passes, separated by commas.
+func passList(passes []intermediate.Pass) string {
+	var names []string
+	for _, p := range passes {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
 }
 
+func generateIntermediateCode(ast *parser.Program, opts intermediate.Options) (*intermediate.Module, error) {
+	module, err := intermediate.Lower(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run the optimization passes for the requested level
+	intermediate.Optimize(module, intermediate.Passes(opts))
+
+	return module, nil
+}
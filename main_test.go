@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// quietly runs a command with its output discarded and returns its exit
+// status.
+func quietly(t *testing.T, cmd func([]string) int, args ...string) int {
+	t.Helper()
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = null, null
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	return cmd(args)
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	programs := map[string]string{
+		"ok.mk":     "let f = fn(x) { x * 2 }; puts(f(21));",
+		"syntax.mk": "let = 1;",
+		"fails.mk":  "puts(1 / 0);",
+		"string.mk": `puts("a");`,
+	}
+	for name, source := range programs {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ok := filepath.Join(dir, "ok.mk")
+	out := filepath.Join(dir, "out")
+
+	tests := []struct {
+		name string
+		cmd  func([]string) int
+		args []string
+		want int
+	}{
+		{"build", build, []string{"-out", out, ok}, exitOK},
+		{"build the IR at -O2", build, []string{"-O", "2", "-emit=ir", ok}, exitOK},
+		{"build wasm", build, []string{"-target=wasm", "-emit=wat", "-out", out, ok}, exitOK},
+		{"build C", build, []string{"-target=c", "-emit=c", "-out", filepath.Join(dir, "out.c"), ok}, exitOK},
+		{"build LLVM IR for another target", build, []string{"-target=aarch64-linux", "-emit=llvm", "-out", out, ok}, exitOK},
+		{"build a syntax error", build, []string{filepath.Join(dir, "syntax.mk")}, exitError},
+		{"build an unsupported program", build, []string{filepath.Join(dir, "string.mk")}, exitError},
+		{"build a missing file", build, []string{filepath.Join(dir, "missing.mk")}, exitError},
+		{"build no file", build, nil, exitUsage},
+		{"build -O 9", build, []string{"-O", "9", ok}, exitUsage},
+		{"build -O -1", build, []string{"-O", "-1", ok}, exitUsage},
+		{"build an unknown target", build, []string{"-target=pdp11", ok}, exitUsage},
+		{"build an unknown allocator", build, []string{"-regalloc=best", ok}, exitUsage},
+		{"build an executable for wasm", build, []string{"-target=wasm", "-emit=exe", "-out", out, ok}, exitUsage},
+		{"build an executable for aarch64", build, []string{"-target=aarch64-linux", "-emit=exe", "-out", out, ok}, exitUsage},
+		{"build wasm for x86-64", build, []string{"-emit=wasm", "-out", out, ok}, exitUsage},
+		{"build an object for C", build, []string{"-target=c", "-emit=obj", "-out", out, ok}, exitUsage},
+		{"build an unknown format", build, []string{"-emit=pdf", "-out", out, ok}, exitUsage},
+		{"build two formats", build, []string{"-emit=obj,exe", "-out", out, ok}, exitUsage},
+		{"build a format without a file", build, []string{"-emit=exe", ok}, exitUsage},
+		{"run", run, []string{ok}, exitOK},
+		{"run on the vm", run, []string{"-backend=vm", ok}, exitOK},
+		{"run a failing program", run, []string{filepath.Join(dir, "fails.mk")}, exitError},
+		{"run a failing program on the vm", run, []string{"-backend=vm", filepath.Join(dir, "fails.mk")}, exitError},
+		{"run on an unknown backend", run, []string{"-backend=jit", ok}, exitUsage},
+		{"check", check, []string{ok}, exitOK},
+		{"check a syntax error", check, []string{filepath.Join(dir, "syntax.mk")}, exitError},
+		{"dump an unknown stage", dump, []string{"bytes", ok}, exitUsage},
+		{"opt -O 3", optimizeIR, []string{"-O", "3", ok}, exitUsage},
+		{"difftest -O 3", diffTest, []string{"-passes", "-O", "3", ok}, exitUsage},
+		{"unknown flag", build, []string{"-fast", ok}, exitUsage},
+		{"help", build, []string{"-h"}, exitOK},
+	}
+	for _, tt := range tests {
+		if got := quietly(t, tt.cmd, tt.args...); got != tt.want {
+			t.Errorf("%s: exit status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseEmit(t *testing.T) {
+	tests := []struct {
+		value   string
+		outfile string
+		stages  int
+		format  string
+		err     bool
+	}{
+		{"asm", "", 1, "", false},
+		{"asm", "a.s", 0, "asm", false},
+		{"tokens,ast, ir", "", 3, "", false},
+		{"ir,exe", "a.out", 1, "exe", false},
+		{"exe", "", 0, "", true},
+		{"obj,exe", "a.out", 0, "", true},
+		{"pdf", "a.out", 0, "", true},
+	}
+	for _, tt := range tests {
+		e, err := parseEmit(tt.value, tt.outfile)
+		if (err != nil) != tt.err {
+			t.Errorf("parseEmit(%q, %q): got error %v", tt.value, tt.outfile, err)
+			continue
+		}
+		if !tt.err && (len(e.stages) != tt.stages || e.format != tt.format) {
+			t.Errorf("parseEmit(%q, %q) = %v stages and format %q, want %d and %q", tt.value, tt.outfile, e.stages, e.format, tt.stages, tt.format)
+		}
+	}
+}
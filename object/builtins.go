@@ -0,0 +1,144 @@
+package object
+
+import (
+	"fmt"
+	"io"
+)
+
+// BuiltinFunction represents the implementation of a builtin function. Output
+// goes to out. A failure is reported by returning an *Error.
+type BuiltinFunction func(out io.Writer, args ...Object) Object
+
+// Builtin represents a builtin function.
+type Builtin struct {
+	Name string          // The name the function is called by.
+	Fn   BuiltinFunction // The implementation.
+}
+
+func (b *Builtin) Type() Type      { return BuiltinType }
+func (b *Builtin) Inspect() string { return "builtin " + b.Name }
+
+// Builtins lists the builtin functions. The bytecode refers to them by their
+// index, so new ones are added at the end.
+var Builtins = []*Builtin{
+	{Name: "len", Fn: builtinLen},
+	{Name: "puts", Fn: builtinPuts},
+	{Name: "first", Fn: builtinFirst},
+	{Name: "last", Fn: builtinLast},
+	{Name: "rest", Fn: builtinRest},
+	{Name: "push", Fn: builtinPush},
+}
+
+// LookupBuiltin returns the builtin function with the name, or nil if there
+// is none.
+func LookupBuiltin(name string) *Builtin {
+	for _, b := range Builtins {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// checkArgs returns an error if the number of arguments is not n.
+func checkArgs(name string, args []Object, n int) *Error {
+	if len(args) != n {
+		return Errorf("wrong number of arguments to %s: got %d, want %d", name, len(args), n)
+	}
+	return nil
+}
+
+// arrayArg returns the first argument as an array, or an error if it is not
+// one.
+func arrayArg(name string, args []Object) (*Array, *Error) {
+	a, ok := args[0].(*Array)
+	if !ok {
+		return nil, Errorf("argument to %s must be ARRAY, got %s", name, args[0].Type())
+	}
+	return a, nil
+}
+
+// builtinLen returns the length of a string in bytes or of an array.
+func builtinLen(out io.Writer, args ...Object) Object {
+	if err := checkArgs("len", args, 1); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(len(arg.Value))}
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	}
+	return Errorf("argument to len not supported, got %s", args[0].Type())
+}
+
+// builtinPuts prints each argument on a line of its own.
+func builtinPuts(out io.Writer, args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(out, arg.Inspect())
+	}
+	return NullValue
+}
+
+// builtinFirst returns the first element of an array, or null if it is empty.
+func builtinFirst(out io.Writer, args ...Object) Object {
+	if err := checkArgs("first", args, 1); err != nil {
+		return err
+	}
+	a, err := arrayArg("first", args)
+	if err != nil {
+		return err
+	}
+	if len(a.Elements) == 0 {
+		return NullValue
+	}
+	return a.Elements[0]
+}
+
+// builtinLast returns the last element of an array, or null if it is empty.
+func builtinLast(out io.Writer, args ...Object) Object {
+	if err := checkArgs("last", args, 1); err != nil {
+		return err
+	}
+	a, err := arrayArg("last", args)
+	if err != nil {
+		return err
+	}
+	if len(a.Elements) == 0 {
+		return NullValue
+	}
+	return a.Elements[len(a.Elements)-1]
+}
+
+// builtinRest returns a new array of all elements but the first, or null if
+// the array is empty.
+func builtinRest(out io.Writer, args ...Object) Object {
+	if err := checkArgs("rest", args, 1); err != nil {
+		return err
+	}
+	a, err := arrayArg("rest", args)
+	if err != nil {
+		return err
+	}
+	if len(a.Elements) == 0 {
+		return NullValue
+	}
+	rest := make([]Object, len(a.Elements)-1)
+	copy(rest, a.Elements[1:])
+	return &Array{Elements: rest}
+}
+
+// builtinPush returns a new array with the second argument appended.
+func builtinPush(out io.Writer, args ...Object) Object {
+	if err := checkArgs("push", args, 2); err != nil {
+		return err
+	}
+	a, err := arrayArg("push", args)
+	if err != nil {
+		return err
+	}
+	elements := make([]Object, len(a.Elements)+1)
+	copy(elements, a.Elements)
+	elements[len(a.Elements)] = args[1]
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,175 @@
+// Package object defines the values Monkey programs compute when they are
+// interpreted rather than compiled to machine code, along with the builtin
+// functions and the semantics of the operators on them.
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Type represents the type of a value.
+type Type string
+
+// The types of values.
+const (
+	IntegerType  Type = "INTEGER"
+	BooleanType  Type = "BOOLEAN"
+	StringType   Type = "STRING"
+	NullType     Type = "NULL"
+	ArrayType    Type = "ARRAY"
+	HashType     Type = "HASH"
+	BuiltinType  Type = "BUILTIN"
+	FunctionType Type = "FUNCTION"
+	ErrorType    Type = "ERROR"
+)
+
+// Object represents a value.
+type Object interface {
+	Type() Type      // The type of the value.
+	Inspect() string // The value as puts prints it.
+}
+
+// Integer represents a 64-bit signed integer.
+type Integer struct {
+	Value int64 // The value of the integer.
+}
+
+func (i *Integer) Type() Type      { return IntegerType }
+func (i *Integer) Inspect() string { return fmt.Sprint(i.Value) }
+
+// Boolean represents true or false. There is one value of each, True and
+// False, so booleans can be compared by identity.
+type Boolean struct {
+	Value bool // The value of the boolean.
+}
+
+func (b *Boolean) Type() Type      { return BooleanType }
+func (b *Boolean) Inspect() string { return fmt.Sprint(b.Value) }
+
+// String represents an immutable string.
+type String struct {
+	Value string // The contents of the string.
+}
+
+func (s *String) Type() Type      { return StringType }
+func (s *String) Inspect() string { return s.Value }
+
+// Null represents the absence of a value, produced by an if expression
+// without an else branch that is not taken, a missing hash key or a function
+// that returns nothing. There is one value, NullValue.
+type Null struct{}
+
+func (n *Null) Type() Type      { return NullType }
+func (n *Null) Inspect() string { return "null" }
+
+// Array represents an immutable sequence of values.
+type Array struct {
+	Elements []Object // The elements, in order.
+}
+
+func (a *Array) Type() Type { return ArrayType }
+func (a *Array) Inspect() string {
+	var elements []string
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey represents the identity of a value used as a hash key. Equal keys
+// have equal HashKeys.
+type HashKey struct {
+	Type  Type   // The type of the key.
+	Value uint64 // The value of the key, or a hash of it for strings.
+}
+
+// Hashable is implemented by the values that can be hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey { return HashKey{Type: IntegerType, Value: uint64(i.Value)} }
+
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: BooleanType, Value: 1}
+	}
+	return HashKey{Type: BooleanType}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: StringType, Value: h.Sum64()}
+}
+
+// HashPair represents an entry of a hash.
+type HashPair struct {
+	Key   Object // The key, as written in the hash literal.
+	Value Object // The value.
+}
+
+// Hash represents an immutable mapping from keys to values.
+type Hash struct {
+	Pairs map[HashKey]HashPair // The entries, by the identity of their key.
+}
+
+func (h *Hash) Type() Type { return HashType }
+
+// Inspect returns the entries sorted by key, so that printing a hash is
+// deterministic.
+func (h *Hash) Inspect() string {
+	var pairs []string
+	for _, p := range h.Pairs {
+		pairs = append(pairs, p.Key.Inspect()+": "+p.Value.Inspect())
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Error represents a runtime error, which ends the program.
+type Error struct {
+	Message string // The description of the error.
+}
+
+func (e *Error) Type() Type      { return ErrorType }
+func (e *Error) Inspect() string { return "error: " + e.Message }
+
+// Errorf returns an error with the formatted message.
+func Errorf(format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// The only values of the boolean and null types.
+var (
+	True      = &Boolean{Value: true}
+	False     = &Boolean{Value: false}
+	NullValue = &Null{}
+)
+
+// Bool returns the boolean value of b.
+func Bool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
+// Truthy returns true if the value counts as true in a condition. Like the
+// compiled code, false, null and the integer 0 are false and everything else
+// is true.
+func Truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	case *Integer:
+		return obj.Value != 0
+	}
+	return true
+}
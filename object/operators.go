@@ -0,0 +1,139 @@
+package object
+
+import "math"
+
+// Prefix returns the result of applying a prefix operator to a value, or an
+// *Error if the operator does not apply to it.
+func Prefix(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return Bool(!Truthy(right))
+	case "-":
+		if i, ok := right.(*Integer); ok {
+			return &Integer{Value: -i.Value}
+		}
+	}
+	return Errorf("unknown operator: %s%s", operator, right.Type())
+}
+
+// Infix returns the result of applying an infix operator to two values, or an
+// *Error if the operator does not apply to them. Integer arithmetic wraps
+// around like the compiled code, and dividing by zero or the most negative
+// integer by -1 is an error like the trap of the native targets. Values of
+// different types are never equal.
+func Infix(operator string, left, right Object) Object {
+	switch {
+	case left.Type() == IntegerType && right.Type() == IntegerType:
+		return integerInfix(operator, left.(*Integer).Value, right.(*Integer).Value)
+	case left.Type() == StringType && right.Type() == StringType:
+		return stringInfix(operator, left.(*String).Value, right.(*String).Value)
+	case operator == "==":
+		return Bool(Equal(left, right))
+	case operator == "!=":
+		return Bool(!Equal(left, right))
+	case left.Type() != right.Type():
+		return Errorf("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// integerInfix applies an infix operator to two integers.
+func integerInfix(operator string, left, right int64) Object {
+	switch operator {
+	case "+":
+		return &Integer{Value: left + right}
+	case "-":
+		return &Integer{Value: left - right}
+	case "*":
+		return &Integer{Value: left * right}
+	case "/":
+		if right == 0 {
+			return Errorf("division by zero")
+		}
+		if left == math.MinInt64 && right == -1 {
+			return Errorf("integer overflow in division")
+		}
+		return &Integer{Value: left / right}
+	case "<":
+		return Bool(left < right)
+	case ">":
+		return Bool(left > right)
+	case "==":
+		return Bool(left == right)
+	case "!=":
+		return Bool(left != right)
+	}
+	return Errorf("unknown operator: %s %s %s", IntegerType, operator, IntegerType)
+}
+
+// stringInfix applies an infix operator to two strings.
+func stringInfix(operator string, left, right string) Object {
+	switch operator {
+	case "+":
+		return &String{Value: left + right}
+	case "==":
+		return Bool(left == right)
+	case "!=":
+		return Bool(left != right)
+	}
+	return Errorf("unknown operator: %s %s %s", StringType, operator, StringType)
+}
+
+// Equal returns true if two values are equal: integers, strings and booleans
+// are compared by value and everything else by identity.
+func Equal(left, right Object) bool {
+	switch l := left.(type) {
+	case *Integer:
+		r, ok := right.(*Integer)
+		return ok && l.Value == r.Value
+	case *String:
+		r, ok := right.(*String)
+		return ok && l.Value == r.Value
+	case *Boolean:
+		r, ok := right.(*Boolean)
+		return ok && l.Value == r.Value
+	}
+	return left == right
+}
+
+// Index returns the element of an array or the value of a hash at the index,
+// null if there is none, or an *Error if the value cannot be indexed.
+func Index(left, index Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			return Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NullValue
+		}
+		return left.Elements[i.Value]
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return Errorf("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return NullValue
+		}
+		return pair.Value
+	}
+	return Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+}
+
+// NewHash returns a hash of the keys and values, which alternate in pairs, or
+// an *Error if a key cannot be a hash key. A later duplicate key replaces the
+// earlier one.
+func NewHash(pairs []Object) Object {
+	h := &Hash{Pairs: make(map[HashKey]HashPair, len(pairs)/2)}
+	for n := 0; n+1 < len(pairs); n += 2 {
+		key, ok := pairs[n].(Hashable)
+		if !ok {
+			return Errorf("unusable as hash key: %s", pairs[n].Type())
+		}
+		h.Pairs[key.HashKey()] = HashPair{Key: pairs[n], Value: pairs[n+1]}
+	}
+	return h
+}
@@ -0,0 +1,260 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// Tree represents the syntax tree of a source kept up to date as the source
+// is edited, for editors: an edit lexes again only the tokens it damages,
+// and parses again only the top-level statements around them, reusing the
+// others.
+type Tree struct {
+	Source  string   // The source.
+	Program *Program // The syntax tree of the source.
+	Errors  []string // The errors of the parser.
+	Reused  int      // The number of top-level statements the last edit reused.
+
+	lexer *lexer.Lexer // A lexer that has lexed the whole source.
+}
+
+// NewTree lexes and parses a source.
+func NewTree(source string) *Tree {
+	t := &Tree{Source: source, lexer: lexer.New(source)}
+	t.Program, t.Errors = parse(t.lexer.Tokens())
+	return t
+}
+
+// Tokens returns the tokens of the source, the last of which is EOF.
+func (t *Tree) Tokens() []lexer.Token {
+	return t.lexer.Tokens()
+}
+
+// Comments returns the comments of the source, in order.
+func (t *Tree) Comments() []lexer.Comment {
+	return t.lexer.Comments()
+}
+
+// Edit makes an edit to the source and brings the tree up to date. The
+// statements it reuses are moved in place, so the nodes of the previous
+// tree must not be used any more.
+func (t *Tree) Edit(e lexer.Edit) {
+	old := t.lexer.Tokens()
+	l, damage := t.lexer.Edit(e)
+	t.Source = e.Apply(t.Source)
+	t.lexer = l
+	if !t.reparse(old, damage) {
+		t.Program, t.Errors = parse(l.Tokens())
+		t.Reused = 0
+	}
+	if verifyEdits {
+		t.verify(e)
+	}
+}
+
+// reparse parses again the top-level statements that contain damaged
+// tokens, reusing the others. A statement ending with a semicolon ends there
+// whatever follows, so if the statements parsed again lie between two such
+// semicolons, and parse without errors or open blocks, they are those a parser of the
+// whole source would find. It returns false if it could not be done, for
+// programs with errors in particular.
+func (t *Tree) reparse(old []lexer.Token, d lexer.Damage) bool {
+	stmts := t.Program.Statements
+	if len(t.Errors) > 0 || len(stmts) == 0 {
+		return false
+	}
+	tokens := t.lexer.Tokens()
+
+	// The indexes of the first old tokens of the statements, and of EOF.
+	starts := make([]int, len(stmts)+1)
+	for n, stmt := range stmts {
+		starts[n] = firstToken(old, stmt)
+	}
+	starts[len(stmts)] = len(old) - 1
+
+	// The statements from a up to b contain the damaged tokens, or surround
+	// them if they were only inserted, at least one of them; widen them until
+	// semicolons end the statements before them and the last of them.
+	a := sort.Search(len(stmts), func(n int) bool { return starts[n+1] >= d.First })
+	b := sort.Search(len(stmts), func(n int) bool { return starts[n] >= d.OldEnd })
+	if b <= a {
+		b = a + 1
+	}
+	moved := func(n int) int { return n - d.OldEnd + d.End }
+	for a > 0 && tokens[starts[a]-1].Type != lexer.SEMICOLON {
+		a--
+	}
+	// The semicolons before the first statement belong to no statement, and
+	// an edit may have made them part of one.
+	from := starts[a]
+	if a == 0 {
+		from = 0
+	}
+	for b < len(stmts) && moved(starts[b]) > from && tokens[moved(starts[b])-1].Type != lexer.SEMICOLON {
+		b++
+	}
+	end := len(tokens) - 1
+	if b < len(stmts) {
+		end = moved(starts[b])
+	}
+
+	eof := lexer.Token{Type: lexer.EOF, Pos: tokens[end].Pos}
+	region, errors := parse(append(tokens[from:end:end], eof))
+	if len(errors) > 0 || b < len(stmts) && !closed(tokens[from:end]) {
+		return false
+	}
+
+	for _, stmt := range stmts[b:] {
+		walkTokens(stmt, func(tok *lexer.Token) { tok.Pos = d.Shift(tok.Pos) })
+	}
+	t.Program = &Program{Statements: append(append(append([]Statement{}, stmts[:a]...), region.Statements...), stmts[b:]...)}
+	t.Reused = len(stmts) - (b - a)
+	return true
+}
+
+// parse parses tokens.
+func parse(tokens []lexer.Token) (*Program, []string) {
+	p := New(lexer.FromTokens(tokens))
+	program := p.ParseProgram()
+	return program, p.Errors()
+}
+
+// closed returns true if the tokens close every brace they open. The parser
+// lets the end of the input close blocks, so the end of a region parsed
+// again could otherwise stop a block short.
+func closed(tokens []lexer.Token) bool {
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.Type {
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// firstToken returns the index of the first token of a statement. Pos
+// misses the opening parentheses of a statement that starts with a grouped
+// expression, which no statement can end with.
+func firstToken(tokens []lexer.Token, stmt Statement) int {
+	offset := Pos(stmt).Offset
+	n := sort.Search(len(tokens), func(n int) bool { return tokens[n].Pos.Offset >= offset })
+	for n > 0 && tokens[n-1].Type == lexer.LPAREN {
+		n--
+	}
+	return n
+}
+
+// walkTokens calls visit with each token of the syntax tree rooted at the
+// node.
+func walkTokens(node Node, visit func(*lexer.Token)) {
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			walkTokens(stmt, visit)
+		}
+	case *LetStatement:
+		visit(&n.Token)
+		walkTokens(n.Name, visit)
+		walkTokens(n.Value, visit)
+	case *ReturnStatement:
+		visit(&n.Token)
+		walkTokens(n.ReturnValue, visit)
+	case *ExpressionStatement:
+		visit(&n.Token)
+		walkTokens(n.Expression, visit)
+	case *BlockStatement:
+		visit(&n.Token)
+		for _, stmt := range n.Statements {
+			walkTokens(stmt, visit)
+		}
+	case *Identifier:
+		visit(&n.Token)
+	case *IntegerLiteral:
+		visit(&n.Token)
+	case *StringLiteral:
+		visit(&n.Token)
+	case *Boolean:
+		visit(&n.Token)
+	case *PrefixExpression:
+		visit(&n.Token)
+		walkTokens(n.Right, visit)
+	case *InfixExpression:
+		visit(&n.Token)
+		walkTokens(n.Left, visit)
+		walkTokens(n.Right, visit)
+	case *IfExpression:
+		visit(&n.Token)
+		walkTokens(n.Condition, visit)
+		if n.Consequence != nil {
+			walkTokens(n.Consequence, visit)
+		}
+		if n.Alternative != nil {
+			walkTokens(n.Alternative, visit)
+		}
+	case *FunctionLiteral:
+		visit(&n.Token)
+		for _, param := range n.Parameters {
+			walkTokens(param, visit)
+		}
+		if n.Body != nil {
+			walkTokens(n.Body, visit)
+		}
+	case *CallExpression:
+		visit(&n.Token)
+		walkTokens(n.Function, visit)
+		for _, arg := range n.Arguments {
+			walkTokens(arg, visit)
+		}
+	case *ArrayLiteral:
+		visit(&n.Token)
+		for _, elem := range n.Elements {
+			walkTokens(elem, visit)
+		}
+	case *IndexExpression:
+		visit(&n.Token)
+		walkTokens(n.Left, visit)
+		walkTokens(n.Index, visit)
+	case *HashLiteral:
+		visit(&n.Token)
+		for key, value := range n.Pairs {
+			walkTokens(key, visit)
+			walkTokens(value, visit)
+		}
+	}
+}
+
+// verify checks that the tree is the one parsing the source from scratch
+// gives, tokens and positions included, and panics otherwise.
+func (t *Tree) verify(e lexer.Edit) {
+	fresh := NewTree(t.Source)
+	var what string
+	switch {
+	case !reflect.DeepEqual(t.Tokens(), fresh.Tokens()):
+		what = "tokens"
+	case !reflect.DeepEqual(t.Comments(), fresh.Comments()):
+		what = "comments"
+	case !reflect.DeepEqual(t.Errors, fresh.Errors):
+		what = "errors"
+	case Dump(t.Program) != Dump(fresh.Program):
+		what = "syntax tree"
+	case !reflect.DeepEqual(positions(t.Program), positions(fresh.Program)):
+		what = "positions"
+	default:
+		return
+	}
+	panic(fmt.Sprintf("parser: the %s after edit %+v differ from those of parsing again", what, e))
+}
+
+// positions returns the positions of the tokens of a syntax tree, sorted.
+func positions(node Node) []lexer.Position {
+	var result []lexer.Position
+	walkTokens(node, func(tok *lexer.Token) { result = append(result, tok.Pos) })
+	sort.Slice(result, func(i, j int) bool { return result[i].Offset < result[j].Offset })
+	return result
+}
@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// The tests compare the trees edits give with those of parsing from
+// scratch. Run with -tags monkeydebug, every Edit also checks its tree
+// itself and panics on a difference.
+
+// same fails the test if the tree differs from the tree of its source parsed
+// from scratch: tokens, comments, errors, syntax tree or positions.
+func same(t *testing.T, tree *Tree, what string) {
+	t.Helper()
+	fresh := NewTree(tree.Source)
+	switch {
+	case !reflect.DeepEqual(tree.Tokens(), fresh.Tokens()):
+		t.Fatalf("%s: tokens differ from those of\n%s", what, tree.Source)
+	case !reflect.DeepEqual(tree.Comments(), fresh.Comments()):
+		t.Fatalf("%s: comments differ from those of\n%s", what, tree.Source)
+	case !reflect.DeepEqual(tree.Errors, fresh.Errors):
+		t.Fatalf("%s: errors %v, want %v for\n%s", what, tree.Errors, fresh.Errors, tree.Source)
+	case Dump(tree.Program) != Dump(fresh.Program):
+		t.Fatalf("%s: syntax tree\n%swant\n%sfor\n%s", what, Dump(tree.Program), Dump(fresh.Program), tree.Source)
+	case !reflect.DeepEqual(positions(tree.Program), positions(fresh.Program)):
+		t.Fatalf("%s: positions differ from those of\n%s", what, tree.Source)
+	}
+}
+
+// replace returns the edit replacing the nth occurrence, from 0, of old in
+// the source by text.
+func replace(t *testing.T, source, old string, nth int, text string) lexer.Edit {
+	t.Helper()
+	start := -1
+	for n := 0; n <= nth; n++ {
+		next := strings.Index(source[start+1:], old)
+		if next < 0 {
+			t.Fatalf("no occurrence %d of %q in\n%s", nth, old, source)
+		}
+		start += 1 + next
+	}
+	return lexer.Edit{Start: start, End: start + len(old), Text: text}
+}
+
+const base = `let add = fn(a, b) { a + b };
+// the total
+let total = add(1, 2);
+let names = ["a", "b"];
+let ages = {"a": 1, "b": 2};
+if (total > 2) { puts(total); } else { puts(0); }
+puts(names[0]);
+`
+
+func TestEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		old    string
+		nth    int
+		text   string
+		reuse  bool // Whether statements must be reused.
+	}{
+		{"rename", base, "total", 0, "sum", true},
+		{"number", base, "1, 2", 0, "10, 20", true},
+		{"operator", base, "a + b", 0, "a * b", true},
+		{"insert statement", base, "puts(names[0]);", 0, "puts(1);\nputs(names[0]);", true},
+		{"delete statement", base, "let names = [\"a\", \"b\"];\n", 0, "", true},
+		{"open block", base, "{ puts(total); }", 0, "{ puts(total);", false},
+		{"unclosed string", base, `"a", "b"]`, 0, `"a, "b"]`, false},
+		{"comment out", base, "let total", 0, "// let total", false},
+		{"uncomment", base, "// the total", 0, "the + total;", false},
+		{"join tokens", base, "a, b)", 0, "ab)", false},
+		{"keyword", base, "let ages", 0, "lett ages", false},
+		{"delete everything", base, base, 0, "", false},
+		{"into empty", "", "", 0, "let x = 1;", false},
+		{"before leading semicolon", ";puts(1);", ";", 0, "[;", false},
+	}
+	for _, tt := range tests {
+		source := tt.source
+		tree := NewTree(source)
+		e := replace(t, source, tt.old, tt.nth, tt.text)
+		tree.Edit(e)
+		same(t, tree, tt.name)
+		if tt.reuse && tree.Reused == 0 {
+			t.Errorf("%s: no statement reused", tt.name)
+		}
+
+		// Undoing the edit gives the tree of the original source back.
+		tree.Edit(lexer.Edit{Start: e.Start, End: e.Start + len(e.Text), Text: source[e.Start:e.End]})
+		same(t, tree, tt.name+" undone")
+		if tree.Source != source {
+			t.Errorf("%s: undoing gives\n%s", tt.name, tree.Source)
+		}
+	}
+}
+
+// TestTyping types a program one byte at a time, as an editor sends it,
+// and then deletes it from the middle.
+func TestTyping(t *testing.T) {
+	tree := NewTree("")
+	for n := range base {
+		tree.Edit(lexer.Edit{Start: n, End: n, Text: base[n : n+1]})
+		same(t, tree, "typing "+base[:n+1])
+	}
+	for len(tree.Source) > 0 {
+		mid := len(tree.Source) / 2
+		tree.Edit(lexer.Edit{Start: mid, End: mid + 1})
+		same(t, tree, "deleting")
+	}
+}
+
+// fragments are the texts random edits insert: tokens and pieces of tokens,
+// whole statements, brackets, quotes, comments and line breaks.
+var fragments = []string{
+	"let", "fn", "if", "else", "return", "true", "false", "x", "total", "add",
+	"1", "42", "+", "-", "*", "/", "!", "==", "!=", "<", ">", "=", ";", ",", ":",
+	"(", ")", "{", "}", "[", "]", `"`, `"s"`, "//", "// note\n", "\n", " ", "\t",
+	"let y = 2;\n", "puts(y);", "fn(a) { a }", "if (x) { 1 } else { 2 }", "[1, 2][0]", `{"k": 1}`,
+}
+
+// TestRandomEdits makes random insertions, deletions and replacements in
+// programs, and compares every tree with that of parsing from scratch. The
+// seed is fixed so that failures reproduce.
+func TestRandomEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sources := []string{base, "", ";puts(1);", "let f = fn(n) {\n\tif (n < 2) { return n; }\n\tf(n - 1) + f(n - 2)\n};\nputs(f(10));\n"}
+	for round := 0; round < 40; round++ {
+		tree := NewTree(sources[round%len(sources)])
+		for n := 0; n < 100; n++ {
+			size := len(tree.Source)
+			start := r.Intn(size + 1)
+			end := start
+			if r.Intn(2) == 0 && size > start {
+				end = start + 1 + r.Intn(min(size-start, 12))
+			}
+			text := ""
+			if r.Intn(3) > 0 {
+				text = fragments[r.Intn(len(fragments))]
+			}
+			e := lexer.Edit{Start: start, End: end, Text: text}
+			before := tree.Source
+			tree.Edit(e)
+			if tree.Source != e.Apply(before) {
+				t.Fatalf("edit %+v of %q gives source %q", e, before, tree.Source)
+			}
+			same(t, tree, "random edit")
+		}
+	}
+}
+
+// min returns the smaller of two integers.
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
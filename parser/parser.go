@@ -1 +1,473 @@
 package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/user/golang-interpreter/lexer"
+)
+
+// The precedences of the operators, from the loosest to the tightest.
+const (
+	_ int = iota
+	LOWEST
+	EQUALS      // == and !=
+	LESSGREATER // < and >
+	SUM         // + and -
+	PRODUCT     // * and /
+	PREFIX      // -x and !x
+	CALL        // f(x)
+	INDEX       // a[i]
+)
+
+// precedences maps the token types of the infix operators to their
+// precedences.
+var precedences = map[lexer.TokenType]int{
+	lexer.EQ:       EQUALS,
+	lexer.NEQ:      EQUALS,
+	lexer.LT:       LESSGREATER,
+	lexer.GT:       LESSGREATER,
+	lexer.PLUS:     SUM,
+	lexer.MINUS:    SUM,
+	lexer.SLASH:    PRODUCT,
+	lexer.ASTERISK: PRODUCT,
+	lexer.LPAREN:   CALL,
+	lexer.LBRACKET: INDEX,
+}
+
+type (
+	// prefixParseFn parses an expression starting with the current token.
+	prefixParseFn func() Expression
+	// infixParseFn parses an expression continuing the given left-hand side
+	// at the current token.
+	infixParseFn func(Expression) Expression
+)
+
+// Parser represents a Pratt parser for the Monkey programming language.
+type Parser struct {
+	l      *lexer.Lexer // The lexer providing the tokens.
+	errors []string     // The errors found so far.
+
+	curToken  lexer.Token // The current token.
+	peekToken lexer.Token // The token after the current one.
+
+	prefixParseFns map[lexer.TokenType]prefixParseFn // The parsers of the expressions, by first token.
+	infixParseFns  map[lexer.TokenType]infixParseFn  // The parsers of the operators, by operator token.
+}
+
+// New creates a new parser reading its tokens from the given lexer.
+func New(l *lexer.Lexer) *Parser {
+	p := &Parser{l: l}
+
+	p.prefixParseFns = map[lexer.TokenType]prefixParseFn{
+		lexer.IDENT:    p.parseIdentifier,
+		lexer.INT:      p.parseIntegerLiteral,
+		lexer.STRING:   p.parseStringLiteral,
+		lexer.TRUE:     p.parseBoolean,
+		lexer.FALSE:    p.parseBoolean,
+		lexer.BANG:     p.parsePrefixExpression,
+		lexer.MINUS:    p.parsePrefixExpression,
+		lexer.LPAREN:   p.parseGroupedExpression,
+		lexer.IF:       p.parseIfExpression,
+		lexer.FUNCTION: p.parseFunctionLiteral,
+		lexer.LBRACKET: p.parseArrayLiteral,
+		lexer.LBRACE:   p.parseHashLiteral,
+	}
+	p.infixParseFns = map[lexer.TokenType]infixParseFn{
+		lexer.PLUS:     p.parseInfixExpression,
+		lexer.MINUS:    p.parseInfixExpression,
+		lexer.SLASH:    p.parseInfixExpression,
+		lexer.ASTERISK: p.parseInfixExpression,
+		lexer.EQ:       p.parseInfixExpression,
+		lexer.NEQ:      p.parseInfixExpression,
+		lexer.LT:       p.parseInfixExpression,
+		lexer.GT:       p.parseInfixExpression,
+		lexer.LPAREN:   p.parseCallExpression,
+		lexer.LBRACKET: p.parseIndexExpression,
+	}
+
+	// Read two tokens, so curToken and peekToken are both set.
+	p.nextToken()
+	p.nextToken()
+	return p
+}
+
+// Errors returns the errors found while parsing, each in the form
+// "line:column: message".
+func (p *Parser) Errors() []string {
+	return p.errors
+}
+
+// ParseProgram parses the whole input. It always returns a program, with
+// the statements it could parse if there are errors.
+func (p *Parser) ParseProgram() *Program {
+	program := &Program{}
+	for !p.curTokenIs(lexer.EOF) {
+		if stmt := p.parseStatement(); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	return program
+}
+
+// nextToken advances to the next token.
+func (p *Parser) nextToken() {
+	p.curToken = p.peekToken
+	p.peekToken = p.l.NextToken()
+}
+
+// curTokenIs returns true if the current token is of the given type.
+func (p *Parser) curTokenIs(t lexer.TokenType) bool {
+	return p.curToken.Type == t
+}
+
+// peekTokenIs returns true if the next token is of the given type.
+func (p *Parser) peekTokenIs(t lexer.TokenType) bool {
+	return p.peekToken.Type == t
+}
+
+// expectPeek advances to the next token if it is of the given type, and
+// records an error otherwise.
+func (p *Parser) expectPeek(t lexer.TokenType) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	}
+	p.errorf(p.peekToken, "expected next token to be %s, got %s instead", t, describe(p.peekToken))
+	return false
+}
+
+// errorf records an error at the given token.
+func (p *Parser) errorf(tok lexer.Token, format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf("%d:%d: ", tok.Pos.Line, tok.Pos.Column)+fmt.Sprintf(format, args...))
+}
+
+// describe returns how errors name a token.
+func describe(tok lexer.Token) string {
+	if tok.Type == lexer.EOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", tok.Literal)
+}
+
+// peekPrecedence returns the precedence of the next token.
+func (p *Parser) peekPrecedence() int {
+	if p, ok := precedences[p.peekToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// curPrecedence returns the precedence of the current token.
+func (p *Parser) curPrecedence() int {
+	if p, ok := precedences[p.curToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// parseStatement parses the statement starting at the current token.
+func (p *Parser) parseStatement() Statement {
+	switch p.curToken.Type {
+	case lexer.LET:
+		return p.parseLetStatement()
+	case lexer.RETURN:
+		return p.parseReturnStatement()
+	case lexer.SEMICOLON:
+		// An empty statement.
+		return nil
+	default:
+		return p.parseExpressionStatement()
+	}
+}
+
+// parseLetStatement parses "let name = value", with an optional semicolon.
+func (p *Parser) parseLetStatement() Statement {
+	stmt := &LetStatement{Token: p.curToken}
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseReturnStatement parses "return value" or a bare "return", with an
+// optional semicolon.
+func (p *Parser) parseReturnStatement() Statement {
+	stmt := &ReturnStatement{Token: p.curToken}
+	if p.peekTokenIs(lexer.SEMICOLON) || p.peekTokenIs(lexer.RBRACE) || p.peekTokenIs(lexer.EOF) {
+		if p.peekTokenIs(lexer.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+	p.nextToken()
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExpressionStatement parses an expression used as a statement, with
+// an optional semicolon.
+func (p *Parser) parseExpressionStatement() Statement {
+	stmt := &ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExpression parses the expression starting at the current token,
+// whose operators bind tighter than the given precedence.
+func (p *Parser) parseExpression(precedence int) Expression {
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if prefix == nil {
+		p.errorf(p.curToken, "no prefix parse function for %s found", describe(p.curToken))
+		return nil
+	}
+	left := prefix()
+	for left != nil && !p.peekTokenIs(lexer.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return left
+		}
+		p.nextToken()
+		left = infix(left)
+	}
+	return left
+}
+
+// parseIdentifier parses an identifier.
+func (p *Parser) parseIdentifier() Expression {
+	return &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseIntegerLiteral parses an integer literal.
+func (p *Parser) parseIntegerLiteral() Expression {
+	value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	if err != nil {
+		p.errorf(p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+	return &IntegerLiteral{Token: p.curToken, Value: value}
+}
+
+// parseStringLiteral parses a string literal.
+func (p *Parser) parseStringLiteral() Expression {
+	lit := p.curToken.Literal
+	return &StringLiteral{Token: p.curToken, Value: lit[1 : len(lit)-1]}
+}
+
+// parseBoolean parses true or false.
+func (p *Parser) parseBoolean() Expression {
+	return &Boolean{Token: p.curToken, Value: p.curTokenIs(lexer.TRUE)}
+}
+
+// parsePrefixExpression parses a prefix operator and its operand.
+func (p *Parser) parsePrefixExpression() Expression {
+	expr := &PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
+	p.nextToken()
+	expr.Right = p.parseExpression(PREFIX)
+	if expr.Right == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseInfixExpression parses an infix operator and its right-hand side.
+func (p *Parser) parseInfixExpression(left Expression) Expression {
+	expr := &InfixExpression{Token: p.curToken, Operator: p.curToken.Literal, Left: left}
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expr.Right = p.parseExpression(precedence)
+	if expr.Right == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseGroupedExpression parses an expression between parentheses, which
+// leave no node in the tree.
+func (p *Parser) parseGroupedExpression() Expression {
+	p.nextToken()
+	expr := p.parseExpression(LOWEST)
+	if expr == nil || !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	return expr
+}
+
+// parseIfExpression parses "if (condition) { ... }", with an optional
+// "else { ... }".
+func (p *Parser) parseIfExpression() Expression {
+	expr := &IfExpression{Token: p.curToken}
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Condition = p.parseExpression(LOWEST)
+	if expr.Condition == nil || !p.expectPeek(lexer.RPAREN) || !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	expr.Consequence = p.parseBlockStatement()
+	if p.peekTokenIs(lexer.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(lexer.LBRACE) {
+			return nil
+		}
+		expr.Alternative = p.parseBlockStatement()
+	}
+	return expr
+}
+
+// parseBlockStatement parses the statements of a block up to its closing
+// brace, or up to the end of the input, which closes it too.
+func (p *Parser) parseBlockStatement() *BlockStatement {
+	block := &BlockStatement{Token: p.curToken}
+	p.nextToken()
+	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
+		if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	return block
+}
+
+// parseFunctionLiteral parses "fn(parameters) { ... }".
+func (p *Parser) parseFunctionLiteral() Expression {
+	lit := &FunctionLiteral{Token: p.curToken}
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	var ok bool
+	if lit.Parameters, ok = p.parseFunctionParameters(); !ok || !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+	return lit
+}
+
+// parseFunctionParameters parses the parameters of a function up to the
+// closing parenthesis.
+func (p *Parser) parseFunctionParameters() ([]*Identifier, bool) {
+	var params []*Identifier
+	if p.peekTokenIs(lexer.RPAREN) {
+		p.nextToken()
+		return params, true
+	}
+	if !p.expectPeek(lexer.IDENT) {
+		return nil, false
+	}
+	params = append(params, &Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	for p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil, false
+		}
+		params = append(params, &Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+	return params, p.expectPeek(lexer.RPAREN)
+}
+
+// parseCallExpression parses the arguments of a call to the given function.
+func (p *Parser) parseCallExpression(function Expression) Expression {
+	expr := &CallExpression{Token: p.curToken, Function: function}
+	var ok bool
+	if expr.Arguments, ok = p.parseExpressionList(lexer.RPAREN); !ok {
+		return nil
+	}
+	return expr
+}
+
+// parseArrayLiteral parses "[elements]".
+func (p *Parser) parseArrayLiteral() Expression {
+	array := &ArrayLiteral{Token: p.curToken}
+	var ok bool
+	if array.Elements, ok = p.parseExpressionList(lexer.RBRACKET); !ok {
+		return nil
+	}
+	return array
+}
+
+// parseExpressionList parses expressions separated by commas up to the
+// given closing token.
+func (p *Parser) parseExpressionList(end lexer.TokenType) ([]Expression, bool) {
+	var list []Expression
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list, true
+	}
+	p.nextToken()
+	expr := p.parseExpression(LOWEST)
+	if expr == nil {
+		return nil, false
+	}
+	list = append(list, expr)
+	for p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		if expr = p.parseExpression(LOWEST); expr == nil {
+			return nil, false
+		}
+		list = append(list, expr)
+	}
+	return list, p.expectPeek(end)
+}
+
+// parseIndexExpression parses "[index]" after the given expression.
+func (p *Parser) parseIndexExpression(left Expression) Expression {
+	expr := &IndexExpression{Token: p.curToken, Left: left}
+	p.nextToken()
+	expr.Index = p.parseExpression(LOWEST)
+	if expr.Index == nil || !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+	return expr
+}
+
+// parseHashLiteral parses "{key: value, ...}".
+func (p *Parser) parseHashLiteral() Expression {
+	hash := &HashLiteral{Token: p.curToken, Pairs: make(map[Expression]Expression)}
+	for !p.peekTokenIs(lexer.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil || !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		hash.Pairs[key] = value
+		if !p.peekTokenIs(lexer.RBRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(lexer.RBRACE) {
+		return nil
+	}
+	return hash
+}
@@ -0,0 +1,52 @@
+package parser
+
+import "github.com/user/golang-interpreter/lexer"
+
+// Pos returns the position of the first token of the given node.
+func Pos(node Node) lexer.Position {
+	switch n := node.(type) {
+	case *Program:
+		if len(n.Statements) > 0 {
+			return Pos(n.Statements[0])
+		}
+	case *LetStatement:
+		return n.Token.Pos
+	case *ReturnStatement:
+		return n.Token.Pos
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			return Pos(n.Expression)
+		}
+		return n.Token.Pos
+	case *BlockStatement:
+		return n.Token.Pos
+	case *Identifier:
+		return n.Token.Pos
+	case *IntegerLiteral:
+		return n.Token.Pos
+	case *StringLiteral:
+		return n.Token.Pos
+	case *Boolean:
+		return n.Token.Pos
+	case *PrefixExpression:
+		return n.Token.Pos
+	case *InfixExpression:
+		// The token of an infix expression is its operator.
+		return Pos(n.Left)
+	case *IfExpression:
+		return n.Token.Pos
+	case *FunctionLiteral:
+		return n.Token.Pos
+	case *CallExpression:
+		// The token of a call expression is its opening parenthesis.
+		return Pos(n.Function)
+	case *ArrayLiteral:
+		return n.Token.Pos
+	case *IndexExpression:
+		// The token of an index expression is its opening bracket.
+		return Pos(n.Left)
+	case *HashLiteral:
+		return n.Token.Pos
+	}
+	return lexer.Position{}
+}
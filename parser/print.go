@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sexpr represents a node of the tree printed by Dump.
+type sexpr struct {
+	head     string   // The kind of the node and its attributes.
+	children []*sexpr // The child nodes.
+}
+
+// Dump returns the syntax tree rooted at the node as an indented
+// S-expression, one node per line unless all the children of a node are
+// leaves:
+//
+//	(program
+//	  (let x
+//	    (infix + (int 1) (int 2))))
+func Dump(node Node) string {
+	var b strings.Builder
+	render(&b, toSexpr(node), 0)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// render writes the S-expression at the indentation depth.
+func render(b *strings.Builder, s *sexpr, depth int) {
+	b.WriteString("(" + s.head)
+	inline := true
+	for _, c := range s.children {
+		if len(c.children) > 0 {
+			inline = false
+		}
+	}
+	for _, c := range s.children {
+		if inline {
+			b.WriteString(" ")
+		} else {
+			b.WriteString("\n" + strings.Repeat("  ", depth+1))
+		}
+		render(b, c, depth+1)
+	}
+	b.WriteString(")")
+}
+
+// toSexpr returns the S-expression of a node.
+func toSexpr(node Node) *sexpr {
+	leaf := func(format string, args ...interface{}) *sexpr {
+		return &sexpr{head: fmt.Sprintf(format, args...)}
+	}
+	branch := func(head string, children ...Node) *sexpr {
+		s := &sexpr{head: head}
+		for _, c := range children {
+			s.children = append(s.children, toSexpr(c))
+		}
+		return s
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		s := &sexpr{head: "program"}
+		for _, stmt := range n.Statements {
+			s.children = append(s.children, toSexpr(stmt))
+		}
+		return s
+	case *LetStatement:
+		return branch("let "+n.Name.Value, n.Value)
+	case *ReturnStatement:
+		if n.ReturnValue == nil {
+			return leaf("return")
+		}
+		return branch("return", n.ReturnValue)
+	case *ExpressionStatement:
+		if n.Expression == nil {
+			return leaf("expr")
+		}
+		return branch("expr", n.Expression)
+	case *BlockStatement:
+		s := &sexpr{head: "block"}
+		for _, stmt := range n.Statements {
+			s.children = append(s.children, toSexpr(stmt))
+		}
+		return s
+	case *Identifier:
+		return leaf("ident %s", n.Value)
+	case *IntegerLiteral:
+		return leaf("int %d", n.Value)
+	case *StringLiteral:
+		return leaf("string %q", n.Value)
+	case *Boolean:
+		return leaf("bool %t", n.Value)
+	case *PrefixExpression:
+		return branch("prefix "+n.Operator, n.Right)
+	case *InfixExpression:
+		return branch("infix "+n.Operator, n.Left, n.Right)
+	case *IfExpression:
+		s := branch("if", n.Condition)
+		if n.Consequence != nil {
+			s.children = append(s.children, toSexpr(n.Consequence))
+		}
+		if n.Alternative != nil {
+			s.children = append(s.children, toSexpr(n.Alternative))
+		}
+		return s
+	case *FunctionLiteral:
+		var params []string
+		for _, p := range n.Parameters {
+			params = append(params, p.Value)
+		}
+		s := &sexpr{head: "fn (" + strings.Join(params, " ") + ")"}
+		if n.Body != nil {
+			s.children = append(s.children, toSexpr(n.Body))
+		}
+		return s
+	case *CallExpression:
+		s := branch("call", n.Function)
+		for _, a := range n.Arguments {
+			s.children = append(s.children, toSexpr(a))
+		}
+		return s
+	case *ArrayLiteral:
+		s := &sexpr{head: "array"}
+		for _, e := range n.Elements {
+			s.children = append(s.children, toSexpr(e))
+		}
+		return s
+	case *IndexExpression:
+		return branch("index", n.Left, n.Index)
+	case *HashLiteral:
+		// The pairs are printed in source order, whatever the order of the
+		// map holding them.
+		var keys []Expression
+		for k := range n.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return Pos(keys[i]).Offset < Pos(keys[j]).Offset })
+		s := &sexpr{head: "hash"}
+		for _, k := range keys {
+			s.children = append(s.children, branch("pair", k, n.Pairs[k]))
+		}
+		return s
+	}
+	return leaf("unknown %T", node)
+}
@@ -0,0 +1,8 @@
+//go:build !monkeydebug
+
+package parser
+
+// verifyEdits makes Tree.Edit check the tree against parsing the source
+// again after every edit. It is set in debug builds, made with -tags
+// monkeydebug.
+const verifyEdits = false
@@ -0,0 +1,244 @@
+// Package repl implements the interactive read-eval-print loop of Monkey.
+//
+// Inputs are evaluated by the tree-walking evaluator in one environment, so
+// bindings persist from one input to the next. An input with unbalanced
+// braces, brackets or parentheses continues on the next line. Lines starting with a
+// colon are meta-commands showing the stages of the compiler for the last
+// input; :help lists them.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/user/golang-interpreter/backend"
+	"github.com/user/golang-interpreter/evaluator"
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// The prompts of the first line of an input and of its continuation lines.
+const (
+	Prompt             = ">> "
+	ContinuationPrompt = ".. "
+)
+
+// session represents the state of the loop.
+type session struct {
+	out     io.Writer
+	env     *evaluator.Environment // The bindings of all inputs.
+	history []string               // The inputs evaluated without error, whose bindings are in env.
+	earlier []string               // The inputs of the history evaluated before the last input.
+	last    string                 // The last input evaluated.
+	quit    bool                   // Whether :quit was entered.
+}
+
+// command represents a meta-command.
+type command struct {
+	help string           // What the command shows.
+	run  func(s *session) // Runs the command.
+}
+
+// commands maps the names of the meta-commands to them. It is filled in by
+// init, since :help refers to it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		":tokens": {"show the tokens of the last input", (*session).showTokens},
+		":ast":    {"show the syntax tree of the last input", (*session).showAST},
+		":ir":     {"show the intermediate representation of the last input", (*session).showIR},
+		":asm":    {"show the assembly of the last input", (*session).showAsm},
+		":help":   {"list the meta-commands", (*session).showHelp},
+		":quit":   {"leave the loop", func(s *session) { s.quit = true }},
+	}
+}
+
+// Start reads inputs from in, evaluates them and writes their values to out,
+// until in ends or :quit is entered.
+func Start(in io.Reader, out io.Writer) {
+	s := &session{out: out, env: evaluator.NewEnvironment(out)}
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	for !s.quit {
+		if input.Len() == 0 {
+			fmt.Fprint(out, Prompt)
+		} else {
+			fmt.Fprint(out, ContinuationPrompt)
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := scanner.Text()
+
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			name := strings.TrimSpace(line)
+			cmd, ok := commands[name]
+			if !ok {
+				fmt.Fprintf(out, "unknown command %s; :help lists the commands\n", name)
+				continue
+			}
+			cmd.run(s)
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+		if Incomplete(input.String()) {
+			continue
+		}
+		s.eval(input.String())
+		input.Reset()
+	}
+}
+
+// Incomplete returns true if the input opens more braces, brackets or
+// parentheses than it closes, so that it continues on the next line.
+func Incomplete(input string) bool {
+	depth := 0
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case lexer.LBRACE, lexer.LBRACKET, lexer.LPAREN:
+			depth++
+		case lexer.RBRACE, lexer.RBRACKET, lexer.RPAREN:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// parse parses an input, printing the errors if it does not parse.
+func (s *session) parse(input string) (*parser.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, msg := range errs {
+			fmt.Fprintf(s.out, "parse error: %s\n", msg)
+		}
+		return nil, false
+	}
+	return program, true
+}
+
+// eval evaluates an input and prints its value.
+func (s *session) eval(input string) {
+	if strings.TrimSpace(input) == "" {
+		return
+	}
+	s.last = input
+	s.earlier = s.history
+	program, ok := s.parse(input)
+	if !ok {
+		return
+	}
+	result := evaluator.Eval(program, s.env)
+	if result == nil {
+		// A let statement has no value.
+		s.history = append(s.history, input)
+		return
+	}
+	fmt.Fprintln(s.out, result.Inspect())
+	if result.Type() != object.ErrorType {
+		s.history = append(s.history, input)
+	}
+}
+
+// parseQuietly parses an input of the history, which parsed before.
+func parseQuietly(input string) (*parser.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	return program, len(p.Errors()) == 0
+}
+
+// showTokens prints the tokens of the last input with their positions.
+func (s *session) showTokens() {
+	l := lexer.New(s.last)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%d:%d\t%v\t%q\n", tok.Pos.Line, tok.Pos.Column, tok.Type, tok.Literal)
+	}
+}
+
+// showAST prints the syntax tree of the last input.
+func (s *session) showAST() {
+	if program, ok := s.parse(s.last); ok {
+		fmt.Fprint(s.out, parser.Dump(program))
+	}
+}
+
+// lower translates the last input to the intermediate representation. Since
+// it may refer to the bindings of the earlier inputs, their let statements
+// come first, except those the compiler does not support: they only make the
+// command fail if the last input uses them.
+func (s *session) lower() (*intermediate.Module, bool) {
+	last, ok := s.parse(s.last)
+	if !ok {
+		return nil, false
+	}
+	var lets []parser.Statement
+	for _, input := range s.earlier {
+		program, ok := parseQuietly(input)
+		if !ok {
+			continue
+		}
+		for _, stmt := range program.Statements {
+			if _, ok := stmt.(*parser.LetStatement); !ok {
+				continue
+			}
+			candidate := append(lets[:len(lets):len(lets)], stmt)
+			if _, err := intermediate.Lower(&parser.Program{Statements: candidate}); err == nil {
+				lets = candidate
+			}
+		}
+	}
+	program := &parser.Program{Statements: append(lets, last.Statements...)}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %s\n", err)
+		return nil, false
+	}
+	intermediate.Optimize(module, intermediate.Passes(intermediate.Options{Level: 1, InlineThreshold: intermediate.DefaultInlineThreshold}))
+	return module, true
+}
+
+// showIR prints the intermediate representation of the last input.
+func (s *session) showIR() {
+	if module, ok := s.lower(); ok {
+		g := intermediate.NewCodeGenerator()
+		g.Renumber = true
+		g.GenerateModule(module)
+		fmt.Fprint(s.out, g.GetCode())
+	}
+}
+
+// showAsm prints the assembly of the last input for the default target.
+func (s *session) showAsm() {
+	module, ok := s.lower()
+	if !ok {
+		return
+	}
+	assembly, err := backend.GenerateAssembly(module, backend.Options{})
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %s\n", err)
+		return
+	}
+	fmt.Fprint(s.out, assembly)
+}
+
+// showHelp lists the meta-commands.
+func (s *session) showHelp() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%-8s %s\n", name, commands[name].help)
+	}
+}
@@ -0,0 +1,74 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// run runs the loop over the lines of the input and returns what it
+// printed, without the prompts.
+func run(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	got := strings.ReplaceAll(out.String(), Prompt, "")
+	return strings.ReplaceAll(got, ContinuationPrompt, "")
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"let a = 1;", false},
+		{"let f = fn(x) {", true},
+		{"let a = [1,", true},
+		{"let h = {1: [2,", true},
+		{"puts(1,", true},
+		{"let a = [1, 2];", false},
+		{"}", false},
+	}
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.want {
+			t.Errorf("Incomplete(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bindings persist", "let a = 2;\na * 3\n", "6\n"},
+		{"multi-line function", "let f = fn(x) {\nx + 1\n};\nf(1)\n", "2\n"},
+		{"multi-line array", "let a = [1,\n2];\na\n", "[1, 2]\n"},
+		{"parse error", "let = 1;\n", "parse error: 1:5: expected next token to be IDENT, got \"=\" instead\nparse error: 1:5: no prefix parse function for \"=\" found\n"},
+		{"runtime error", "1 / 0\n", "error: division by zero\n"},
+		{"tokens", "a + 1\n:tokens\n", "error: 1:1: identifier not found: a\n1:1\tIDENT\t\"a\"\n1:3\t+\t\"+\"\n1:5\tINT\t\"1\"\n"},
+		{"unknown command", ":bogus\n", "unknown command :bogus; :help lists the commands\n"},
+		{"quit", "1\n:quit\n2\n", "1\n"},
+	}
+	for _, tt := range tests {
+		// The end of the input ends the last line.
+		if got := strings.TrimRight(run(tt.input), "\n"); got != strings.TrimRight(tt.want, "\n") {
+			t.Errorf("%s: printed %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestIRShowsLastInput checks that :ir compiles the last input with the
+// bindings of the earlier ones, whatever the earlier inputs the compiler does
+// not support.
+func TestIRShowsLastInput(t *testing.T) {
+	got := run("let add = fn(x, y) { x + y };\nlet s = \"str\";\nputs(s);\nputs(add(1, 2));\n:ir\n")
+	if strings.Contains(got, "error") || !strings.Contains(got, "func @add(") {
+		t.Errorf("printed\n%s\nwant the functions of the last input", got)
+	}
+
+	got = run("let s = \"str\";\nputs(s);\n:ir\n")
+	if !strings.Contains(got, "error: 1:6: identifier not found: s\n") {
+		t.Errorf("printed\n%s\nwant the error of the binding the last input uses", got)
+	}
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/object"
+)
+
+// Closure represents a function value: the code of a function literal and
+// the free variables it captured when it was created.
+type Closure struct {
+	Fn   *bytecode.CompiledFunction // The code of the function.
+	Free []object.Object            // The captured cells, or values for the function itself, by the index of the free variable.
+}
+
+func (c *Closure) Type() object.Type { return object.FunctionType }
+func (c *Closure) Inspect() string   { return c.Fn.Inspect() }
+
+// cell represents a local captured by a closure. The slot of the local holds
+// the cell from then on, so that the function and its closures share the
+// value.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.Type { return c.value.Type() }
+func (c *cell) Inspect() string   { return c.value.Inspect() }
+
+// load returns the value held by a slot, which may be a cell.
+func load(slot object.Object) object.Object {
+	if c, ok := slot.(*cell); ok {
+		return c.value
+	}
+	return slot
+}
+
+// Frame represents a call being executed.
+type Frame struct {
+	cl          *Closure // The closure called.
+	ip          int      // The offset of the instruction being executed.
+	basePointer int      // The stack index of the first local; the closure is just below it.
+}
+
+// NewFrame returns the frame of a call of the closure whose locals start at
+// the base pointer.
+func NewFrame(cl *Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the code executed by the frame.
+func (f *Frame) Instructions() bytecode.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,357 @@
+// Package vm executes the bytecode of compiled Monkey programs on a stack
+// machine, without generating native code.
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/object"
+)
+
+// BackendName is the name of the virtual machine accepted by the --backend
+// flag of monkey run.
+const BackendName = "vm"
+
+// The sizes of the machine.
+const (
+	StackSize   = 1 << 20 // The number of values on the stack.
+	GlobalsSize = 1 << 16 // The number of globals.
+	MaxFrames   = 1 << 16 // The depth of nested calls.
+)
+
+// errStackOverflow is the runtime error of a call nested too deeply.
+var errStackOverflow = errors.New("stack overflow")
+
+// VM represents the virtual machine executing a program.
+type VM struct {
+	constants []object.Object // The constant pool of the program.
+	globals   []object.Object // The values of the globals.
+
+	stack []object.Object // The operand stack, holding the locals of the frames too.
+	sp    int             // The index of the free slot above the top of the stack.
+
+	frames      []*Frame // The calls being executed, innermost last.
+	framesIndex int      // The number of calls being executed.
+
+	out        io.Writer     // The destination of puts.
+	lastPopped object.Object // The value of the last expression statement at the top level.
+}
+
+// New returns a machine executing the program, printing to out.
+func New(bc *bytecode.Bytecode, out io.Writer) *VM {
+	return NewWithGlobalsState(bc, make([]object.Object, GlobalsSize), out)
+}
+
+// NewWithGlobalsState returns a machine executing the program with the globals
+// left by earlier parts of it, as the REPL does.
+func NewWithGlobalsState(bc *bytecode.Bytecode, globals []object.Object, out io.Writer) *VM {
+	main := &Closure{Fn: &bytecode.CompiledFunction{Instructions: bc.Instructions}}
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(main, 0)
+	return &VM{
+		constants:   bc.Constants,
+		globals:     globals,
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+		out:         out,
+	}
+}
+
+// Globals returns the values of the globals, to continue the program with
+// NewWithGlobalsState.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// LastPopped returns the value of the last expression statement executed at
+// the top level, or nil if there is none.
+func (vm *VM) LastPopped() object.Object {
+	return vm.lastPopped
+}
+
+// currentFrame returns the frame of the innermost call.
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame enters a call.
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return errStackOverflow
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+// popFrame leaves the innermost call.
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// push pushes a value on the stack.
+func (vm *VM) push(obj object.Object) error {
+	if vm.sp >= StackSize {
+		return errStackOverflow
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+	return nil
+}
+
+// pop pops the value on top of the stack.
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// check turns a value that is an *object.Error into a runtime error.
+func check(obj object.Object) error {
+	if err, ok := obj.(*object.Error); ok {
+		return errors.New(err.Message)
+	}
+	return nil
+}
+
+// operators maps the opcodes of the operations on two values to the
+// operators of the source language.
+var operators = map[bytecode.Opcode]string{
+	bytecode.OpAdd:         "+",
+	bytecode.OpSub:         "-",
+	bytecode.OpMul:         "*",
+	bytecode.OpDiv:         "/",
+	bytecode.OpEqual:       "==",
+	bytecode.OpNotEqual:    "!=",
+	bytecode.OpLessThan:    "<",
+	bytecode.OpGreaterThan: ">",
+}
+
+// Run executes the program until the top level ends or returns, or a runtime
+// error occurs.
+func (vm *VM) Run() error {
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+		ins := frame.Instructions()
+		if frame.ip >= len(ins) {
+			return nil
+		}
+		op := bytecode.Opcode(ins[frame.ip])
+		var err error
+
+		switch op {
+		case bytecode.OpConstant:
+			index := bytecode.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.constants[index])
+
+		case bytecode.OpPop:
+			v := vm.pop()
+			if vm.framesIndex == 1 {
+				vm.lastPopped = v
+			}
+
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv,
+			bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpLessThan, bytecode.OpGreaterThan:
+			right := vm.pop()
+			left := vm.pop()
+			result := object.Infix(operators[op], left, right)
+			if err = check(result); err == nil {
+				err = vm.push(result)
+			}
+
+		case bytecode.OpMinus, bytecode.OpBang:
+			operator := "-"
+			if op == bytecode.OpBang {
+				operator = "!"
+			}
+			result := object.Prefix(operator, vm.pop())
+			if err = check(result); err == nil {
+				err = vm.push(result)
+			}
+
+		case bytecode.OpTrue:
+			err = vm.push(object.True)
+		case bytecode.OpFalse:
+			err = vm.push(object.False)
+		case bytecode.OpNull:
+			err = vm.push(object.NullValue)
+
+		case bytecode.OpJump:
+			pos := int(bytecode.ReadUint16(ins[frame.ip+1:]))
+			frame.ip = pos - 1
+
+		case bytecode.OpJumpNotTruthy:
+			pos := int(bytecode.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if !object.Truthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case bytecode.OpGetGlobal:
+			index := bytecode.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			global := vm.globals[index]
+			if global == nil {
+				// Globals not bound yet read as null.
+				global = object.NullValue
+			}
+			err = vm.push(global)
+		case bytecode.OpSetGlobal:
+			index := bytecode.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			vm.globals[index] = vm.pop()
+
+		case bytecode.OpGetLocal:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			err = vm.push(load(vm.stack[frame.basePointer+int(index)]))
+		case bytecode.OpSetLocal:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			slot := &vm.stack[frame.basePointer+int(index)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case bytecode.OpGetBuiltin:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			err = vm.push(object.Builtins[index])
+		case bytecode.OpGetFree:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			err = vm.push(load(frame.cl.Free[index]))
+		case bytecode.OpCaptureLocal:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			slot := &vm.stack[frame.basePointer+int(index)]
+			if _, ok := (*slot).(*cell); !ok {
+				*slot = &cell{value: *slot}
+			}
+			err = vm.push(*slot)
+		case bytecode.OpCaptureFree:
+			index := bytecode.ReadUint8(ins[frame.ip+1:])
+			frame.ip++
+			err = vm.push(frame.cl.Free[index])
+		case bytecode.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		case bytecode.OpArray:
+			n := int(bytecode.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			err = vm.push(&object.Array{Elements: elements})
+
+		case bytecode.OpHash:
+			n := int(bytecode.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			hash := object.NewHash(vm.stack[vm.sp-n : vm.sp])
+			vm.sp -= n
+			if err = check(hash); err == nil {
+				err = vm.push(hash)
+			}
+
+		case bytecode.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result := object.Index(left, index)
+			if err = check(result); err == nil {
+				err = vm.push(result)
+			}
+
+		case bytecode.OpCall, bytecode.OpTailCall:
+			numArgs := int(bytecode.ReadUint8(ins[frame.ip+1:]))
+			frame.ip++
+			err = vm.call(numArgs, op == bytecode.OpTailCall)
+
+		case bytecode.OpReturnValue, bytecode.OpReturn:
+			result := object.Object(object.NullValue)
+			if op == bytecode.OpReturnValue {
+				result = vm.pop()
+			}
+			if vm.framesIndex == 1 {
+				// A return statement at the top level ends the program.
+				return nil
+			}
+			err = vm.ret(result)
+
+		case bytecode.OpClosure:
+			index := bytecode.ReadUint16(ins[frame.ip+1:])
+			numFree := int(bytecode.ReadUint8(ins[frame.ip+3:]))
+			frame.ip += 3
+			free := make([]object.Object, numFree)
+			copy(free, vm.stack[vm.sp-numFree:vm.sp])
+			vm.sp -= numFree
+			err = vm.push(&Closure{Fn: vm.constants[index].(*bytecode.CompiledFunction), Free: free})
+
+		default:
+			err = fmt.Errorf("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ret returns a value from the innermost call, replacing the callee and its
+// arguments on the stack of the caller with it.
+func (vm *VM) ret(result object.Object) error {
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	return vm.push(result)
+}
+
+// call calls the function below the arguments on the stack. A tail call
+// returns the result from the current function, and replaces its frame
+// rather than adding one.
+func (vm *VM) call(numArgs int, tail bool) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, numArgs)
+		}
+		basePointer := vm.sp - numArgs
+		if tail {
+			// Move the callee and the arguments over those of the current call.
+			basePointer = vm.currentFrame().basePointer
+			copy(vm.stack[basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+			vm.popFrame()
+		}
+		if basePointer+callee.Fn.NumLocals >= StackSize {
+			return errStackOverflow
+		}
+		if err := vm.pushFrame(NewFrame(callee, basePointer)); err != nil {
+			return err
+		}
+		// Locals not bound yet read as null.
+		for n := basePointer + numArgs; n < basePointer+callee.Fn.NumLocals; n++ {
+			vm.stack[n] = object.NullValue
+		}
+		vm.sp = basePointer + callee.Fn.NumLocals
+		return nil
+
+	case *object.Builtin:
+		result := callee.Fn(vm.out, vm.stack[vm.sp-numArgs:vm.sp]...)
+		if err := check(result); err != nil {
+			return err
+		}
+		if tail {
+			return vm.ret(result)
+		}
+		vm.sp -= numArgs + 1
+		return vm.push(result)
+	}
+	return fmt.Errorf("calling non-function: %s", callee.Type())
+}
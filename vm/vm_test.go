@@ -0,0 +1,115 @@
+package vm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/user/golang-interpreter/bytecode"
+	"github.com/user/golang-interpreter/evaluator"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/object"
+	"github.com/user/golang-interpreter/parser"
+	"github.com/user/golang-interpreter/vm"
+)
+
+// run compiles a program and runs it on the virtual machine, and returns its
+// output and runtime error.
+func run(t *testing.T, source string) (string, error) {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("%s: parse errors: %v", source, errs)
+	}
+	compiler := bytecode.New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("%s: %s", source, err)
+	}
+	var out bytes.Buffer
+	err := vm.New(compiler.Bytecode(), &out).Run()
+	return out.String(), err
+}
+
+// evaluate runs a program with the evaluator, the reference the virtual
+// machine must agree with, and returns its output.
+func evaluate(t *testing.T, source string) string {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	var out bytes.Buffer
+	if err, ok := evaluator.Eval(p.ParseProgram(), evaluator.NewEnvironment(&out)).(*object.Error); ok {
+		t.Fatalf("%s: evaluator failed: %s", source, err.Message)
+	}
+	return out.String()
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"arithmetic", "puts(1 + 2 * 3 - 4 / 2); puts(-5); puts(!true, !0);", "5\n-5\nfalse\ntrue\n"},
+		{"conditionals", "puts(if (1 < 2) { 10 } else { 20 }); puts(if (false) { 1 });", "10\nnull\n"},
+		{"strings", `let s = "mon" + "key"; puts(s, len(s), s == "monkey");`, "monkey\n6\ntrue\n"},
+		{"arrays", "let a = [1, 2 + 3, 4]; puts(a[1], a[3], len(a), first(a), last(a), rest(a), push(a, 5));",
+			"5\nnull\n3\n1\n4\n[5, 4]\n[1, 5, 4, 5]\n"},
+		{"hashes", `let h = {"one": 1, 2: "two", true: 3}; puts(h["one"], h[2], h[true], h["none"]);`, "1\ntwo\n3\nnull\n"},
+		{"hash order", `let k = fn(s) { puts(s); s }; let h = {k("a"): 1, k("b"): 2, k("c"): 3}; puts(h["b"]);`, "a\nb\nc\n2\n"},
+		{"builtins as values", "let f = len; puts(f([1, 2]));", "2\n"},
+		{"closures", "let add = fn(a) { fn(b) { a + b } }; let inc = add(1); puts(inc(41), add(2)(3));", "42\n5\n"},
+		{"nested closures", "let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; puts(f(1)(2)(3));", "6\n"},
+		{"recursion", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; puts(fib(15));", "610\n"},
+		{"local recursion", "let f = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) }; puts(f());", "120\n"},
+		{"redefined global", "let a = 1; let f = fn() { a + a }; let a = 2; puts(f());", "4\n"},
+		{"redefined local", "let mk = fn() { let n = 1; let get = fn() { n }; let n = 2; get }; puts(mk()());", "2\n"},
+		{"redefined parameter", "let f = fn(x) { let g = fn() { x }; let x = x * 10; g() }; puts(f(3));", "30\n"},
+		{"binding after the closure", "let f = fn() { let g = fn() { h() }; let h = fn() { 5 }; g() }; puts(f());", "5\n"},
+		{"binding after the closure, nested", "let f = fn() { let g = fn() { fn() { h() } }; let h = fn() { 7 }; g()() }; puts(f());", "7\n"},
+		{"block scope", "let x = 1; let f = fn() { if (true) { let x = 2; puts(x); } x }; puts(f());", "2\n1\n"},
+		{"tail calls", "let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; puts(count(100000));", "0\n"},
+		{"return at the top level", "puts(1); return 2; puts(3);", "1\n"},
+	}
+	for _, tt := range tests {
+		got, err := run(t, tt.source)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: printed %q, want %q", tt.name, got, tt.want)
+		}
+		if ref := evaluate(t, tt.source); got != ref {
+			t.Errorf("%s: printed %q, the evaluator %q", tt.name, got, ref)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		out    string
+		want   string
+	}{
+		{"puts(1); 1 / 0; puts(2);", "1\n", "division by zero"},
+		{"(-9223372036854775807 - 1) / -1;", "", "integer overflow in division"},
+		{"1 + true;", "", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true;", "", "unknown operator: -BOOLEAN"},
+		{`"a" - "b";`, "", "unknown operator: STRING - STRING"},
+		{"1(2);", "", "calling non-function: INTEGER"},
+		{"let f = fn(a) { a }; f(1, 2);", "", "wrong number of arguments: want=1, got=2"},
+		{"len(1);", "", "argument to len not supported, got INTEGER"},
+		{"push(1, 2);", "", "argument to push must be ARRAY, got INTEGER"},
+		{"first([1], [2]);", "", "wrong number of arguments to first: got 2, want 1"},
+		{"{fn() { 1 }: 2};", "", "unusable as hash key: FUNCTION"},
+		{"let f = fn(n) { f(n + 1) + 1 }; f(0);", "", "stack overflow"},
+	}
+	for _, tt := range tests {
+		out, err := run(t, tt.source)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.source, err, tt.want)
+		}
+		if out != tt.out {
+			t.Errorf("%s: printed %q before the error, want %q", tt.source, out, tt.out)
+		}
+	}
+}
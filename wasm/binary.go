@@ -0,0 +1,197 @@
+package wasm
+
+import "bytes"
+
+// The identifiers of the sections of the binary format.
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionMemory   = 5
+	sectionExport   = 7
+	sectionCode     = 10
+)
+
+// The kinds of imports and exports.
+const (
+	externFunc   = 0x00
+	externMemory = 0x02
+)
+
+// The encodings of the binary format that are not instructions.
+const (
+	funcTypeTag    = 0x60
+	emptyBlockType = 0x40
+	limitsMinOnly  = 0x00
+	alignI64       = 3 // The natural alignment of 64-bit accesses, as a power of 2.
+)
+
+// magic and version start every binary module.
+var (
+	magic   = []byte{0x00, 'a', 's', 'm'}
+	version = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+// encoder writes the binary format.
+type encoder struct {
+	bytes.Buffer
+}
+
+// uleb writes an unsigned LEB128 integer.
+func (e *encoder) uleb(v uint64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		e.WriteByte(b)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+// sleb writes a signed LEB128 integer.
+func (e *encoder) sleb(v int64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		done := v == 0 && b&0x40 == 0 || v == -1 && b&0x40 != 0
+		if !done {
+			b |= 0x80
+		}
+		e.WriteByte(b)
+		if done {
+			return
+		}
+	}
+}
+
+// name writes a name as a length-prefixed UTF-8 string.
+func (e *encoder) name(s string) {
+	e.uleb(uint64(len(s)))
+	e.WriteString(s)
+}
+
+// types writes a vector of value types.
+func (e *encoder) types(types []ValType) {
+	e.uleb(uint64(len(types)))
+	for _, t := range types {
+		e.WriteByte(byte(t))
+	}
+}
+
+// section writes a section holding the contents written by the function.
+func (e *encoder) section(id byte, contents func(s *encoder)) {
+	var s encoder
+	contents(&s)
+	e.WriteByte(id)
+	e.uleb(uint64(s.Len()))
+	e.Write(s.Bytes())
+}
+
+// Encode returns the module in the WebAssembly binary format.
+func (m *Module) Encode() []byte {
+	var e encoder
+	e.Write(magic)
+	e.Write(version)
+
+	e.section(sectionType, func(s *encoder) {
+		s.uleb(uint64(len(m.Types)))
+		for _, t := range m.Types {
+			s.WriteByte(funcTypeTag)
+			s.types(t.Params)
+			s.types(t.Results)
+		}
+	})
+	e.section(sectionImport, func(s *encoder) {
+		s.uleb(uint64(len(m.Imports)))
+		for _, imp := range m.Imports {
+			s.name(imp.Module)
+			s.name(imp.Field)
+			s.WriteByte(externFunc)
+			s.uleb(uint64(imp.Type))
+		}
+	})
+	e.section(sectionFunction, func(s *encoder) {
+		s.uleb(uint64(len(m.Funcs)))
+		for _, f := range m.Funcs {
+			s.uleb(uint64(f.Type))
+		}
+	})
+	e.section(sectionMemory, func(s *encoder) {
+		s.uleb(1)
+		s.WriteByte(limitsMinOnly)
+		s.uleb(uint64(m.MemoryPages))
+	})
+	e.section(sectionExport, func(s *encoder) {
+		exports := 1
+		for _, f := range m.Funcs {
+			if f.Export != "" {
+				exports++
+			}
+		}
+		s.uleb(uint64(exports))
+		s.name(MemoryExport)
+		s.WriteByte(externMemory)
+		s.uleb(0)
+		for n, f := range m.Funcs {
+			if f.Export != "" {
+				s.name(f.Export)
+				s.WriteByte(externFunc)
+				s.uleb(uint64(len(m.Imports) + n))
+			}
+		}
+	})
+	e.section(sectionCode, func(s *encoder) {
+		s.uleb(uint64(len(m.Funcs)))
+		for _, f := range m.Funcs {
+			var body encoder
+			body.locals(f.Locals)
+			for _, in := range f.Body {
+				body.instr(in)
+			}
+			body.WriteByte(byte(OpEnd))
+			s.uleb(uint64(body.Len()))
+			s.Write(body.Bytes())
+		}
+	})
+	return e.Bytes()
+}
+
+// locals writes the declarations of the locals, grouping runs of the same
+// type.
+func (e *encoder) locals(locals []ValType) {
+	var groups encoder
+	count := 0
+	for n := 0; n < len(locals); {
+		run := 1
+		for n+run < len(locals) && locals[n+run] == locals[n] {
+			run++
+		}
+		groups.uleb(uint64(run))
+		groups.WriteByte(byte(locals[n]))
+		count++
+		n += run
+	}
+	e.uleb(uint64(count))
+	e.Write(groups.Bytes())
+}
+
+// instr writes an instruction and its immediate.
+func (e *encoder) instr(in Instr) {
+	e.WriteByte(byte(in.Op))
+	switch in.Op.immediates() {
+	case immBlock:
+		e.WriteByte(emptyBlockType)
+	case immIndex:
+		e.uleb(uint64(in.Imm))
+	case immConst:
+		e.sleb(in.Imm)
+	case immMemory:
+		e.uleb(alignI64)
+		e.uleb(uint64(in.Imm))
+	}
+}
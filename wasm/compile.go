@@ -0,0 +1,323 @@
+package wasm
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// The module and names of the functions imported from the host, which print
+// an integer or a boolean followed by a newline.
+const (
+	importModule  = "env"
+	putsIntField  = "puts_int"
+	putsBoolField = "puts_bool"
+)
+
+// globalSize is the number of bytes of linear memory each global takes.
+const globalSize = 8
+
+// compiler translates a module of the intermediate representation.
+type compiler struct {
+	module  *intermediate.Module
+	mod     *Module
+	funcs   map[string]int // The index of every function, by name.
+	globals map[string]int // The address of every global in linear memory.
+}
+
+// Compile translates a module of the intermediate representation into a
+// WebAssembly module. The main function is exported as main.
+func Compile(module *intermediate.Module) (*Module, error) {
+	c := &compiler{
+		module:  module,
+		mod:     &Module{MemoryPages: 1},
+		funcs:   make(map[string]int),
+		globals: make(map[string]int),
+	}
+	for n, name := range module.Globals {
+		c.globals[name] = globalSize * n
+	}
+	if len(module.Globals)*globalSize > 1<<16 {
+		c.mod.MemoryPages = (len(module.Globals)*globalSize + 1<<16 - 1) >> 16
+	}
+
+	c.mod.Imports = []Import{
+		{Module: importModule, Field: putsIntField, Name: "$rt." + putsIntField,
+			Type: c.mod.typeIndex(FuncType{Params: []ValType{I64}})},
+		{Module: importModule, Field: putsBoolField, Name: "$rt." + putsBoolField,
+			Type: c.mod.typeIndex(FuncType{Params: []ValType{I32}})},
+	}
+	for n, fn := range module.Functions {
+		c.funcs[fn.Name] = len(c.mod.Imports) + n
+	}
+	for _, fn := range module.Functions {
+		f, err := c.compileFunction(fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fn.Name, err)
+		}
+		c.mod.Funcs = append(c.mod.Funcs, f)
+	}
+	return c.mod, nil
+}
+
+// valType returns the WebAssembly type holding values of the type.
+func valType(t intermediate.Type) ValType {
+	if t == intermediate.TypeBool {
+		return I32
+	}
+	return I64
+}
+
+// signature returns the signature of the function.
+func signature(fn *intermediate.Function) FuncType {
+	var t FuncType
+	for _, p := range fn.Params {
+		t.Params = append(t.Params, valType(p.Type))
+	}
+	if fn.ReturnType != intermediate.TypeVoid {
+		t.Results = []ValType{valType(fn.ReturnType)}
+	}
+	return t
+}
+
+// funcCompiler translates one function.
+type funcCompiler struct {
+	*compiler
+	fn      *intermediate.Function
+	f       *Func
+	sig     FuncType
+	locals  map[*intermediate.Instr]int  // The local holding every value computed into one.
+	uses    []int                        // The number of uses of every value.
+	inlined map[*intermediate.Instr]bool // The values computed where they are used.
+}
+
+// compileFunction translates a function.
+func (c *compiler) compileFunction(fn *intermediate.Function) (*Func, error) {
+	fc := &funcCompiler{
+		compiler: c,
+		fn:       fn,
+		sig:      signature(fn),
+		locals:   make(map[*intermediate.Instr]int),
+		uses:     fn.Uses(),
+		inlined:  make(map[*intermediate.Instr]bool),
+	}
+	fc.f = &Func{Name: "$" + fn.Name, Type: c.mod.typeIndex(fc.sig)}
+	if fn.Name == intermediate.MainFunction {
+		fc.f.Export = intermediate.MainFunction
+	}
+	fc.assignLocals()
+
+	s := newStackifier(fc)
+	if err := s.checkReducible(); err != nil {
+		return nil, err
+	}
+	s.doTree(fn.Entry())
+	if len(fc.sig.Results) > 0 {
+		// Every path returns explicitly, but the end of the body is
+		// reachable as far as validation is concerned when the last
+		// construct is a loop.
+		fc.emit(OpUnreachable, 0)
+	}
+	return fc.f, nil
+}
+
+// assignLocals decides which values are computed where they are used and
+// gives a local to the others. The parameters are the first locals.
+func (fc *funcCompiler) assignLocals() {
+	for _, b := range fc.fn.Blocks {
+		for n, in := range b.Instrs {
+			if in.Op == intermediate.OpParam {
+				fc.locals[in] = int(in.Const)
+				continue
+			}
+			if in.Type == intermediate.TypeVoid || in.Op == intermediate.OpConst {
+				continue
+			}
+			if fc.inlinable(b, n) {
+				fc.inlined[in] = true
+				continue
+			}
+			fc.locals[in] = len(fc.sig.Params) + len(fc.f.Locals)
+			fc.f.Locals = append(fc.f.Locals, valType(in.Type))
+		}
+	}
+}
+
+// inlinable returns true if the value of the instruction with the index in
+// the block can be computed where it is used rather than into a local: it is
+// used once, by a later instruction of the same block other than a phi, and
+// computing it has no effect and cannot trap, so it can move past the
+// instructions in between.
+func (fc *funcCompiler) inlinable(b *intermediate.Block, n int) bool {
+	in := b.Instrs[n]
+	switch in.Op {
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul, intermediate.OpNeg,
+		intermediate.OpNot, intermediate.OpEq, intermediate.OpNe, intermediate.OpLt,
+		intermediate.OpGt, intermediate.OpZext:
+	default:
+		return false
+	}
+	if fc.uses[in.ID] != 1 {
+		return false
+	}
+	for _, user := range b.Instrs[n+1:] {
+		for _, a := range user.Args {
+			if a == in {
+				return user.Op != intermediate.OpPhi
+			}
+		}
+	}
+	return false
+}
+
+// emit appends an instruction to the body of the function.
+func (fc *funcCompiler) emit(op Opcode, imm int64) {
+	fc.f.Body = append(fc.f.Body, Instr{Op: op, Imm: imm})
+}
+
+// value pushes the value of an instruction of the function on the stack.
+func (fc *funcCompiler) value(v *intermediate.Instr) {
+	switch {
+	case v.Op == intermediate.OpConst && v.Type == intermediate.TypeBool:
+		fc.emit(OpI32Const, v.Const)
+	case v.Op == intermediate.OpConst:
+		fc.emit(OpI64Const, v.Const)
+	case fc.inlined[v]:
+		fc.expr(v)
+	default:
+		fc.emit(OpLocalGet, int64(fc.locals[v]))
+	}
+}
+
+// valueAs pushes the value on the stack as the type, widening a boolean
+// passed where an integer is expected.
+func (fc *funcCompiler) valueAs(v *intermediate.Instr, t ValType) {
+	fc.value(v)
+	if valType(v.Type) == I32 && t == I64 {
+		fc.emit(OpI64ExtendU, 0)
+	}
+}
+
+// binaryOps maps the binary operations on integers to instructions.
+var binaryOps = map[intermediate.Op]Opcode{
+	intermediate.OpAdd: OpI64Add,
+	intermediate.OpSub: OpI64Sub,
+	intermediate.OpMul: OpI64Mul,
+	intermediate.OpDiv: OpI64DivS,
+	intermediate.OpEq:  OpI64Eq,
+	intermediate.OpNe:  OpI64Ne,
+	intermediate.OpLt:  OpI64LtS,
+	intermediate.OpGt:  OpI64GtS,
+}
+
+// expr pushes the result of an instruction on the stack, or performs it if
+// it has no result.
+func (fc *funcCompiler) expr(in *intermediate.Instr) {
+	switch in.Op {
+	case intermediate.OpAdd, intermediate.OpSub, intermediate.OpMul, intermediate.OpDiv,
+		intermediate.OpLt, intermediate.OpGt:
+		fc.value(in.Args[0])
+		fc.value(in.Args[1])
+		fc.emit(binaryOps[in.Op], 0)
+
+	case intermediate.OpEq, intermediate.OpNe:
+		// Booleans are compared to each other as 32-bit integers.
+		fc.value(in.Args[0])
+		fc.value(in.Args[1])
+		op := binaryOps[in.Op]
+		if valType(in.Args[0].Type) == I32 {
+			op = map[intermediate.Op]Opcode{intermediate.OpEq: OpI32Eq, intermediate.OpNe: OpI32Ne}[in.Op]
+		}
+		fc.emit(op, 0)
+
+	case intermediate.OpNeg:
+		fc.emit(OpI64Const, 0)
+		fc.value(in.Args[0])
+		fc.emit(OpI64Sub, 0)
+
+	case intermediate.OpNot:
+		fc.value(in.Args[0])
+		fc.emit(OpI32Eqz, 0)
+
+	case intermediate.OpZext:
+		fc.valueAs(in.Args[0], I64)
+
+	case intermediate.OpCall:
+		fc.call(OpCall, in)
+
+	case intermediate.OpLoadGlobal:
+		fc.emit(OpI32Const, 0)
+		fc.emit(OpI64Load, int64(fc.globals[in.Name]))
+
+	case intermediate.OpStoreGlobal:
+		fc.emit(OpI32Const, 0)
+		fc.valueAs(in.Args[0], I64)
+		fc.emit(OpI64Store, int64(fc.globals[in.Name]))
+
+	case intermediate.OpReturn:
+		if len(in.Args) > 0 {
+			fc.valueAs(in.Args[0], fc.sig.Results[0])
+		}
+		fc.emit(OpReturn, 0)
+
+	case intermediate.OpTailCall:
+		fc.call(OpReturnCall, in)
+	}
+}
+
+// call pushes the arguments and calls the callee of the instruction. Calls of
+// puts go to the host function printing the type of the argument.
+func (fc *funcCompiler) call(op Opcode, in *intermediate.Instr) {
+	if in.Name == "puts" {
+		index := 0
+		if in.Args[0].Type == intermediate.TypeBool {
+			index = 1
+		}
+		fc.value(in.Args[0])
+		fc.emit(op, int64(index))
+		return
+	}
+	params := signature(fc.module.Function(in.Name)).Params
+	for n, a := range in.Args {
+		fc.valueAs(a, params[n])
+	}
+	fc.emit(op, int64(fc.funcs[in.Name]))
+}
+
+// block emits the instructions of a block other than its phis and its
+// terminator. The values computed into locals are stored there, and the
+// results nobody uses are dropped.
+func (fc *funcCompiler) block(b *intermediate.Block) {
+	for _, in := range b.Instrs {
+		switch {
+		case in.Op == intermediate.OpPhi || in.Op == intermediate.OpParam ||
+			in.Op == intermediate.OpConst || in.Op.IsTerminator() || fc.inlined[in]:
+			continue
+		case in.Type == intermediate.TypeVoid:
+			fc.expr(in)
+		case fc.uses[in.ID] > 0:
+			fc.expr(in)
+			fc.emit(OpLocalSet, int64(fc.locals[in]))
+		case in.HasSideEffects():
+			fc.expr(in)
+			fc.emit(OpDrop, 0)
+		}
+	}
+}
+
+// phiCopies assigns the locals of the phis of target the operands for the
+// edge from the block. All the operands are pushed before any local is
+// assigned, since phis of a loop header may read each other's values.
+func (fc *funcCompiler) phiCopies(from, target *intermediate.Block) {
+	phis := target.Phis()
+	if len(phis) == 0 {
+		return
+	}
+	n := target.PredIndex(from)
+	for _, phi := range phis {
+		fc.valueAs(phi.Args[n], valType(phi.Type))
+	}
+	for k := len(phis) - 1; k >= 0; k-- {
+		fc.emit(OpLocalSet, int64(fc.locals[phis[k]]))
+	}
+}
@@ -0,0 +1,44 @@
+package wasm
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// TargetName is the name of the WebAssembly target accepted by the --target
+// flag.
+const TargetName = "wasm"
+
+// The output formats of the WebAssembly target. The text format is the
+// assembly language of WebAssembly, so it is also emitted for asm.
+const (
+	EmitWat  = "wat"  // The text format.
+	EmitWasm = "wasm" // The binary format.
+)
+
+// GenerateCode translates the module to WebAssembly and writes it to the
+// output file in the requested format. The binary encoding of the module is
+// validated before either format is written.
+func GenerateCode(module *intermediate.Module, outputFile string, emit string) error {
+	m, err := Compile(module)
+	if err != nil {
+		return err
+	}
+	binary := m.Encode()
+	if err := Validate(binary); err != nil {
+		return fmt.Errorf("invalid WebAssembly module: %s", err)
+	}
+
+	var output []byte
+	switch emit {
+	case "", "asm", EmitWat:
+		output = []byte(m.Text())
+	case EmitWasm:
+		output = binary
+	default:
+		return fmt.Errorf("target %s cannot emit %s files, only %s or %s", TargetName, emit, EmitWat, EmitWasm)
+	}
+	return ioutil.WriteFile(outputFile, output, 0644)
+}
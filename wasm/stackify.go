@@ -0,0 +1,175 @@
+package wasm
+
+import (
+	"fmt"
+
+	"github.com/user/golang-interpreter/intermediate"
+)
+
+// frameKind represents the kind of a structured control construct enclosing
+// the code being emitted.
+type frameKind int
+
+const (
+	ifThenElse      frameKind = iota // An if, which no branch targets.
+	loopHeadedBy                     // A loop, a branch to which continues at its header.
+	blockFollowedBy                  // A block, a branch to which continues after its end.
+)
+
+// frame represents an enclosing control construct and the block a branch to
+// it continues at.
+type frame struct {
+	kind  frameKind
+	block *intermediate.Block
+}
+
+// stackifier reconstructs structured control flow from the control flow
+// graph of a function, following "Beyond Relooper" by Norman Ramsey. The
+// code of each block is emitted where its immediate dominator branches to
+// it, except for merge nodes, which are reached by more than one forward
+// edge: a merge node follows a block wrapped around the code of its
+// immediate dominator, and a branch to it leaves that block. A loop header
+// starts a loop, and a branch back to it continues the loop.
+type stackifier struct {
+	fc      *funcCompiler
+	dom     *intermediate.DomTree
+	rpo     map[*intermediate.Block]int // The reverse postorder number of every reachable block.
+	forward map[*intermediate.Block]int // The number of forward edges into every block.
+	loop    map[*intermediate.Block]bool
+	ctx     []frame // The enclosing constructs, innermost last.
+}
+
+// newStackifier analyzes the control flow graph of the function.
+func newStackifier(fc *funcCompiler) *stackifier {
+	s := &stackifier{
+		fc:      fc,
+		dom:     intermediate.Dominators(fc.fn),
+		rpo:     make(map[*intermediate.Block]int),
+		forward: make(map[*intermediate.Block]int),
+		loop:    make(map[*intermediate.Block]bool),
+	}
+	for n, b := range s.dom.Order {
+		s.rpo[b] = n
+	}
+	for _, b := range s.dom.Order {
+		for _, succ := range b.Succs() {
+			if s.rpo[succ] > s.rpo[b] {
+				s.forward[succ]++
+			} else {
+				s.loop[succ] = true
+			}
+		}
+	}
+	return s
+}
+
+// checkReducible returns an error if the control flow graph is irreducible,
+// which happens if the target of a back edge does not dominate its source.
+// The source language only produces reducible control flow.
+func (s *stackifier) checkReducible() error {
+	for _, b := range s.dom.Order {
+		for _, succ := range b.Succs() {
+			if s.rpo[succ] <= s.rpo[b] && !s.dom.Dominates(succ, b) {
+				return fmt.Errorf("irreducible control flow from %s to %s", b.Label(), succ.Label())
+			}
+		}
+	}
+	return nil
+}
+
+// isMerge returns true if the block is reached by more than one forward edge.
+func (s *stackifier) isMerge(b *intermediate.Block) bool {
+	return s.forward[b] > 1
+}
+
+// doTree emits the code of the block and of the blocks it dominates.
+func (s *stackifier) doTree(b *intermediate.Block) {
+	var merges []*intermediate.Block
+	for _, child := range s.dom.Children[b] {
+		if s.isMerge(child) {
+			merges = append(merges, child)
+		}
+	}
+	// The children are in reverse postorder already, since the dominator
+	// tree is built by walking the blocks in that order.
+	if s.loop[b] {
+		s.enter(OpLoop, loopHeadedBy, b)
+		s.nodeWithin(b, merges)
+		s.leave()
+		return
+	}
+	s.nodeWithin(b, merges)
+}
+
+// nodeWithin emits the code of the block inside one block construct for each
+// of the merge nodes it immediately dominates, the last one in reverse
+// postorder outermost, each followed by the code of its merge node.
+func (s *stackifier) nodeWithin(b *intermediate.Block, merges []*intermediate.Block) {
+	if len(merges) == 0 {
+		s.fc.block(b)
+		s.terminator(b)
+		return
+	}
+	last := merges[len(merges)-1]
+	s.enter(OpBlock, blockFollowedBy, last)
+	s.nodeWithin(b, merges[:len(merges)-1])
+	s.leave()
+	s.doTree(last)
+}
+
+// terminator emits the terminator of the block.
+func (s *stackifier) terminator(b *intermediate.Block) {
+	t := b.Terminator()
+	switch t.Op {
+	case intermediate.OpJump:
+		s.branch(b, t.Targets[0])
+	case intermediate.OpBranch:
+		s.fc.value(t.Args[0])
+		s.enter(OpIf, ifThenElse, nil)
+		s.branch(b, t.Targets[0])
+		s.fc.emit(OpElse, 0)
+		s.branch(b, t.Targets[1])
+		s.leave()
+	default:
+		s.fc.expr(t)
+	}
+}
+
+// branch emits the transfer of control along the edge from one block to
+// another, after assigning the phis of the target: a branch back to the loop
+// it heads, a branch out of the block its merge node follows, or else the
+// code of the target itself, which the source immediately dominates.
+func (s *stackifier) branch(from, to *intermediate.Block) {
+	s.fc.phiCopies(from, to)
+	switch {
+	case s.rpo[to] <= s.rpo[from]:
+		s.fc.emit(OpBr, s.depth(loopHeadedBy, to))
+	case s.isMerge(to):
+		s.fc.emit(OpBr, s.depth(blockFollowedBy, to))
+	default:
+		s.doTree(to)
+	}
+}
+
+// depth returns the label depth of the innermost enclosing construct of the
+// kind for the block.
+func (s *stackifier) depth(kind frameKind, b *intermediate.Block) int64 {
+	for n := len(s.ctx) - 1; n >= 0; n-- {
+		if s.ctx[n].kind == kind && s.ctx[n].block == b {
+			return int64(len(s.ctx) - 1 - n)
+		}
+	}
+	panic(fmt.Sprintf("no enclosing construct for a branch to %s", b.Label()))
+}
+
+// enter starts a control construct.
+func (s *stackifier) enter(op Opcode, kind frameKind, b *intermediate.Block) {
+	s.fc.emit(op, 0)
+	s.ctx = append(s.ctx, frame{kind: kind, block: b})
+}
+
+// leave ends the innermost control construct.
+func (s *stackifier) leave() {
+	s.fc.emit(OpEnd, 0)
+	s.ctx = s.ctx[:len(s.ctx)-1]
+}
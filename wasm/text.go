@@ -0,0 +1,84 @@
+package wasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Text returns the module in the WebAssembly text format, with the function
+// bodies as indented sequences of instructions.
+func (m *Module) Text() string {
+	var b strings.Builder
+	b.WriteString("(module\n")
+	for n, t := range m.Types {
+		fmt.Fprintf(&b, "  (type (;%d;) (func%s))\n", n, signatureText(t))
+	}
+	for _, imp := range m.Imports {
+		fmt.Fprintf(&b, "  (import %q %q (func %s (type %d)))\n", imp.Module, imp.Field, imp.Name, imp.Type)
+	}
+	fmt.Fprintf(&b, "  (memory (export %q) %d)\n", MemoryExport, m.MemoryPages)
+	for _, f := range m.Funcs {
+		fmt.Fprintf(&b, "  (func %s", f.Name)
+		if f.Export != "" {
+			fmt.Fprintf(&b, " (export %q)", f.Export)
+		}
+		fmt.Fprintf(&b, " (type %d)%s\n", f.Type, signatureText(m.Types[f.Type]))
+		if len(f.Locals) > 0 {
+			fmt.Fprintf(&b, "    (local%s)\n", typesText(f.Locals))
+		}
+		indent := 2
+		for _, in := range f.Body {
+			if in.Op == OpEnd || in.Op == OpElse {
+				indent--
+			}
+			fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", indent), m.instrText(in))
+			if in.Op.immediates() == immBlock || in.Op == OpElse {
+				indent++
+			}
+		}
+		b.WriteString("  )\n")
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// signatureText returns the parameters and results of a signature in the
+// text format.
+func signatureText(t FuncType) string {
+	var s string
+	if len(t.Params) > 0 {
+		s += " (param" + typesText(t.Params) + ")"
+	}
+	if len(t.Results) > 0 {
+		s += " (result" + typesText(t.Results) + ")"
+	}
+	return s
+}
+
+// typesText returns a list of types in the text format, each preceded by a
+// space.
+func typesText(types []ValType) string {
+	var s string
+	for _, t := range types {
+		s += " " + t.String()
+	}
+	return s
+}
+
+// instrText returns an instruction in the text format.
+func (m *Module) instrText(in Instr) string {
+	switch in.Op.immediates() {
+	case immIndex:
+		if in.Op == OpCall || in.Op == OpReturnCall {
+			return fmt.Sprintf("%s %s", in.Op, m.funcName(int(in.Imm)))
+		}
+		return fmt.Sprintf("%s %d", in.Op, in.Imm)
+	case immConst:
+		return fmt.Sprintf("%s %d", in.Op, in.Imm)
+	case immMemory:
+		if in.Imm != 0 {
+			return fmt.Sprintf("%s offset=%d", in.Op, in.Imm)
+		}
+	}
+	return in.Op.String()
+}
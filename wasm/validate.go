@@ -0,0 +1,718 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// errTruncated is returned when the module ends in the middle of a
+// construct.
+var errTruncated = errors.New("unexpected end of module")
+
+// decoder reads the binary format.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// byte reads a byte.
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+// uleb reads an unsigned LEB128 integer of at most the number of bits.
+func (d *decoder) uleb(bits uint) (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b, err := d.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits || shift+7 > bits && b&0x7f>>(bits-shift) != 0 {
+			return 0, fmt.Errorf("integer too large at offset %d", d.pos-1)
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// u32 reads an unsigned 32-bit LEB128 integer, used for counts and indices.
+func (d *decoder) u32() (int, error) {
+	v, err := d.uleb(32)
+	return int(v), err
+}
+
+// sleb reads a signed LEB128 integer of at most the number of bits.
+func (d *decoder) sleb(bits uint) (int64, error) {
+	var v int64
+	for shift := uint(0); ; shift += 7 {
+		b, err := d.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits {
+			return 0, fmt.Errorf("integer too large at offset %d", d.pos-1)
+		}
+		v |= int64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if shift+7 < 64 && b&0x40 != 0 {
+				v |= -1 << (shift + 7)
+			}
+			return v, nil
+		}
+	}
+}
+
+// bytes reads n bytes.
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// name reads a length-prefixed name.
+func (d *decoder) name() (string, error) {
+	n, err := d.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.bytes(n)
+	return string(b), err
+}
+
+// valType reads a value type.
+func (d *decoder) valType() (ValType, error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch ValType(b) {
+	case I32, I64:
+		return ValType(b), nil
+	}
+	return 0, fmt.Errorf("unsupported value type 0x%02x", b)
+}
+
+// types reads a vector of value types.
+func (d *decoder) types() ([]ValType, error) {
+	n, err := d.u32()
+	if err != nil {
+		return nil, err
+	}
+	var types []ValType
+	for ; n > 0; n-- {
+		t, err := d.valType()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// validator holds what the sections of a module declare, which the later
+// sections are checked against.
+type validator struct {
+	types   []FuncType
+	funcs   []int // The signature of every function, imports first.
+	imports int   // The number of imported functions.
+	memory  bool  // Whether the module has a memory.
+	bodies  int   // The number of function bodies.
+}
+
+// Validate checks that a binary module is well-formed: that it decodes, that
+// every index it uses is in range and that every function body is well
+// typed. It supports the subset of WebAssembly the backend generates.
+func Validate(module []byte) error {
+	d := &decoder{data: module}
+	header, err := d.bytes(8)
+	if err != nil || !bytes.Equal(header[:4], magic) {
+		return errors.New("missing magic number")
+	}
+	if !bytes.Equal(header[4:], version) {
+		return errors.New("unsupported version")
+	}
+
+	v := &validator{}
+	last := 0
+	for d.pos < len(d.data) {
+		id, err := d.byte()
+		if err != nil {
+			return err
+		}
+		size, err := d.u32()
+		if err != nil {
+			return err
+		}
+		contents, err := d.bytes(size)
+		if err != nil {
+			return err
+		}
+		if id == sectionCustom {
+			continue
+		}
+		if int(id) <= last {
+			return fmt.Errorf("section %d out of order", id)
+		}
+		last = int(id)
+		s := &decoder{data: contents}
+		if err := v.section(id, s); err != nil {
+			return fmt.Errorf("section %d: %s", id, err)
+		}
+		if s.pos != len(s.data) {
+			return fmt.Errorf("section %d: %d bytes left over", id, len(s.data)-s.pos)
+		}
+	}
+	if v.bodies != len(v.funcs)-v.imports {
+		return fmt.Errorf("%d functions declared but %d bodies", len(v.funcs)-v.imports, v.bodies)
+	}
+	return nil
+}
+
+// section validates the contents of a section.
+func (v *validator) section(id byte, d *decoder) error {
+	count, err := d.u32()
+	if err != nil {
+		return err
+	}
+	for n := 0; n < count; n++ {
+		var err error
+		switch id {
+		case sectionType:
+			err = v.funcType(d)
+		case sectionImport:
+			err = v.importEntry(d)
+		case sectionFunction:
+			err = v.function(d)
+		case sectionMemory:
+			err = v.memoryEntry(d, count)
+		case sectionExport:
+			err = v.export(d)
+		case sectionCode:
+			err = v.code(d, n)
+		default:
+			err = errors.New("unsupported section")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// funcType validates a signature.
+func (v *validator) funcType(d *decoder) error {
+	tag, err := d.byte()
+	if err != nil {
+		return err
+	}
+	if tag != funcTypeTag {
+		return fmt.Errorf("malformed function type 0x%02x", tag)
+	}
+	var t FuncType
+	if t.Params, err = d.types(); err != nil {
+		return err
+	}
+	if t.Results, err = d.types(); err != nil {
+		return err
+	}
+	v.types = append(v.types, t)
+	return nil
+}
+
+// typeIndex reads the index of a signature.
+func (v *validator) typeIndex(d *decoder) (int, error) {
+	t, err := d.u32()
+	if err != nil {
+		return 0, err
+	}
+	if t >= len(v.types) {
+		return 0, fmt.Errorf("unknown type %d", t)
+	}
+	return t, nil
+}
+
+// importEntry validates an import, which must be a function.
+func (v *validator) importEntry(d *decoder) error {
+	if _, err := d.name(); err != nil {
+		return err
+	}
+	if _, err := d.name(); err != nil {
+		return err
+	}
+	kind, err := d.byte()
+	if err != nil {
+		return err
+	}
+	if kind != externFunc {
+		return fmt.Errorf("unsupported import kind 0x%02x", kind)
+	}
+	t, err := v.typeIndex(d)
+	if err != nil {
+		return err
+	}
+	v.funcs = append(v.funcs, t)
+	v.imports++
+	return nil
+}
+
+// function validates the declaration of a function defined by the module.
+func (v *validator) function(d *decoder) error {
+	t, err := v.typeIndex(d)
+	if err != nil {
+		return err
+	}
+	v.funcs = append(v.funcs, t)
+	return nil
+}
+
+// memoryEntry validates a memory, of which there can be only one.
+func (v *validator) memoryEntry(d *decoder, count int) error {
+	if count > 1 {
+		return errors.New("multiple memories")
+	}
+	flags, err := d.byte()
+	if err != nil {
+		return err
+	}
+	min, err := d.u32()
+	if err != nil {
+		return err
+	}
+	max := 1 << 16
+	switch flags {
+	case 0x00:
+	case 0x01:
+		if max, err = d.u32(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("malformed limits 0x%02x", flags)
+	}
+	if min > max || max > 1<<16 {
+		return errors.New("memory size out of range")
+	}
+	v.memory = true
+	return nil
+}
+
+// export validates an export of a function or the memory.
+func (v *validator) export(d *decoder) error {
+	if _, err := d.name(); err != nil {
+		return err
+	}
+	kind, err := d.byte()
+	if err != nil {
+		return err
+	}
+	index, err := d.u32()
+	if err != nil {
+		return err
+	}
+	switch {
+	case kind == externFunc && index < len(v.funcs):
+	case kind == externMemory && index == 0 && v.memory:
+	default:
+		return fmt.Errorf("export of unknown item %d of kind 0x%02x", index, kind)
+	}
+	return nil
+}
+
+// code validates the body of the nth function defined by the module.
+func (v *validator) code(d *decoder, n int) error {
+	if v.imports+n >= len(v.funcs) {
+		return errors.New("more bodies than functions")
+	}
+	v.bodies++
+	size, err := d.u32()
+	if err != nil {
+		return err
+	}
+	body, err := d.bytes(size)
+	if err != nil {
+		return err
+	}
+	sig := v.types[v.funcs[v.imports+n]]
+	fv := &funcValidator{v: v, d: &decoder{data: body}, sig: sig}
+	if err := fv.validate(); err != nil {
+		return fmt.Errorf("function %d: %s", v.imports+n, err)
+	}
+	return nil
+}
+
+// unknown is the type of an operand popped from the polymorphic stack of
+// unreachable code, which matches any type.
+const unknown ValType = 0
+
+// ctrlFrame represents a control construct being validated.
+type ctrlFrame struct {
+	op          Opcode    // The instruction starting the construct.
+	results     []ValType // The types the construct leaves on the stack.
+	height      int       // The height of the operand stack at the start.
+	unreachable bool      // Whether the rest of the construct is unreachable.
+}
+
+// funcValidator checks that a function body is well typed, following the
+// validation algorithm of the appendix of the WebAssembly specification.
+type funcValidator struct {
+	v      *validator
+	d      *decoder
+	sig    FuncType
+	locals []ValType
+	vals   []ValType
+	ctrls  []ctrlFrame
+}
+
+// push pushes an operand type.
+func (fv *funcValidator) push(t ValType) {
+	fv.vals = append(fv.vals, t)
+}
+
+// pop pops an operand and checks that it has the expected type, unless that
+// is unknown.
+func (fv *funcValidator) pop(expect ValType) (ValType, error) {
+	frame := &fv.ctrls[len(fv.ctrls)-1]
+	if len(fv.vals) == frame.height {
+		if frame.unreachable {
+			return expect, nil
+		}
+		return 0, errors.New("operand stack underflow")
+	}
+	t := fv.vals[len(fv.vals)-1]
+	fv.vals = fv.vals[:len(fv.vals)-1]
+	if expect != unknown && t != unknown && t != expect {
+		return 0, fmt.Errorf("type mismatch: expected %s, found %s", expect, t)
+	}
+	return t, nil
+}
+
+// popAll pops operands of the types, the last one first.
+func (fv *funcValidator) popAll(types []ValType) error {
+	for n := len(types) - 1; n >= 0; n-- {
+		if _, err := fv.pop(types[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushCtrl starts a control construct.
+func (fv *funcValidator) pushCtrl(op Opcode, results []ValType) {
+	fv.ctrls = append(fv.ctrls, ctrlFrame{op: op, results: results, height: len(fv.vals)})
+}
+
+// popCtrl ends the innermost control construct, checking that it leaves
+// exactly its results on the stack.
+func (fv *funcValidator) popCtrl() (ctrlFrame, error) {
+	frame := fv.ctrls[len(fv.ctrls)-1]
+	if err := fv.popAll(frame.results); err != nil {
+		return frame, err
+	}
+	if len(fv.vals) != frame.height {
+		return frame, errors.New("values left on the stack at the end of a block")
+	}
+	fv.ctrls = fv.ctrls[:len(fv.ctrls)-1]
+	return frame, nil
+}
+
+// labelTypes returns the types a branch to the construct carries: none for a
+// loop, which has no parameters, and its results otherwise.
+func labelTypes(frame ctrlFrame) []ValType {
+	if frame.op == OpLoop {
+		return nil
+	}
+	return frame.results
+}
+
+// setUnreachable marks the rest of the innermost construct unreachable.
+func (fv *funcValidator) setUnreachable() {
+	frame := &fv.ctrls[len(fv.ctrls)-1]
+	fv.vals = fv.vals[:frame.height]
+	frame.unreachable = true
+}
+
+// blockType reads the type of a block, which is empty or a single result.
+func (fv *funcValidator) blockType() ([]ValType, error) {
+	b, err := fv.d.byte()
+	if err != nil {
+		return nil, err
+	}
+	if b == emptyBlockType {
+		return nil, nil
+	}
+	fv.d.pos--
+	t, err := fv.d.valType()
+	if err != nil {
+		return nil, err
+	}
+	return []ValType{t}, nil
+}
+
+// local reads a local index and returns the type of the local.
+func (fv *funcValidator) local() (ValType, error) {
+	n, err := fv.d.u32()
+	if err != nil {
+		return 0, err
+	}
+	if n >= len(fv.locals) {
+		return 0, fmt.Errorf("unknown local %d", n)
+	}
+	return fv.locals[n], nil
+}
+
+// callee reads a function index and returns the signature of the function.
+func (fv *funcValidator) callee() (FuncType, error) {
+	n, err := fv.d.u32()
+	if err != nil {
+		return FuncType{}, err
+	}
+	if n >= len(fv.v.funcs) {
+		return FuncType{}, fmt.Errorf("unknown function %d", n)
+	}
+	return fv.v.types[fv.v.funcs[n]], nil
+}
+
+// memarg reads the alignment and offset of a memory access of the size in
+// bytes.
+func (fv *funcValidator) memarg(size int) error {
+	if !fv.v.memory {
+		return errors.New("memory access without a memory")
+	}
+	align, err := fv.d.u32()
+	if err != nil {
+		return err
+	}
+	if 1<<uint(align) > size {
+		return fmt.Errorf("alignment 2**%d larger than the access", align)
+	}
+	_, err = fv.d.u32()
+	return err
+}
+
+// binary maps the binary instructions to their operand and result types.
+var binary = map[Opcode][2]ValType{
+	OpI32Eq:   {I32, I32},
+	OpI32Ne:   {I32, I32},
+	OpI64Eq:   {I64, I32},
+	OpI64Ne:   {I64, I32},
+	OpI64LtS:  {I64, I32},
+	OpI64GtS:  {I64, I32},
+	OpI64Add:  {I64, I64},
+	OpI64Sub:  {I64, I64},
+	OpI64Mul:  {I64, I64},
+	OpI64DivS: {I64, I64},
+}
+
+// unary maps the unary instructions to their operand and result types.
+var unary = map[Opcode][2]ValType{
+	OpI32Eqz:     {I32, I32},
+	OpI64ExtendU: {I32, I64},
+}
+
+// validate decodes the locals and instructions of the body and checks their
+// types.
+func (fv *funcValidator) validate() error {
+	fv.locals = append([]ValType(nil), fv.sig.Params...)
+	groups, err := fv.d.u32()
+	if err != nil {
+		return err
+	}
+	for ; groups > 0; groups-- {
+		count, err := fv.d.u32()
+		if err != nil {
+			return err
+		}
+		t, err := fv.d.valType()
+		if err != nil {
+			return err
+		}
+		if len(fv.locals)+count > 50000 {
+			return errors.New("too many locals")
+		}
+		for ; count > 0; count-- {
+			fv.locals = append(fv.locals, t)
+		}
+	}
+
+	fv.pushCtrl(OpBlock, fv.sig.Results)
+	for len(fv.ctrls) > 0 {
+		at := fv.d.pos
+		if err := fv.instr(); err != nil {
+			return fmt.Errorf("offset %d: %s", at, err)
+		}
+	}
+	if fv.d.pos != len(fv.d.data) {
+		return errors.New("instructions after the end of the body")
+	}
+	return nil
+}
+
+// instr validates one instruction.
+func (fv *funcValidator) instr() error {
+	b, err := fv.d.byte()
+	if err != nil {
+		return err
+	}
+	op := Opcode(b)
+	if types, ok := binary[op]; ok {
+		if err := fv.popAll([]ValType{types[0], types[0]}); err != nil {
+			return err
+		}
+		fv.push(types[1])
+		return nil
+	}
+	if types, ok := unary[op]; ok {
+		if _, err := fv.pop(types[0]); err != nil {
+			return err
+		}
+		fv.push(types[1])
+		return nil
+	}
+
+	switch op {
+	case OpUnreachable:
+		fv.setUnreachable()
+
+	case OpBlock, OpLoop:
+		results, err := fv.blockType()
+		if err != nil {
+			return err
+		}
+		fv.pushCtrl(op, results)
+
+	case OpIf:
+		results, err := fv.blockType()
+		if err != nil {
+			return err
+		}
+		if _, err := fv.pop(I32); err != nil {
+			return err
+		}
+		fv.pushCtrl(op, results)
+
+	case OpElse:
+		frame, err := fv.popCtrl()
+		if err != nil {
+			return err
+		}
+		if frame.op != OpIf {
+			return errors.New("else outside of an if")
+		}
+		fv.pushCtrl(OpElse, frame.results)
+
+	case OpEnd:
+		frame, err := fv.popCtrl()
+		if err != nil {
+			return err
+		}
+		if frame.op == OpIf && len(frame.results) > 0 {
+			return errors.New("if with a result but no else")
+		}
+		for _, t := range frame.results {
+			fv.push(t)
+		}
+
+	case OpBr:
+		depth, err := fv.d.u32()
+		if err != nil {
+			return err
+		}
+		if depth >= len(fv.ctrls) {
+			return fmt.Errorf("unknown label %d", depth)
+		}
+		if err := fv.popAll(labelTypes(fv.ctrls[len(fv.ctrls)-1-depth])); err != nil {
+			return err
+		}
+		fv.setUnreachable()
+
+	case OpReturn:
+		if err := fv.popAll(fv.sig.Results); err != nil {
+			return err
+		}
+		fv.setUnreachable()
+
+	case OpCall, OpReturnCall:
+		t, err := fv.callee()
+		if err != nil {
+			return err
+		}
+		if err := fv.popAll(t.Params); err != nil {
+			return err
+		}
+		if op == OpReturnCall {
+			if !sameTypes(t.Results, fv.sig.Results) {
+				return errors.New("tail call of a function with other results")
+			}
+			fv.setUnreachable()
+			break
+		}
+		for _, r := range t.Results {
+			fv.push(r)
+		}
+
+	case OpDrop:
+		if _, err := fv.pop(unknown); err != nil {
+			return err
+		}
+
+	case OpLocalGet:
+		t, err := fv.local()
+		if err != nil {
+			return err
+		}
+		fv.push(t)
+
+	case OpLocalSet:
+		t, err := fv.local()
+		if err != nil {
+			return err
+		}
+		if _, err := fv.pop(t); err != nil {
+			return err
+		}
+
+	case OpI64Load:
+		if err := fv.memarg(8); err != nil {
+			return err
+		}
+		if _, err := fv.pop(I32); err != nil {
+			return err
+		}
+		fv.push(I64)
+
+	case OpI64Store:
+		if err := fv.memarg(8); err != nil {
+			return err
+		}
+		if err := fv.popAll([]ValType{I32, I64}); err != nil {
+			return err
+		}
+
+	case OpI32Const:
+		if _, err := fv.d.sleb(32); err != nil {
+			return err
+		}
+		fv.push(I32)
+
+	case OpI64Const:
+		if _, err := fv.d.sleb(64); err != nil {
+			return err
+		}
+		fv.push(I64)
+
+	default:
+		return fmt.Errorf("unsupported instruction 0x%02x", b)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package wasm translates the intermediate representation into a
+// WebAssembly module, so that Monkey programs can run in a browser or any
+// other WebAssembly host.
+//
+// Every function of the module becomes a WebAssembly function taking and
+// returning 64-bit integers, and 32-bit ones for booleans. The structured
+// control flow WebAssembly requires is reconstructed from the control flow
+// graph by the stackifier, the globals live in linear memory, and puts calls
+// functions imported from the host. The module can be written in the text
+// format or the binary format, and Validate checks that a binary module is
+// well-formed.
+//
+// Linear memory holds only the globals: there are no heap objects yet, since
+// the intermediate representation has no strings, arrays, hashes or
+// closures, and intermediate.Lower rejects programs using them.
+package wasm
+
+import "fmt"
+
+// ValType represents the type of a WebAssembly value, encoded as in the
+// binary format.
+type ValType byte
+
+const (
+	// I32 represents a 32-bit integer, which holds the booleans.
+	I32 ValType = 0x7f
+	// I64 represents a 64-bit integer, which holds the integers.
+	I64 ValType = 0x7e
+)
+
+// String returns the name of the type in the text format.
+func (t ValType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	}
+	return fmt.Sprintf("type(0x%02x)", byte(t))
+}
+
+// FuncType represents the signature of a function.
+type FuncType struct {
+	Params  []ValType // The types of the parameters.
+	Results []ValType // The types of the results, at most one.
+}
+
+// equal returns true if the two signatures are the same.
+func (t FuncType) equal(u FuncType) bool {
+	return sameTypes(t.Params, u.Params) && sameTypes(t.Results, u.Results)
+}
+
+// sameTypes returns true if the two type lists are the same.
+func sameTypes(a, b []ValType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// Opcode represents a WebAssembly instruction, encoded as in the binary
+// format.
+type Opcode byte
+
+// The instructions the backend generates.
+const (
+	OpUnreachable Opcode = 0x00
+	OpBlock       Opcode = 0x02
+	OpLoop        Opcode = 0x03
+	OpIf          Opcode = 0x04
+	OpElse        Opcode = 0x05
+	OpEnd         Opcode = 0x0b
+	OpBr          Opcode = 0x0c
+	OpReturn      Opcode = 0x0f
+	OpCall        Opcode = 0x10
+	OpReturnCall  Opcode = 0x12
+	OpDrop        Opcode = 0x1a
+	OpLocalGet    Opcode = 0x20
+	OpLocalSet    Opcode = 0x21
+	OpI64Load     Opcode = 0x29
+	OpI64Store    Opcode = 0x37
+	OpI32Const    Opcode = 0x41
+	OpI64Const    Opcode = 0x42
+	OpI32Eqz      Opcode = 0x45
+	OpI32Eq       Opcode = 0x46
+	OpI32Ne       Opcode = 0x47
+	OpI64Eq       Opcode = 0x51
+	OpI64Ne       Opcode = 0x52
+	OpI64LtS      Opcode = 0x53
+	OpI64GtS      Opcode = 0x55
+	OpI64Add      Opcode = 0x7c
+	OpI64Sub      Opcode = 0x7d
+	OpI64Mul      Opcode = 0x7e
+	OpI64DivS     Opcode = 0x7f
+	OpI64ExtendU  Opcode = 0xad
+)
+
+// opcodeNames maps each instruction to its name in the text format.
+var opcodeNames = map[Opcode]string{
+	OpUnreachable: "unreachable",
+	OpBlock:       "block",
+	OpLoop:        "loop",
+	OpIf:          "if",
+	OpElse:        "else",
+	OpEnd:         "end",
+	OpBr:          "br",
+	OpReturn:      "return",
+	OpCall:        "call",
+	OpReturnCall:  "return_call",
+	OpDrop:        "drop",
+	OpLocalGet:    "local.get",
+	OpLocalSet:    "local.set",
+	OpI64Load:     "i64.load",
+	OpI64Store:    "i64.store",
+	OpI32Const:    "i32.const",
+	OpI64Const:    "i64.const",
+	OpI32Eqz:      "i32.eqz",
+	OpI32Eq:       "i32.eq",
+	OpI32Ne:       "i32.ne",
+	OpI64Eq:       "i64.eq",
+	OpI64Ne:       "i64.ne",
+	OpI64LtS:      "i64.lt_s",
+	OpI64GtS:      "i64.gt_s",
+	OpI64Add:      "i64.add",
+	OpI64Sub:      "i64.sub",
+	OpI64Mul:      "i64.mul",
+	OpI64DivS:     "i64.div_s",
+	OpI64ExtendU:  "i64.extend_i32_u",
+}
+
+// String returns the name of the instruction in the text format.
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("op(0x%02x)", byte(op))
+}
+
+// immediate describes the immediate operand an instruction takes.
+type immediate int
+
+const (
+	immNone   immediate = iota // No immediate.
+	immBlock                   // A block type, always empty in generated code.
+	immIndex                   // An unsigned index: a label depth, a function or a local.
+	immConst                   // A signed constant.
+	immMemory                  // An alignment and an offset.
+)
+
+// immediates returns the immediate operand the instruction takes.
+func (op Opcode) immediates() immediate {
+	switch op {
+	case OpBlock, OpLoop, OpIf:
+		return immBlock
+	case OpBr, OpCall, OpReturnCall, OpLocalGet, OpLocalSet:
+		return immIndex
+	case OpI32Const, OpI64Const:
+		return immConst
+	case OpI64Load, OpI64Store:
+		return immMemory
+	}
+	return immNone
+}
+
+// Instr represents an instruction of a function body.
+type Instr struct {
+	Op  Opcode // The instruction.
+	Imm int64  // The label depth, index, constant or memory offset, if the instruction takes one.
+}
+
+// Import represents a function imported from the host.
+type Import struct {
+	Module string // The name of the module the function is imported from.
+	Field  string // The name of the function within the module.
+	Name   string // The name of the function in the text format.
+	Type   int    // The index of the signature of the function.
+}
+
+// Func represents a function defined by the module.
+type Func struct {
+	Name   string    // The name of the function in the text format.
+	Type   int       // The index of the signature of the function.
+	Locals []ValType // The types of the locals beyond the parameters.
+	Body   []Instr   // The instructions, without the final end.
+	Export string    // The name the function is exported as, or empty.
+}
+
+// Module represents a WebAssembly module. The functions are indexed with the
+// imports first, followed by the functions defined by the module.
+type Module struct {
+	Types       []FuncType // The signatures of the functions.
+	Imports     []Import   // The functions imported from the host.
+	Funcs       []*Func    // The functions defined by the module.
+	MemoryPages int        // The initial size of the exported memory, in 64 KiB pages.
+}
+
+// typeIndex returns the index of the signature in the module, adding it if
+// it is not there yet.
+func (m *Module) typeIndex(t FuncType) int {
+	for n, u := range m.Types {
+		if u.equal(t) {
+			return n
+		}
+	}
+	m.Types = append(m.Types, t)
+	return len(m.Types) - 1
+}
+
+// funcName returns the name of the function with the index in the text
+// format.
+func (m *Module) funcName(index int) string {
+	if index < len(m.Imports) {
+		return m.Imports[index].Name
+	}
+	return m.Funcs[index-len(m.Imports)].Name
+}
+
+// MemoryExport is the name the linear memory is exported as, so that the host
+// can inspect the globals.
+const MemoryExport = "memory"
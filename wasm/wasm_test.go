@@ -0,0 +1,144 @@
+package wasm
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/golang-interpreter/intermediate"
+	"github.com/user/golang-interpreter/lexer"
+	"github.com/user/golang-interpreter/parser"
+)
+
+// programs are programs covering the control flow the stackifier
+// reconstructs, globals in linear memory, booleans and tail calls.
+var programs = []struct {
+	name   string
+	source string
+	want   string
+}{
+	{"arithmetic", `puts(1 + 2 * 3 - 4 / 2); puts(0 - 42);`, "5\n-42\n"},
+	{"branches", `
+let sign = fn(x) { if (x < 0) { 0 - 1 } else { if (x == 0) { 0 } else { 1 } } };
+puts(sign(0 - 5)); puts(sign(0)); puts(sign(5));
+`, "-1\n0\n1\n"},
+	{"recursion", `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+puts(fib(20));
+`, "6765\n"},
+	{"loops", `
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+puts(sum(1000000, 0));
+`, "500000500000\n"},
+	{"booleans", `
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+puts(even(100001)); puts(!odd(3));
+`, "false\nfalse\n"},
+	{"globals", `
+let base = 40;
+let add = fn(x) { base + x };
+puts(add(2));
+`, "42\n"},
+}
+
+// compile parses, lowers and optimizes a program at the level, and
+// translates it to WebAssembly.
+func compile(t *testing.T, source string, level int) *Module {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	module, err := intermediate.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate.Optimize(module, intermediate.Passes(intermediate.Options{Level: level, InlineThreshold: intermediate.DefaultInlineThreshold}))
+	m, err := Compile(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range programs {
+		for _, level := range []int{0, 2} {
+			if err := Validate(compile(t, tt.source, level).Encode()); err != nil {
+				t.Errorf("%s at -O%d: %s", tt.name, level, err)
+			}
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	valid := compile(t, programs[0].source, 1).Encode()
+
+	illTyped := compile(t, programs[0].source, 1)
+	body := illTyped.Funcs[0].Body
+	illTyped.Funcs[0].Body = append([]Instr{{Op: OpI32Const, Imm: 1}, {Op: OpI64Const, Imm: 1}, {Op: OpI64Add}, {Op: OpDrop}}, body...)
+
+	badCall := compile(t, programs[0].source, 1)
+	badCall.Funcs[0].Body = append([]Instr{{Op: OpCall, Imm: 99}}, badCall.Funcs[0].Body...)
+
+	tests := []struct {
+		name   string
+		module []byte
+	}{
+		{"empty", nil},
+		{"magic", append([]byte("\x00wat"), valid[4:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"ill-typed", illTyped.Encode()},
+		{"call index", badCall.Encode()},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.module); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+}
+
+// host is a WebAssembly host for Node.js providing the functions the module
+// imports, which runs the module given as its argument.
+const host = `
+const fs = require("fs");
+const env = {
+  puts_int: (v) => process.stdout.write(v + "\n"),
+  puts_bool: (v) => process.stdout.write((v ? "true" : "false") + "\n"),
+};
+WebAssembly.instantiate(fs.readFileSync(process.argv[2]), {env})
+  .then(({instance}) => instance.exports.main())
+  .catch((e) => { console.error(e.message); process.exit(1); });
+`
+
+// TestRun runs the modules with Node.js, when it is installed.
+func TestRun(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "host.js")
+	if err := ioutil.WriteFile(script, []byte(host), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range programs {
+		for _, level := range []int{0, 2} {
+			file := filepath.Join(dir, tt.name+".wasm")
+			if err := ioutil.WriteFile(file, compile(t, tt.source, level).Encode(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := exec.Command(node, script, file).CombinedOutput()
+			if err != nil {
+				t.Errorf("%s at -O%d: %s\n%s", tt.name, level, err, out)
+				continue
+			}
+			if string(out) != tt.want {
+				t.Errorf("%s at -O%d: got %q, want %q", tt.name, level, out, tt.want)
+			}
+		}
+	}
+}